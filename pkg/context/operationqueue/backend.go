@@ -0,0 +1,144 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operationqueue
+
+import (
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/trustbloc/fabric-peer-ext/pkg/collections/client"
+	"github.com/trustbloc/sidetree-core-go/pkg/api/batch"
+	"github.com/trustbloc/sidetree-core-go/pkg/batch/cutter"
+)
+
+const (
+	// LevelDBBackend persists operation queues in LevelDB databases on the peer's file system
+	LevelDBBackend = "leveldb"
+
+	// MemoryBackend holds operation queues in memory. All pending operations are lost when the peer
+	// is restarted, so this backend should only be used for tests and ephemeral (development) peers.
+	MemoryBackend = "memory"
+
+	// OffLedgerBackend holds pending operations in an off-ledger collection that's shared by the batch writers
+	// of the same org. If a batch writer fails then the pending operations are processed by the other batch writers.
+	OffLedgerBackend = "offledger"
+)
+
+var errArchiveNotSupported = errors.New("archive is not supported by the operation queue backend")
+
+// Queue is an operation queue that's created by a backend
+type Queue interface {
+	cutter.OperationQueue
+
+	Close()
+	Drop() error
+	Archive() (string, error)
+	SetLimits(limits Limits)
+	Sweep() error
+	DeadLetters() ([]*batch.OperationInfo, error)
+	Stats() *Stats
+	Lease(num uint, timeout time.Duration) (*Lease, error)
+	Commit(leaseID string) (uint, error)
+	Release(leaseID string) error
+}
+
+// Backend creates operation queues
+type Backend interface {
+	Open(channelID, namespace string) (Queue, error)
+}
+
+type offLedgerClientProvider interface {
+	ForChannel(channelID string) (client.OffLedger, error)
+}
+
+// newBackend returns the backend that's configured for the peer
+func newBackend(cfg peerConfig, offLedgerProvider offLedgerClientProvider) (Backend, error) {
+	switch cfg.OperationQueueBackend() {
+	case LevelDBBackend, "":
+		return &levelDBBackend{baseDir: cfg.LevelDBOpQueueBasePath()}, nil
+	case MemoryBackend:
+		return &memBackend{}, nil
+	case OffLedgerBackend:
+		return &offLedgerBackend{
+			peerID:     cfg.PeerID(),
+			collection: cfg.OperationQueueCollection(),
+			provider:   offLedgerProvider,
+		}, nil
+	default:
+		return nil, errors.Errorf("unsupported operation queue backend [%s]", cfg.OperationQueueBackend())
+	}
+}
+
+// levelDBBackend creates queues that are persisted in a LevelDB database under the base directory
+type levelDBBackend struct {
+	baseDir string
+}
+
+// Open opens (or creates) the LevelDB queue for the given channel and namespace
+func (b *levelDBBackend) Open(channelID, namespace string) (Queue, error) {
+	return newLevelDBQueue(channelID, namespace, b.baseDir)
+}
+
+// memBackend creates queues that are held in memory. The queues use LevelDB's in-memory storage
+// so that they behave exactly the same as the persistent queues (leases, limits, priorities, etc.)
+type memBackend struct {
+}
+
+// Open creates a new in-memory queue for the given channel and namespace
+func (b *memBackend) Open(channelID, namespace string) (Queue, error) {
+	return newMemQueue(channelID, namespace)
+}
+
+// offLedgerBackend creates queues that are backed by a pool of operations in a shared off-ledger collection
+type offLedgerBackend struct {
+	peerID     string
+	collection string
+	provider   offLedgerClientProvider
+}
+
+// Open joins the shared operation pool for the given channel and namespace
+func (b *offLedgerBackend) Open(channelID, namespace string) (Queue, error) {
+	c, err := b.provider.ForChannel(channelID)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "unable to get off-ledger client for channel [%s]", channelID)
+	}
+
+	return newOffLedgerQueue(channelID, namespace, b.peerID, b.collection, c)
+}
+
+func newLevelDBQueue(channelID, namespace, baseDir string) (*LevelDBQueue, error) {
+	dir := path.Join(baseDir, channelID, namespace)
+
+	db, err := openFile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return newQueue(channelID, namespace, dir, db)
+}
+
+func newMemQueue(channelID, namespace string) (*LevelDBQueue, error) {
+	db, err := openMem()
+	if err != nil {
+		return nil, err
+	}
+
+	return newQueue(channelID, namespace, "", db)
+}
+
+// openFile may be overridden by unit tests
+var openFile = func(dir string) (dbHandle, error) {
+	return leveldb.OpenFile(dir, nil)
+}
+
+// openMem may be overridden by unit tests
+var openMem = func() (dbHandle, error) {
+	return leveldb.Open(storage.NewMemStorage(), nil)
+}
@@ -0,0 +1,324 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operationqueue
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/sidetree-core-go/pkg/api/batch"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/context/operationqueue/mocks"
+	obmocks "github.com/trustbloc/sidetree-fabric/pkg/observer/mocks"
+)
+
+const conformanceChannel = "conformance"
+
+func TestNewBackend(t *testing.T) {
+	peerConfig := &mocks.PeerConfig{}
+	peerConfig.LevelDBOpQueueBasePathReturns(levelDBBasePath)
+	peerConfig.PeerIDReturns(peer1)
+	peerConfig.OperationQueueCollectionReturns(opQueueColl)
+
+	offLedgerProvider := &obmocks.OffLedgerClientProvider{}
+
+	t.Run("Default", func(t *testing.T) {
+		b, err := newBackend(peerConfig, offLedgerProvider)
+		require.NoError(t, err)
+		require.IsType(t, &levelDBBackend{}, b)
+	})
+
+	t.Run("LevelDB", func(t *testing.T) {
+		peerConfig.OperationQueueBackendReturns(LevelDBBackend)
+
+		b, err := newBackend(peerConfig, offLedgerProvider)
+		require.NoError(t, err)
+		require.IsType(t, &levelDBBackend{}, b)
+		require.Equal(t, levelDBBasePath, b.(*levelDBBackend).baseDir)
+	})
+
+	t.Run("Memory", func(t *testing.T) {
+		peerConfig.OperationQueueBackendReturns(MemoryBackend)
+
+		b, err := newBackend(peerConfig, offLedgerProvider)
+		require.NoError(t, err)
+		require.IsType(t, &memBackend{}, b)
+	})
+
+	t.Run("OffLedger", func(t *testing.T) {
+		peerConfig.OperationQueueBackendReturns(OffLedgerBackend)
+
+		b, err := newBackend(peerConfig, offLedgerProvider)
+		require.NoError(t, err)
+		require.IsType(t, &offLedgerBackend{}, b)
+		require.Equal(t, peer1, b.(*offLedgerBackend).peerID)
+		require.Equal(t, opQueueColl, b.(*offLedgerBackend).collection)
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		peerConfig.OperationQueueBackendReturns("redis")
+
+		b, err := newBackend(peerConfig, offLedgerProvider)
+		require.EqualError(t, err, "unsupported operation queue backend [redis]")
+		require.Nil(t, b)
+
+		require.Panics(t, func() { NewProvider(peerConfig, nil) })
+	})
+}
+
+func TestLevelDBBackend(t *testing.T) {
+	defer func() {
+		if err := os.RemoveAll(levelDBBasePath); err != nil {
+			t.Errorf("Error removing temp dir [%s]: %s", levelDBBasePath, err)
+		}
+	}()
+
+	testBackendConformance(t, &levelDBBackend{baseDir: levelDBBasePath})
+}
+
+func TestMemBackend(t *testing.T) {
+	testBackendConformance(t, &memBackend{})
+
+	t.Run("Drop and archive", func(t *testing.T) {
+		q, err := (&memBackend{}).Open(channel1, namespace1)
+		require.NoError(t, err)
+
+		_, err = q.Add(op1)
+		require.NoError(t, err)
+
+		q.Close()
+
+		_, err = q.Archive()
+		require.EqualError(t, err, errArchiveNotSupported.Error())
+		require.NoError(t, q.Drop())
+	})
+
+	t.Run("Open error", func(t *testing.T) {
+		restoreOpenMem := openMem
+		defer func() { openMem = restoreOpenMem }()
+
+		errExpected := errors.New("injected open error")
+		openMem = func() (dbHandle, error) { return nil, errExpected }
+
+		q, err := (&memBackend{}).Open(channel1, namespace1)
+		require.EqualError(t, err, errExpected.Error())
+		require.Nil(t, q)
+	})
+}
+
+func TestOffLedgerBackend(t *testing.T) {
+	restoreSettleTime := claimSettleTime
+	claimSettleTime = 0
+	defer func() { claimSettleTime = restoreSettleTime }()
+
+	offLedgerProvider := &obmocks.OffLedgerClientProvider{}
+	offLedgerProvider.ForChannelReturns(obmocks.NewMockOffLedgerClient(), nil)
+
+	testBackendConformance(t, &offLedgerBackend{peerID: peer1, collection: opQueueColl, provider: offLedgerProvider})
+
+	t.Run("Archive", func(t *testing.T) {
+		b := &offLedgerBackend{peerID: peer1, collection: opQueueColl, provider: offLedgerProvider}
+
+		q, err := b.Open(conformanceChannel, namespace1)
+		require.NoError(t, err)
+
+		_, err = q.Archive()
+		require.EqualError(t, err, errNotClosed.Error())
+
+		q.Close()
+
+		location, err := q.Archive()
+		require.NoError(t, err)
+		require.Equal(t, "offledger://conformance/document_cc/opqueue", location)
+	})
+
+	t.Run("Client error", func(t *testing.T) {
+		errExpected := errors.New("injected client error")
+
+		p := &obmocks.OffLedgerClientProvider{}
+		p.ForChannelReturns(nil, errExpected)
+
+		q, err := (&offLedgerBackend{peerID: peer1, collection: opQueueColl, provider: p}).Open(conformanceChannel, namespace1)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errExpected.Error())
+		require.Nil(t, q)
+	})
+}
+
+// testBackendConformance runs the tests that every operation queue backend must pass
+func testBackendConformance(t *testing.T, b Backend) {
+	open := func(t *testing.T, namespace string) Queue {
+		q, err := b.Open(conformanceChannel, namespace)
+		require.NoError(t, err)
+		require.NotNil(t, q)
+
+		return q
+	}
+
+	drop := func(t *testing.T, q Queue) {
+		q.Close()
+		require.NoError(t, q.Drop())
+	}
+
+	t.Run("FIFO", func(t *testing.T) {
+		q := open(t, "fifo")
+		defer drop(t, q)
+
+		require.Zero(t, q.Len())
+
+		for i, op := range []*batch.OperationInfo{op1, op2, op3} {
+			n, err := q.Add(op)
+			require.NoError(t, err)
+			require.Equal(t, uint(i+1), n)
+		}
+
+		ops, err := q.Peek(2)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1, op2}, ops)
+
+		ops, n, err := q.Remove(2)
+		require.NoError(t, err)
+		require.Equal(t, uint(1), n)
+		require.Equal(t, []*batch.OperationInfo{op1, op2}, ops)
+
+		ops, n, err = q.Remove(2)
+		require.NoError(t, err)
+		require.Zero(t, n)
+		require.Equal(t, []*batch.OperationInfo{op3}, ops)
+
+		ops, err = q.Peek(1)
+		require.NoError(t, err)
+		require.Empty(t, ops)
+	})
+
+	t.Run("Duplicates", func(t *testing.T) {
+		q := open(t, "duplicates")
+		defer drop(t, q)
+
+		_, err := q.Add(newOp(t, "suffix1", batch.OperationTypeUpdate))
+		require.NoError(t, err)
+
+		_, err = q.Add(newOp(t, "suffix1", batch.OperationTypeUpdate))
+		require.Equal(t, ErrDuplicateOperation, errors.Cause(err))
+
+		_, err = q.Add(newOp(t, "suffix1", batch.OperationTypeDelete))
+		require.Equal(t, ErrConflictingOperation, errors.Cause(err))
+
+		require.Equal(t, uint(1), q.Len())
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		q := open(t, "limits")
+		defer drop(t, q)
+
+		q.SetLimits(Limits{MaxLength: 2})
+
+		_, err := q.Add(op1)
+		require.NoError(t, err)
+		_, err = q.Add(op2)
+		require.NoError(t, err)
+
+		_, err = q.Add(op3)
+		require.Equal(t, ErrQueueFull, errors.Cause(err))
+
+		stats := q.Stats()
+		require.Equal(t, conformanceChannel, stats.ChannelID)
+		require.Equal(t, "limits", stats.Namespace)
+		require.Equal(t, uint(2), stats.Length)
+		require.NotZero(t, stats.Size)
+		require.Equal(t, uint(2), stats.Limits.MaxLength)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		q := open(t, "expiry")
+		defer drop(t, q)
+
+		q.SetLimits(Limits{MaxAge: 10 * time.Millisecond, DeadLetterExpired: true})
+
+		_, err := q.Add(op1)
+		require.NoError(t, err)
+
+		time.Sleep(20 * time.Millisecond)
+
+		require.NoError(t, q.Sweep())
+		require.Zero(t, q.Len())
+		require.Equal(t, uint64(1), q.Stats().Expired)
+
+		deadLetters, err := q.DeadLetters()
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, deadLetters)
+	})
+
+	t.Run("Priority", func(t *testing.T) {
+		q := open(t, "priority")
+		defer drop(t, q)
+
+		update := newOp(t, "suffix1", batch.OperationTypeUpdate)
+		recoverOp := newOp(t, "suffix2", batch.OperationTypeRecover)
+
+		_, err := q.Add(update)
+		require.NoError(t, err)
+		_, err = q.Add(recoverOp)
+		require.NoError(t, err)
+
+		ops, err := q.Peek(2)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{recoverOp, update}, ops)
+
+		ops, _, err = q.Remove(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{recoverOp}, ops)
+	})
+
+	t.Run("Lease", func(t *testing.T) {
+		q := open(t, "lease")
+		defer drop(t, q)
+
+		_, err := q.Add(op1)
+		require.NoError(t, err)
+		_, err = q.Add(op2)
+		require.NoError(t, err)
+
+		l1, err := q.Lease(1, time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, l1.Operations)
+
+		l2, err := q.Lease(1, time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op2}, l2.Operations)
+		require.Zero(t, q.Len())
+		require.Equal(t, uint(2), q.Stats().Leased)
+
+		require.NoError(t, q.Release(l1.ID))
+		require.Equal(t, ErrLeaseNotFound, q.Release(l1.ID))
+
+		n, err := q.Commit(l2.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint(1), n)
+
+		ops, err := q.Peek(2)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, ops)
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		q := open(t, "close")
+
+		require.EqualError(t, q.Drop(), errNotClosed.Error())
+
+		q.Close()
+		require.NotPanics(t, q.Close)
+
+		_, err := q.Add(op1)
+		require.EqualError(t, err, errClosed.Error())
+
+		require.NoError(t, q.Drop())
+	})
+}
@@ -0,0 +1,100 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operationqueue
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/trustbloc/sidetree-core-go/pkg/api/batch"
+)
+
+// Operations are persisted as a two byte header followed by the encoded record. The first byte
+// of the header is always recordMarker and the second byte is the version of the record format.
+// Legacy (gob-encoded) records never start with recordMarker since the first byte of a gob
+// stream is the (non-zero) length of the first message.
+const (
+	recordMarker = byte(0x00)
+
+	// recordVersion1 is a JSON-encoded operationRecord
+	recordVersion1 = byte(0x01)
+
+	currentRecordVersion = recordVersion1
+)
+
+// operationRecord is the persisted form of an operation. It is decoupled from batch.OperationInfo
+// so that changes to sidetree-core-go don't affect operations that are already queued.
+type operationRecord struct {
+	UniqueSuffix string    `json:"uniqueSuffix"`
+	Data         []byte    `json:"data"`
+	EnqueuedAt   time.Time `json:"enqueuedAt,omitempty"`
+}
+
+func marshal(op *batch.OperationInfo, enqueuedAt time.Time) ([]byte, error) {
+	b, err := json.Marshal(&operationRecord{
+		UniqueSuffix: op.UniqueSuffix,
+		Data:         op.Data,
+		EnqueuedAt:   enqueuedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{recordMarker, currentRecordVersion}, b...), nil
+}
+
+func unmarshal(b []byte, op *batch.OperationInfo) error {
+	r, err := decode(b)
+	if err != nil {
+		return err
+	}
+
+	op.UniqueSuffix = r.UniqueSuffix
+	op.Data = r.Data
+
+	return nil
+}
+
+// decode decodes the operation record. The enqueue time of legacy records is not known and is therefore zero.
+func decode(b []byte) (*operationRecord, error) {
+	if isLegacy(b) {
+		op := &batch.OperationInfo{}
+		if err := unmarshalLegacy(b, op); err != nil {
+			return nil, err
+		}
+
+		return &operationRecord{UniqueSuffix: op.UniqueSuffix, Data: op.Data}, nil
+	}
+
+	if len(b) < 2 {
+		return nil, errors.New("invalid operation record")
+	}
+
+	switch b[1] {
+	case recordVersion1:
+		r := &operationRecord{}
+		if err := json.Unmarshal(b[2:], r); err != nil {
+			return nil, err
+		}
+
+		return r, nil
+	default:
+		return nil, errors.Errorf("unsupported operation record version [%d]", b[1])
+	}
+}
+
+// isLegacy returns true if the given bytes were persisted in the legacy (gob) format
+func isLegacy(b []byte) bool {
+	return len(b) > 0 && b[0] != recordMarker
+}
+
+func unmarshalLegacy(b []byte, op *batch.OperationInfo) error {
+	return gob.NewDecoder(bytes.NewBuffer(b)).Decode(op)
+}
@@ -0,0 +1,76 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operationqueue
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/sidetree-core-go/pkg/api/batch"
+)
+
+func TestMarshal(t *testing.T) {
+	op := &batch.OperationInfo{UniqueSuffix: "op1", Data: []byte("op1 data")}
+
+	now := time.Now()
+
+	b, err := marshal(op, now)
+	require.NoError(t, err)
+	require.Equal(t, recordMarker, b[0])
+	require.Equal(t, currentRecordVersion, b[1])
+	require.False(t, isLegacy(b))
+
+	op2 := &batch.OperationInfo{}
+	require.NoError(t, unmarshal(b, op2))
+	require.Equal(t, op, op2)
+
+	r, err := decode(b)
+	require.NoError(t, err)
+	require.True(t, now.Equal(r.EnqueuedAt))
+}
+
+func TestUnmarshal(t *testing.T) {
+	op := &batch.OperationInfo{UniqueSuffix: "op1", Data: []byte("op1 data")}
+
+	t.Run("Legacy", func(t *testing.T) {
+		b := marshalLegacy(t, op)
+		require.True(t, isLegacy(b))
+
+		op2 := &batch.OperationInfo{}
+		require.NoError(t, unmarshal(b, op2))
+		require.Equal(t, op, op2)
+
+		r, err := decode(b)
+		require.NoError(t, err)
+		require.True(t, r.EnqueuedAt.IsZero())
+	})
+
+	t.Run("Invalid record", func(t *testing.T) {
+		err := unmarshal([]byte{recordMarker}, &batch.OperationInfo{})
+		require.EqualError(t, err, "invalid operation record")
+	})
+
+	t.Run("Unsupported version", func(t *testing.T) {
+		err := unmarshal([]byte{recordMarker, 0x7f, '{', '}'}, &batch.OperationInfo{})
+		require.EqualError(t, err, "unsupported operation record version [127]")
+	})
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		err := unmarshal([]byte{recordMarker, recordVersion1, '{'}, &batch.OperationInfo{})
+		require.Error(t, err)
+	})
+}
+
+func marshalLegacy(t *testing.T, op *batch.OperationInfo) []byte {
+	var buffer bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&buffer).Encode(op))
+
+	return buffer.Bytes()
+}
@@ -7,15 +7,18 @@ SPDX-License-Identifier: Apache-2.0
 package operationqueue
 
 import (
-	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/binary"
-	"encoding/gob"
+	"encoding/json"
+	"fmt"
 	"os"
-	"path"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
-	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
@@ -26,8 +29,105 @@ import (
 var (
 	errClosed    = errors.New("queue is closed")
 	errNotClosed = errors.New("queue must be closed before it can be dropped")
+
+	// ErrDuplicateOperation indicates that an identical operation is already pending in the queue
+	ErrDuplicateOperation = errors.New("duplicate operation")
+
+	// ErrConflictingOperation indicates that a different operation for the same unique suffix is already pending in the queue
+	ErrConflictingOperation = errors.New("an operation for the same unique suffix is already pending")
+
+	// ErrQueueFull indicates that the operation can't be added since the queue has reached its capacity
+	ErrQueueFull = errors.New("operation queue is full")
+
+	// ErrLeaseNotFound indicates that the lease doesn't exist, either because it was already
+	// committed/released or because it expired and the operations were returned to the queue.
+	ErrLeaseNotFound = errors.New("lease not found")
 )
 
+const (
+	// metaKeyPrefix is the first byte of all keys that don't hold operations. Operation keys are
+	// big-endian sequence numbers and therefore never start with this byte in practice.
+	metaKeyPrefix = byte(0xff)
+)
+
+var (
+	// opsRange is the range of keys that hold operations
+	opsRange = &util.Range{Limit: []byte{metaKeyPrefix}}
+
+	// leaseKeyPrefix is the prefix of keys that hold leases
+	leaseKeyPrefix = []byte{metaKeyPrefix, 'l', 'e', 'a', 's', 'e', ':'}
+
+	// deadLetterKeyPrefix is the prefix of keys that hold expired operations
+	deadLetterKeyPrefix = []byte{metaKeyPrefix, 'd', 'e', 'a', 'd', ':'}
+
+	leaseSeq uint64
+)
+
+// cutLeasePrefix is the prefix of the ID of the lease that holds the operations of the batch that is being written
+const cutLeasePrefix = "cut-"
+
+// Lease holds a set of operations that were leased from the queue. The operations remain in the queue
+// (but are not visible to other consumers) until the lease is either committed or released. If neither
+// happens before the lease expires then the operations are returned to the queue.
+type Lease struct {
+	ID         string
+	Operations []*batch.OperationInfo
+	Expiry     time.Time
+}
+
+// Limits holds the capacity limits of the queue. A value of 0 means that there is no limit.
+type Limits struct {
+	// MaxLength is the maximum number of operations in the queue (including leased operations)
+	MaxLength uint
+	// MaxSize is the maximum total size (in bytes) of the persisted operations
+	MaxSize uint64
+	// MaxAge is the maximum amount of time that an operation may remain in the queue. Expired
+	// operations are removed from the queue and are never returned by Peek, Remove or Lease.
+	MaxAge time.Duration
+	// DeadLetterExpired indicates that expired operations should be retained in a dead-letter
+	// area of the database rather than being discarded
+	DeadLetterExpired bool
+	// HighPriorityWeight is the maximum number of high-priority (recover and delete) operations that are
+	// selected before a normal-priority operation is selected. If 0 then a default value is used.
+	HighPriorityWeight uint
+}
+
+// Stats holds the current depth of the queue
+type Stats struct {
+	ChannelID string
+	Namespace string
+	// Length is the number of operations that are waiting to be processed
+	Length uint
+	// Leased is the number of operations that are currently leased
+	Leased uint
+	// Size is the total size (in bytes) of the persisted operations
+	Size uint64
+	// Expired is the number of operations that have expired since the queue was opened
+	Expired uint64
+	Limits  Limits
+}
+
+// queueEntry holds the unique suffix, size, enqueue time and priority of a persisted operation
+type queueEntry struct {
+	suffix     string
+	size       uint64
+	enqueuedAt time.Time
+	priority   priority
+}
+
+// pendingOperation is an entry in the unique suffix index
+type pendingOperation struct {
+	key  uint64
+	hash string
+}
+
+// leaseRecord is the persisted form of a lease
+type leaseRecord struct {
+	ID     string
+	Keys   []uint64
+	Expiry time.Time
+}
+
 type dbHandle interface {
 	Put(key, value []byte, wo *opt.WriteOptions) error
 	Delete(key []byte, wo *opt.WriteOptions) error
@@ -35,50 +135,189 @@ type dbHandle interface {
 	Close() error
 }
 
-// LevelDBQueue implements an operation queue that's backed by a LevelDB persistent store
+// LevelDBQueue implements an operation queue that's backed by a LevelDB store. The store is either persisted
+// in a directory or (if no directory is set) held in memory.
 type LevelDBQueue struct {
 	channelID string
 	namespace string
-	dir       string
+	dir       string // Empty if the store is held in memory
 	db        dbHandle
 	head      uint64
 	tail      uint64 // Non-inclusive
+	size      uint64
+	leases    map[string]*leaseRecord
+	leased    map[uint64]string
+	bytes     uint64
+	expired   uint64
+	limits    Limits
+	pending   map[string]*pendingOperation // Indexed by unique suffix
+	entries   map[uint64]*queueEntry       // Indexed by key
+	lanes     [numPriorities][]uint64      // Keys in FIFO order for each priority class
+	cutLease  *leaseRecord                 // The lease that holds the operations returned by the last Peek
 	mutex     sync.RWMutex
 	closed    bool
 }
 
-func newLevelDBQueue(channelID, namespace, baseDir string) (*LevelDBQueue, error) {
-	dir := path.Join(baseDir, channelID, namespace)
+func newQueue(channelID, namespace, dir string, db dbHandle) (*LevelDBQueue, error) {
+	q := &LevelDBQueue{
+		channelID: channelID,
+		namespace: namespace,
+		dir:       dir,
+		db:        db,
+		leases:    make(map[string]*leaseRecord),
+		leased:    make(map[uint64]string),
+		pending:   make(map[string]*pendingOperation),
+		entries:   make(map[uint64]*queueEntry),
+		mutex:     sync.RWMutex{},
+	}
 
-	db, err := openFile(dir)
-	if err != nil {
+	if err := q.migrate(); err != nil {
 		return nil, err
 	}
 
-	it := db.NewIterator(nil, nil)
+	if err := q.loadLeases(); err != nil {
+		return nil, err
+	}
 
-	var first uint64
-	var last uint64
+	if err := q.loadOperations(); err != nil {
+		return nil, err
+	}
 
-	if it.First() {
-		first = toUint64(it.Key())
+	if err := q.pruneLeases(); err != nil {
+		return nil, err
 	}
 
-	if it.Last() {
-		last = toUint64(it.Key()) + 1
+	logger.Infof("[%s-%s] Initialized LevelDB queue in dir [%s]. New [head:tail]: [%d:%d], Size: %d, Leases: %d", channelID, namespace, q.location(), q.head, q.tail, q.size, len(q.leases))
+
+	return q, nil
+}
+
+// migrate converts all operations that were persisted in a legacy format (or without an enqueue time) to the
+// current format. Since the enqueue time of these operations is unknown, the time of the migration is used.
+func (q *LevelDBQueue) migrate() error {
+	it := q.db.NewIterator(opsRange, nil)
+	defer it.Release()
+
+	now := time.Now()
+
+	migrated := 0
+	for it.Next() {
+		r, err := decode(it.Value())
+		if err != nil {
+			return errors.WithMessagef(err, "unable to migrate operation at key [%d]", toUint64(it.Key()))
+		}
+
+		if !isLegacy(it.Value()) && !r.EnqueuedAt.IsZero() {
+			continue
+		}
+
+		b, err := marshal(&batch.OperationInfo{UniqueSuffix: r.UniqueSuffix, Data: r.Data}, now)
+		if err != nil {
+			return errors.WithMessagef(err, "unable to migrate operation at key [%d]", toUint64(it.Key()))
+		}
+
+		if err := q.db.Put(it.Key(), b, nil); err != nil {
+			return errors.WithMessagef(err, "unable to migrate operation at key [%d]", toUint64(it.Key()))
+		}
+
+		migrated++
 	}
 
-	logger.Infof("[%s-%s] Initialized LevelDB queue in dir [%s]. New [head:tail]: [%d:%d]", channelID, namespace, dir, first, last)
+	if migrated > 0 {
+		logger.Infof("[%s-%s] Migrated %d operations to record format version %d", q.channelID, q.namespace, migrated, currentRecordVersion)
+	}
 
-	return &LevelDBQueue{
-		channelID: channelID,
-		namespace: namespace,
-		dir:       dir,
-		db:        db,
-		head:      first,
-		tail:      last,
-		mutex:     sync.RWMutex{},
-	}, nil
+	return nil
+}
+
+// loadLeases loads the persisted leases
+func (q *LevelDBQueue) loadLeases() error {
+	it := q.db.NewIterator(util.BytesPrefix(leaseKeyPrefix), nil)
+	defer it.Release()
+
+	for it.Next() {
+		l := &leaseRecord{}
+		if err := json.Unmarshal(it.Value(), l); err != nil {
+			return errors.WithMessagef(err, "unable to unmarshal lease for key [%s]", it.Key())
+		}
+
+		q.addLease(l)
+	}
+
+	return nil
+}
+
+// loadOperations determines the head, tail and size of the queue and builds the unique suffix index. Leased
+// keys that no longer exist (i.e. the peer stopped while a lease was being committed) are removed.
+func (q *LevelDBQueue) loadOperations() error {
+	it := q.db.NewIterator(opsRange, nil)
+	defer it.Release()
+
+	leased := make(map[uint64]string)
+
+	first := true
+	for it.Next() {
+		n := toUint64(it.Key())
+		if first {
+			q.head = n
+			first = false
+		}
+
+		q.tail = n + 1
+		q.size++
+
+		if id, ok := q.leased[n]; ok {
+			leased[n] = id
+		}
+
+		r, err := decode(it.Value())
+		if err != nil {
+			return errors.WithMessagef(err, "unable to unmarshal operation at key [%d]", n)
+		}
+
+		q.index(n, &batch.OperationInfo{UniqueSuffix: r.UniqueSuffix, Data: r.Data}, len(it.Value()), r.EnqueuedAt)
+	}
+
+	q.leased = leased
+
+	return nil
+}
+
+// pruneLeases removes leases that have expired (for example, because the peer was restarted while a
+// batch was being written) so that the operations are returned to the head of the queue. Leases that
+// no longer hold any operations are also removed, as are the leases of batches that were being cut when
+// the peer stopped, since the batch writer that would have committed them is no longer running.
+func (q *LevelDBQueue) pruneLeases() error {
+	for _, l := range q.leases {
+		if isCutLease(l.ID) {
+			logger.Infof("[%s-%s] Returning %d operations of an uncommitted batch to the queue", q.channelID, q.namespace, len(l.Keys))
+
+			if err := q.removeLease(l); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		var keys []uint64
+		for _, key := range l.Keys {
+			if _, ok := q.leased[key]; ok {
+				keys = append(keys, key)
+			}
+		}
+
+		l.Keys = keys
+
+		if len(keys) == 0 {
+			logger.Infof("[%s-%s] Removing lease [%s] since it no longer holds any operations", q.channelID, q.namespace, l.ID)
+
+			if err := q.removeLease(l); err != nil {
+				return err
+			}
+		}
+	}
+
+	return q.returnExpiredLeases(time.Now())
 }
 
 // Close closes the database
@@ -96,7 +335,7 @@ func (q *LevelDBQueue) Close() {
 	q.closed = true
 
 	if err := q.db.Close(); err != nil {
-		logger.Errorf("[%s-%s] Error closing LevelDB [%s]: %s", q.channelID, q.namespace, q.dir, err)
+		logger.Errorf("[%s-%s] Error closing LevelDB [%s]: %s", q.channelID, q.namespace, q.location(), err)
 	}
 }
 
@@ -109,11 +348,41 @@ func (q *LevelDBQueue) Drop() error {
 		return errNotClosed
 	}
 
+	if q.dir == "" {
+		// The in-memory store was released when the queue was closed
+		return nil
+	}
+
 	logger.Warnf("[%s-%s] Dropping DB [%s]", q.channelID, q.namespace, q.dir)
 
 	return os.RemoveAll(q.dir)
 }
 
+// Archive moves the database to an archive directory (in the same parent directory) and returns the path of
+// the archive. Note that the queue must be closed before this operation may be performed.
+func (q *LevelDBQueue) Archive() (string, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if !q.closed {
+		return "", errNotClosed
+	}
+
+	if q.dir == "" {
+		return "", errArchiveNotSupported
+	}
+
+	archiveDir := fmt.Sprintf("%s_archived_%s", q.dir, time.Now().UTC().Format("20060102T150405Z"))
+
+	logger.Warnf("[%s-%s] Archiving DB [%s] to [%s]", q.channelID, q.namespace, q.dir, archiveDir)
+
+	if err := os.Rename(q.dir, archiveDir); err != nil {
+		return "", errors.WithMessagef(err, "unable to archive DB [%s]", q.dir)
+	}
+
+	return archiveDir, nil
+}
+
 // Add adds the given operation to the tail of the queue
 func (q *LevelDBQueue) Add(op *batch.OperationInfo) (uint, error) {
 	q.mutex.Lock()
@@ -123,24 +392,40 @@ func (q *LevelDBQueue) Add(op *batch.OperationInfo) (uint, error) {
 		return 0, errClosed
 	}
 
-	b, err := marshal(op)
+	if err := q.checkPending(op); err != nil {
+		return q.len(), err
+	}
+
+	now := time.Now()
+
+	b, err := marshal(op, now)
 	if err != nil {
-		return uint(q.tail - q.head), err
+		return q.len(), err
+	}
+
+	if err := q.checkCapacity(len(b)); err != nil {
+		return q.len(), err
 	}
 
 	if err := q.db.Put(toBytes(q.tail), b, nil); err != nil {
-		return uint(q.tail - q.head), err
+		return q.len(), err
 	}
 
+	q.index(q.tail, op, len(b), now)
+
 	q.tail++
+	q.size++
 
 	logger.Debugf("[%s-%s] Added operation %s. New head:tail - [%d:%d]", q.channelID, q.namespace, op.UniqueSuffix, q.head, q.tail)
 
-	return uint(q.tail - q.head), nil
+	return q.len(), nil
 }
 
 // Remove removes the given number of operation from the head of the queue. The operation are returned
-// along with the new size of the queue and any error.
+// along with the new size of the queue and any error. Operations that are currently leased are skipped.
+// If Peek was called then the lease that holds the operations that were returned by the last call to Peek
+// (i.e. the operations that were batched) is committed and no other operations are removed, even if the
+// lease holds fewer than the given number of operations or if other operations were added in between.
 func (q *LevelDBQueue) Remove(num uint) ([]*batch.OperationInfo, uint, error) {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
@@ -149,84 +434,481 @@ func (q *LevelDBQueue) Remove(num uint) ([]*batch.OperationInfo, uint, error) {
 		return nil, 0, errClosed
 	}
 
-	size := q.tail - q.head
+	if err := q.expire(time.Now()); err != nil {
+		return nil, 0, err
+	}
+
+	if q.cutLease != nil {
+		return q.commitCut(num)
+	}
 
-	if size == 0 {
-		return nil, 0, nil
+	keys, ops, err := q.available(num)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	to := q.head + min(uint64(num), size)
+	if len(ops) == 0 {
+		return nil, q.len(), nil
+	}
 
-	logger.Debugf("[%s-%s] Removing operations in range [%d:%d]", q.channelID, q.namespace, q.head, to-1)
+	logger.Debugf("[%s-%s] Removing %d operations", q.channelID, q.namespace, len(ops))
 
-	it := q.db.NewIterator(
-		&util.Range{
-			Start: toBytes(q.head), // Inclusive
-			Limit: toBytes(to),     // Exclusive
-		}, nil)
+	if err := q.delete(keys); err != nil {
+		return nil, 0, err
+	}
+
+	logger.Debugf("[%s-%s] New head:tail - [%d:%d]", q.channelID, q.namespace, q.head, q.tail)
+
+	return ops, q.len(), nil
+}
+
+// Peek returns the given number of operation at the head of the queue without removing them.
+// Operations that are currently leased are skipped. High-priority operations (recover and delete)
+// are returned ahead of normal-priority operations, subject to the high-priority weight.
+//
+// The returned operations are leased (and the lease is persisted) until the batch is committed by
+// a call to Remove. If Peek is called again before then (i.e. the batch wasn't written), the lease is
+// released so that the operations are returned to the queue and may be peeked again. The lease doesn't
+// expire while the queue is open but it is released when the queue is reopened. Nothing is persisted if
+// there are no operations to return.
+func (q *LevelDBQueue) Peek(num uint) ([]*batch.OperationInfo, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return nil, errClosed
+	}
+
+	if err := q.releaseCut(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	if err := q.expire(now); err != nil {
+		return nil, err
+	}
+
+	keys, ops, err := q.available(num)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		// There's nothing to lease. An empty cut is recorded (but not persisted) so that a subsequent Remove
+		// doesn't remove operations that weren't batched.
+		q.cutLease = &leaseRecord{}
+
+		return ops, nil
+	}
+
+	l, err := q.lease(cutLeasePrefix+newLeaseID(now), keys, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	q.cutLease = l
+
+	return ops, nil
+}
+
+// Len returns the number of operation in the queue, excluding operations that are currently leased (other than
+// the operations that were returned by the last call to Peek, which are returned again if the batch isn't committed)
+func (q *LevelDBQueue) Len() uint {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		logger.Warnf("[%s-%s] Invocation on a closed queue", q.channelID, q.namespace)
+		return 0
+	}
+
+	if err := q.expire(time.Now()); err != nil {
+		logger.Warnf("[%s-%s] Error expiring leases and operations: %s", q.channelID, q.namespace, err)
+	}
+
+	return q.len()
+}
+
+// SetLimits sets the capacity limits of the queue. Operations that are already in the queue are
+// not affected, although new operations are rejected until the queue is within the new limits.
+func (q *LevelDBQueue) SetLimits(limits Limits) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	logger.Debugf("[%s-%s] Setting queue limits - Max length: %d, Max size: %d, Max age: %s, Dead-letter expired: %t",
+		q.channelID, q.namespace, limits.MaxLength, limits.MaxSize, limits.MaxAge, limits.DeadLetterExpired)
+
+	q.limits = limits
+
+	if q.closed {
+		return
+	}
+
+	if err := q.expireOperations(time.Now()); err != nil {
+		logger.Warnf("[%s-%s] Error expiring operations: %s", q.channelID, q.namespace, err)
+	}
+}
+
+// Sweep removes expired leases and operations from the queue
+func (q *LevelDBQueue) Sweep() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return errClosed
+	}
+
+	return q.expire(time.Now())
+}
+
+// DeadLetters returns the operations that expired while in the queue and were moved to the dead-letter area
+func (q *LevelDBQueue) DeadLetters() ([]*batch.OperationInfo, error) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	if q.closed {
+		return nil, errClosed
+	}
+
+	it := q.db.NewIterator(util.BytesPrefix(deadLetterKeyPrefix), nil)
+	defer it.Release()
 
 	var ops []*batch.OperationInfo
-	var keys [][]byte
 	for it.Next() {
 		op := &batch.OperationInfo{}
 		if err := unmarshal(it.Value(), op); err != nil {
-			return nil, 0, err
+			return nil, err
 		}
 
-		logger.Debugf("[%s-%s] Removing operation %s", q.channelID, q.namespace, op.UniqueSuffix)
-
 		ops = append(ops, op)
-		keys = append(keys, it.Key())
 	}
 
-	// Delete the items
-	for i, key := range keys {
-		if err := q.db.Delete(key, nil); err != nil {
-			logger.Warnf("[%s-%s] Unable to delete the key for item %s", q.channelID, q.namespace, ops[i].UniqueSuffix)
-			return nil, 0, errors.WithMessagef(err, "unable to delete the key for item %s", ops[i].UniqueSuffix)
-		}
+	return ops, nil
+}
+
+// Stats returns the current depth of the queue
+func (q *LevelDBQueue) Stats() *Stats {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	return &Stats{
+		ChannelID: q.channelID,
+		Namespace: q.namespace,
+		Length:    q.len(),
+		Leased:    uint(len(q.leased)),
+		Size:      q.bytes,
+		Expired:   q.expired,
+		Limits:    q.limits,
 	}
+}
 
-	q.head = to
+// Lease leases (up to) the given number of operations from the head of the queue. The leased operations
+// are not returned by subsequent calls to Peek, Remove or Lease. The lease must be committed (which removes
+// the operations from the queue) or released (which returns the operations to the queue) before the given
+// timeout, otherwise the operations are automatically returned to the queue. Leases are persisted, so
+// operations that were leased when the peer stopped are not lost. Nil is returned if no operations are available.
+func (q *LevelDBQueue) Lease(num uint, timeout time.Duration) (*Lease, error) {
+	if timeout <= 0 {
+		return nil, errors.New("lease timeout must be greater than 0")
+	}
 
-	logger.Debugf("[%s-%s] New head:tail - [%d:%d]", q.channelID, q.namespace, q.head, q.tail)
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return nil, errClosed
+	}
+
+	now := time.Now()
+
+	if err := q.expire(now); err != nil {
+		return nil, err
+	}
+
+	keys, ops, err := q.available(num)
+	if err != nil {
+		return nil, err
+	}
 
-	return ops, uint(q.tail - q.head), nil
+	if len(ops) == 0 {
+		return nil, nil
+	}
+
+	l, err := q.lease(newLeaseID(now), keys, now.Add(timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("[%s-%s] Leased %d operations - Lease ID [%s], Expiry: %s", q.channelID, q.namespace, len(ops), l.ID, l.Expiry)
+
+	return &Lease{
+		ID:         l.ID,
+		Operations: ops,
+		Expiry:     l.Expiry,
+	}, nil
 }
 
-// Peek returns the given number of operation at the head of the queue without removing them.
-func (q *LevelDBQueue) Peek(num uint) ([]*batch.OperationInfo, error) {
+// Commit removes the operations held by the given lease from the queue and returns the new length of the queue.
+// ErrLeaseNotFound is returned if the lease has expired, in which case the operations were returned to the queue.
+func (q *LevelDBQueue) Commit(leaseID string) (uint, error) {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
 	if q.closed {
-		return nil, errClosed
+		return 0, errClosed
+	}
+
+	if err := q.returnExpiredLeases(time.Now()); err != nil {
+		return 0, err
+	}
+
+	l, ok := q.leases[leaseID]
+	if !ok {
+		return q.len(), ErrLeaseNotFound
+	}
+
+	logger.Debugf("[%s-%s] Committing lease [%s] with %d operations", q.channelID, q.namespace, leaseID, len(l.Keys))
+
+	if err := q.commit(l, l.Keys); err != nil {
+		return 0, err
+	}
+
+	return q.len(), nil
+}
+
+// Release returns the operations held by the given lease to the queue
+func (q *LevelDBQueue) Release(leaseID string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return errClosed
+	}
+
+	l, ok := q.leases[leaseID]
+	if !ok {
+		return ErrLeaseNotFound
+	}
+
+	logger.Debugf("[%s-%s] Releasing lease [%s] with %d operations", q.channelID, q.namespace, leaseID, len(l.Keys))
+
+	return q.removeLease(l)
+}
+
+// available returns (up to) the given number of operations that are not currently leased
+func (q *LevelDBQueue) available(num uint) ([]uint64, []*batch.OperationInfo, error) {
+	if num == 0 || q.len() == 0 {
+		return nil, nil, nil
+	}
+
+	keys := q.selectKeys(num, nil)
+
+	ops, err := q.load(keys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return keys, ops, nil
+}
+
+// lease persists a lease for the given keys
+func (q *LevelDBQueue) lease(id string, keys []uint64, expiry time.Time) (*leaseRecord, error) {
+	l := &leaseRecord{
+		ID:     id,
+		Keys:   keys,
+		Expiry: expiry,
+	}
+
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, errors.WithMessage(err, "unable to marshal lease")
+	}
+
+	if err := q.db.Put(leaseKey(l.ID), b, nil); err != nil {
+		return nil, errors.WithMessagef(err, "unable to persist lease [%s]", l.ID)
 	}
 
-	size := q.tail - q.head
+	q.addLease(l)
 
-	if size == 0 {
+	return l, nil
+}
+
+// commit deletes the operations with the given keys and then removes the lease. Any other operations held
+// by the lease are returned to the queue. If the peer stops in between then the lease will be pruned on
+// restart and any remaining operations will be returned to the queue.
+func (q *LevelDBQueue) commit(l *leaseRecord, keys []uint64) error {
+	if err := q.delete(keys); err != nil {
+		return err
+	}
+
+	return q.removeLease(l)
+}
+
+// commitCut commits (up to) the given number of operations that are held by the lease of the last Peek
+// and returns the committed operations along with the new length of the queue
+func (q *LevelDBQueue) commitCut(num uint) ([]*batch.OperationInfo, uint, error) {
+	l := q.cutLease
+
+	if len(l.Keys) == 0 {
+		// The last Peek returned no operations so there's nothing to commit
+		q.cutLease = nil
+
+		return nil, q.len(), nil
+	}
+
+	keys := l.Keys
+	if uint(len(keys)) > num {
+		keys = keys[:num]
+	}
+
+	ops, err := q.load(keys)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	logger.Debugf("[%s-%s] Removing %d operations", q.channelID, q.namespace, len(ops))
+
+	if err := q.commit(l, keys); err != nil {
+		return nil, 0, err
+	}
+
+	q.cutLease = nil
+
+	logger.Debugf("[%s-%s] New head:tail - [%d:%d]", q.channelID, q.namespace, q.head, q.tail)
+
+	return ops, q.len(), nil
+}
+
+// releaseCut returns the operations held by the lease of the last Peek (if any) to the queue
+func (q *LevelDBQueue) releaseCut() error {
+	if q.cutLease == nil {
+		return nil
+	}
+
+	if len(q.cutLease.Keys) == 0 {
+		// An empty cut isn't persisted
+		q.cutLease = nil
+
+		return nil
+	}
+
+	logger.Infof("[%s-%s] Returning %d operations of an uncommitted batch to the queue", q.channelID, q.namespace, len(q.cutLease.Keys))
+
+	if err := q.removeLease(q.cutLease); err != nil {
+		return err
+	}
+
+	q.cutLease = nil
+
+	return nil
+}
+
+// selectKeys selects (up to) the given number of keys of available operations, excluding the given keys.
+// Operations are selected in FIFO order within each priority class.
+func (q *LevelDBQueue) selectKeys(num uint, exclude map[uint64]struct{}) []uint64 {
+	weight := q.limits.HighPriorityWeight
+	if weight == 0 {
+		weight = defaultHighPriorityWeight
+	}
+
+	return interleave(
+		q.nextKeys(highPriority, num, exclude),
+		q.nextKeys(normalPriority, num, exclude),
+		num, weight,
+	)
+}
+
+// nextKeys returns (up to) the given number of keys of available operations in the given priority class
+func (q *LevelDBQueue) nextKeys(p priority, num uint, exclude map[uint64]struct{}) []uint64 {
+	lane := q.lanes[p]
+
+	// Trim the keys of deleted operations from the front of the lane
+	i := 0
+	for i < len(lane) {
+		if _, ok := q.entries[lane[i]]; ok {
+			break
+		}
+		i++
+	}
+
+	lane = lane[i:]
+	q.lanes[p] = lane
+
+	var keys []uint64
+	for _, key := range lane {
+		if uint(len(keys)) == num {
+			break
+		}
+
+		if _, ok := exclude[key]; ok || !q.isAvailable(key) {
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// isAvailable returns true if the operation with the given key exists and is not leased
+func (q *LevelDBQueue) isAvailable(key uint64) bool {
+	if _, ok := q.entries[key]; !ok {
+		return false
+	}
+
+	_, leased := q.leased[key]
+
+	return !leased
+}
+
+// load loads the operations with the given keys from the DB. The operations are returned in the order of the given keys.
+func (q *LevelDBQueue) load(keys []uint64) ([]*batch.OperationInfo, error) {
+	if len(keys) == 0 {
 		return nil, nil
 	}
 
-	to := q.head + min(uint64(num), size)
+	first, last := keys[0], keys[0]
+	selected := make(map[uint64]*batch.OperationInfo)
+	for _, key := range keys {
+		selected[key] = nil
+
+		if key < first {
+			first = key
+		}
 
-	logger.Debugf("[%s-%s] Returning operations in range [%d:%d]", q.channelID, q.namespace, q.head, to-1)
+		if key > last {
+			last = key
+		}
+	}
 
 	it := q.db.NewIterator(
 		&util.Range{
-			Start: toBytes(q.head), // Inclusive
-			Limit: toBytes(to),     // Exclusive
+			Start: toBytes(first),    // Inclusive
+			Limit: toBytes(last + 1), // Exclusive
 		}, nil)
+	defer it.Release()
 
-	var ops []*batch.OperationInfo
 	for it.Next() {
+		key := toUint64(it.Key())
+		if _, ok := selected[key]; !ok {
+			continue
+		}
+
 		op := &batch.OperationInfo{}
 		if err := unmarshal(it.Value(), op); err != nil {
 			return nil, err
 		}
 
-		logger.Debugf("[%s-%s] Returning operation [%s]", q.channelID, q.namespace, op.UniqueSuffix)
+		selected[key] = op
+	}
+
+	ops := make([]*batch.OperationInfo, 0, len(keys))
+	for _, key := range keys {
+		op := selected[key]
+		if op == nil {
+			return nil, errors.Errorf("operation for key [%d] not found", key)
+		}
 
 		ops = append(ops, op)
 	}
@@ -234,50 +916,268 @@ func (q *LevelDBQueue) Peek(num uint) ([]*batch.OperationInfo, error) {
 	return ops, nil
 }
 
-// Len returns the number of operation in the queue
-func (q *LevelDBQueue) Len() uint {
-	q.mutex.RLock()
-	defer q.mutex.RUnlock()
+// delete deletes the operations with the given keys from the DB
+func (q *LevelDBQueue) delete(keys []uint64) error {
+	for _, key := range keys {
+		if err := q.db.Delete(toBytes(key), nil); err != nil {
+			logger.Warnf("[%s-%s] Unable to delete the key for item %s", q.channelID, q.namespace, q.suffixOf(key))
 
-	if q.closed {
-		logger.Warnf("[%s-%s] Invocation on a closed queue", q.channelID, q.namespace)
-		return 0
+			return errors.WithMessagef(err, "unable to delete the key for item %s", q.suffixOf(key))
+		}
+
+		q.unindex(key)
+		q.size--
 	}
 
-	return uint(q.tail - q.head)
+	q.head = q.firstKey()
+
+	return nil
 }
 
-func toUint64(b []byte) uint64 {
-	return binary.BigEndian.Uint64(b)
+// firstKey returns the key of the first operation in the queue (or the tail if the queue is empty)
+func (q *LevelDBQueue) firstKey() uint64 {
+	it := q.db.NewIterator(
+		&util.Range{
+			Start: toBytes(q.head),
+			Limit: toBytes(q.tail),
+		}, nil)
+	defer it.Release()
+
+	if it.Next() {
+		return toUint64(it.Key())
+	}
+
+	return q.tail
 }
 
-func toBytes(n uint64) []byte {
-	key := make([]byte, 8)
-	binary.BigEndian.PutUint64(key, n)
-	return key
+// checkPending returns an error if an operation for the same unique suffix is already pending in the queue.
+// Per the Sidetree protocol, a batch may contain only one operation per unique suffix.
+func (q *LevelDBQueue) checkPending(op *batch.OperationInfo) error {
+	p, ok := q.pending[op.UniqueSuffix]
+	if !ok {
+		return nil
+	}
+
+	if p.hash == hashOf(op) {
+		logger.Debugf("[%s-%s] Rejecting duplicate operation for unique suffix [%s]", q.channelID, q.namespace, op.UniqueSuffix)
+
+		return errors.WithMessagef(ErrDuplicateOperation, "unique suffix [%s]", op.UniqueSuffix)
+	}
+
+	logger.Debugf("[%s-%s] Rejecting operation for unique suffix [%s] since a different operation is already pending", q.channelID, q.namespace, op.UniqueSuffix)
+
+	return errors.WithMessagef(ErrConflictingOperation, "unique suffix [%s]", op.UniqueSuffix)
 }
 
-func min(i, j uint64) uint64 {
-	if i < j {
-		return i
+// checkCapacity returns ErrQueueFull if adding an operation of the given size would exceed the limits of the queue
+func (q *LevelDBQueue) checkCapacity(size int) error {
+	if q.limits.MaxLength > 0 && q.size >= uint64(q.limits.MaxLength) {
+		logger.Warnf("[%s-%s] Rejecting operation since the queue has reached its maximum length of %d", q.channelID, q.namespace, q.limits.MaxLength)
+
+		return errors.WithMessagef(ErrQueueFull, "maximum length of %d reached", q.limits.MaxLength)
+	}
+
+	if q.limits.MaxSize > 0 && q.bytes+uint64(size) > q.limits.MaxSize {
+		logger.Warnf("[%s-%s] Rejecting operation since the queue has reached its maximum size of %d bytes", q.channelID, q.namespace, q.limits.MaxSize)
+
+		return errors.WithMessagef(ErrQueueFull, "maximum size of %d bytes reached", q.limits.MaxSize)
 	}
-	return j
+
+	return nil
 }
 
-func marshal(op *batch.OperationInfo) ([]byte, error) {
-	var buffer bytes.Buffer
-	if err := gob.NewEncoder(&buffer).Encode(op); err != nil {
-		return nil, err
+func (q *LevelDBQueue) index(key uint64, op *batch.OperationInfo, size int, enqueuedAt time.Time) {
+	q.pending[op.UniqueSuffix] = &pendingOperation{
+		key:  key,
+		hash: hashOf(op),
+	}
+
+	p := priorityOf(op)
+
+	q.entries[key] = &queueEntry{
+		suffix:     op.UniqueSuffix,
+		size:       uint64(size),
+		enqueuedAt: enqueuedAt,
+		priority:   p,
 	}
 
-	return buffer.Bytes(), nil
+	q.lanes[p] = append(q.lanes[p], key)
+
+	q.bytes += uint64(size)
 }
 
-func unmarshal(b []byte, op *batch.OperationInfo) error {
-	return gob.NewDecoder(bytes.NewBuffer(b)).Decode(op)
+func (q *LevelDBQueue) unindex(key uint64) {
+	e, ok := q.entries[key]
+	if !ok {
+		return
+	}
+
+	delete(q.entries, key)
+
+	q.bytes -= e.size
+
+	if p, ok := q.pending[e.suffix]; ok && p.key == key {
+		delete(q.pending, e.suffix)
+	}
 }
 
-// openFile may be overridden by unit tests
-var openFile = func(dir string) (dbHandle, error) {
-	return leveldb.OpenFile(dir, nil)
+func (q *LevelDBQueue) suffixOf(key uint64) string {
+	if e, ok := q.entries[key]; ok {
+		return e.suffix
+	}
+
+	return ""
+}
+
+func (q *LevelDBQueue) addLease(l *leaseRecord) {
+	q.leases[l.ID] = l
+
+	for _, key := range l.Keys {
+		q.leased[key] = l.ID
+	}
+}
+
+func (q *LevelDBQueue) removeLease(l *leaseRecord) error {
+	if err := q.db.Delete(leaseKey(l.ID), nil); err != nil {
+		return errors.WithMessagef(err, "unable to delete lease [%s]", l.ID)
+	}
+
+	delete(q.leases, l.ID)
+
+	for _, key := range l.Keys {
+		delete(q.leased, key)
+	}
+
+	return nil
+}
+
+// expire returns the operations held by expired leases to the queue and then removes expired operations
+func (q *LevelDBQueue) expire(now time.Time) error {
+	if err := q.returnExpiredLeases(now); err != nil {
+		return err
+	}
+
+	return q.expireOperations(now)
+}
+
+// expireOperations removes (or moves to the dead-letter area) operations that have been in the queue for longer
+// than the maximum age. Operations are in the order in which they were enqueued so the scan stops at the first
+// operation that hasn't expired. Leased operations (including peeked operations) are not expired since they are in the
+// process of being written.
+func (q *LevelDBQueue) expireOperations(now time.Time) error {
+	if q.limits.MaxAge == 0 || q.size == 0 {
+		return nil
+	}
+
+	it := q.db.NewIterator(
+		&util.Range{
+			Start: toBytes(q.head),
+			Limit: toBytes(q.tail),
+		}, nil)
+	defer it.Release()
+
+	expired := 0
+	for it.Next() {
+		key := toUint64(it.Key())
+		if _, ok := q.leased[key]; ok {
+			continue
+		}
+
+		e, ok := q.entries[key]
+		if !ok || now.Sub(e.enqueuedAt) < q.limits.MaxAge {
+			break
+		}
+
+		logger.Warnf("[%s-%s] Operation for unique suffix [%s] expired after being in the queue since %s", q.channelID, q.namespace, e.suffix, e.enqueuedAt)
+
+		if q.limits.DeadLetterExpired {
+			if err := q.db.Put(deadLetterKey(key), it.Value(), nil); err != nil {
+				return errors.WithMessagef(err, "unable to dead-letter operation for unique suffix [%s]", e.suffix)
+			}
+		}
+
+		if err := q.db.Delete(toBytes(key), nil); err != nil {
+			return errors.WithMessagef(err, "unable to delete expired operation for unique suffix [%s]", e.suffix)
+		}
+
+		q.unindex(key)
+		q.size--
+		q.expired++
+		expired++
+	}
+
+	if expired > 0 {
+		q.head = q.firstKey()
+
+		logger.Warnf("[%s-%s] %d operation(s) expired. Dead-lettered: %t, New head:tail - [%d:%d]", q.channelID, q.namespace, expired, q.limits.DeadLetterExpired, q.head, q.tail)
+	}
+
+	return nil
+}
+
+func (q *LevelDBQueue) returnExpiredLeases(now time.Time) error {
+	for _, l := range q.leases {
+		if l == q.cutLease || now.Before(l.Expiry) {
+			continue
+		}
+
+		logger.Warnf("[%s-%s] Lease [%s] expired at %s. Returning %d operations to the queue.", q.channelID, q.namespace, l.ID, l.Expiry, len(l.Keys))
+
+		if err := q.removeLease(l); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// len returns the number of operations that are not leased. The operations held by the lease of the last
+// Peek are included since they will be peeked again unless the batch is committed.
+func (q *LevelDBQueue) len() uint {
+	n := uint(q.size) - uint(len(q.leased))
+	if q.cutLease != nil {
+		n += uint(len(q.cutLease.Keys))
+	}
+
+	return n
+}
+
+func (q *LevelDBQueue) location() string {
+	if q.dir == "" {
+		return "<memory>"
+	}
+
+	return q.dir
+}
+
+func hashOf(op *batch.OperationInfo) string {
+	h := sha256.Sum256(op.Data)
+
+	return base64.URLEncoding.EncodeToString(h[:])
+}
+
+func deadLetterKey(key uint64) []byte {
+	return append(append([]byte{}, deadLetterKeyPrefix...), toBytes(key)...)
+}
+
+func isCutLease(id string) bool {
+	return strings.HasPrefix(id, cutLeasePrefix)
+}
+
+func leaseKey(id string) []byte {
+	return append(append([]byte{}, leaseKeyPrefix...), []byte(id)...)
+}
+
+func newLeaseID(now time.Time) string {
+	return fmt.Sprintf("%d-%d", now.UnixNano(), atomic.AddUint64(&leaseSeq, 1))
+}
+
+func toUint64(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
+
+func toBytes(n uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, n)
+	return key
 }
@@ -7,11 +7,19 @@ SPDX-License-Identifier: Apache-2.0
 package operationqueue
 
 import (
-	"errors"
+	"bytes"
+	"encoding/json"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 	"github.com/trustbloc/sidetree-core-go/pkg/api/batch"
+	"github.com/trustbloc/sidetree-core-go/pkg/batch/cutter"
+	coremocks "github.com/trustbloc/sidetree-core-go/pkg/mocks"
 	"github.com/trustbloc/sidetree-fabric/pkg/context/operationqueue/mocks"
 )
 
@@ -119,6 +127,385 @@ func TestLevelDBQueue_Reload(t *testing.T) {
 	require.Equal(t, op3, op[1])
 }
 
+func TestLevelDBQueue_Duplicates(t *testing.T) {
+	q, cleanup, err := newTestQueue(channel2)
+	require.NoError(t, err)
+
+	defer cleanup()
+
+	op1v1 := &batch.OperationInfo{UniqueSuffix: "op1", Data: []byte("v1")}
+	op1v2 := &batch.OperationInfo{UniqueSuffix: "op1", Data: []byte("v2")}
+
+	_, err = q.Add(op1v1)
+	require.NoError(t, err)
+
+	_, err = q.Add(op2)
+	require.NoError(t, err)
+
+	n, err := q.Add(op1v1)
+	require.Error(t, err)
+	require.Equal(t, ErrDuplicateOperation, errors.Cause(err))
+	require.Equal(t, uint(2), n)
+
+	_, err = q.Add(op1v2)
+	require.Error(t, err)
+	require.Equal(t, ErrConflictingOperation, errors.Cause(err))
+
+	t.Run("Reload", func(t *testing.T) {
+		q.Close()
+
+		q, err = newLevelDBQueue(channel2, namespace1, levelDBBasePath)
+		require.NoError(t, err)
+
+		_, err = q.Add(op1v1)
+		require.Equal(t, ErrDuplicateOperation, errors.Cause(err))
+
+		_, err = q.Add(op1v2)
+		require.Equal(t, ErrConflictingOperation, errors.Cause(err))
+	})
+
+	t.Run("Leased", func(t *testing.T) {
+		l, err := q.Lease(1, time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1v1}, l.Operations)
+
+		_, err = q.Add(op1v2)
+		require.Equal(t, ErrConflictingOperation, errors.Cause(err))
+
+		_, err = q.Commit(l.ID)
+		require.NoError(t, err)
+
+		n, err := q.Add(op1v2)
+		require.NoError(t, err)
+		require.Equal(t, uint(2), n)
+	})
+
+	t.Run("Removed", func(t *testing.T) {
+		ops, _, err := q.Remove(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op2}, ops)
+
+		_, err = q.Add(op2)
+		require.NoError(t, err)
+
+		ops, err = q.Peek(2)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1v2, op2}, ops)
+	})
+
+	// Close the reloaded queue
+	q.Close()
+}
+
+func TestLevelDBQueue_Limits(t *testing.T) {
+	q, cleanup, err := newTestQueue(channel1)
+	require.NoError(t, err)
+
+	defer cleanup()
+
+	t.Run("Max length", func(t *testing.T) {
+		q.SetLimits(Limits{MaxLength: 2})
+
+		_, err = q.Add(op1)
+		require.NoError(t, err)
+		_, err = q.Add(op2)
+		require.NoError(t, err)
+
+		n, err := q.Add(op3)
+		require.Error(t, err)
+		require.Equal(t, ErrQueueFull, errors.Cause(err))
+		require.Equal(t, uint(2), n)
+
+		// Leased operations count towards the length
+		l, err := q.Lease(1, time.Minute)
+		require.NoError(t, err)
+
+		_, err = q.Add(op3)
+		require.Equal(t, ErrQueueFull, errors.Cause(err))
+
+		stats := q.Stats()
+		require.Equal(t, channel1, stats.ChannelID)
+		require.Equal(t, namespace1, stats.Namespace)
+		require.Equal(t, uint(1), stats.Length)
+		require.Equal(t, uint(1), stats.Leased)
+		require.Equal(t, uint(2), stats.Limits.MaxLength)
+
+		_, err = q.Commit(l.ID)
+		require.NoError(t, err)
+
+		_, err = q.Add(op3)
+		require.NoError(t, err)
+
+		_, _, err = q.Remove(2)
+		require.NoError(t, err)
+		require.Zero(t, q.Stats().Size)
+	})
+
+	t.Run("Max size", func(t *testing.T) {
+		q.SetLimits(Limits{})
+
+		_, err = q.Add(op1)
+		require.NoError(t, err)
+
+		size := q.Stats().Size
+		require.NotZero(t, size)
+
+		q.SetLimits(Limits{MaxSize: size + 1})
+
+		_, err = q.Add(op2)
+		require.Error(t, err)
+		require.Equal(t, ErrQueueFull, errors.Cause(err))
+
+		q.SetLimits(Limits{})
+
+		_, err = q.Add(op2)
+		require.NoError(t, err)
+	})
+}
+
+func TestLevelDBQueue_Expiry(t *testing.T) {
+	t.Run("Drop", func(t *testing.T) {
+		q, cleanup, err := newTestQueue(channel1)
+		require.NoError(t, err)
+
+		defer cleanup()
+
+		q.SetLimits(Limits{MaxAge: 50 * time.Millisecond})
+
+		_, err = q.Add(op1)
+		require.NoError(t, err)
+		_, err = q.Add(op2)
+		require.NoError(t, err)
+
+		// Leased operations don't expire
+		l, err := q.Lease(1, time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, l.Operations)
+
+		time.Sleep(60 * time.Millisecond)
+
+		_, err = q.Add(op3)
+		require.NoError(t, err)
+
+		ops, err := q.Peek(3)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op3}, ops)
+		require.Equal(t, uint64(1), q.Stats().Expired)
+
+		// The expired operation may be resubmitted
+		_, err = q.Add(op2)
+		require.NoError(t, err)
+
+		_, err = q.Commit(l.ID)
+		require.NoError(t, err)
+
+		deadLetters, err := q.DeadLetters()
+		require.NoError(t, err)
+		require.Empty(t, deadLetters)
+	})
+
+	t.Run("Peeked operations don't expire", func(t *testing.T) {
+		q, cleanup, err := newTestQueue(channel3)
+		require.NoError(t, err)
+
+		defer cleanup()
+
+		q.SetLimits(Limits{MaxAge: 50 * time.Millisecond})
+
+		_, err = q.Add(op1)
+		require.NoError(t, err)
+
+		ops, err := q.Peek(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, ops)
+
+		// The peeked operation exceeds the maximum age while its batch is being written
+		time.Sleep(60 * time.Millisecond)
+
+		_, err = q.Add(op2)
+		require.NoError(t, err)
+
+		ops, n, err := q.Remove(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, ops)
+		require.Equal(t, uint(1), n)
+		require.Zero(t, q.Stats().Expired)
+
+		ops, err = q.Peek(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op2}, ops)
+	})
+
+	t.Run("Dead letter", func(t *testing.T) {
+		q, cleanup, err := newTestQueue(channel2)
+		require.NoError(t, err)
+
+		defer cleanup()
+
+		_, err = q.Add(op1)
+		require.NoError(t, err)
+		_, err = q.Add(op2)
+		require.NoError(t, err)
+
+		time.Sleep(20 * time.Millisecond)
+
+		_, err = q.Add(op3)
+		require.NoError(t, err)
+
+		q.SetLimits(Limits{MaxAge: 10 * time.Millisecond, DeadLetterExpired: true})
+
+		stats := q.Stats()
+		require.Equal(t, uint(1), stats.Length)
+		require.Equal(t, uint64(2), stats.Expired)
+
+		deadLetters, err := q.DeadLetters()
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1, op2}, deadLetters)
+
+		time.Sleep(20 * time.Millisecond)
+
+		require.NoError(t, q.Sweep())
+		require.Zero(t, q.Len())
+
+		deadLetters, err = q.DeadLetters()
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1, op2, op3}, deadLetters)
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		q, cleanup, err := newTestQueue(channel3)
+		require.NoError(t, err)
+
+		cleanup()
+
+		require.EqualError(t, q.Sweep(), errClosed.Error())
+
+		_, err = q.DeadLetters()
+		require.EqualError(t, err, errClosed.Error())
+	})
+}
+
+func TestLevelDBQueue_Priority(t *testing.T) {
+	q, cleanup, err := newTestQueue(channel1)
+	require.NoError(t, err)
+
+	defer cleanup()
+
+	q.SetLimits(Limits{HighPriorityWeight: 2})
+
+	create1 := newOp(t, "did1", batch.OperationTypeCreate)
+	update2 := newOp(t, "did2", batch.OperationTypeUpdate)
+	update3 := newOp(t, "did3", batch.OperationTypeUpdate)
+	recover4 := newOp(t, "did4", batch.OperationTypeRecover)
+	delete5 := newOp(t, "did5", batch.OperationTypeDelete)
+	recover6 := newOp(t, "did6", batch.OperationTypeRecover)
+	delete7 := newOp(t, "did7", batch.OperationTypeDelete)
+
+	for _, op := range []*batch.OperationInfo{create1, update2, update3, recover4, delete5, recover6} {
+		_, err = q.Add(op)
+		require.NoError(t, err)
+	}
+
+	ops, err := q.Peek(10)
+	require.NoError(t, err)
+	require.Equal(t, []*batch.OperationInfo{recover4, delete5, create1, recover6, update2, update3}, ops)
+
+	ops, err = q.Peek(4)
+	require.NoError(t, err)
+	require.Equal(t, []*batch.OperationInfo{recover4, delete5, create1, recover6}, ops)
+
+	// A high-priority operation that is added after the Peek must not affect what is removed
+	_, err = q.Add(delete7)
+	require.NoError(t, err)
+
+	ops, n, err := q.Remove(4)
+	require.NoError(t, err)
+	require.Equal(t, []*batch.OperationInfo{recover4, delete5, create1, recover6}, ops)
+	require.Equal(t, uint(3), n)
+
+	// Without a Peek, priority applies
+	ops, n, err = q.Remove(2)
+	require.NoError(t, err)
+	require.Equal(t, []*batch.OperationInfo{delete7, update2}, ops)
+	require.Equal(t, uint(1), n)
+
+	t.Run("Peeked operations are not leased", func(t *testing.T) {
+		ops, err := q.Peek(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{update3}, ops)
+
+		_, err = q.Add(recover4)
+		require.NoError(t, err)
+
+		// The peeked operation is held until the batch is committed
+		l, err := q.Lease(1, time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{recover4}, l.Operations)
+
+		// The operation that was leased after the Peek wasn't batched and therefore must not be removed
+		ops, n, err := q.Remove(2)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{update3}, ops)
+		require.Zero(t, n)
+
+		_, err = q.Commit(l.ID)
+		require.NoError(t, err)
+		require.Zero(t, q.Len())
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		_, err = q.Add(update2)
+		require.NoError(t, err)
+		_, err = q.Add(delete5)
+		require.NoError(t, err)
+
+		q.Close()
+
+		q2, err := newLevelDBQueue(channel1, namespace1, levelDBBasePath)
+		require.NoError(t, err)
+		defer q2.Close()
+
+		ops, err := q2.Peek(2)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{delete5, update2}, ops)
+	})
+}
+
+func TestLevelDBQueue_Migrate(t *testing.T) {
+	q, cleanup, err := newTestQueue(channel2)
+	require.NoError(t, err)
+
+	defer cleanup()
+
+	// Persist operations in the legacy format and without an enqueue time
+	require.NoError(t, q.db.Put(toBytes(0), marshalLegacy(t, op1), nil))
+	require.NoError(t, q.db.Put(toBytes(1), marshalLegacy(t, op2), nil))
+
+	b, err := marshal(op3, time.Time{})
+	require.NoError(t, err)
+	require.NoError(t, q.db.Put(toBytes(2), b, nil))
+
+	q.Close()
+
+	q2, cleanup2, err := newTestQueue(channel2)
+	require.NoError(t, err)
+	defer cleanup2()
+
+	it := q2.db.NewIterator(opsRange, nil)
+	for it.Next() {
+		require.False(t, isLegacy(it.Value()))
+
+		r, err := decode(it.Value())
+		require.NoError(t, err)
+		require.False(t, r.EnqueuedAt.IsZero())
+	}
+	it.Release()
+
+	ops, err := q2.Peek(3)
+	require.NoError(t, err)
+	require.Equal(t, []*batch.OperationInfo{op1, op2, op3}, ops)
+}
+
 func TestLevelDBQueue_Close(t *testing.T) {
 	q, err := newLevelDBQueue(channel3, namespace1, levelDBBasePath)
 	require.NoError(t, err)
@@ -131,6 +518,9 @@ func TestLevelDBQueue_Close(t *testing.T) {
 	err = q.Drop()
 	require.Error(t, err, errNotClosed.Error())
 
+	_, err = q.Archive()
+	require.EqualError(t, err, errNotClosed.Error())
+
 	q.Close()
 	require.NotPanicsf(t, func() { q.Close() }, "calling close twice should not panic")
 
@@ -147,6 +537,9 @@ func TestLevelDBQueue_Close(t *testing.T) {
 }
 
 func TestLevelDBQueue_Error(t *testing.T) {
+	restoreOpenFile := openFile
+	defer func() { openFile = restoreOpenFile }()
+
 	t.Run("Create DB error", func(t *testing.T) {
 		errExpected := errors.New("injected OpenFile error")
 
@@ -181,17 +574,370 @@ func TestLevelDBQueue_Error(t *testing.T) {
 	t.Run("Remove error", func(t *testing.T) {
 		errExpected := errors.New("injected Remove error")
 
+		openFile = func(dir string) (handle dbHandle, err error) {
+			db := &mocks.DBHandle{}
+			db.NewIteratorStub = newMockIterator(t)
+			db.DeleteReturns(errExpected)
+
+			return db, nil
+		}
+
+		q, err := newLevelDBQueue(channel1, namespace1, levelDBBasePath)
+		require.NoError(t, err)
+		require.NotNil(t, q)
+
+		_, err = q.Add(op1)
+		require.NoError(t, err)
+
+		_, _, err = q.Remove(1)
+		require.Error(t, err, errExpected.Error())
+	})
+
+	t.Run("Migrate error", func(t *testing.T) {
 		openFile = func(dir string) (handle dbHandle, err error) {
 			it := &mocks.Iterator{}
 			it.NextReturnsOnCall(0, true)
 			it.KeyReturns(toBytes(1000))
+			it.ValueReturns([]byte("invalid gob"))
+
+			db := &mocks.DBHandle{}
+			db.NewIteratorReturns(it)
 
-			v, err := marshal(&batch.OperationInfo{})
+			return db, nil
+		}
+
+		q, err := newLevelDBQueue(channel1, namespace1, levelDBBasePath)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unable to migrate operation at key [1000]")
+		require.Nil(t, q)
+	})
+}
+
+func TestLevelDBQueue_Lease(t *testing.T) {
+	q, cleanup, err := newTestQueue(channel1)
+	require.NoError(t, err)
+
+	defer cleanup()
+
+	_, err = q.Lease(1, 0)
+	require.Error(t, err)
+
+	l, err := q.Lease(1, time.Minute)
+	require.NoError(t, err)
+	require.Nil(t, l)
+
+	_, err = q.Add(op1)
+	require.NoError(t, err)
+	_, err = q.Add(op2)
+	require.NoError(t, err)
+	_, err = q.Add(op3)
+	require.NoError(t, err)
+
+	t.Run("Release", func(t *testing.T) {
+		l, err := q.Lease(2, time.Minute)
+		require.NoError(t, err)
+		require.NotNil(t, l)
+		require.Equal(t, []*batch.OperationInfo{op1, op2}, l.Operations)
+		require.Equal(t, uint(1), q.Len())
+
+		ops, err := q.Peek(3)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op3}, ops)
+
+		require.NoError(t, q.Release(l.ID))
+		require.Equal(t, uint(3), q.Len())
+		require.Equal(t, ErrLeaseNotFound, q.Release(l.ID))
+
+		ops, err = q.Peek(3)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1, op2, op3}, ops)
+
+		// Return the peeked operations to the queue so that they may be leased
+		require.NoError(t, q.releaseCut())
+	})
+
+	t.Run("Commit", func(t *testing.T) {
+		l1, err := q.Lease(1, time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, l1.Operations)
+
+		l2, err := q.Lease(1, time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op2}, l2.Operations)
+		require.Equal(t, uint(1), q.Len())
+
+		n, err := q.Commit(l2.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint(1), n)
+
+		_, err = q.Commit(l2.ID)
+		require.Equal(t, ErrLeaseNotFound, err)
+
+		require.NoError(t, q.Release(l1.ID))
+
+		ops, err := q.Peek(3)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1, op3}, ops)
+
+		require.NoError(t, q.releaseCut())
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		l, err := q.Lease(1, 10*time.Millisecond)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, l.Operations)
+		require.Equal(t, uint(1), q.Len())
+
+		time.Sleep(20 * time.Millisecond)
+
+		require.Equal(t, uint(2), q.Len())
+
+		_, err = q.Commit(l.ID)
+		require.Equal(t, ErrLeaseNotFound, err)
+
+		ops, _, err := q.Remove(2)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1, op3}, ops)
+		require.Zero(t, q.Len())
+	})
+}
+
+func TestLevelDBQueue_Cut(t *testing.T) {
+	q, cleanup, err := newTestQueue(channel3)
+	require.NoError(t, err)
+
+	defer cleanup()
+
+	for _, op := range []*batch.OperationInfo{op1, op2, op3} {
+		_, err = q.Add(op)
+		require.NoError(t, err)
+	}
+
+	// The maximum batch size of the mock protocol is 2
+	c := cutter.New(coremocks.NewMockProtocolClient(), q)
+
+	ops, pending, _, err := c.Cut(false)
+	require.NoError(t, err)
+	require.Equal(t, []*batch.OperationInfo{op1, op2}, ops)
+	require.Equal(t, uint(1), pending)
+
+	// The batched operations are held by a persisted lease while the batch is being written
+	stats := q.Stats()
+	require.Equal(t, uint(2), stats.Leased)
+	require.Equal(t, uint(3), stats.Length)
+
+	t.Run("Batch not written", func(t *testing.T) {
+		// The batch wasn't committed (e.g. the anchor failed), so the same operations are cut again
+		ops, _, commit, err := c.Cut(false)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1, op2}, ops)
+
+		_, err = q.Add(&batch.OperationInfo{UniqueSuffix: "op4"})
+		require.NoError(t, err)
+
+		pending, err := commit()
+		require.NoError(t, err)
+		require.Equal(t, uint(2), pending)
+
+		ops, err = q.Peek(3)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op3, {UniqueSuffix: "op4"}}, ops)
+	})
+
+	t.Run("Peer restarted while writing a batch", func(t *testing.T) {
+		ops, _, _, err := c.Cut(true)
+		require.NoError(t, err)
+		require.Len(t, ops, 2)
+
+		q.Close()
+
+		q2, err := newLevelDBQueue(channel3, namespace1, levelDBBasePath)
+		require.NoError(t, err)
+		defer q2.Close()
+
+		// The operations of the uncommitted batch are returned to the queue
+		stats := q2.Stats()
+		require.Equal(t, uint(2), stats.Length)
+		require.Zero(t, stats.Leased)
+
+		ops, _, commit, err := cutter.New(coremocks.NewMockProtocolClient(), q2).Cut(false)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op3, {UniqueSuffix: "op4"}}, ops)
+
+		pending, err := commit()
+		require.NoError(t, err)
+		require.Zero(t, pending)
+	})
+}
+
+func TestLevelDBQueue_EmptyCut(t *testing.T) {
+	restoreOpenFile := openFile
+	defer func() { openFile = restoreOpenFile }()
+
+	t.Run("Nothing persisted", func(t *testing.T) {
+		db := &mocks.DBHandle{}
+		db.NewIteratorReturns(&mocks.Iterator{})
+
+		openFile = func(dir string) (handle dbHandle, err error) {
+			return db, nil
+		}
+
+		q, err := newLevelDBQueue(channel1, namespace1, levelDBBasePath)
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			ops, err := q.Peek(2)
 			require.NoError(t, err)
-			it.ValueReturns(v)
+			require.Empty(t, ops)
+		}
+
+		ops, pending, err := q.Remove(0)
+		require.NoError(t, err)
+		require.Empty(t, ops)
+		require.Zero(t, pending)
+
+		require.Zero(t, db.PutCallCount())
+		require.Zero(t, db.DeleteCallCount())
+	})
 
+	t.Run("Operations added after an empty cut aren't removed", func(t *testing.T) {
+		openFile = restoreOpenFile
+
+		q, cleanup, err := newTestQueue(channel3)
+		require.NoError(t, err)
+
+		defer cleanup()
+
+		ops, err := q.Peek(2)
+		require.NoError(t, err)
+		require.Empty(t, ops)
+
+		_, err = q.Add(op1)
+		require.NoError(t, err)
+
+		ops, pending, err := q.Remove(2)
+		require.NoError(t, err)
+		require.Empty(t, ops)
+		require.Equal(t, uint(1), pending)
+
+		ops, err = q.Peek(2)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, ops)
+	})
+}
+
+func TestLevelDBQueue_LeaseReload(t *testing.T) {
+	q, cleanup, err := newTestQueue(channel2)
+	require.NoError(t, err)
+
+	defer cleanup()
+
+	_, err = q.Add(op1)
+	require.NoError(t, err)
+	_, err = q.Add(op2)
+	require.NoError(t, err)
+	_, err = q.Add(op3)
+	require.NoError(t, err)
+
+	l1, err := q.Lease(1, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, []*batch.OperationInfo{op1}, l1.Operations)
+
+	l2, err := q.Lease(1, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, []*batch.OperationInfo{op2}, l2.Operations)
+
+	q.Close()
+
+	time.Sleep(20 * time.Millisecond)
+
+	q2, cleanup2, err := newTestQueue(channel2)
+	require.NoError(t, err)
+	defer cleanup2()
+
+	// The unexpired lease survives the restart and the operations from the expired lease are returned to the queue
+	require.Equal(t, uint(2), q2.Len())
+
+	ops, err := q2.Peek(3)
+	require.NoError(t, err)
+	require.Equal(t, []*batch.OperationInfo{op2, op3}, ops)
+
+	n, err := q2.Commit(l1.ID)
+	require.NoError(t, err)
+	require.Equal(t, uint(2), n)
+
+	ops, err = q2.Peek(3)
+	require.NoError(t, err)
+	require.Equal(t, []*batch.OperationInfo{op2, op3}, ops)
+}
+
+func TestLevelDBQueue_LeaseReloadPartialCommit(t *testing.T) {
+	q, cleanup, err := newTestQueue(channel2)
+	require.NoError(t, err)
+
+	defer cleanup()
+
+	_, err = q.Add(op1)
+	require.NoError(t, err)
+	_, err = q.Add(op2)
+	require.NoError(t, err)
+	_, err = q.Add(op3)
+	require.NoError(t, err)
+
+	l, err := q.Lease(2, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, []*batch.OperationInfo{op1, op2}, l.Operations)
+
+	// Simulate a peer crash after the first operation of the lease was deleted
+	require.NoError(t, q.db.Delete(toBytes(0), nil))
+
+	q.Close()
+
+	q2, cleanup2, err := newTestQueue(channel2)
+	require.NoError(t, err)
+	defer cleanup2()
+
+	require.Equal(t, uint(1), q2.Len())
+
+	n, err := q2.Commit(l.ID)
+	require.NoError(t, err)
+	require.Equal(t, uint(1), n)
+
+	ops, err := q2.Peek(3)
+	require.NoError(t, err)
+	require.Equal(t, []*batch.OperationInfo{op3}, ops)
+}
+
+func TestLevelDBQueue_LeaseError(t *testing.T) {
+	restoreOpenFile := openFile
+	defer func() { openFile = restoreOpenFile }()
+
+	t.Run("Persist lease error", func(t *testing.T) {
+		errExpected := errors.New("injected Put error")
+
+		openFile = func(dir string) (handle dbHandle, err error) {
 			db := &mocks.DBHandle{}
-			db.NewIteratorReturns(it)
+			db.NewIteratorStub = newMockIterator(t)
+			db.PutReturns(errExpected)
+
+			return db, nil
+		}
+
+		q, err := newLevelDBQueue(channel1, namespace1, levelDBBasePath)
+		require.NoError(t, err)
+
+		_, err = q.Lease(1, time.Minute)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errExpected.Error())
+		require.Equal(t, uint(1), q.Len())
+	})
+
+	t.Run("Commit error", func(t *testing.T) {
+		errExpected := errors.New("injected Delete error")
+
+		openFile = func(dir string) (handle dbHandle, err error) {
+			db := &mocks.DBHandle{}
+			db.NewIteratorStub = newMockIterator(t)
 			db.DeleteReturns(errExpected)
 
 			return db, nil
@@ -199,14 +945,91 @@ func TestLevelDBQueue_Error(t *testing.T) {
 
 		q, err := newLevelDBQueue(channel1, namespace1, levelDBBasePath)
 		require.NoError(t, err)
-		require.NotNil(t, q)
 
-		_, err = q.Add(&batch.OperationInfo{})
+		l, err := q.Lease(1, time.Minute)
 		require.NoError(t, err)
 
-		_, _, err = q.Remove(1)
-		require.Error(t, err, errExpected.Error())
+		_, err = q.Commit(l.ID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errExpected.Error())
+
+		err = q.Release(l.ID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errExpected.Error())
+	})
+
+	t.Run("Invalid lease", func(t *testing.T) {
+		openFile = func(dir string) (handle dbHandle, err error) {
+			db := &mocks.DBHandle{}
+			db.NewIteratorStub = func(r *util.Range, _ *opt.ReadOptions) iterator.Iterator {
+				it := &mocks.Iterator{}
+				if bytes.HasPrefix(r.Start, leaseKeyPrefix) {
+					it.NextReturnsOnCall(0, true)
+					it.KeyReturns(leaseKey("lease1"))
+					it.ValueReturns([]byte("{"))
+				}
+
+				return it
+			}
+
+			return db, nil
+		}
+
+		q, err := newLevelDBQueue(channel1, namespace1, levelDBBasePath)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unable to unmarshal lease")
+		require.Nil(t, q)
 	})
+
+	t.Run("Closed", func(t *testing.T) {
+		openFile = restoreOpenFile
+
+		q, err := newLevelDBQueue(channel3, namespace1, levelDBBasePath)
+		require.NoError(t, err)
+		q.Close()
+
+		defer func() {
+			if err := q.Drop(); err != nil {
+				t.Errorf("Error dropping DB [%s]: %s", q.dir, err)
+			}
+		}()
+
+		_, err = q.Lease(1, time.Minute)
+		require.EqualError(t, err, errClosed.Error())
+
+		_, err = q.Commit("lease1")
+		require.EqualError(t, err, errClosed.Error())
+
+		err = q.Release("lease1")
+		require.EqualError(t, err, errClosed.Error())
+	})
+}
+
+// newMockIterator returns a NewIterator stub that returns a fresh iterator over a single operation
+// (with key 1000) for operation ranges and an empty iterator for all other ranges
+func newMockIterator(t *testing.T) func(*util.Range, *opt.ReadOptions) iterator.Iterator {
+	v, err := marshal(&batch.OperationInfo{}, time.Now())
+	require.NoError(t, err)
+
+	return func(r *util.Range, _ *opt.ReadOptions) iterator.Iterator {
+		it := &mocks.Iterator{}
+		if r != nil && bytes.HasPrefix(r.Start, leaseKeyPrefix) {
+			return it
+		}
+
+		it.NextReturnsOnCall(0, true)
+		it.KeyReturns(toBytes(1000))
+		it.ValueReturns(v)
+
+		return it
+	}
+}
+
+func newOp(t *testing.T, suffix string, opType batch.OperationType) *batch.OperationInfo {
+	data, err := json.Marshal(&batch.Operation{Type: opType, UniqueSuffix: suffix})
+	require.NoError(t, err)
+
+	return &batch.OperationInfo{UniqueSuffix: suffix, Data: data}
 }
 
 func newTestQueue(channelID string) (q *LevelDBQueue, cleanup func(), err error) {
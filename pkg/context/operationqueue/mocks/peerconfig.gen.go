@@ -15,6 +15,33 @@ type PeerConfig struct {
 	levelDBOpQueueBasePathReturnsOnCall map[int]struct {
 		result1 string
 	}
+	OperationQueueBackendStub        func() string
+	operationQueueBackendMutex       sync.RWMutex
+	operationQueueBackendArgsForCall []struct{}
+	operationQueueBackendReturns     struct {
+		result1 string
+	}
+	operationQueueBackendReturnsOnCall map[int]struct {
+		result1 string
+	}
+	PeerIDStub        func() string
+	peerIDMutex       sync.RWMutex
+	peerIDArgsForCall []struct{}
+	peerIDReturns     struct {
+		result1 string
+	}
+	peerIDReturnsOnCall map[int]struct {
+		result1 string
+	}
+	OperationQueueCollectionStub        func() string
+	operationQueueCollectionMutex       sync.RWMutex
+	operationQueueCollectionArgsForCall []struct{}
+	operationQueueCollectionReturns     struct {
+		result1 string
+	}
+	operationQueueCollectionReturnsOnCall map[int]struct {
+		result1 string
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -59,9 +86,135 @@ func (fake *PeerConfig) LevelDBOpQueueBasePathReturnsOnCall(i int, result1 strin
 	}{result1}
 }
 
+func (fake *PeerConfig) OperationQueueBackend() string {
+	fake.operationQueueBackendMutex.Lock()
+	ret, specificReturn := fake.operationQueueBackendReturnsOnCall[len(fake.operationQueueBackendArgsForCall)]
+	fake.operationQueueBackendArgsForCall = append(fake.operationQueueBackendArgsForCall, struct{}{})
+	fake.recordInvocation("OperationQueueBackend", []interface{}{})
+	fake.operationQueueBackendMutex.Unlock()
+	if fake.OperationQueueBackendStub != nil {
+		return fake.OperationQueueBackendStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.operationQueueBackendReturns.result1
+}
+
+func (fake *PeerConfig) OperationQueueBackendCallCount() int {
+	fake.operationQueueBackendMutex.RLock()
+	defer fake.operationQueueBackendMutex.RUnlock()
+	return len(fake.operationQueueBackendArgsForCall)
+}
+
+func (fake *PeerConfig) OperationQueueBackendReturns(result1 string) {
+	fake.OperationQueueBackendStub = nil
+	fake.operationQueueBackendReturns = struct {
+		result1 string
+	}{result1}
+}
+
+func (fake *PeerConfig) OperationQueueBackendReturnsOnCall(i int, result1 string) {
+	fake.OperationQueueBackendStub = nil
+	if fake.operationQueueBackendReturnsOnCall == nil {
+		fake.operationQueueBackendReturnsOnCall = make(map[int]struct {
+			result1 string
+		})
+	}
+	fake.operationQueueBackendReturnsOnCall[i] = struct {
+		result1 string
+	}{result1}
+}
+
+func (fake *PeerConfig) PeerID() string {
+	fake.peerIDMutex.Lock()
+	ret, specificReturn := fake.peerIDReturnsOnCall[len(fake.peerIDArgsForCall)]
+	fake.peerIDArgsForCall = append(fake.peerIDArgsForCall, struct{}{})
+	fake.recordInvocation("PeerID", []interface{}{})
+	fake.peerIDMutex.Unlock()
+	if fake.PeerIDStub != nil {
+		return fake.PeerIDStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.peerIDReturns.result1
+}
+
+func (fake *PeerConfig) PeerIDCallCount() int {
+	fake.peerIDMutex.RLock()
+	defer fake.peerIDMutex.RUnlock()
+	return len(fake.peerIDArgsForCall)
+}
+
+func (fake *PeerConfig) PeerIDReturns(result1 string) {
+	fake.PeerIDStub = nil
+	fake.peerIDReturns = struct {
+		result1 string
+	}{result1}
+}
+
+func (fake *PeerConfig) PeerIDReturnsOnCall(i int, result1 string) {
+	fake.PeerIDStub = nil
+	if fake.peerIDReturnsOnCall == nil {
+		fake.peerIDReturnsOnCall = make(map[int]struct {
+			result1 string
+		})
+	}
+	fake.peerIDReturnsOnCall[i] = struct {
+		result1 string
+	}{result1}
+}
+
+func (fake *PeerConfig) OperationQueueCollection() string {
+	fake.operationQueueCollectionMutex.Lock()
+	ret, specificReturn := fake.operationQueueCollectionReturnsOnCall[len(fake.operationQueueCollectionArgsForCall)]
+	fake.operationQueueCollectionArgsForCall = append(fake.operationQueueCollectionArgsForCall, struct{}{})
+	fake.recordInvocation("OperationQueueCollection", []interface{}{})
+	fake.operationQueueCollectionMutex.Unlock()
+	if fake.OperationQueueCollectionStub != nil {
+		return fake.OperationQueueCollectionStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.operationQueueCollectionReturns.result1
+}
+
+func (fake *PeerConfig) OperationQueueCollectionCallCount() int {
+	fake.operationQueueCollectionMutex.RLock()
+	defer fake.operationQueueCollectionMutex.RUnlock()
+	return len(fake.operationQueueCollectionArgsForCall)
+}
+
+func (fake *PeerConfig) OperationQueueCollectionReturns(result1 string) {
+	fake.OperationQueueCollectionStub = nil
+	fake.operationQueueCollectionReturns = struct {
+		result1 string
+	}{result1}
+}
+
+func (fake *PeerConfig) OperationQueueCollectionReturnsOnCall(i int, result1 string) {
+	fake.OperationQueueCollectionStub = nil
+	if fake.operationQueueCollectionReturnsOnCall == nil {
+		fake.operationQueueCollectionReturnsOnCall = make(map[int]struct {
+			result1 string
+		})
+	}
+	fake.operationQueueCollectionReturnsOnCall[i] = struct {
+		result1 string
+	}{result1}
+}
+
 func (fake *PeerConfig) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.peerIDMutex.RLock()
+	defer fake.peerIDMutex.RUnlock()
+	fake.operationQueueCollectionMutex.RLock()
+	defer fake.operationQueueCollectionMutex.RUnlock()
+	fake.operationQueueBackendMutex.RLock()
+	defer fake.operationQueueBackendMutex.RUnlock()
 	fake.levelDBOpQueueBasePathMutex.RLock()
 	defer fake.levelDBOpQueueBasePathMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
@@ -0,0 +1,1383 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operationqueue
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/trustbloc/fabric-peer-ext/pkg/collections/client"
+	"github.com/trustbloc/sidetree-core-go/pkg/api/batch"
+)
+
+// offLedgerNamespace is the chaincode namespace of the off-ledger collection that holds the shared operation pool
+const offLedgerNamespace = "document_cc"
+
+var (
+	// claimSettleTime is the time to wait after writing claims before reading them back in order to confirm
+	// that no other peer has claimed the same operations. It may be overridden by unit tests.
+	claimSettleTime = 500 * time.Millisecond
+
+	// peekTimeout is the duration of the claims on the operations returned by Peek. The claims are renewed
+	// on each subsequent Peek. It may be overridden by unit tests.
+	peekTimeout = 2 * time.Minute
+
+	// refreshInterval is the maximum age of the local view of the shared pool. (Loading the view requires a number
+	// of round trips that's proportional to the size of the pool, so it isn't loaded on every invocation.)
+	// It may be overridden by unit tests.
+	refreshInterval = 2 * time.Second
+
+	// memberTimeout is the time after which a member of the shared pool that hasn't updated its heartbeat is
+	// considered to be gone, in which case its operations are taken over by the surviving members. (Each member
+	// updates its heartbeat on refresh, at most every quarter of the timeout. The view of the pool is refreshed
+	// by the provider's sweeper at least once per sweep interval.) It may be overridden by unit tests.
+	memberTimeout = 10 * time.Minute
+
+	opSeq uint64
+)
+
+// memberIndex is the persisted form of the index of a member of the shared pool
+type memberIndex struct {
+	IDs       []string
+	Heartbeat time.Time
+}
+
+// sharedOperation is the persisted form of an operation in the shared pool
+type sharedOperation struct {
+	ID           string
+	UniqueSuffix string
+	Data         []byte
+	EnqueuedAt   time.Time
+	Owner        string
+	size         int // The size of the persisted record
+}
+
+// claimRecord is the persisted form of a claim on an operation in the shared pool
+type claimRecord struct {
+	Owner   string
+	LeaseID string
+	Expiry  time.Time
+}
+
+// sharedLease holds the IDs of the operations that were claimed by this peer under the same lease ID
+type sharedLease struct {
+	id     string
+	ids    []string
+	expiry time.Time
+}
+
+// OffLedgerQueue implements an operation queue that's backed by a pool of pending operations in an off-ledger
+// collection. The pool is shared by all batch writers (of the same org) that use the same collection, so
+// if a batch writer fails then the operations that it accepted are processed by the surviving batch writers.
+//
+// Each peer keeps an index of the operations that it added to the pool, and a member list holds the IDs of all
+// peers that use the pool. The local view of the pool is refreshed at most once per refresh interval. The index
+// also holds a heartbeat: if a member's heartbeat is older than the member timeout then a surviving member adds
+// the operations of the member to its own index and removes the member from the pool.
+//
+// Batches are cut by one peer only, namely the elected leader among the batch writers (leader election must be
+// enabled with this backend). Before an operation is included in a batch it's claimed by the leader, and the
+// claims on the operations of a batch are held until the batch is committed. The claims guard the hand-over of
+// leadership: a new leader only takes over the operations that aren't claimed, or whose claims expired because
+// the previous leader failed. The off-ledger store doesn't support an atomic compare-and-swap so a claim is
+// confirmed by reading it back after a settle time. Claims expire according to wall-clock time so the clocks
+// of the peers must be reasonably in sync.
+type OffLedgerQueue struct {
+	channelID  string
+	namespace  string
+	peerID     string
+	collection string
+	client     client.OffLedger
+	limits     Limits
+	expired    uint64
+	index      []string                    // IDs of the operations that this peer added to the pool
+	dead       []string                    // IDs of the operations that this peer dead-lettered
+	ops        map[string]*sharedOperation // The current view of the pool, indexed by ID
+	claims     map[string]*claimRecord     // Live claims, indexed by operation ID
+	leases     map[string]*sharedLease     // Leases held by this peer, indexed by lease ID
+	peeked     *sharedLease                // Claims on the operations returned by the last Peek
+	refreshed  time.Time                   // The time of the last refresh of the local view
+	heartbeat  time.Time                   // The heartbeat of this peer's index (as last persisted)
+	claimMutex sync.Mutex                  // Serializes claims (the queue mutex is released while claims settle)
+	mutex      sync.Mutex
+	closed     bool
+}
+
+func newOffLedgerQueue(channelID, namespace, peerID, collection string, c client.OffLedger) (*OffLedgerQueue, error) {
+	q := &OffLedgerQueue{
+		channelID:  channelID,
+		namespace:  namespace,
+		peerID:     peerID,
+		collection: collection,
+		client:     c,
+		ops:        make(map[string]*sharedOperation),
+		claims:     make(map[string]*claimRecord),
+		leases:     make(map[string]*sharedLease),
+	}
+
+	index, err := q.getIndex(peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if index != nil {
+		q.index = index.IDs
+	}
+
+	q.dead, err = q.getIDs(q.deadIndexKey(peerID))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := q.refresh(time.Now()); err != nil {
+		return nil, err
+	}
+
+	logger.Infof("[%s-%s] Joined shared operation pool in collection [%s]. Size: %d", channelID, namespace, collection, len(q.ops))
+
+	return q, nil
+}
+
+// Close releases the claims held by this peer (so that other peers may process the operations immediately)
+func (q *OffLedgerQueue) Close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		// Already closed
+		return
+	}
+
+	logger.Infof("[%s-%s] Closing queue", q.channelID, q.namespace)
+
+	q.closed = true
+
+	var ids []string
+	if q.peeked != nil {
+		ids = append(ids, q.peeked.ids...)
+	}
+
+	for _, l := range q.leases {
+		ids = append(ids, l.ids...)
+	}
+
+	if err := q.deleteClaims(ids); err != nil {
+		logger.Warnf("[%s-%s] Error releasing claims: %s", q.channelID, q.namespace, err)
+	}
+}
+
+// Drop does nothing other than ensure that the queue is closed since the pool is shared with other peers
+func (q *OffLedgerQueue) Drop() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if !q.closed {
+		return errNotClosed
+	}
+
+	logger.Debugf("[%s-%s] The shared operation pool is not dropped since it may be used by other peers", q.channelID, q.namespace)
+
+	return nil
+}
+
+// Archive leaves the pending operations in the shared pool (where they may be processed by other peers)
+// and returns the location of the pool. Note that the queue must be closed before this operation may be performed.
+func (q *OffLedgerQueue) Archive() (string, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if !q.closed {
+		return "", errNotClosed
+	}
+
+	return fmt.Sprintf("offledger://%s/%s/%s", q.channelID, offLedgerNamespace, q.collection), nil
+}
+
+// Add adds the given operation to the shared pool and returns the number of operations that are available to this peer
+func (q *OffLedgerQueue) Add(op *batch.OperationInfo) (uint, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return 0, errClosed
+	}
+
+	now := time.Now()
+
+	if err := q.update(now); err != nil {
+		return 0, err
+	}
+
+	if err := q.checkPending(op); err != nil {
+		return 0, err
+	}
+
+	rec := &sharedOperation{
+		ID:           newOperationID(now, q.peerID),
+		UniqueSuffix: op.UniqueSuffix,
+		Data:         op.Data,
+		EnqueuedAt:   now,
+		Owner:        q.peerID,
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return 0, errors.WithMessage(err, "unable to marshal operation")
+	}
+
+	if err := q.checkCapacity(len(b)); err != nil {
+		return 0, err
+	}
+
+	rec.size = len(b)
+
+	if err := q.client.Put(offLedgerNamespace, q.collection, q.opKey(rec.ID), b); err != nil {
+		return 0, errors.WithMessagef(err, "unable to add operation for unique suffix [%s] to shared pool", op.UniqueSuffix)
+	}
+
+	if err := q.putIndex(append(q.index, rec.ID), now); err != nil {
+		return 0, err
+	}
+
+	q.index = append(q.index, rec.ID)
+	q.ops[rec.ID] = rec
+
+	logger.Debugf("[%s-%s] Added operation for unique suffix [%s] to shared pool - ID [%s]", q.channelID, q.namespace, op.UniqueSuffix, rec.ID)
+
+	return q.len(), nil
+}
+
+// Peek claims (up to) the given number of operations and returns them. The claims are held until the
+// operations are removed and are renewed on each invocation.
+func (q *OffLedgerQueue) Peek(num uint) ([]*batch.OperationInfo, error) {
+	q.claimMutex.Lock()
+	defer q.claimMutex.Unlock()
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return nil, errClosed
+	}
+
+	now := time.Now()
+
+	if err := q.update(now); err != nil {
+		return nil, err
+	}
+
+	ids, err := q.peek(num, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.operations(ids), nil
+}
+
+// Remove removes (up to) the given number of the operations that were returned by the last Peek from the
+// shared pool (the claims on the remaining operations are released). If Peek wasn't invoked then operations
+// are claimed first. Returns the removed operations along with the new length of the queue.
+func (q *OffLedgerQueue) Remove(num uint) ([]*batch.OperationInfo, uint, error) {
+	q.claimMutex.Lock()
+	defer q.claimMutex.Unlock()
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return nil, 0, errClosed
+	}
+
+	now := time.Now()
+
+	if err := q.update(now); err != nil {
+		return nil, 0, err
+	}
+
+	if q.peeked == nil {
+		if _, err := q.peek(num, now); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	ids := q.peeked.ids
+
+	var released []string
+	if uint(len(ids)) > num {
+		released = ids[num:]
+		ids = ids[:num]
+	}
+
+	ops := q.operations(ids)
+
+	if err := q.delete(ids); err != nil {
+		return nil, 0, err
+	}
+
+	q.peeked = nil
+
+	if err := q.releaseClaims(released); err != nil {
+		return nil, 0, err
+	}
+
+	logger.Debugf("[%s-%s] Removed %d operations from shared pool", q.channelID, q.namespace, len(ops))
+
+	return ops, q.len(), nil
+}
+
+// Len returns the number of operations in the shared pool that are available to this peer
+func (q *OffLedgerQueue) Len() uint {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		logger.Warnf("[%s-%s] Invocation on a closed queue", q.channelID, q.namespace)
+		return 0
+	}
+
+	if err := q.update(time.Now()); err != nil {
+		logger.Warnf("[%s-%s] Error refreshing shared operation pool: %s", q.channelID, q.namespace, err)
+	}
+
+	return q.len()
+}
+
+// SetLimits sets the capacity limits of the queue. The limits apply to the entire shared pool.
+func (q *OffLedgerQueue) SetLimits(limits Limits) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	logger.Debugf("[%s-%s] Setting limits: %+v", q.channelID, q.namespace, limits)
+
+	q.limits = limits
+}
+
+// Sweep refreshes the local view of the shared pool and removes expired operations
+func (q *OffLedgerQueue) Sweep() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return errClosed
+	}
+
+	now := time.Now()
+
+	if err := q.refresh(now); err != nil {
+		return err
+	}
+
+	return q.expireOperations(now)
+}
+
+// DeadLetters returns the expired operations that were dead-lettered by this peer
+func (q *OffLedgerQueue) DeadLetters() ([]*batch.OperationInfo, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return nil, errClosed
+	}
+
+	recs, err := q.getOperations(q.deadKey, q.dead)
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []*batch.OperationInfo
+	for _, id := range q.dead {
+		if rec, ok := recs[id]; ok {
+			ops = append(ops, toOperationInfo(rec))
+		}
+	}
+
+	return ops, nil
+}
+
+// Stats returns the current depth of the shared pool (as of the last refresh)
+func (q *OffLedgerQueue) Stats() *Stats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var size uint64
+	for _, rec := range q.ops {
+		size += uint64(rec.size)
+	}
+
+	var leased uint
+	for _, l := range q.leases {
+		leased += uint(len(l.ids))
+	}
+
+	return &Stats{
+		ChannelID: q.channelID,
+		Namespace: q.namespace,
+		Length:    q.len(),
+		Leased:    leased,
+		Size:      size,
+		Expired:   q.expired,
+		Limits:    q.limits,
+	}
+}
+
+// Lease claims (up to) the given number of operations for the given amount of time. Nil is returned if
+// no operations are available.
+func (q *OffLedgerQueue) Lease(num uint, timeout time.Duration) (*Lease, error) {
+	if timeout <= 0 {
+		return nil, errors.New("lease timeout must be greater than 0")
+	}
+
+	q.claimMutex.Lock()
+	defer q.claimMutex.Unlock()
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return nil, errClosed
+	}
+
+	now := time.Now()
+
+	if err := q.update(now); err != nil {
+		return nil, err
+	}
+
+	l := &sharedLease{
+		id:     newLeaseID(now),
+		expiry: now.Add(timeout),
+	}
+
+	// The lease is registered before the claims are made so that the claimed operations
+	// aren't considered to be available while the claims settle
+	q.leases[l.id] = l
+
+	ids, err := q.claim(l.id, q.selectIDs(num, q.heldIDs()), l.expiry)
+	if err != nil {
+		delete(q.leases, l.id)
+
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		delete(q.leases, l.id)
+
+		return nil, nil
+	}
+
+	l.ids = ids
+
+	logger.Debugf("[%s-%s] Leased %d operations - Lease ID [%s], Expiry: %s", q.channelID, q.namespace, len(ids), l.id, l.expiry)
+
+	return &Lease{
+		ID:         l.id,
+		Operations: q.operations(ids),
+		Expiry:     l.expiry,
+	}, nil
+}
+
+// Commit removes the operations held by the given lease from the shared pool and returns the number of
+// operations that were removed. ErrLeaseNotFound is returned if the lease has expired.
+func (q *OffLedgerQueue) Commit(leaseID string) (uint, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return 0, errClosed
+	}
+
+	l, err := q.lease(leaseID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := q.delete(l.ids); err != nil {
+		return 0, err
+	}
+
+	delete(q.leases, leaseID)
+
+	logger.Debugf("[%s-%s] Committed lease [%s] - removed %d operations", q.channelID, q.namespace, leaseID, len(l.ids))
+
+	return uint(len(l.ids)), nil
+}
+
+// Release releases the claims held by the given lease so that the operations may be processed by any peer
+func (q *OffLedgerQueue) Release(leaseID string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return errClosed
+	}
+
+	l, err := q.lease(leaseID)
+	if err != nil {
+		return err
+	}
+
+	if err := q.releaseClaims(l.ids); err != nil {
+		return err
+	}
+
+	delete(q.leases, leaseID)
+
+	logger.Debugf("[%s-%s] Released lease [%s] - returned %d operations", q.channelID, q.namespace, leaseID, len(l.ids))
+
+	return nil
+}
+
+// update refreshes the view of the shared pool (if it's older than the refresh interval) and then removes
+// expired operations
+func (q *OffLedgerQueue) update(now time.Time) error {
+	if now.Sub(q.refreshed) >= refreshInterval {
+		if err := q.refresh(now); err != nil {
+			return err
+		}
+	}
+
+	return q.expireOperations(now)
+}
+
+// refresh loads the operations and live claims of all members of the shared pool. The operations of the
+// members that are gone are taken over by this peer.
+func (q *OffLedgerQueue) refresh(now time.Time) error {
+	// The heartbeat is persisted before joining so that the other members don't consider this peer to be gone
+	if now.Sub(q.heartbeat) >= memberTimeout/4 {
+		if err := q.putIndex(q.index, now); err != nil {
+			return err
+		}
+	}
+
+	members, err := q.join()
+	if err != nil {
+		return err
+	}
+
+	var memberIDs []string
+	var gone []string
+	for _, member := range members {
+		if member == q.peerID {
+			continue
+		}
+
+		index, err := q.getIndex(member)
+		if err != nil {
+			return err
+		}
+
+		if index == nil || now.Sub(index.Heartbeat) >= memberTimeout {
+			gone = append(gone, member)
+			continue
+		}
+
+		memberIDs = append(memberIDs, index.IDs...)
+	}
+
+	if len(gone) > 0 {
+		if err := q.takeOver(gone, members, now); err != nil {
+			return err
+		}
+	}
+
+	ids := distinct(append(append([]string(nil), q.index...), memberIDs...))
+
+	ops, err := q.getOperations(q.opKey, ids)
+	if err != nil {
+		return err
+	}
+
+	claims, err := q.getClaims(ids, now)
+	if err != nil {
+		return err
+	}
+
+	q.ops = ops
+	q.claims = claims
+	q.refreshed = now
+
+	q.pruneLeases(now)
+
+	return q.pruneIndex()
+}
+
+// takeOver adds the operations (and dead-lettered operations) of the given members, which are gone, to the
+// index of this peer and then removes the members from the shared pool. If other members take over the same
+// operations at the same time then the operations are in more than one index, which is harmless since the
+// indexes are merged.
+func (q *OffLedgerQueue) takeOver(gone, members []string, now time.Time) error {
+	goneMap := make(map[string]struct{})
+
+	var ids, dead []string
+	for _, member := range gone {
+		goneMap[member] = struct{}{}
+
+		var memberIDs []string
+
+		index, err := q.getIndex(member)
+		if err != nil {
+			return err
+		}
+
+		if index != nil {
+			memberIDs = index.IDs
+		}
+
+		memberDead, err := q.getIDs(q.deadIndexKey(member))
+		if err != nil {
+			return err
+		}
+
+		logger.Warnf("[%s-%s] Member [%s] of the shared operation pool is gone. Taking over %d operation(s) and %d dead-lettered operation(s).",
+			q.channelID, q.namespace, member, len(memberIDs), len(memberDead))
+
+		ids = append(ids, memberIDs...)
+		dead = append(dead, memberDead...)
+	}
+
+	index := distinct(append(append([]string(nil), q.index...), ids...))
+	if err := q.putIndex(index, now); err != nil {
+		return err
+	}
+
+	q.index = index
+
+	if len(dead) > 0 {
+		d := distinct(append(append([]string(nil), q.dead...), dead...))
+		if err := q.putIDs(q.deadIndexKey(q.peerID), d); err != nil {
+			return err
+		}
+
+		q.dead = d
+	}
+
+	var keys []string
+	for _, member := range gone {
+		keys = append(keys, q.indexKey(member), q.deadIndexKey(member))
+	}
+
+	if err := q.client.Delete(offLedgerNamespace, q.collection, keys...); err != nil {
+		return errors.WithMessage(err, "unable to delete the indexes of members that are gone")
+	}
+
+	var remaining []string
+	for _, member := range members {
+		if _, ok := goneMap[member]; !ok {
+			remaining = append(remaining, member)
+		}
+	}
+
+	return q.putIDs(q.membersKey(), remaining)
+}
+
+// join adds this peer to the member list of the shared pool (if it's not already a member) and returns the members.
+// The member list isn't updated atomically, so an update may be lost if two peers join at the same time. In this
+// case the peer is added again on the next refresh.
+func (q *OffLedgerQueue) join() ([]string, error) {
+	members, err := q.getIDs(q.membersKey())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, member := range members {
+		if member == q.peerID {
+			return members, nil
+		}
+	}
+
+	logger.Infof("[%s-%s] Adding peer [%s] to the members of the shared operation pool", q.channelID, q.namespace, q.peerID)
+
+	members = append(members, q.peerID)
+
+	if err := q.putIDs(q.membersKey(), members); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// pruneLeases removes expired leases and the operations that are no longer claimed by this peer. The operations
+// returned by Peek aren't pruned since they may already have been included in a batch.
+func (q *OffLedgerQueue) pruneLeases(now time.Time) {
+	for id, l := range q.leases {
+		if !now.Before(l.expiry) {
+			logger.Warnf("[%s-%s] Lease [%s] expired at %s. Returning %d operations to the pool.", q.channelID, q.namespace, l.id, l.expiry, len(l.ids))
+
+			delete(q.leases, id)
+
+			continue
+		}
+
+		l.ids = q.claimed(l.id, l.ids)
+	}
+}
+
+// pruneIndex removes the IDs of operations that no longer exist from this peer's index
+func (q *OffLedgerQueue) pruneIndex() error {
+	var index []string
+	for _, id := range q.index {
+		if _, ok := q.ops[id]; ok {
+			index = append(index, id)
+		}
+	}
+
+	if len(index) == len(q.index) {
+		return nil
+	}
+
+	if err := q.putIndex(index, time.Now()); err != nil {
+		return err
+	}
+
+	q.index = index
+
+	return nil
+}
+
+// expireOperations removes (or dead-letters) operations that have been in the pool for longer than the
+// maximum age. Claimed operations (including the operations returned by Peek) are not expired since they
+// are in the process of being written.
+func (q *OffLedgerQueue) expireOperations(now time.Time) error {
+	if q.limits.MaxAge == 0 {
+		return nil
+	}
+
+	held := q.heldIDs()
+
+	var expired []string
+	for _, id := range q.sortedIDs() {
+		rec := q.ops[id]
+		if _, claimed := q.claims[id]; claimed || now.Sub(rec.EnqueuedAt) < q.limits.MaxAge {
+			continue
+		}
+
+		if _, ok := held[id]; ok {
+			continue
+		}
+
+		logger.Warnf("[%s-%s] Operation for unique suffix [%s] expired after being in the shared pool since %s", q.channelID, q.namespace, rec.UniqueSuffix, rec.EnqueuedAt)
+
+		expired = append(expired, id)
+	}
+
+	if len(expired) == 0 {
+		return nil
+	}
+
+	if q.limits.DeadLetterExpired {
+		if err := q.deadLetter(expired); err != nil {
+			return err
+		}
+	}
+
+	if err := q.delete(expired); err != nil {
+		return err
+	}
+
+	q.expired += uint64(len(expired))
+
+	logger.Warnf("[%s-%s] %d operation(s) expired. Dead-lettered: %t", q.channelID, q.namespace, len(expired), q.limits.DeadLetterExpired)
+
+	return nil
+}
+
+func (q *OffLedgerQueue) deadLetter(ids []string) error {
+	var kvs []*client.KeyValue
+	for _, id := range ids {
+		b, err := json.Marshal(q.ops[id])
+		if err != nil {
+			return errors.WithMessage(err, "unable to marshal operation")
+		}
+
+		kvs = append(kvs, &client.KeyValue{Key: q.deadKey(id), Value: b})
+	}
+
+	if err := q.client.PutMultipleValues(offLedgerNamespace, q.collection, kvs); err != nil {
+		return errors.WithMessage(err, "unable to dead-letter operations")
+	}
+
+	dead := append(q.dead, ids...)
+
+	if err := q.putIDs(q.deadIndexKey(q.peerID), dead); err != nil {
+		return err
+	}
+
+	q.dead = dead
+
+	return nil
+}
+
+// peek claims (up to) the given number of operations for the next batch and returns their IDs. The claims on the
+// operations returned by the previous invocation are renewed (so that they're included in the batch first) and
+// the claims on any operations in excess of the given number are released.
+func (q *OffLedgerQueue) peek(num uint, now time.Time) ([]string, error) {
+	if q.peeked == nil {
+		q.peeked = &sharedLease{id: newLeaseID(now)}
+	}
+
+	l := q.peeked
+
+	var ids []string
+	for _, id := range l.ids {
+		if _, ok := q.ops[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+
+	if uint(len(ids)) < num {
+		ids = append(ids, q.selectIDs(num-uint(len(ids)), q.heldIDs())...)
+	}
+
+	expiry := now.Add(peekTimeout)
+
+	claimed, err := q.claim(l.id, ids, expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	var released []string
+	if uint(len(claimed)) > num {
+		released = claimed[num:]
+		claimed = claimed[:num]
+	}
+
+	if err := q.releaseClaims(released); err != nil {
+		return nil, err
+	}
+
+	l.ids = claimed
+	l.expiry = expiry
+
+	return claimed, nil
+}
+
+// claim writes claims for the given operations and then reads them back (after the settle time) in order
+// to confirm that no other peer claimed the same operations. Returns the IDs of the confirmed claims.
+// The queue mutex is released while waiting for the claims to settle, so the caller must hold the claim mutex.
+func (q *OffLedgerQueue) claim(leaseID string, ids []string, expiry time.Time) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	c := &claimRecord{Owner: q.peerID, LeaseID: leaseID, Expiry: expiry}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, errors.WithMessage(err, "unable to marshal claim")
+	}
+
+	var kvs []*client.KeyValue
+	for _, id := range ids {
+		kvs = append(kvs, &client.KeyValue{Key: q.claimKey(id), Value: b})
+	}
+
+	if err := q.client.PutMultipleValues(offLedgerNamespace, q.collection, kvs); err != nil {
+		return nil, errors.WithMessage(err, "unable to claim operations")
+	}
+
+	for _, id := range ids {
+		q.claims[id] = c
+	}
+
+	q.mutex.Unlock()
+	time.Sleep(claimSettleTime)
+	q.mutex.Lock()
+
+	if q.closed {
+		if err := q.deleteClaims(ids); err != nil {
+			logger.Warnf("[%s-%s] Error releasing claims: %s", q.channelID, q.namespace, err)
+		}
+
+		return nil, errClosed
+	}
+
+	// The operations are also read back since they may have been removed by another peer
+	// since the last refresh
+	ops, err := q.getOperations(q.opKey, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := q.getClaims(ids, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if rec, ok := ops[id]; ok {
+			q.ops[id] = rec
+		} else {
+			delete(q.ops, id)
+		}
+
+		if c, ok := claims[id]; ok {
+			q.claims[id] = c
+		} else {
+			delete(q.claims, id)
+		}
+	}
+
+	claimed := q.claimed(leaseID, ids)
+
+	if len(claimed) < len(ids) {
+		logger.Infof("[%s-%s] %d of %d operations were claimed by other peers or removed", q.channelID, q.namespace, len(ids)-len(claimed), len(ids))
+	}
+
+	return claimed, nil
+}
+
+// claimed returns the IDs of the given operations that are claimed by this peer under the given lease
+func (q *OffLedgerQueue) claimed(leaseID string, ids []string) []string {
+	var claimed []string
+	for _, id := range ids {
+		c, ok := q.claims[id]
+		if !ok || c.Owner != q.peerID || c.LeaseID != leaseID {
+			continue
+		}
+
+		if _, ok := q.ops[id]; ok {
+			claimed = append(claimed, id)
+		}
+	}
+
+	return claimed
+}
+
+// lease returns the given lease. ErrLeaseNotFound is returned if the lease doesn't exist or has expired.
+func (q *OffLedgerQueue) lease(leaseID string) (*sharedLease, error) {
+	l, ok := q.leases[leaseID]
+	if !ok {
+		return nil, ErrLeaseNotFound
+	}
+
+	if !time.Now().Before(l.expiry) {
+		delete(q.leases, leaseID)
+
+		return nil, ErrLeaseNotFound
+	}
+
+	return l, nil
+}
+
+// delete deletes the given operations (along with their claims) from the shared pool
+func (q *OffLedgerQueue) delete(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var keys []string
+	for _, id := range ids {
+		keys = append(keys, q.opKey(id), q.claimKey(id))
+	}
+
+	if err := q.client.Delete(offLedgerNamespace, q.collection, keys...); err != nil {
+		return errors.WithMessage(err, "unable to delete operations from shared pool")
+	}
+
+	for _, id := range ids {
+		delete(q.ops, id)
+		delete(q.claims, id)
+	}
+
+	return q.pruneIndex()
+}
+
+// releaseClaims deletes this peer's claims on the given operations so that they may be processed by any peer
+func (q *OffLedgerQueue) releaseClaims(ids []string) error {
+	if err := q.deleteClaims(ids); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		delete(q.claims, id)
+	}
+
+	return nil
+}
+
+func (q *OffLedgerQueue) deleteClaims(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var keys []string
+	for _, id := range ids {
+		keys = append(keys, q.claimKey(id))
+	}
+
+	return errors.WithMessage(q.client.Delete(offLedgerNamespace, q.collection, keys...), "unable to delete claims")
+}
+
+// checkPending returns an error if an operation for the same unique suffix is already pending in the shared pool
+func (q *OffLedgerQueue) checkPending(op *batch.OperationInfo) error {
+	for _, rec := range q.ops {
+		if rec.UniqueSuffix != op.UniqueSuffix {
+			continue
+		}
+
+		if hashOf(toOperationInfo(rec)) == hashOf(op) {
+			return errors.WithMessagef(ErrDuplicateOperation, "unique suffix [%s]", op.UniqueSuffix)
+		}
+
+		return errors.WithMessagef(ErrConflictingOperation, "unique suffix [%s]", op.UniqueSuffix)
+	}
+
+	return nil
+}
+
+// checkCapacity returns ErrQueueFull if adding an operation of the given size would exceed the limits of the pool
+func (q *OffLedgerQueue) checkCapacity(size int) error {
+	if q.limits.MaxLength > 0 && uint(len(q.ops)) >= q.limits.MaxLength {
+		logger.Warnf("[%s-%s] Rejecting operation since the shared pool has reached its maximum length of %d", q.channelID, q.namespace, q.limits.MaxLength)
+
+		return errors.WithMessagef(ErrQueueFull, "maximum length of %d reached", q.limits.MaxLength)
+	}
+
+	if q.limits.MaxSize == 0 {
+		return nil
+	}
+
+	total := uint64(size)
+	for _, rec := range q.ops {
+		total += uint64(rec.size)
+	}
+
+	if total > q.limits.MaxSize {
+		logger.Warnf("[%s-%s] Rejecting operation since the shared pool has reached its maximum size of %d bytes", q.channelID, q.namespace, q.limits.MaxSize)
+
+		return errors.WithMessagef(ErrQueueFull, "maximum size of %d bytes reached", q.limits.MaxSize)
+	}
+
+	return nil
+}
+
+// selectIDs selects (up to) the given number of available operations, excluding the given IDs.
+// Operations are selected in the order in which they were added within each priority class.
+func (q *OffLedgerQueue) selectIDs(num uint, exclude map[string]struct{}) []string {
+	ids := q.sortedIDs()
+
+	var lanes [numPriorities][]uint64
+	for i, id := range ids {
+		if _, ok := exclude[id]; ok || !q.isAvailable(id) {
+			continue
+		}
+
+		p := priorityOf(toOperationInfo(q.ops[id]))
+		lanes[p] = append(lanes[p], uint64(i))
+	}
+
+	weight := q.limits.HighPriorityWeight
+	if weight == 0 {
+		weight = defaultHighPriorityWeight
+	}
+
+	var selected []string
+	for _, i := range interleave(lanes[highPriority], lanes[normalPriority], num, weight) {
+		selected = append(selected, ids[i])
+	}
+
+	return selected
+}
+
+// heldIDs returns the IDs of the operations that are held by this peer, i.e. the operations returned by
+// Peek and the leased operations
+func (q *OffLedgerQueue) heldIDs() map[string]struct{} {
+	held := make(map[string]struct{})
+
+	if q.peeked != nil {
+		for _, id := range q.peeked.ids {
+			held[id] = struct{}{}
+		}
+	}
+
+	for _, l := range q.leases {
+		for _, id := range l.ids {
+			held[id] = struct{}{}
+		}
+	}
+
+	return held
+}
+
+// isAvailable returns true if the given operation is not claimed, or if it was claimed by this peer under
+// a lease that no longer exists (for example, if the peer was restarted)
+func (q *OffLedgerQueue) isAvailable(id string) bool {
+	if q.isPeeked(id) {
+		return false
+	}
+
+	c, ok := q.claims[id]
+	if !ok {
+		return true
+	}
+
+	if c.Owner != q.peerID {
+		return false
+	}
+
+	if _, ok := q.leases[c.LeaseID]; ok {
+		return false
+	}
+
+	return q.peeked == nil || q.peeked.id != c.LeaseID
+}
+
+func (q *OffLedgerQueue) isPeeked(id string) bool {
+	if q.peeked == nil {
+		return false
+	}
+
+	for _, peekedID := range q.peeked.ids {
+		if peekedID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// len returns the number of operations that are available to this peer, including the operations returned by Peek
+func (q *OffLedgerQueue) len() uint {
+	n := 0
+	for id := range q.ops {
+		if q.isAvailable(id) {
+			n++
+		}
+	}
+
+	if q.peeked != nil {
+		for _, id := range q.peeked.ids {
+			if _, ok := q.ops[id]; ok {
+				n++
+			}
+		}
+	}
+
+	return uint(n)
+}
+
+func (q *OffLedgerQueue) sortedIDs() []string {
+	ids := make([]string, 0, len(q.ops))
+	for id := range q.ops {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// operations returns the given operations, excluding the operations that no longer exist in the pool
+func (q *OffLedgerQueue) operations(ids []string) []*batch.OperationInfo {
+	var ops []*batch.OperationInfo
+	for _, id := range ids {
+		if rec, ok := q.ops[id]; ok {
+			ops = append(ops, toOperationInfo(rec))
+		}
+	}
+
+	return ops
+}
+
+func (q *OffLedgerQueue) getOperations(keyOf func(string) string, ids []string) (map[string]*sharedOperation, error) {
+	values, err := q.getMultiple(keyOf, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make(map[string]*sharedOperation)
+	for i, b := range values {
+		if len(b) == 0 {
+			// The operation was removed
+			continue
+		}
+
+		rec := &sharedOperation{}
+		if err := json.Unmarshal(b, rec); err != nil {
+			return nil, errors.WithMessagef(err, "unable to unmarshal operation [%s]", ids[i])
+		}
+
+		rec.size = len(b)
+
+		ops[ids[i]] = rec
+	}
+
+	return ops, nil
+}
+
+// getClaims returns the claims on the given operations that haven't expired
+func (q *OffLedgerQueue) getClaims(ids []string, now time.Time) (map[string]*claimRecord, error) {
+	values, err := q.getMultiple(q.claimKey, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]*claimRecord)
+	for i, b := range values {
+		if len(b) == 0 {
+			continue
+		}
+
+		c := &claimRecord{}
+		if err := json.Unmarshal(b, c); err != nil {
+			return nil, errors.WithMessagef(err, "unable to unmarshal claim on operation [%s]", ids[i])
+		}
+
+		if now.Before(c.Expiry) {
+			claims[ids[i]] = c
+		}
+	}
+
+	return claims, nil
+}
+
+func (q *OffLedgerQueue) getMultiple(keyOf func(string) string, ids []string) ([][]byte, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = keyOf(id)
+	}
+
+	values, err := q.client.GetMultipleKeys(offLedgerNamespace, q.collection, keys...)
+	if err != nil {
+		return nil, errors.WithMessage(err, "unable to load from shared pool")
+	}
+
+	if len(values) != len(keys) {
+		return nil, errors.Errorf("expecting %d values from shared pool but got %d", len(keys), len(values))
+	}
+
+	return values, nil
+}
+
+func (q *OffLedgerQueue) getIDs(key string) ([]string, error) {
+	b, err := q.client.Get(offLedgerNamespace, q.collection, key)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "unable to load [%s] from shared pool", key)
+	}
+
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	var ids []string
+	if err := json.Unmarshal(b, &ids); err != nil {
+		return nil, errors.WithMessagef(err, "unable to unmarshal [%s]", key)
+	}
+
+	return ids, nil
+}
+
+func (q *OffLedgerQueue) putIDs(key string, ids []string) error {
+	b, err := json.Marshal(ids)
+	if err != nil {
+		return errors.WithMessagef(err, "unable to marshal [%s]", key)
+	}
+
+	if err := q.client.Put(offLedgerNamespace, q.collection, key, b); err != nil {
+		return errors.WithMessagef(err, "unable to store [%s] in shared pool", key)
+	}
+
+	return nil
+}
+
+// getIndex returns the index of the given member or nil if the member has no index
+func (q *OffLedgerQueue) getIndex(peerID string) (*memberIndex, error) {
+	key := q.indexKey(peerID)
+
+	b, err := q.client.Get(offLedgerNamespace, q.collection, key)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "unable to load [%s] from shared pool", key)
+	}
+
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	index := &memberIndex{}
+	if err := json.Unmarshal(b, index); err != nil {
+		return nil, errors.WithMessagef(err, "unable to unmarshal [%s]", key)
+	}
+
+	return index, nil
+}
+
+// putIndex persists the index of this peer along with the given heartbeat
+func (q *OffLedgerQueue) putIndex(ids []string, heartbeat time.Time) error {
+	key := q.indexKey(q.peerID)
+
+	b, err := json.Marshal(&memberIndex{IDs: ids, Heartbeat: heartbeat})
+	if err != nil {
+		return errors.WithMessagef(err, "unable to marshal [%s]", key)
+	}
+
+	if err := q.client.Put(offLedgerNamespace, q.collection, key, b); err != nil {
+		return errors.WithMessagef(err, "unable to store [%s] in shared pool", key)
+	}
+
+	q.heartbeat = heartbeat
+
+	return nil
+}
+
+func (q *OffLedgerQueue) membersKey() string {
+	return "members~" + q.namespace
+}
+
+func (q *OffLedgerQueue) indexKey(peerID string) string {
+	return "index~" + q.namespace + "~" + peerID
+}
+
+func (q *OffLedgerQueue) deadIndexKey(peerID string) string {
+	return "deadindex~" + q.namespace + "~" + peerID
+}
+
+func (q *OffLedgerQueue) opKey(id string) string {
+	return "op~" + q.namespace + "~" + id
+}
+
+func (q *OffLedgerQueue) claimKey(id string) string {
+	return "claim~" + q.namespace + "~" + id
+}
+
+func (q *OffLedgerQueue) deadKey(id string) string {
+	return "dead~" + q.namespace + "~" + id
+}
+
+func toOperationInfo(rec *sharedOperation) *batch.OperationInfo {
+	return &batch.OperationInfo{
+		UniqueSuffix: rec.UniqueSuffix,
+		Data:         rec.Data,
+	}
+}
+
+// newOperationID returns an ID that sorts in the order in which operations were added to the pool
+func newOperationID(now time.Time, peerID string) string {
+	return fmt.Sprintf("%020d_%s_%d", now.UnixNano(), peerID, atomic.AddUint64(&opSeq, 1))
+}
+
+func distinct(ids []string) []string {
+	idMap := make(map[string]struct{})
+
+	var result []string
+	for _, id := range ids {
+		if _, ok := idMap[id]; !ok {
+			idMap[id] = struct{}{}
+			result = append(result, id)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,536 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operationqueue
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/fabric-peer-ext/pkg/collections/client"
+	"github.com/trustbloc/sidetree-core-go/pkg/api/batch"
+
+	obmocks "github.com/trustbloc/sidetree-fabric/pkg/observer/mocks"
+)
+
+const (
+	peer1 = "peer1.org1.example.com"
+	peer2 = "peer2.org1.example.com"
+
+	opQueueColl = "opqueue"
+)
+
+func TestOffLedgerQueue_SharedPool(t *testing.T) {
+	restoreSettleTime := claimSettleTime
+	claimSettleTime = 0
+	defer func() { claimSettleTime = restoreSettleTime }()
+
+	restoreRefreshInterval := refreshInterval
+	refreshInterval = 0
+	defer func() { refreshInterval = restoreRefreshInterval }()
+
+	c := obmocks.NewMockOffLedgerClient()
+
+	q1, err := newOffLedgerQueue(channel1, namespace1, peer1, opQueueColl, c)
+	require.NoError(t, err)
+	defer q1.Close()
+
+	q2, err := newOffLedgerQueue(channel1, namespace1, peer2, opQueueColl, c)
+	require.NoError(t, err)
+	defer q2.Close()
+
+	members, err := q1.getIDs(q1.membersKey())
+	require.NoError(t, err)
+	require.Equal(t, []string{peer1, peer2}, members)
+
+	_, err = q1.Add(op1)
+	require.NoError(t, err)
+	_, err = q1.Add(op2)
+	require.NoError(t, err)
+
+	require.Equal(t, uint(2), q2.Len())
+
+	_, err = q2.Add(op1)
+	require.Equal(t, ErrDuplicateOperation, errors.Cause(err))
+
+	_, err = q2.Add(op3)
+	require.NoError(t, err)
+	require.Equal(t, uint(3), q1.Len())
+
+	t.Run("Claims", func(t *testing.T) {
+		ops, err := q1.Peek(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, ops)
+
+		ops, err = q2.Peek(3)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op2, op3}, ops)
+
+		require.Equal(t, uint(1), q1.Len())
+		require.Equal(t, uint(2), q2.Len())
+
+		ops, n, err := q2.Remove(2)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op2, op3}, ops)
+		require.Zero(t, n)
+
+		ops, n, err = q1.Remove(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, ops)
+		require.Zero(t, n)
+
+		require.Zero(t, q2.Len())
+		require.Empty(t, q1.index)
+		require.Empty(t, q2.index)
+	})
+
+	t.Run("Failover", func(t *testing.T) {
+		_, err = q1.Add(op1)
+		require.NoError(t, err)
+		_, err = q1.Add(op2)
+		require.NoError(t, err)
+
+		// Peer 1 claims the operations and then fails (the claims are never released)
+		l, err := q1.Lease(2, 10*time.Millisecond)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1, op2}, l.Operations)
+
+		require.Zero(t, q2.Len())
+
+		time.Sleep(20 * time.Millisecond)
+
+		require.Equal(t, uint(2), q2.Len())
+
+		ops, _, err := q2.Remove(2)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1, op2}, ops)
+
+		_, err = q1.Commit(l.ID)
+		require.Equal(t, ErrLeaseNotFound, err)
+
+		require.Zero(t, q1.Len())
+		require.Empty(t, q1.index)
+	})
+
+	t.Run("Restart", func(t *testing.T) {
+		_, err = q1.Add(op1)
+		require.NoError(t, err)
+
+		ops, err := q1.Peek(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, ops)
+
+		// The restarted peer takes over the claims of the previous instance
+		q, err := newOffLedgerQueue(channel1, namespace1, peer1, opQueueColl, c)
+		require.NoError(t, err)
+
+		require.Equal(t, []string{q1.index[0]}, q.index)
+		require.Equal(t, uint(1), q.Len())
+		require.Zero(t, q2.Len())
+
+		ops, _, err = q.Remove(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, ops)
+
+		q.Close()
+
+		require.Zero(t, q1.Len())
+	})
+
+	t.Run("Close releases claims", func(t *testing.T) {
+		q, err := newOffLedgerQueue(channel1, namespace1, peer1, opQueueColl, c)
+		require.NoError(t, err)
+
+		_, err = q.Add(op1)
+		require.NoError(t, err)
+
+		ops, err := q.Peek(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, ops)
+		require.Zero(t, q2.Len())
+
+		q.Close()
+
+		ops, _, err = q2.Remove(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, ops)
+	})
+}
+
+func TestOffLedgerQueue_LostClaim(t *testing.T) {
+	restoreSettleTime := claimSettleTime
+	claimSettleTime = 0
+	defer func() { claimSettleTime = restoreSettleTime }()
+
+	restoreRefreshInterval := refreshInterval
+	refreshInterval = 0
+	defer func() { refreshInterval = restoreRefreshInterval }()
+
+	c := &racingClient{MockOffLedgerClient: obmocks.NewMockOffLedgerClient()}
+
+	q, err := newOffLedgerQueue(channel1, namespace1, peer1, opQueueColl, c)
+	require.NoError(t, err)
+	defer q.Close()
+
+	_, err = q.Add(op1)
+	require.NoError(t, err)
+	_, err = q.Add(op2)
+	require.NoError(t, err)
+
+	// Another peer claims the first operation at the same time
+	c.racingClaimKey = q.claimKey(q.index[0])
+
+	ops, err := q.Peek(2)
+	require.NoError(t, err)
+	require.Equal(t, []*batch.OperationInfo{op2}, ops)
+
+	ops, n, err := q.Remove(2)
+	require.NoError(t, err)
+	require.Equal(t, []*batch.OperationInfo{op2}, ops)
+	require.Zero(t, n)
+
+	stats := q.Stats()
+	require.Zero(t, stats.Length)
+	require.NotZero(t, stats.Size)
+}
+
+func TestOffLedgerQueue_Remove(t *testing.T) {
+	restoreSettleTime := claimSettleTime
+	claimSettleTime = 0
+	defer func() { claimSettleTime = restoreSettleTime }()
+
+	restoreRefreshInterval := refreshInterval
+	refreshInterval = 0
+	defer func() { refreshInterval = restoreRefreshInterval }()
+
+	c := obmocks.NewMockOffLedgerClient()
+
+	q, err := newOffLedgerQueue(channel1, namespace1, peer1, opQueueColl, c)
+	require.NoError(t, err)
+	defer q.Close()
+
+	t.Run("Only peeked operations are removed", func(t *testing.T) {
+		_, err = q.Add(op1)
+		require.NoError(t, err)
+
+		ops, err := q.Peek(2)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, ops)
+
+		// The operation that's added after the batch was cut must not be removed
+		_, err = q.Add(op2)
+		require.NoError(t, err)
+
+		ops, n, err := q.Remove(2)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, ops)
+		require.Equal(t, uint(1), n)
+
+		ops, n, err = q.Remove(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op2}, ops)
+		require.Zero(t, n)
+	})
+
+	t.Run("Excess operations are released", func(t *testing.T) {
+		_, err = q.Add(op1)
+		require.NoError(t, err)
+		_, err = q.Add(op2)
+		require.NoError(t, err)
+
+		ops, err := q.Peek(2)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1, op2}, ops)
+
+		ops, err = q.Peek(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, ops)
+		require.Len(t, q.claims, 1)
+
+		ops, n, err := q.Remove(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, ops)
+		require.Equal(t, uint(1), n)
+
+		ops, n, err = q.Remove(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op2}, ops)
+		require.Zero(t, n)
+	})
+
+	t.Run("Peeked operations don't expire", func(t *testing.T) {
+		_, err = q.Add(op1)
+		require.NoError(t, err)
+
+		ops, err := q.Peek(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, ops)
+
+		// The claim expires (e.g. the batch took a long time to write)
+		require.NoError(t, c.Delete(offLedgerNamespace, opQueueColl, q.claimKey(q.index[0])))
+
+		q.SetLimits(Limits{MaxAge: time.Nanosecond})
+		defer q.SetLimits(Limits{})
+
+		require.NoError(t, q.Sweep())
+		require.Equal(t, uint(1), q.Len())
+
+		ops, n, err := q.Remove(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, ops)
+		require.Zero(t, n)
+	})
+}
+
+func TestOffLedgerQueue_ClaimSettle(t *testing.T) {
+	restoreSettleTime := claimSettleTime
+	claimSettleTime = time.Second
+	defer func() { claimSettleTime = restoreSettleTime }()
+
+	c := &signallingClient{MockOffLedgerClient: obmocks.NewMockOffLedgerClient(), claimed: make(chan struct{}, 1)}
+
+	q, err := newOffLedgerQueue(channel1, namespace1, peer1, opQueueColl, c)
+	require.NoError(t, err)
+	defer q.Close()
+
+	_, err = q.Add(op1)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ops, err := q.Peek(1)
+		require.NoError(t, err)
+		require.Equal(t, []*batch.OperationInfo{op1}, ops)
+	}()
+
+	<-c.claimed
+
+	// Operations may be added while the claims settle
+	_, err = q.Add(op2)
+	require.NoError(t, err)
+
+	select {
+	case <-done:
+		t.Fatal("expecting Add to complete before the claims settle")
+	default:
+	}
+
+	<-done
+
+	require.Equal(t, uint(2), q.Len())
+}
+
+func TestOffLedgerQueue_Refresh(t *testing.T) {
+	restoreRefreshInterval := refreshInterval
+	refreshInterval = time.Hour
+	defer func() { refreshInterval = restoreRefreshInterval }()
+
+	c := obmocks.NewMockOffLedgerClient()
+
+	q1, err := newOffLedgerQueue(channel1, namespace1, peer1, opQueueColl, c)
+	require.NoError(t, err)
+	defer q1.Close()
+
+	q2, err := newOffLedgerQueue(channel1, namespace1, peer2, opQueueColl, c)
+	require.NoError(t, err)
+	defer q2.Close()
+
+	_, err = q1.Add(op1)
+	require.NoError(t, err)
+	require.Equal(t, uint(1), q1.Len())
+
+	// The view of the other peer isn't refreshed until the refresh interval has elapsed
+	require.Zero(t, q2.Len())
+
+	require.NoError(t, q2.Sweep())
+	require.Equal(t, uint(1), q2.Len())
+}
+
+func TestOffLedgerQueue_MemberTimeout(t *testing.T) {
+	restoreSettleTime := claimSettleTime
+	claimSettleTime = 0
+	defer func() { claimSettleTime = restoreSettleTime }()
+
+	restoreRefreshInterval := refreshInterval
+	refreshInterval = 0
+	defer func() { refreshInterval = restoreRefreshInterval }()
+
+	restoreMemberTimeout := memberTimeout
+	memberTimeout = 400 * time.Millisecond
+	defer func() { memberTimeout = restoreMemberTimeout }()
+
+	c := obmocks.NewMockOffLedgerClient()
+
+	q1, err := newOffLedgerQueue(channel1, namespace1, peer1, opQueueColl, c)
+	require.NoError(t, err)
+	defer q1.Close()
+
+	q2, err := newOffLedgerQueue(channel1, namespace1, peer2, opQueueColl, c)
+	require.NoError(t, err)
+
+	_, err = q2.Add(op1)
+	require.NoError(t, err)
+
+	require.NoError(t, q2.deadLetter([]string{q2.index[0]}))
+
+	// Both members refresh (and update their heartbeats) within the timeout
+	time.Sleep(250 * time.Millisecond)
+	require.Equal(t, uint(1), q2.Len())
+	time.Sleep(250 * time.Millisecond)
+	require.Equal(t, uint(1), q1.Len())
+
+	members, err := q1.getIDs(q1.membersKey())
+	require.NoError(t, err)
+	require.Equal(t, []string{peer1, peer2}, members)
+	require.Empty(t, q1.index)
+
+	// peer2 fails
+	time.Sleep(500 * time.Millisecond)
+	require.Equal(t, uint(1), q1.Len())
+
+	// The operations of peer2 were taken over by peer1
+	require.Len(t, q1.index, 1)
+	require.Len(t, q1.dead, 1)
+
+	members, err = q1.getIDs(q1.membersKey())
+	require.NoError(t, err)
+	require.Equal(t, []string{peer1}, members)
+
+	index, err := q1.getIndex(peer2)
+	require.NoError(t, err)
+	require.Nil(t, index)
+
+	index, err = q1.getIndex(peer1)
+	require.NoError(t, err)
+	require.Equal(t, q1.index, index.IDs)
+
+	ops, err := q1.Peek(1)
+	require.NoError(t, err)
+	require.Equal(t, []*batch.OperationInfo{op1}, ops)
+}
+
+func TestOffLedgerQueue_Error(t *testing.T) {
+	restoreRefreshInterval := refreshInterval
+	refreshInterval = 0
+	defer func() { refreshInterval = restoreRefreshInterval }()
+
+	errExpected := errors.New("injected off-ledger error")
+
+	t.Run("Open error", func(t *testing.T) {
+		c := obmocks.NewMockOffLedgerClient().WithGetError(errExpected)
+
+		q, err := newOffLedgerQueue(channel1, namespace1, peer1, opQueueColl, c)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errExpected.Error())
+		require.Nil(t, q)
+	})
+
+	t.Run("Add error", func(t *testing.T) {
+		c := obmocks.NewMockOffLedgerClient()
+
+		q, err := newOffLedgerQueue(channel1, namespace1, peer1, opQueueColl, c)
+		require.NoError(t, err)
+		defer q.Close()
+
+		c.WithPutError(errExpected)
+
+		_, err = q.Add(op1)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errExpected.Error())
+	})
+
+	t.Run("Invalid operation", func(t *testing.T) {
+		c := obmocks.NewMockOffLedgerClient()
+
+		q, err := newOffLedgerQueue(channel1, namespace1, peer1, opQueueColl, c)
+		require.NoError(t, err)
+		defer q.Close()
+
+		require.NoError(t, q.putIDs(q.membersKey(), []string{peer1, peer2}))
+		indexBytes, err := json.Marshal(&memberIndex{IDs: []string{"id1"}, Heartbeat: time.Now()})
+		require.NoError(t, err)
+		require.NoError(t, c.Put(offLedgerNamespace, opQueueColl, q.indexKey(peer2), indexBytes))
+		require.NoError(t, c.Put(offLedgerNamespace, opQueueColl, q.opKey("id1"), []byte("{")))
+
+		_, err = q.Peek(1)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unable to unmarshal operation [id1]")
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		q, err := newOffLedgerQueue(channel1, namespace1, peer1, opQueueColl, obmocks.NewMockOffLedgerClient())
+		require.NoError(t, err)
+
+		q.Close()
+
+		_, err = q.Add(op1)
+		require.EqualError(t, err, errClosed.Error())
+		_, err = q.Peek(1)
+		require.EqualError(t, err, errClosed.Error())
+		_, _, err = q.Remove(1)
+		require.EqualError(t, err, errClosed.Error())
+		_, err = q.Lease(1, time.Minute)
+		require.EqualError(t, err, errClosed.Error())
+		_, err = q.Commit("lease1")
+		require.EqualError(t, err, errClosed.Error())
+		require.EqualError(t, q.Release("lease1"), errClosed.Error())
+		require.EqualError(t, q.Sweep(), errClosed.Error())
+		_, err = q.DeadLetters()
+		require.EqualError(t, err, errClosed.Error())
+		require.Zero(t, q.Len())
+	})
+}
+
+// racingClient overwrites the claim for the given key with a claim from another peer
+// (as if the other peer claimed the same operation at the same time)
+type racingClient struct {
+	*obmocks.MockOffLedgerClient
+
+	racingClaimKey string
+}
+
+func (c *racingClient) PutMultipleValues(ns, coll string, kvs []*client.KeyValue) error {
+	if err := c.MockOffLedgerClient.PutMultipleValues(ns, coll, kvs); err != nil {
+		return err
+	}
+
+	if c.racingClaimKey == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(&claimRecord{Owner: peer2, LeaseID: "lease2", Expiry: time.Now().Add(time.Minute)})
+	if err != nil {
+		return err
+	}
+
+	return c.Put(ns, coll, c.racingClaimKey, b)
+}
+
+// signallingClient signals when claims are written
+type signallingClient struct {
+	*obmocks.MockOffLedgerClient
+
+	claimed chan struct{}
+}
+
+func (c *signallingClient) PutMultipleValues(ns, coll string, kvs []*client.KeyValue) error {
+	if err := c.MockOffLedgerClient.PutMultipleValues(ns, coll, kvs); err != nil {
+		return err
+	}
+
+	select {
+	case c.claimed <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operationqueue
+
+import (
+	"encoding/json"
+
+	"github.com/trustbloc/sidetree-core-go/pkg/api/batch"
+)
+
+// priority is the priority class of an operation
+type priority int
+
+const (
+	// highPriority is the priority class of operations that protect a (possibly compromised) DID, i.e. recover and delete
+	highPriority priority = iota
+	// normalPriority is the priority class of all other operations
+	normalPriority
+
+	numPriorities = 2
+)
+
+// defaultHighPriorityWeight is used if the high-priority weight is not set in the queue limits
+const defaultHighPriorityWeight = 4
+
+// priorityOf returns the priority class of the given operation. Operations whose type
+// can't be determined (for example, if the data isn't a valid operation) are normal priority.
+func priorityOf(op *batch.OperationInfo) priority {
+	typeOnly := &struct {
+		Type batch.OperationType `json:"type"`
+	}{}
+
+	if err := json.Unmarshal(op.Data, typeOnly); err != nil {
+		return normalPriority
+	}
+
+	switch typeOnly.Type {
+	case batch.OperationTypeRecover, batch.OperationTypeDelete:
+		return highPriority
+	default:
+		return normalPriority
+	}
+}
+
+// interleave merges (up to) num keys from the high and normal priority lanes. Up to 'weight' high-priority
+// keys are taken for every normal-priority key so that normal-priority operations aren't starved. The
+// order of the keys within each lane is preserved.
+func interleave(high, normal []uint64, num, weight uint) []uint64 {
+	var keys []uint64
+
+	h, n := 0, 0
+	for uint(len(keys)) < num && (h < len(high) || n < len(normal)) {
+		for i := uint(0); i < weight && h < len(high) && uint(len(keys)) < num; i++ {
+			keys = append(keys, high[h])
+			h++
+		}
+
+		if n < len(normal) && uint(len(keys)) < num {
+			keys = append(keys, normal[n])
+			n++
+		}
+	}
+
+	return keys
+}
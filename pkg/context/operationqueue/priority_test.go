@@ -0,0 +1,34 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operationqueue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/sidetree-core-go/pkg/api/batch"
+)
+
+func TestPriorityOf(t *testing.T) {
+	require.Equal(t, highPriority, priorityOf(newOp(t, "did1", batch.OperationTypeRecover)))
+	require.Equal(t, highPriority, priorityOf(newOp(t, "did1", batch.OperationTypeDelete)))
+	require.Equal(t, normalPriority, priorityOf(newOp(t, "did1", batch.OperationTypeCreate)))
+	require.Equal(t, normalPriority, priorityOf(newOp(t, "did1", batch.OperationTypeUpdate)))
+	require.Equal(t, normalPriority, priorityOf(&batch.OperationInfo{Data: []byte("invalid")}))
+}
+
+func TestInterleave(t *testing.T) {
+	high := []uint64{1, 2, 3, 4, 5}
+	normal := []uint64{10, 11, 12}
+
+	require.Equal(t, []uint64{1, 2, 10, 3, 4, 11, 5, 12}, interleave(high, normal, 10, 2))
+	require.Equal(t, []uint64{1, 2, 10, 3}, interleave(high, normal, 4, 2))
+	require.Equal(t, []uint64{1, 2, 3, 4, 5, 10, 11, 12}, interleave(high, normal, 10, 10))
+	require.Equal(t, []uint64{10, 11}, interleave(nil, normal, 2, 2))
+	require.Equal(t, []uint64{1, 2, 3}, interleave(high, nil, 3, 2))
+	require.Empty(t, interleave(high, normal, 0, 2))
+}
@@ -8,13 +8,22 @@ package operationqueue
 
 import (
 	"sync"
+	"time"
 
 	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/pkg/errors"
 	"github.com/trustbloc/sidetree-core-go/pkg/batch/cutter"
 )
 
 var logger = flogging.MustGetLogger("sidetree_opqueue")
 
+// sweepInterval is the interval at which expired operations are removed from the queues (and at which the depth of
+// the queues is logged). It may be overridden by unit tests.
+var sweepInterval = time.Minute
+
+// nearLimitPercent is the percentage of a capacity limit above which a warning is logged for the queue
+const nearLimitPercent = 90
+
 type key struct {
 	channelID string
 	namespace string
@@ -22,23 +31,38 @@ type key struct {
 
 // Provider manages operation queues
 type Provider struct {
-	baseDir string
-	queues  map[key]*LevelDBQueue
+	backend Backend
+	queues  map[key]Queue
 	mutex   sync.RWMutex
+	done    chan struct{}
 }
 
 type peerConfig interface {
+	PeerID() string
+	OperationQueueBackend() string
+	OperationQueueCollection() string
 	LevelDBOpQueueBasePath() string
 }
 
-// NewProvider returns a new Operation LevelDBQueue provider
-func NewProvider(cfg peerConfig) *Provider {
-	logger.Infof("Creating Sidetree operation queue provider")
+// NewProvider returns a new operation queue provider. The queues are created by the backend that's
+// configured for the peer. A panic results if the configured backend is not supported.
+func NewProvider(cfg peerConfig, offLedgerProvider offLedgerClientProvider) *Provider {
+	backend, err := newBackend(cfg, offLedgerProvider)
+	if err != nil {
+		logger.Panicf("Error creating Sidetree operation queue provider: %s", err)
+	}
+
+	logger.Infof("Creating Sidetree operation queue provider with backend [%s]", cfg.OperationQueueBackend())
 
-	return &Provider{
-		baseDir: cfg.LevelDBOpQueueBasePath(),
-		queues:  make(map[key]*LevelDBQueue),
+	p := &Provider{
+		backend: backend,
+		queues:  make(map[key]Queue),
+		done:    make(chan struct{}),
 	}
+
+	go p.sweep(sweepInterval)
+
+	return p
 }
 
 // Create returns the operation queue for the given channel
@@ -57,7 +81,7 @@ func (p *Provider) Create(channelID, namespace string) (cutter.OperationQueue, e
 		defer p.mutex.Unlock()
 
 		var err error
-		q, err = newLevelDBQueue(channelID, namespace, p.baseDir)
+		q, err = p.backend.Open(channelID, namespace)
 		if err != nil {
 			return nil, err
 		}
@@ -68,10 +92,66 @@ func (p *Provider) Create(channelID, namespace string) (cutter.OperationQueue, e
 	return q, nil
 }
 
+// Remove closes the operation queue for the given channel and namespace (for example, when the namespace is removed
+// from the peer config). If the queue is empty then the database is dropped. Otherwise the database is archived
+// so that the pending operations aren't lost. (The archived database may be restored manually if required.)
+func (p *Provider) Remove(channelID, namespace string) error {
+	k := key{
+		channelID: channelID,
+		namespace: namespace,
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	q, ok := p.queues[k]
+	if !ok {
+		logger.Debugf("[%s-%s] Operation queue not found", channelID, namespace)
+		return nil
+	}
+
+	delete(p.queues, k)
+
+	// Remove any expired operations before determining whether or not the queue is empty
+	if err := q.Sweep(); err != nil {
+		logger.Warnf("[%s-%s] Error sweeping operation queue: %s", channelID, namespace, err)
+	}
+
+	stats := q.Stats()
+	pending := stats.Length + stats.Leased
+
+	q.Close()
+
+	if pending == 0 {
+		logger.Infof("[%s-%s] Dropping empty operation queue", channelID, namespace)
+
+		return q.Drop()
+	}
+
+	archiveDir, err := q.Archive()
+	if err != nil {
+		if errors.Cause(err) != errArchiveNotSupported {
+			return err
+		}
+
+		logger.Warnf("[%s-%s] !!! The operation queue was removed while it still contained %d pending operation(s). "+
+			"The operations will NOT be processed and have been discarded.", channelID, namespace, pending)
+
+		return q.Drop()
+	}
+
+	logger.Warnf("[%s-%s] !!! The operation queue was removed while it still contained %d pending operation(s). "+
+		"The operations will NOT be processed by this peer. The queue was archived to [%s].", channelID, namespace, pending, archiveDir)
+
+	return nil
+}
+
 // Close closes all databases
 func (p *Provider) Close() {
 	logger.Info("Closing operation queues...")
 
+	close(p.done)
+
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
 
@@ -79,3 +159,52 @@ func (p *Provider) Close() {
 		q.Close()
 	}
 }
+
+// sweep periodically removes expired operations from all queues and logs the depth of each queue. This ensures that
+// expired operations are removed even if the queue is not being read (for example, if the peer is not a batch writer).
+func (p *Provider) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.mutex.RLock()
+			for k, q := range p.queues {
+				if err := q.Sweep(); err != nil {
+					logger.Warnf("[%s-%s] Error sweeping operation queue: %s", k.channelID, k.namespace, err)
+				}
+
+				logStats(q.Stats())
+			}
+			p.mutex.RUnlock()
+		case <-p.done:
+			logger.Debug("Exiting operation queue sweeper")
+			return
+		}
+	}
+}
+
+// logStats logs the depth of a queue. The stats are logged at DEBUG level unless the queue is nearing one of its
+// capacity limits, in which case a warning is logged.
+func logStats(stats *Stats) {
+	if nearLimit(stats) {
+		logger.Warnf("[%s-%s] Operation queue is nearing its capacity limits - Length: %d, Leased: %d, MaxLength: %d, Size: %d bytes, MaxSize: %d bytes, Expired: %d",
+			stats.ChannelID, stats.Namespace, stats.Length, stats.Leased, stats.Limits.MaxLength, stats.Size, stats.Limits.MaxSize, stats.Expired)
+
+		return
+	}
+
+	logger.Debugf("[%s-%s] Operation queue stats - Length: %d, Leased: %d, Size: %d bytes, Expired: %d",
+		stats.ChannelID, stats.Namespace, stats.Length, stats.Leased, stats.Size, stats.Expired)
+}
+
+// nearLimit returns true if the number of operations or the total size of the queue has reached
+// nearLimitPercent of the configured maximum
+func nearLimit(stats *Stats) bool {
+	if stats.Limits.MaxLength > 0 && (stats.Length+stats.Leased)*100 >= stats.Limits.MaxLength*nearLimitPercent {
+		return true
+	}
+
+	return stats.Limits.MaxSize > 0 && stats.Size*100 >= stats.Limits.MaxSize*nearLimitPercent
+}
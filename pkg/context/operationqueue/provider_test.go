@@ -7,10 +7,14 @@ SPDX-License-Identifier: Apache-2.0
 package operationqueue
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/hyperledger/fabric/common/flogging"
 	"github.com/stretchr/testify/require"
 	"github.com/trustbloc/sidetree-core-go/pkg/batch/cutter"
 	"github.com/trustbloc/sidetree-fabric/pkg/context/operationqueue/mocks"
@@ -37,7 +41,7 @@ func TestProvider(t *testing.T) {
 	peerConfig := &mocks.PeerConfig{}
 	peerConfig.LevelDBOpQueueBasePathReturns(levelDBBasePath)
 
-	p := NewProvider(peerConfig)
+	p := NewProvider(peerConfig, nil)
 	require.NotNil(t, p)
 
 	q1, err := p.Create(channel_x, namespace1)
@@ -52,7 +56,179 @@ func TestProvider(t *testing.T) {
 
 	require.False(t, q1 == q2)
 
+	_, err = q1.Add(op1)
+	require.NoError(t, err)
+
+	stats := queueStats(p)
+	require.Len(t, stats, 2)
+
+	for _, s := range stats {
+		require.Equal(t, namespace1, s.Namespace)
+		if s.ChannelID == channel_x {
+			require.Equal(t, uint(1), s.Length)
+			require.NotZero(t, s.Size)
+		} else {
+			require.Zero(t, s.Length)
+			require.Zero(t, s.Size)
+		}
+	}
+
+	p.Close()
+}
+
+func TestProvider_Sweep(t *testing.T) {
+	restoreInterval := sweepInterval
+	sweepInterval = 10 * time.Millisecond
+	defer func() { sweepInterval = restoreInterval }()
+
+	peerConfig := &mocks.PeerConfig{}
+	peerConfig.LevelDBOpQueueBasePathReturns(levelDBBasePath)
+
+	p := NewProvider(peerConfig, nil)
+	require.NotNil(t, p)
+
+	q, err := p.Create(channel_x, namespace1)
+	require.NoError(t, err)
+	defer cleanup(q)
+
+	q.(*LevelDBQueue).SetLimits(Limits{MaxAge: 20 * time.Millisecond})
+
+	_, err = q.Add(op1)
+	require.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+
+	stats := queueStats(p)
+	require.Len(t, stats, 1)
+	require.Zero(t, stats[0].Length)
+	require.Equal(t, uint64(1), stats[0].Expired)
+
+	p.Close()
+}
+
+func TestProvider_LogStats(t *testing.T) {
+	restoreInterval := sweepInterval
+	sweepInterval = 10 * time.Millisecond
+	defer func() { sweepInterval = restoreInterval }()
+
+	w := &logWriter{}
+	restoreWriter := flogging.SetWriter(w)
+	defer flogging.SetWriter(restoreWriter)
+
+	peerConfig := &mocks.PeerConfig{}
+	peerConfig.OperationQueueBackendReturns(MemoryBackend)
+
+	p := NewProvider(peerConfig, nil)
+	require.NotNil(t, p)
+
+	q, err := p.Create(channel_x, namespace1)
+	require.NoError(t, err)
+
+	_, err = q.Add(op1)
+	require.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+
+	// The stats are logged at DEBUG level when the queue isn't near its limits
+	require.NotContains(t, w.String(), "Operation queue")
+
+	q.(Queue).SetLimits(Limits{MaxLength: 1})
+
+	time.Sleep(100 * time.Millisecond)
+
 	p.Close()
+
+	require.Contains(t, w.String(), "[channel_x-"+namespace1+"] Operation queue is nearing its capacity limits - Length: 1, Leased: 0, MaxLength: 1")
+}
+
+func TestNearLimit(t *testing.T) {
+	require.False(t, nearLimit(&Stats{Length: 1000, Size: 1000}))
+	require.False(t, nearLimit(&Stats{Length: 8, Leased: 0, Limits: Limits{MaxLength: 10}}))
+	require.True(t, nearLimit(&Stats{Length: 8, Leased: 1, Limits: Limits{MaxLength: 10}}))
+	require.False(t, nearLimit(&Stats{Size: 899, Limits: Limits{MaxSize: 1000}}))
+	require.True(t, nearLimit(&Stats{Size: 900, Limits: Limits{MaxSize: 1000}}))
+}
+
+func TestProvider_Remove(t *testing.T) {
+	defer func() {
+		if err := os.RemoveAll(levelDBBasePath); err != nil {
+			t.Errorf("Error removing temp dir [%s]: %s", levelDBBasePath, err)
+		}
+	}()
+
+	peerConfig := &mocks.PeerConfig{}
+	peerConfig.LevelDBOpQueueBasePathReturns(levelDBBasePath)
+
+	p := NewProvider(peerConfig, nil)
+	require.NotNil(t, p)
+	defer p.Close()
+
+	t.Run("Not found", func(t *testing.T) {
+		require.NoError(t, p.Remove(channel_x, namespace1))
+	})
+
+	t.Run("Empty queue -> dropped", func(t *testing.T) {
+		q, err := p.Create(channel_x, namespace1)
+		require.NoError(t, err)
+
+		dir := q.(*LevelDBQueue).dir
+
+		require.NoError(t, p.Remove(channel_x, namespace1))
+		require.Empty(t, queueStats(p))
+
+		_, err = os.Stat(dir)
+		require.True(t, os.IsNotExist(err))
+
+		_, err = q.Add(op1)
+		require.EqualError(t, err, errClosed.Error())
+	})
+
+	t.Run("Pending operations -> archived", func(t *testing.T) {
+		q, err := p.Create(channel_y, namespace1)
+		require.NoError(t, err)
+
+		_, err = q.Add(op1)
+		require.NoError(t, err)
+
+		dir := q.(*LevelDBQueue).dir
+
+		require.NoError(t, p.Remove(channel_y, namespace1))
+		require.Empty(t, queueStats(p))
+
+		_, err = os.Stat(dir)
+		require.True(t, os.IsNotExist(err))
+
+		archives, err := filepath.Glob(dir + "_archived_*")
+		require.NoError(t, err)
+		require.Len(t, archives, 1)
+	})
+}
+
+func TestProvider_MemoryBackend(t *testing.T) {
+	peerConfig := &mocks.PeerConfig{}
+	peerConfig.OperationQueueBackendReturns(MemoryBackend)
+
+	p := NewProvider(peerConfig, nil)
+	require.NotNil(t, p)
+	defer p.Close()
+
+	q, err := p.Create(channel_x, namespace1)
+	require.NoError(t, err)
+	require.NotNil(t, q)
+
+	_, err = q.Add(op1)
+	require.NoError(t, err)
+
+	stats := queueStats(p)
+	require.Len(t, stats, 1)
+	require.Equal(t, uint(1), stats[0].Length)
+
+	// The in-memory queue can't be archived so the pending operation is discarded
+	require.NoError(t, p.Remove(channel_x, namespace1))
+	require.Empty(t, queueStats(p))
+
+	_, err = q.Add(op1)
+	require.EqualError(t, err, errClosed.Error())
 }
 
 func cleanup(q cutter.OperationQueue) {
@@ -61,3 +237,35 @@ func cleanup(q cutter.OperationQueue) {
 		logger.Infof("Error dropping queue: %s", err)
 	}
 }
+
+type logWriter struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.buf.Write(p)
+}
+
+func (w *logWriter) String() string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.buf.String()
+}
+
+// queueStats returns the stats of all queues opened by the provider
+func queueStats(p *Provider) []*Stats {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	var stats []*Stats
+	for _, q := range p.queues {
+		stats = append(stats, q.Stats())
+	}
+
+	return stats
+}
@@ -0,0 +1,94 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package httpserver
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/trustbloc/sidetree-core-go/pkg/restapi/common"
+)
+
+const (
+	authHeader   = "Authorization"
+	bearerPrefix = "Bearer "
+)
+
+var (
+	errUnauthorized = errors.New("unauthorized")
+	errForbidden    = errors.New("forbidden")
+)
+
+// Authorizer authorizes HTTP requests
+type Authorizer interface {
+	// Authorize returns true if the request is authorized
+	Authorize(req *http.Request) bool
+}
+
+// authHandler wraps an HTTP handler and only invokes it for authorized requests
+type authHandler struct {
+	common.HTTPHandler
+	authorizers []Authorizer
+}
+
+// NewAuthHandler returns an HTTP handler that passes a request on to the given handler only if it is authorized by at
+// least one of the given authorizers. If no authorizers are provided then the given handler is returned as is.
+// A request that is not authorized is rejected with status 401 (Unauthorized) if it carries no credentials
+// (i.e. neither an Authorization header nor a verified client certificate) and with status 403 (Forbidden) otherwise.
+func NewAuthHandler(handler common.HTTPHandler, authorizers ...Authorizer) common.HTTPHandler {
+	if len(authorizers) == 0 {
+		return handler
+	}
+
+	return &authHandler{
+		HTTPHandler: handler,
+		authorizers: authorizers,
+	}
+}
+
+// Handler returns the request handler
+func (h *authHandler) Handler() common.HTTPRequestHandler {
+	handle := h.HTTPHandler.Handler()
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		for _, a := range h.authorizers {
+			if a.Authorize(req) {
+				handle(w, req)
+				return
+			}
+		}
+
+		if !hasCredentials(req) {
+			logger.Debugf("Rejecting request to [%s] without credentials", req.URL.Path)
+
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			common.WriteError(w, http.StatusUnauthorized, errUnauthorized)
+
+			return
+		}
+
+		logger.Infof("Rejecting unauthorized request to [%s] from [%s]", req.URL.Path, req.RemoteAddr)
+
+		common.WriteError(w, http.StatusForbidden, errForbidden)
+	}
+}
+
+func hasCredentials(req *http.Request) bool {
+	return req.Header.Get(authHeader) != "" || verifiedClientCert(req) != nil
+}
+
+// bearerToken returns the token from the request's Authorization header or an empty string
+// if the request doesn't have a bearer token
+func bearerToken(req *http.Request) string {
+	value := req.Header.Get(authHeader)
+	if len(value) <= len(bearerPrefix) || !strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+		return ""
+	}
+
+	return strings.TrimSpace(value[len(bearerPrefix):])
+}
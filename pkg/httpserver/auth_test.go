@@ -0,0 +1,303 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package httpserver
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	token1 = "token1"
+	token2 = "token2"
+	issuer = "https://issuer.example.com"
+	aud    = "sidetree"
+)
+
+func TestNewAuthHandler(t *testing.T) {
+	h := newPingHandler()
+
+	t.Run("No authorizers", func(t *testing.T) {
+		require.Equal(t, h, NewAuthHandler(h))
+	})
+
+	tokenAuth, err := NewTokenAuthorizer(HashToken(token1))
+	require.NoError(t, err)
+
+	certAuth, err := NewClientCertAuthorizer("CN=client")
+	require.NoError(t, err)
+
+	ah := NewAuthHandler(h, tokenAuth, certAuth)
+	require.Equal(t, pingPath, ah.Path())
+	require.Equal(t, http.MethodGet, ah.Method())
+
+	t.Run("Authorized by token", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		ah.Handler()(rw, newRequest(token1, nil))
+		require.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("Authorized by client cert", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		ah.Handler()(rw, newRequest("", newClientCert(pkix.Name{CommonName: "client"})))
+		require.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("No credentials", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		ah.Handler()(rw, newRequest("", nil))
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Equal(t, "Bearer", rw.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		ah.Handler()(rw, newRequest(token2, nil))
+		require.Equal(t, http.StatusForbidden, rw.Code)
+	})
+
+	t.Run("Client cert not authorized", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		ah.Handler()(rw, newRequest("", newClientCert(pkix.Name{CommonName: "other"})))
+		require.Equal(t, http.StatusForbidden, rw.Code)
+	})
+}
+
+func TestTokenAuthorizer(t *testing.T) {
+	t.Run("Invalid config", func(t *testing.T) {
+		_, err := NewTokenAuthorizer()
+		require.EqualError(t, err, "at least one token hash is required")
+
+		_, err = NewTokenAuthorizer("!!!")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid token hash")
+
+		_, err = NewTokenAuthorizer(base64.RawURLEncoding.EncodeToString([]byte("short")))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "expecting a SHA-256 hash")
+	})
+
+	hash2 := sha256.Sum256([]byte(token2))
+
+	// Padded hashes should also be accepted
+	a, err := NewTokenAuthorizer(HashToken(token1), base64.URLEncoding.EncodeToString(hash2[:]))
+	require.NoError(t, err)
+
+	require.True(t, a.Authorize(newRequest(token1, nil)))
+	require.True(t, a.Authorize(newRequest(token2, nil)))
+	require.False(t, a.Authorize(newRequest("token3", nil)))
+	require.False(t, a.Authorize(newRequest("", nil)))
+
+	req := newRequest("", nil)
+	req.Header.Set(authHeader, "Basic "+token1)
+	require.False(t, a.Authorize(req))
+}
+
+func TestJWTAuthorizer(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	edPubKey, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	t.Run("Invalid config", func(t *testing.T) {
+		_, err := NewJWTAuthorizer(issuer, aud)
+		require.EqualError(t, err, "at least one public key is required")
+
+		_, err = NewJWTAuthorizer(issuer, aud, "invalid")
+		require.EqualError(t, err, "no PEM data found in public key")
+
+		_, err = NewJWTAuthorizer(issuer, aud, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("x")})))
+		require.EqualError(t, err, "unsupported PEM block type [PRIVATE KEY]")
+
+		_, err = NewJWTAuthorizer(issuer, aud, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("x")})))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid public key")
+	})
+
+	caCert := newTestCA(t, "ca").cert
+
+	a, err := NewJWTAuthorizer(issuer, aud,
+		pemPublicKey(t, &rsaKey.PublicKey), pemPublicKey(t, edPubKey),
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw})),
+		pemPublicKey(t, &ecKey.PublicKey),
+	)
+	require.NoError(t, err)
+
+	now := time.Now()
+	validClaims := map[string]interface{}{"iss": issuer, "aud": aud, "exp": now.Add(time.Minute).Unix()}
+
+	t.Run("Valid tokens", func(t *testing.T) {
+		require.True(t, a.Authorize(newRequest(signJWT(t, algRS256, rsaKey, validClaims), nil)))
+		require.True(t, a.Authorize(newRequest(signJWT(t, algES256, ecKey, validClaims), nil)))
+		require.True(t, a.Authorize(newRequest(signJWT(t, algEdDSA, edKey, validClaims), nil)))
+
+		claims := copyClaims(validClaims)
+		claims["aud"] = []string{"other", aud}
+		claims["nbf"] = now.Add(-time.Minute).Unix()
+		require.True(t, a.Authorize(newRequest(signJWT(t, algES256, ecKey, claims), nil)))
+	})
+
+	t.Run("Invalid signature", func(t *testing.T) {
+		require.False(t, a.Authorize(newRequest(signJWT(t, algES256, otherKey, validClaims), nil)))
+
+		// Algorithm doesn't match the key
+		token := signJWT(t, algES256, ecKey, validClaims)
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`))
+		require.False(t, a.Authorize(newRequest(header+token[len(header):], nil)))
+	})
+
+	t.Run("Invalid claims", func(t *testing.T) {
+		for name, update := range map[string]func(claims map[string]interface{}){
+			"expired":     func(c map[string]interface{}) { c["exp"] = now.Add(-time.Hour).Unix() },
+			"no expiry":   func(c map[string]interface{}) { delete(c, "exp") },
+			"not before":  func(c map[string]interface{}) { c["nbf"] = now.Add(time.Hour).Unix() },
+			"issuer":      func(c map[string]interface{}) { c["iss"] = "other" },
+			"audience":    func(c map[string]interface{}) { c["aud"] = []string{"other"} },
+			"no audience": func(c map[string]interface{}) { delete(c, "aud") },
+		} {
+			claims := copyClaims(validClaims)
+			update(claims)
+			require.Falsef(t, a.Authorize(newRequest(signJWT(t, algES256, ecKey, claims), nil)), name)
+		}
+	})
+
+	t.Run("Malformed token", func(t *testing.T) {
+		require.False(t, a.Authorize(newRequest("", nil)))
+		require.False(t, a.Authorize(newRequest("a.b", nil)))
+		require.False(t, a.Authorize(newRequest("!.b.c", nil)))
+		require.False(t, a.Authorize(newRequest("e30.e30.!", nil)))
+	})
+}
+
+func TestClientCertAuthorizer(t *testing.T) {
+	t.Run("Invalid rules", func(t *testing.T) {
+		_, err := NewClientCertAuthorizer()
+		require.EqualError(t, err, "at least one subject rule is required")
+
+		_, err = NewClientCertAuthorizer("CN")
+		require.EqualError(t, err, "invalid attribute [CN] in subject rule [CN]")
+
+		_, err = NewClientCertAuthorizer("XX=abc")
+		require.EqualError(t, err, "unsupported attribute [XX] in subject rule [XX=abc]")
+
+		_, err = NewClientCertAuthorizer("CN=")
+		require.EqualError(t, err, "empty value for attribute [CN] in subject rule [CN=]")
+	})
+
+	a, err := NewClientCertAuthorizer("CN=admin, O=org1", "ou=writers,O=org2,C=US,L=Toronto,ST=ON")
+	require.NoError(t, err)
+
+	require.True(t, a.Authorize(newRequest("", newClientCert(pkix.Name{CommonName: "admin", Organization: []string{"org1"}}))))
+	require.True(t, a.Authorize(newRequest("", newClientCert(pkix.Name{
+		CommonName:         "user",
+		Organization:       []string{"org2"},
+		OrganizationalUnit: []string{"readers", "writers"},
+		Country:            []string{"US"},
+		Locality:           []string{"Toronto"},
+		Province:           []string{"ON"},
+	}))))
+	require.False(t, a.Authorize(newRequest("", newClientCert(pkix.Name{CommonName: "admin", Organization: []string{"org2"}}))))
+	require.False(t, a.Authorize(newRequest("", newClientCert(pkix.Name{Organization: []string{"org2"}}))))
+	require.False(t, a.Authorize(newRequest("", nil)))
+
+	// The client certificate must have been verified
+	req := newRequest("", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "admin", Organization: []string{"org1"}}}}}
+	require.False(t, a.Authorize(req))
+}
+
+func newRequest(token string, cert *x509.Certificate) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, pingPath, nil)
+
+	if token != "" {
+		req.Header.Set(authHeader, bearerPrefix+token)
+	}
+
+	if cert != nil {
+		req.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}
+	}
+
+	return req
+}
+
+func newClientCert(subject pkix.Name) *x509.Certificate {
+	return &x509.Certificate{Subject: subject}
+}
+
+func pemPublicKey(t *testing.T, key crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func signJWT(t *testing.T, alg string, key crypto.Signer, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	require.NoError(t, err)
+
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var sig []byte
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		hash := sha256.Sum256([]byte(input))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		hash := sha256.Sum256([]byte(input))
+		r, s, err := ecdsa.Sign(rand.Reader, k, hash[:])
+		require.NoError(t, err)
+
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(input))
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func copyClaims(claims map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{})
+	for k, v := range claims {
+		c[k] = v
+	}
+
+	return c
+}
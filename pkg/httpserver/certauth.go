@@ -0,0 +1,147 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package httpserver
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// subjectAttributes are the subject attributes that may be used in a rule
+var subjectAttributes = []string{"CN", "O", "OU", "C", "L", "ST"}
+
+// ClientCertAuthorizer authorizes requests that were made with a verified client certificate (i.e. using mutual TLS)
+// whose subject matches one of a set of rules. A rule is a comma-separated list of attributes, for example
+// "CN=admin,O=org1.example.com". A subject matches a rule if it has all of the attributes of the rule. The
+// supported attributes are CN, O, OU, C, L and ST.
+type ClientCertAuthorizer struct {
+	rules []subjectRule
+}
+
+type subjectAttribute struct {
+	name  string
+	value string
+}
+
+type subjectRule []subjectAttribute
+
+// NewClientCertAuthorizer returns a new client certificate authorizer for the given subject rules
+func NewClientCertAuthorizer(rules ...string) (*ClientCertAuthorizer, error) {
+	if len(rules) == 0 {
+		return nil, errors.New("at least one subject rule is required")
+	}
+
+	a := &ClientCertAuthorizer{}
+
+	for _, r := range rules {
+		rule, err := parseSubjectRule(r)
+		if err != nil {
+			return nil, err
+		}
+
+		a.rules = append(a.rules, rule)
+	}
+
+	return a, nil
+}
+
+// Authorize returns true if the request has a verified client certificate whose subject matches one of the rules
+func (a *ClientCertAuthorizer) Authorize(req *http.Request) bool {
+	cert := verifiedClientCert(req)
+	if cert == nil {
+		return false
+	}
+
+	for _, rule := range a.rules {
+		if rule.matches(cert.Subject) {
+			return true
+		}
+	}
+
+	logger.Debugf("The subject [%s] of the client certificate doesn't match any of the rules", cert.Subject)
+
+	return false
+}
+
+func (r subjectRule) matches(subject pkix.Name) bool {
+	for _, attr := range r {
+		if !contains(subjectValues(subject, attr.name), attr.value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func subjectValues(subject pkix.Name, name string) []string {
+	switch name {
+	case "CN":
+		return []string{subject.CommonName}
+	case "O":
+		return subject.Organization
+	case "OU":
+		return subject.OrganizationalUnit
+	case "C":
+		return subject.Country
+	case "L":
+		return subject.Locality
+	case "ST":
+		return subject.Province
+	default:
+		return nil
+	}
+}
+
+func parseSubjectRule(rule string) (subjectRule, error) {
+	var attrs subjectRule
+
+	for _, part := range strings.Split(rule, ",") {
+		nv := strings.SplitN(part, "=", 2)
+		if len(nv) != 2 {
+			return nil, errors.Errorf("invalid attribute [%s] in subject rule [%s]", part, rule)
+		}
+
+		name := strings.ToUpper(strings.TrimSpace(nv[0]))
+		value := strings.TrimSpace(nv[1])
+
+		if !contains(subjectAttributes, name) {
+			return nil, errors.Errorf("unsupported attribute [%s] in subject rule [%s]", name, rule)
+		}
+
+		if value == "" {
+			return nil, errors.Errorf("empty value for attribute [%s] in subject rule [%s]", name, rule)
+		}
+
+		attrs = append(attrs, subjectAttribute{name: name, value: value})
+	}
+
+	return attrs, nil
+}
+
+// verifiedClientCert returns the client certificate of the request if it was verified
+// by the server (against the client CAs) and nil otherwise
+func verifiedClientCert(req *http.Request) *x509.Certificate {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return req.TLS.VerifiedChains[0][0]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,253 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package httpserver
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	algRS256 = "RS256"
+	algES256 = "ES256"
+	algEdDSA = "EdDSA"
+
+	// clockSkew is the tolerance that is applied when checking the expiry and not-before times of a token
+	clockSkew = time.Minute
+)
+
+// JWTAuthorizer authorizes requests that present a bearer token which is a JWT signed by one of a set of
+// public keys. The supported algorithms are RS256, ES256 (P-256) and EdDSA (Ed25519). The token must contain
+// an expiry time ("exp") and, if configured, the expected issuer ("iss") and audience ("aud").
+type JWTAuthorizer struct {
+	issuer   string
+	audience string
+	keys     []crypto.PublicKey
+	now      func() time.Time
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+}
+
+type jwtClaims struct {
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+}
+
+// NewJWTAuthorizer returns a new JWT authorizer. Each of the given keys is a PEM-encoded public key (PKIX)
+// or certificate. If issuer or audience is empty then the corresponding claim isn't checked.
+func NewJWTAuthorizer(issuer, audience string, pemKeys ...string) (*JWTAuthorizer, error) {
+	if len(pemKeys) == 0 {
+		return nil, errors.New("at least one public key is required")
+	}
+
+	var keys []crypto.PublicKey
+
+	for _, pemKey := range pemKeys {
+		key, err := parsePublicKey(pemKey)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return &JWTAuthorizer{
+		issuer:   issuer,
+		audience: audience,
+		keys:     keys,
+		now:      time.Now,
+	}, nil
+}
+
+// Authorize returns true if the request has a bearer token that is a valid JWT
+func (a *JWTAuthorizer) Authorize(req *http.Request) bool {
+	token := bearerToken(req)
+	if token == "" {
+		return false
+	}
+
+	if err := a.verify(token); err != nil {
+		logger.Debugf("Invalid JWT in request to [%s]: %s", req.URL.Path, err)
+		return false
+	}
+
+	return true
+}
+
+func (a *JWTAuthorizer) verify(token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed token")
+	}
+
+	header := &jwtHeader{}
+	if err := decodeSegment(parts[0], header); err != nil {
+		return errors.WithMessage(err, "invalid header")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errors.WithMessage(err, "invalid signature encoding")
+	}
+
+	if !a.verifySignature(header.Alg, []byte(parts[0]+"."+parts[1]), sig) {
+		return errors.Errorf("signature verification failed for algorithm [%s]", header.Alg)
+	}
+
+	claims := &jwtClaims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return errors.WithMessage(err, "invalid claims")
+	}
+
+	return a.validateClaims(claims)
+}
+
+func (a *JWTAuthorizer) verifySignature(alg string, input, sig []byte) bool {
+	for _, key := range a.keys {
+		if verifySignature(alg, key, input, sig) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *JWTAuthorizer) validateClaims(claims *jwtClaims) error {
+	now := a.now()
+
+	if claims.ExpiresAt == nil {
+		return errors.New("token has no expiry time")
+	}
+
+	if now.After(time.Unix(*claims.ExpiresAt, 0).Add(clockSkew)) {
+		return errors.New("token has expired")
+	}
+
+	if claims.NotBefore != nil && now.Add(clockSkew).Before(time.Unix(*claims.NotBefore, 0)) {
+		return errors.New("token is not valid yet")
+	}
+
+	if a.issuer != "" && claims.Issuer != a.issuer {
+		return errors.Errorf("unexpected issuer [%s]", claims.Issuer)
+	}
+
+	if a.audience != "" && !containsAudience(claims.Audience, a.audience) {
+		return errors.Errorf("audience [%s] not found in token", a.audience)
+	}
+
+	return nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, input, sig []byte) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg != algRS256 {
+			return false
+		}
+
+		hash := sha256.Sum256(input)
+
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, hash[:], sig) == nil
+	case *ecdsa.PublicKey:
+		if alg != algES256 || k.Curve.Params().BitSize != 256 || len(sig) != 64 {
+			return false
+		}
+
+		hash := sha256.Sum256(input)
+
+		return ecdsa.Verify(k, hash[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]))
+	case ed25519.PublicKey:
+		return alg == algEdDSA && ed25519.Verify(k, input, sig)
+	default:
+		return false
+	}
+}
+
+func containsAudience(raw json.RawMessage, audience string) bool {
+	if len(raw) == 0 {
+		return false
+	}
+
+	var aud string
+	if err := json.Unmarshal(raw, &aud); err == nil {
+		return aud == audience
+	}
+
+	var auds []string
+	if err := json.Unmarshal(raw, &auds); err != nil {
+		return false
+	}
+
+	for _, a := range auds {
+		if a == audience {
+			return true
+		}
+	}
+
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	bytes, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bytes, v)
+}
+
+func parsePublicKey(pemKey string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, errors.New("no PEM data found in public key")
+	}
+
+	var key crypto.PublicKey
+
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.WithMessage(err, "invalid certificate")
+		}
+
+		key = cert.PublicKey
+	case "PUBLIC KEY":
+		k, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.WithMessage(err, "invalid public key")
+		}
+
+		key = k
+	default:
+		return nil, errors.Errorf("unsupported PEM block type [%s]", block.Type)
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, errors.Errorf("unsupported public key type %T", key)
+	}
+}
@@ -27,21 +27,40 @@ var logger = logrus.New()
 type Server struct {
 	httpServer *http.Server
 	started    uint32
+	tlsCfg     *TLSConfig
+	reloader   *certReloader
+}
+
+// Option is an HTTP server option
+type Option func(s *Server)
+
+// WithTLS configures the server to serve HTTPS using the given TLS configuration
+func WithTLS(cfg TLSConfig) Option {
+	return func(s *Server) {
+		s.tlsCfg = &cfg
+	}
 }
 
 // New returns a new HTTP server
-func New(url string, handlers ...common.HTTPHandler) *Server {
+func New(url string, handlers []common.HTTPHandler, opts ...Option) *Server {
 	router := mux.NewRouter()
 	for _, handler := range handlers {
 		logger.Infof("Registering handler for [%s]", handler.Path())
 		router.HandleFunc(handler.Path(), handler.Handler()).Methods(handler.Method())
 	}
-	return &Server{
+
+	s := &Server{
 		httpServer: &http.Server{
 			Addr:    url,
 			Handler: router,
 		},
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 // Start starts the HTTP server in a separate Go routine
@@ -50,8 +69,20 @@ func (s *Server) Start() error {
 		return errors.New("server already started")
 	}
 
+	if s.tlsCfg != nil {
+		reloader, err := newCertReloader(*s.tlsCfg)
+		if err != nil {
+			atomic.StoreUint32(&s.started, 0)
+			return errors.WithMessage(err, "invalid TLS configuration")
+		}
+
+		s.reloader = reloader
+		s.httpServer.TLSConfig = reloader.tlsConfig()
+		reloader.start()
+	}
+
 	go func() {
-		logger.Infof("Listening for requests on [%s]", s.httpServer.Addr)
+		logger.Infof("Listening for requests on [%s] - TLS: %t", s.httpServer.Addr, s.tlsCfg != nil)
 
 		err := s.startWithRetry()
 		if err != nil && err != http.ErrServerClosed {
@@ -68,6 +99,11 @@ func (s *Server) Stop(ctx context.Context) error {
 	if !atomic.CompareAndSwapUint32(&s.started, 1, 0) {
 		return errors.New("Cannot stop HTTP server since it hasn't been started")
 	}
+
+	if s.reloader != nil {
+		s.reloader.stop()
+	}
+
 	return s.httpServer.Shutdown(ctx)
 }
 
@@ -76,6 +112,11 @@ func (s *Server) Stop(ctx context.Context) error {
 func (s *Server) startWithRetry() error {
 	_, err := retry.Invoke(
 		func() (interface{}, error) {
+			if s.tlsCfg != nil {
+				// The certificate is provided by the TLS config
+				return nil, s.httpServer.ListenAndServeTLS("", "")
+			}
+
 			return nil, s.httpServer.ListenAndServe()
 		},
 		retry.WithMaxAttempts(10),
@@ -43,10 +43,12 @@ func TestServer_Start(t *testing.T) {
 	sampleDocHandler := mocks.NewMockDocumentHandler().WithNamespace(sampleNamespace)
 
 	s := New(url,
-		diddochandler.NewUpdateHandler(didDocPath, didDocHandler),
-		diddochandler.NewResolveHandler(didDocPath, didDocHandler),
-		newSampleUpdateHandler(sampleDocHandler),
-		newSampleResolveHandler(sampleDocHandler),
+		[]common.HTTPHandler{
+			diddochandler.NewUpdateHandler(didDocPath, didDocHandler),
+			diddochandler.NewResolveHandler(didDocPath, didDocHandler),
+			newSampleUpdateHandler(sampleDocHandler),
+			newSampleResolveHandler(sampleDocHandler),
+		},
 	)
 	require.NoError(t, s.Start())
 	require.Error(t, s.Start())
@@ -109,24 +111,30 @@ func TestServer_RetryOnStartup(t *testing.T) {
 	sampleDocHandler := mocks.NewMockDocumentHandler().WithNamespace(sampleNamespace)
 
 	s1 := New(url,
-		diddochandler.NewUpdateHandler(didDocPath, didDocHandler),
-		diddochandler.NewResolveHandler(didDocPath, didDocHandler),
-		newSampleUpdateHandler(sampleDocHandler),
-		newSampleResolveHandler(sampleDocHandler),
+		[]common.HTTPHandler{
+			diddochandler.NewUpdateHandler(didDocPath, didDocHandler),
+			diddochandler.NewResolveHandler(didDocPath, didDocHandler),
+			newSampleUpdateHandler(sampleDocHandler),
+			newSampleResolveHandler(sampleDocHandler),
+		},
 	)
 
 	s2 := New(url,
-		diddochandler.NewUpdateHandler(didDocPath, didDocHandler),
-		diddochandler.NewResolveHandler(didDocPath, didDocHandler),
-		newSampleUpdateHandler(sampleDocHandler),
-		newSampleResolveHandler(sampleDocHandler),
+		[]common.HTTPHandler{
+			diddochandler.NewUpdateHandler(didDocPath, didDocHandler),
+			diddochandler.NewResolveHandler(didDocPath, didDocHandler),
+			newSampleUpdateHandler(sampleDocHandler),
+			newSampleResolveHandler(sampleDocHandler),
+		},
 	)
 
 	s3 := New(url,
-		diddochandler.NewUpdateHandler(didDocPath, didDocHandler),
-		diddochandler.NewResolveHandler(didDocPath, didDocHandler),
-		newSampleUpdateHandler(sampleDocHandler),
-		newSampleResolveHandler(sampleDocHandler),
+		[]common.HTTPHandler{
+			diddochandler.NewUpdateHandler(didDocPath, didDocHandler),
+			diddochandler.NewResolveHandler(didDocPath, didDocHandler),
+			newSampleUpdateHandler(sampleDocHandler),
+			newSampleResolveHandler(sampleDocHandler),
+		},
 	)
 
 	// Start three HTTP servers (all listening on the same port) to test the retry logic
@@ -0,0 +1,211 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultReloadInterval = 30 * time.Second
+
+// TLSConfig holds the TLS configuration of the HTTP server
+type TLSConfig struct {
+	// CertFile is the path of the server's PEM-encoded certificate
+	CertFile string
+
+	// KeyFile is the path of the server's PEM-encoded private key
+	KeyFile string
+
+	// ClientAuthRequired indicates that clients must present a certificate that is signed by one of the client CAs
+	ClientAuthRequired bool
+
+	// ClientCAFiles contains the paths of the PEM-encoded CA certificates that are used to verify client certificates.
+	// If client authentication isn't required then a client certificate is verified only if the client presents one
+	// (so that it may be used for authorization).
+	ClientCAFiles []string
+
+	// ReloadInterval is the interval at which the certificate, key and client CA files are checked for changes.
+	// Changed files are reloaded without restarting the server. Defaults to 30s.
+	ReloadInterval time.Duration
+}
+
+// certReloader holds the server certificate and the client CA pool and reloads them when the underlying files change
+type certReloader struct {
+	cfg       TLSConfig
+	mutex     sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+	done      chan struct{}
+	stopOnce  sync.Once
+}
+
+func newCertReloader(cfg TLSConfig) (*certReloader, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("certificate and key files are required for TLS")
+	}
+
+	if cfg.ClientAuthRequired && len(cfg.ClientCAFiles) == 0 {
+		return nil, errors.New("client CA files are required for client authentication")
+	}
+
+	if cfg.ReloadInterval <= 0 {
+		cfg.ReloadInterval = defaultReloadInterval
+	}
+
+	r := &certReloader{
+		cfg:  cfg,
+		done: make(chan struct{}),
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// tlsConfig returns the TLS config of the server. The certificate and client CAs are resolved on each
+// handshake so that reloaded files take effect for new connections.
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.serverConfig(), nil
+		},
+	}
+}
+
+func (r *certReloader) serverConfig() *tls.Config {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*r.cert},
+	}
+
+	if r.cfg.ClientAuthRequired {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = r.clientCAs
+	} else if r.clientCAs != nil {
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		cfg.ClientCAs = r.clientCAs
+	}
+
+	return cfg
+}
+
+// start periodically checks the files for changes until stop is called
+func (r *certReloader) start() {
+	go func() {
+		ticker := time.NewTicker(r.cfg.ReloadInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if !r.changed() {
+					continue
+				}
+
+				if err := r.load(); err != nil {
+					logger.Errorf("Error reloading TLS certificates. The existing certificates will continue to be used: %s", err)
+				} else {
+					logger.Infof("Reloaded TLS certificates")
+				}
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+func (r *certReloader) stop() {
+	r.stopOnce.Do(func() {
+		close(r.done)
+	})
+}
+
+func (r *certReloader) load() error {
+	modTimes, err := r.currentModTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return errors.WithMessage(err, "error loading server certificate and key")
+	}
+
+	var clientCAs *x509.CertPool
+	if len(r.cfg.ClientCAFiles) > 0 {
+		clientCAs = x509.NewCertPool()
+
+		for _, file := range r.cfg.ClientCAFiles {
+			pem, err := ioutil.ReadFile(file)
+			if err != nil {
+				return errors.WithMessagef(err, "error reading client CA file [%s]", file)
+			}
+
+			if !clientCAs.AppendCertsFromPEM(pem) {
+				return errors.Errorf("no certificates found in client CA file [%s]", file)
+			}
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+
+	return nil
+}
+
+// changed returns true if any of the files were modified since they were last loaded
+func (r *certReloader) changed() bool {
+	modTimes, err := r.currentModTimes()
+	if err != nil {
+		logger.Warnf("Unable to check TLS certificate files for changes: %s", err)
+		return false
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for file, modTime := range modTimes {
+		if !modTime.Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *certReloader) currentModTimes() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+
+	for _, file := range append([]string{r.cfg.CertFile, r.cfg.KeyFile}, r.cfg.ClientCAFiles...) {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "error accessing file [%s]", file)
+		}
+
+		modTimes[file] = info.ModTime()
+	}
+
+	return modTimes, nil
+}
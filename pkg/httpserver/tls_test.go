@@ -0,0 +1,342 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package httpserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/sidetree-core-go/pkg/restapi/common"
+)
+
+const (
+	tlsURL       = "localhost:8443"
+	tlsClientURL = "https://" + tlsURL
+	pingPath     = "/ping"
+)
+
+func TestServer_TLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpserver_tls")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	ca := newTestCA(t, "ca")
+	clientCA := newTestCA(t, "client-ca")
+
+	certFile := filepath.Join(dir, "server.pem")
+	keyFile := filepath.Join(dir, "server.key")
+	clientCAFile := filepath.Join(dir, "client-ca.pem")
+
+	ca.issue(t, "server", 1, certFile, keyFile)
+	writePEM(t, clientCAFile, "CERTIFICATE", clientCA.cert.Raw)
+
+	clientCert := clientCA.issueKeyPair(t, "client", 100)
+
+	s := New(tlsURL, []common.HTTPHandler{newPingHandler()},
+		WithTLS(TLSConfig{
+			CertFile:           certFile,
+			KeyFile:            keyFile,
+			ClientAuthRequired: true,
+			ClientCAFiles:      []string{clientCAFile},
+			ReloadInterval:     50 * time.Millisecond,
+		}),
+	)
+	require.NoError(t, s.Start())
+	defer func() { require.NoError(t, s.Stop(context.Background())) }()
+
+	t.Run("Client certificate", func(t *testing.T) {
+		resp, err := invokeWithRetry(func() (*http.Response, error) {
+			return newTLSClient(ca.pool(), &clientCert).Get(tlsClientURL + pingPath)
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, int64(1), resp.TLS.PeerCertificates[0].SerialNumber.Int64())
+		require.NoError(t, resp.Body.Close())
+	})
+
+	t.Run("No client certificate", func(t *testing.T) {
+		_, err := newTLSClient(ca.pool(), nil).Get(tlsClientURL + pingPath)
+		require.Error(t, err)
+	})
+
+	t.Run("Plain HTTP", func(t *testing.T) {
+		resp, err := http.Get("http://" + tlsURL + pingPath)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		require.NoError(t, resp.Body.Close())
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		// Make sure that the modification time of the new files differs from the old files
+		time.Sleep(10 * time.Millisecond)
+		ca.issue(t, "server", 2, certFile, keyFile)
+
+		require.Eventually(t, func() bool {
+			resp, err := newTLSClient(ca.pool(), &clientCert).Get(tlsClientURL + pingPath)
+			if err != nil {
+				return false
+			}
+
+			defer func() { require.NoError(t, resp.Body.Close()) }()
+
+			return resp.TLS.PeerCertificates[0].SerialNumber.Int64() == 2
+		}, 5*time.Second, 50*time.Millisecond)
+	})
+
+	t.Run("Invalid reload", func(t *testing.T) {
+		time.Sleep(10 * time.Millisecond)
+		require.NoError(t, ioutil.WriteFile(certFile, []byte("invalid"), 0600))
+		time.Sleep(200 * time.Millisecond)
+
+		// The previous certificate should still be used
+		resp, err := newTLSClient(ca.pool(), &clientCert).Get(tlsClientURL + pingPath)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), resp.TLS.PeerCertificates[0].SerialNumber.Int64())
+		require.NoError(t, resp.Body.Close())
+	})
+}
+
+func TestServer_OptionalClientCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpserver_tls")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	ca := newTestCA(t, "ca")
+	clientCA := newTestCA(t, "client-ca")
+
+	certFile := filepath.Join(dir, "server.pem")
+	keyFile := filepath.Join(dir, "server.key")
+	clientCAFile := filepath.Join(dir, "client-ca.pem")
+
+	ca.issue(t, "server", 1, certFile, keyFile)
+	writePEM(t, clientCAFile, "CERTIFICATE", clientCA.cert.Raw)
+
+	certAuth, err := NewClientCertAuthorizer("CN=client")
+	require.NoError(t, err)
+
+	s := New(tlsURL, []common.HTTPHandler{NewAuthHandler(newPingHandler(), certAuth)},
+		WithTLS(TLSConfig{
+			CertFile:      certFile,
+			KeyFile:       keyFile,
+			ClientCAFiles: []string{clientCAFile},
+		}),
+	)
+	require.NoError(t, s.Start())
+	defer func() { require.NoError(t, s.Stop(context.Background())) }()
+
+	t.Run("Authorized client certificate", func(t *testing.T) {
+		clientCert := clientCA.issueKeyPair(t, "client", 100)
+
+		resp, err := invokeWithRetry(func() (*http.Response, error) {
+			return newTLSClient(ca.pool(), &clientCert).Get(tlsClientURL + pingPath)
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.NoError(t, resp.Body.Close())
+	})
+
+	t.Run("Unauthorized client certificate", func(t *testing.T) {
+		clientCert := clientCA.issueKeyPair(t, "other", 101)
+
+		resp, err := newTLSClient(ca.pool(), &clientCert).Get(tlsClientURL + pingPath)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusForbidden, resp.StatusCode)
+		require.NoError(t, resp.Body.Close())
+	})
+
+	t.Run("Untrusted client certificate", func(t *testing.T) {
+		// The client only presents a certificate that is issued by one of the CAs requested by the server
+		clientCert := ca.issueKeyPair(t, "client", 102)
+
+		resp, err := newTLSClient(ca.pool(), &clientCert).Get(tlsClientURL + pingPath)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		require.NoError(t, resp.Body.Close())
+	})
+
+	t.Run("No client certificate", func(t *testing.T) {
+		resp, err := newTLSClient(ca.pool(), nil).Get(tlsClientURL + pingPath)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		require.NoError(t, resp.Body.Close())
+	})
+}
+
+func TestServer_InvalidTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpserver_tls")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	t.Run("No certificate", func(t *testing.T) {
+		s := New(tlsURL, []common.HTTPHandler{newPingHandler()}, WithTLS(TLSConfig{}))
+
+		err := s.Start()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "certificate and key files are required")
+	})
+
+	t.Run("Certificate not found", func(t *testing.T) {
+		s := New(tlsURL, []common.HTTPHandler{newPingHandler()},
+			WithTLS(TLSConfig{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem")}),
+		)
+
+		err := s.Start()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "error accessing file")
+	})
+
+	t.Run("No client CAs", func(t *testing.T) {
+		s := New(tlsURL, []common.HTTPHandler{newPingHandler()},
+			WithTLS(TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", ClientAuthRequired: true}),
+		)
+
+		err := s.Start()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "client CA files are required")
+	})
+
+	t.Run("Invalid client CA", func(t *testing.T) {
+		ca := newTestCA(t, "ca")
+
+		certFile := filepath.Join(dir, "server.pem")
+		keyFile := filepath.Join(dir, "server.key")
+		caFile := filepath.Join(dir, "ca.pem")
+
+		ca.issue(t, "server", 1, certFile, keyFile)
+		require.NoError(t, ioutil.WriteFile(caFile, []byte("invalid"), 0600))
+
+		s := New(tlsURL, []common.HTTPHandler{newPingHandler()},
+			WithTLS(TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientAuthRequired: true, ClientCAFiles: []string{caFile}}),
+		)
+
+		err := s.Start()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "no certificates found in client CA file")
+	})
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, cn string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	return pool
+}
+
+func (ca *testCA) newCert(t *testing.T, cn string, serial int64) ([]byte, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	return der, key
+}
+
+func (ca *testCA) issue(t *testing.T, cn string, serial int64, certFile, keyFile string) {
+	der, key := ca.newCert(t, cn, serial)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	writePEM(t, certFile, "CERTIFICATE", der)
+}
+
+func (ca *testCA) issueKeyPair(t *testing.T, cn string, serial int64) tls.Certificate {
+	der, key := ca.newCert(t, cn, serial)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func writePEM(t *testing.T, file, blockType string, der []byte) {
+	require.NoError(t, ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+}
+
+func newTLSClient(rootCAs *x509.CertPool, cert *tls.Certificate) *http.Client {
+	tlsCfg := &tls.Config{RootCAs: rootCAs}
+	if cert != nil {
+		tlsCfg.Certificates = []tls.Certificate{*cert}
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsCfg, DisableKeepAlives: true},
+	}
+}
+
+type pingHandler struct{}
+
+func newPingHandler() *pingHandler {
+	return &pingHandler{}
+}
+
+func (h *pingHandler) Path() string {
+	return pingPath
+}
+
+func (h *pingHandler) Method() string {
+	return http.MethodGet
+}
+
+func (h *pingHandler) Handler() common.HTTPRequestHandler {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+}
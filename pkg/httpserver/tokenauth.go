@@ -0,0 +1,75 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package httpserver
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TokenAuthorizer authorizes requests that present one of a set of static bearer tokens. The tokens are
+// configured as hashes so that the tokens themselves don't need to be stored in (possibly shared) config.
+type TokenAuthorizer struct {
+	hashes [][]byte
+}
+
+// NewTokenAuthorizer returns a new token authorizer. Each of the given hashes is the base64URL-encoded
+// SHA-256 hash of a bearer token.
+func NewTokenAuthorizer(tokenHashes ...string) (*TokenAuthorizer, error) {
+	if len(tokenHashes) == 0 {
+		return nil, errors.New("at least one token hash is required")
+	}
+
+	hashes := make([][]byte, len(tokenHashes))
+
+	for i, h := range tokenHashes {
+		hash, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(h, "="))
+		if err != nil {
+			return nil, errors.WithMessagef(err, "invalid token hash [%s]", h)
+		}
+
+		if len(hash) != sha256.Size {
+			return nil, errors.Errorf("invalid token hash [%s] - expecting a SHA-256 hash", h)
+		}
+
+		hashes[i] = hash
+	}
+
+	return &TokenAuthorizer{hashes: hashes}, nil
+}
+
+// HashToken returns the base64URL-encoded SHA-256 hash of the given token, i.e. the value that is
+// provided to NewTokenAuthorizer
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// Authorize returns true if the request has a bearer token that matches one of the configured hashes
+func (a *TokenAuthorizer) Authorize(req *http.Request) bool {
+	token := bearerToken(req)
+	if token == "" {
+		return false
+	}
+
+	hash := sha256.Sum256([]byte(token))
+
+	authorized := false
+	for _, h := range a.hashes {
+		if subtle.ConstantTimeCompare(h, hash[:]) == 1 {
+			authorized = true
+		}
+	}
+
+	return authorized
+}
@@ -0,0 +1,346 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package leader
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/pkg/errors"
+	"github.com/trustbloc/fabric-peer-ext/pkg/collections/client"
+)
+
+var logger = flogging.MustGetLogger("sidetree_leader")
+
+// offLedgerNamespace is the chaincode namespace of the off-ledger collection that holds the leader leases
+const offLedgerNamespace = "document_cc"
+
+// settleTime is the time to wait after writing the lease before reading it back in order to confirm
+// that no other peer acquired the lease at the same time. It may be overridden by unit tests.
+var settleTime = 500 * time.Millisecond
+
+// Listener is notified when the peer gains or loses leadership
+type Listener func(isLeader bool)
+
+// Config holds the leader election config
+type Config struct {
+	// Collection is the off-ledger collection that holds the leases
+	Collection string
+
+	// LeaseTimeout is the amount of time after which the lease expires if it isn't renewed by the leader.
+	// The lease is renewed at a third of this interval.
+	LeaseTimeout time.Duration
+}
+
+// leaseRecord is the persisted form of a leader lease
+type leaseRecord struct {
+	Leader string
+	Expiry time.Time
+}
+
+type offLedgerClientProvider interface {
+	ForChannel(channelID string) (client.OffLedger, error)
+}
+
+// Elector elects a single leader among the peers of the same org that take part in an election for the same
+// name (e.g. the batch writers of a Sidetree namespace). The leader holds a lease in an off-ledger collection and
+// renews it periodically. If the leader fails to renew the lease before it expires then it loses leadership as
+// soon as the lease expires, after which another peer acquires the lease.
+//
+// The off-ledger store doesn't support an atomic compare-and-swap so the lease is confirmed by reading it back
+// after a settle time. Leases expire according to wall-clock time so the clocks of the peers must be reasonably
+// in sync.
+type Elector struct {
+	Config
+
+	channelID string
+	name      string
+	mspID     string
+	peerID    string
+	provider  offLedgerClientProvider
+	listener  Listener
+	isLeader  bool
+	expiry    time.Time
+	mutex     sync.RWMutex
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+// New returns a new leader elector for the given election name. The listener is invoked each time that the
+// peer gains or loses leadership.
+func New(channelID, name, mspID, peerID string, cfg Config, provider offLedgerClientProvider, listener Listener) (*Elector, error) {
+	if cfg.Collection == "" {
+		return nil, errors.New("collection must be specified for leader election")
+	}
+
+	if cfg.LeaseTimeout <= 0 {
+		return nil, errors.New("lease timeout must be greater than 0 for leader election")
+	}
+
+	return &Elector{
+		Config:    cfg,
+		channelID: channelID,
+		name:      name,
+		mspID:     mspID,
+		peerID:    peerID,
+		provider:  provider,
+		listener:  listener,
+	}, nil
+}
+
+// Start starts taking part in the election
+func (e *Elector) Start() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.done != nil {
+		logger.Debugf("[%s] Leader elector for [%s] is already started", e.channelID, e.name)
+		return
+	}
+
+	logger.Infof("[%s] Starting leader elector for [%s] - Lease timeout: %s", e.channelID, e.name, e.LeaseTimeout)
+
+	e.done = make(chan struct{})
+	e.stopped = make(chan struct{})
+
+	go e.run(e.done, e.stopped)
+}
+
+// Stop stops taking part in the election. If this peer is the leader then the lease is
+// relinquished so that another peer may take over immediately.
+func (e *Elector) Stop() {
+	e.mutex.Lock()
+	done, stopped := e.done, e.stopped
+	e.done, e.stopped = nil, nil
+	e.mutex.Unlock()
+
+	if done == nil {
+		logger.Debugf("[%s] Leader elector for [%s] is not started", e.channelID, e.name)
+		return
+	}
+
+	logger.Infof("[%s] Stopping leader elector for [%s]", e.channelID, e.name)
+
+	close(done)
+	<-stopped
+
+	if e.IsLeader() {
+		e.resign()
+	}
+}
+
+// IsLeader returns true if this peer is currently the leader
+func (e *Elector) IsLeader() bool {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	return e.isLeader && time.Now().Before(e.expiry)
+}
+
+func (e *Elector) run(done, stopped chan struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(e.LeaseTimeout / 3)
+	defer ticker.Stop()
+
+	// The expiry timer fires when the current lease expires so that leadership is lost
+	// immediately (rather than on the next tick) if the lease couldn't be renewed
+	expiryTimer := time.NewTimer(e.LeaseTimeout)
+	defer expiryTimer.Stop()
+
+	e.elect()
+	e.scheduleExpiry(expiryTimer)
+
+	for {
+		select {
+		case <-ticker.C:
+			e.elect()
+			e.scheduleExpiry(expiryTimer)
+		case <-expiryTimer.C:
+			e.expire()
+		case <-done:
+			logger.Debugf("[%s] Exiting leader elector for [%s]", e.channelID, e.name)
+			return
+		}
+	}
+}
+
+// elect acquires (or renews) the lease if it's available and updates the leadership status
+func (e *Elector) elect() {
+	leader, expiry, err := e.acquire(time.Now())
+	if err != nil {
+		logger.Warnf("[%s] Error acquiring leader lease for [%s]: %s", e.channelID, e.name, err)
+
+		// Remain the leader until the current lease expires
+		e.setLeader(e.IsLeader(), e.leaseExpiry())
+
+		return
+	}
+
+	e.setLeader(leader, expiry)
+}
+
+// scheduleExpiry resets the given timer so that it fires when the current lease expires. The timer
+// is stopped if this peer isn't the leader.
+func (e *Elector) scheduleExpiry(t *time.Timer) {
+	if !t.Stop() {
+		// Drain the channel if the timer fired but wasn't received
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+
+	if e.IsLeader() {
+		t.Reset(time.Until(e.leaseExpiry()))
+	}
+}
+
+// expire relinquishes leadership if the lease has expired
+func (e *Elector) expire() {
+	e.mutex.RLock()
+	expired := e.isLeader && !time.Now().Before(e.expiry)
+	e.mutex.RUnlock()
+
+	if !expired {
+		return
+	}
+
+	logger.Warnf("[%s] The leader lease for [%s] expired before it could be renewed", e.channelID, e.name)
+
+	e.setLeader(false, time.Time{})
+}
+
+// acquire writes a lease for this peer if the lease is not held by another peer and then reads it back in
+// order to confirm that no other peer acquired the lease at the same time
+func (e *Elector) acquire(now time.Time) (bool, time.Time, error) {
+	c, err := e.provider.ForChannel(e.channelID)
+	if err != nil {
+		return false, time.Time{}, errors.WithMessage(err, "unable to get off-ledger client")
+	}
+
+	current, err := e.load(c)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
+	if current != nil && current.Leader != e.peerID && now.Before(current.Expiry) {
+		logger.Debugf("[%s] Peer [%s] holds the leader lease for [%s] until %s", e.channelID, current.Leader, e.name, current.Expiry)
+
+		return false, time.Time{}, nil
+	}
+
+	lease := &leaseRecord{
+		Leader: e.peerID,
+		Expiry: now.Add(e.LeaseTimeout),
+	}
+
+	b, err := json.Marshal(lease)
+	if err != nil {
+		return false, time.Time{}, errors.WithMessage(err, "unable to marshal lease")
+	}
+
+	if err := c.Put(offLedgerNamespace, e.Collection, e.key(), b); err != nil {
+		return false, time.Time{}, errors.WithMessage(err, "unable to store lease")
+	}
+
+	time.Sleep(settleTime)
+
+	confirmed, err := e.load(c)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
+	if confirmed == nil || confirmed.Leader != e.peerID {
+		logger.Infof("[%s] The leader lease for [%s] was acquired by another peer", e.channelID, e.name)
+
+		return false, time.Time{}, nil
+	}
+
+	return true, lease.Expiry, nil
+}
+
+// resign deletes the lease if it's still held by this peer
+func (e *Elector) resign() {
+	logger.Infof("[%s] Relinquishing leadership for [%s]", e.channelID, e.name)
+
+	e.setLeader(false, time.Time{})
+
+	c, err := e.provider.ForChannel(e.channelID)
+	if err != nil {
+		logger.Warnf("[%s] Unable to relinquish the leader lease for [%s]: %s", e.channelID, e.name, err)
+		return
+	}
+
+	current, err := e.load(c)
+	if err != nil {
+		logger.Warnf("[%s] Unable to relinquish the leader lease for [%s]: %s", e.channelID, e.name, err)
+		return
+	}
+
+	if current == nil || current.Leader != e.peerID {
+		return
+	}
+
+	if err := c.Delete(offLedgerNamespace, e.Collection, e.key()); err != nil {
+		logger.Warnf("[%s] Unable to relinquish the leader lease for [%s]: %s", e.channelID, e.name, err)
+	}
+}
+
+func (e *Elector) setLeader(leader bool, expiry time.Time) {
+	e.mutex.Lock()
+	changed := leader != e.isLeader
+	e.isLeader = leader
+	e.expiry = expiry
+	e.mutex.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if leader {
+		logger.Infof("[%s] This peer [%s] is now the leader for [%s]", e.channelID, e.peerID, e.name)
+	} else {
+		logger.Infof("[%s] This peer [%s] is no longer the leader for [%s]", e.channelID, e.peerID, e.name)
+	}
+
+	if e.listener != nil {
+		e.listener(leader)
+	}
+}
+
+func (e *Elector) leaseExpiry() time.Time {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	return e.expiry
+}
+
+func (e *Elector) load(c client.OffLedger) (*leaseRecord, error) {
+	b, err := c.Get(offLedgerNamespace, e.Collection, e.key())
+	if err != nil {
+		return nil, errors.WithMessage(err, "unable to load lease")
+	}
+
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	lease := &leaseRecord{}
+	if err := json.Unmarshal(b, lease); err != nil {
+		return nil, errors.WithMessage(err, "unable to unmarshal lease")
+	}
+
+	return lease, nil
+}
+
+// key returns the key of the lease. The MSP ID is included in the key so that each org elects its own leader.
+func (e *Elector) key() string {
+	return "leader~" + e.name + "~" + e.mspID
+}
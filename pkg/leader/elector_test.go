@@ -0,0 +1,244 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package leader
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/fabric-peer-ext/pkg/collections/client"
+
+	obmocks "github.com/trustbloc/sidetree-fabric/pkg/observer/mocks"
+)
+
+const (
+	channel1 = "channel1"
+	name1    = "did:sidetree"
+	org1MSP  = "Org1MSP"
+	org2MSP  = "Org2MSP"
+	peer1    = "peer1.org1.example.com"
+	peer2    = "peer2.org1.example.com"
+	peer3    = "peer1.org2.example.com"
+	coll     = "leases"
+
+	leaseTimeout = 150 * time.Millisecond
+)
+
+var cfg = Config{Collection: coll, LeaseTimeout: leaseTimeout}
+
+func TestNew(t *testing.T) {
+	p := &obmocks.OffLedgerClientProvider{}
+
+	e, err := New(channel1, name1, org1MSP, peer1, cfg, p, nil)
+	require.NoError(t, err)
+	require.NotNil(t, e)
+	require.False(t, e.IsLeader())
+
+	e, err = New(channel1, name1, org1MSP, peer1, Config{LeaseTimeout: leaseTimeout}, p, nil)
+	require.EqualError(t, err, "collection must be specified for leader election")
+	require.Nil(t, e)
+
+	e, err = New(channel1, name1, org1MSP, peer1, Config{Collection: coll}, p, nil)
+	require.EqualError(t, err, "lease timeout must be greater than 0 for leader election")
+	require.Nil(t, e)
+}
+
+func TestElector(t *testing.T) {
+	restoreSettleTime := settleTime
+	settleTime = 0
+	defer func() { settleTime = restoreSettleTime }()
+
+	p := &obmocks.OffLedgerClientProvider{}
+	p.ForChannelReturns(obmocks.NewMockOffLedgerClient(), nil)
+
+	l1 := &listener{}
+	e1, err := New(channel1, name1, org1MSP, peer1, cfg, p, l1.handle)
+	require.NoError(t, err)
+
+	l2 := &listener{}
+	e2, err := New(channel1, name1, org1MSP, peer2, cfg, p, l2.handle)
+	require.NoError(t, err)
+
+	l3 := &listener{}
+	e3, err := New(channel1, name1, org2MSP, peer3, cfg, p, l3.handle)
+	require.NoError(t, err)
+
+	e1.Start()
+	require.NotPanics(t, e1.Start)
+	time.Sleep(20 * time.Millisecond)
+
+	e2.Start()
+	e3.Start()
+	defer e3.Stop()
+
+	time.Sleep(leaseTimeout)
+
+	require.True(t, e1.IsLeader())
+	require.False(t, e2.IsLeader())
+	require.Equal(t, []bool{true}, l1.events())
+	require.Empty(t, l2.events())
+
+	// Each org elects its own leader
+	require.True(t, e3.IsLeader())
+
+	t.Run("Failover on stop", func(t *testing.T) {
+		e1.Stop()
+		require.NotPanics(t, e1.Stop)
+
+		require.False(t, e1.IsLeader())
+		require.Equal(t, []bool{true, false}, l1.events())
+
+		time.Sleep(leaseTimeout)
+
+		require.True(t, e2.IsLeader())
+		require.Equal(t, []bool{true}, l2.events())
+	})
+
+	t.Run("Failover on expiry", func(t *testing.T) {
+		// Simulate a failed leader by stopping the elector without relinquishing the lease
+		e2.mutex.Lock()
+		done, stopped := e2.done, e2.stopped
+		e2.done, e2.stopped = nil, nil
+		e2.mutex.Unlock()
+
+		close(done)
+		<-stopped
+
+		e1.Start()
+		defer e1.Stop()
+
+		time.Sleep(leaseTimeout / 2)
+		require.False(t, e1.IsLeader())
+
+		time.Sleep(2 * leaseTimeout)
+		require.True(t, e1.IsLeader())
+		require.False(t, e2.IsLeader())
+	})
+}
+
+func TestElector_Error(t *testing.T) {
+	restoreSettleTime := settleTime
+	settleTime = 0
+	defer func() { settleTime = restoreSettleTime }()
+
+	errExpected := errors.New("injected off-ledger error")
+
+	t.Run("Client provider error", func(t *testing.T) {
+		p := &obmocks.OffLedgerClientProvider{}
+		p.ForChannelReturns(nil, errExpected)
+
+		e, err := New(channel1, name1, org1MSP, peer1, cfg, p, nil)
+		require.NoError(t, err)
+
+		e.elect()
+		require.False(t, e.IsLeader())
+	})
+
+	t.Run("Renew error", func(t *testing.T) {
+		c := obmocks.NewMockOffLedgerClient()
+		p := &obmocks.OffLedgerClientProvider{}
+		p.ForChannelReturns(c, nil)
+
+		l := &listener{}
+		e, err := New(channel1, name1, org1MSP, peer1, cfg, p, l.handle)
+		require.NoError(t, err)
+
+		e.elect()
+		require.True(t, e.IsLeader())
+
+		// The peer remains the leader until the lease expires
+		c.WithPutError(errExpected)
+		e.elect()
+		require.True(t, e.IsLeader())
+
+		time.Sleep(leaseTimeout)
+
+		e.elect()
+		require.False(t, e.IsLeader())
+		require.Equal(t, []bool{true, false}, l.events())
+	})
+
+	t.Run("Lease expires between renewals", func(t *testing.T) {
+		p := &failingProvider{c: obmocks.NewMockOffLedgerClient(), err: errExpected}
+
+		timeout := 600 * time.Millisecond
+
+		l := &listener{}
+		e, err := New(channel1, name1, org1MSP, peer1, Config{Collection: coll, LeaseTimeout: timeout}, p, l.handle)
+		require.NoError(t, err)
+
+		e.elect()
+		require.True(t, e.IsLeader())
+
+		time.Sleep(timeout / 2)
+
+		// The lease can't be renewed. The next renewal attempt is after the lease expires.
+		atomic.StoreInt32(&p.failing, 1)
+
+		e.Start()
+		defer e.Stop()
+
+		time.Sleep(timeout / 3)
+		require.True(t, e.IsLeader())
+
+		// Leadership is lost as soon as the lease expires rather than on the next renewal attempt
+		time.Sleep(timeout / 4)
+		require.Equal(t, []bool{true, false}, l.events())
+	})
+
+	t.Run("Invalid lease", func(t *testing.T) {
+		c := obmocks.NewMockOffLedgerClient()
+		p := &obmocks.OffLedgerClientProvider{}
+		p.ForChannelReturns(c, nil)
+
+		e, err := New(channel1, name1, org1MSP, peer1, cfg, p, nil)
+		require.NoError(t, err)
+
+		require.NoError(t, c.Put(offLedgerNamespace, coll, e.key(), []byte("{")))
+
+		e.elect()
+		require.False(t, e.IsLeader())
+	})
+}
+
+type listener struct {
+	mutex      sync.Mutex
+	leadership []bool
+}
+
+func (l *listener) handle(isLeader bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.leadership = append(l.leadership, isLeader)
+}
+
+func (l *listener) events() []bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.leadership
+}
+
+// failingProvider returns an error once it's set to failing
+type failingProvider struct {
+	c       client.OffLedger
+	err     error
+	failing int32
+}
+
+func (p *failingProvider) ForChannel(string) (client.OffLedger, error) {
+	if atomic.LoadInt32(&p.failing) == 1 {
+		return nil, p.err
+	}
+
+	return p.c, nil
+}
@@ -22,6 +22,18 @@ type OperationQueueProvider struct {
 		result1 cutter.OperationQueue
 		result2 error
 	}
+	RemoveStub        func(channelID string, namespace string) error
+	removeMutex       sync.RWMutex
+	removeArgsForCall []struct {
+		channelID string
+		namespace string
+	}
+	removeReturns struct {
+		result1 error
+	}
+	removeReturnsOnCall map[int]struct {
+		result1 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -78,11 +90,62 @@ func (fake *OperationQueueProvider) CreateReturnsOnCall(i int, result1 cutter.Op
 	}{result1, result2}
 }
 
+func (fake *OperationQueueProvider) Remove(channelID string, namespace string) error {
+	fake.removeMutex.Lock()
+	ret, specificReturn := fake.removeReturnsOnCall[len(fake.removeArgsForCall)]
+	fake.removeArgsForCall = append(fake.removeArgsForCall, struct {
+		channelID string
+		namespace string
+	}{channelID, namespace})
+	fake.recordInvocation("Remove", []interface{}{channelID, namespace})
+	fake.removeMutex.Unlock()
+	if fake.RemoveStub != nil {
+		return fake.RemoveStub(channelID, namespace)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.removeReturns.result1
+}
+
+func (fake *OperationQueueProvider) RemoveCallCount() int {
+	fake.removeMutex.RLock()
+	defer fake.removeMutex.RUnlock()
+	return len(fake.removeArgsForCall)
+}
+
+func (fake *OperationQueueProvider) RemoveArgsForCall(i int) (string, string) {
+	fake.removeMutex.RLock()
+	defer fake.removeMutex.RUnlock()
+	return fake.removeArgsForCall[i].channelID, fake.removeArgsForCall[i].namespace
+}
+
+func (fake *OperationQueueProvider) RemoveReturns(result1 error) {
+	fake.RemoveStub = nil
+	fake.removeReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *OperationQueueProvider) RemoveReturnsOnCall(i int, result1 error) {
+	fake.RemoveStub = nil
+	if fake.removeReturnsOnCall == nil {
+		fake.removeReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.removeReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *OperationQueueProvider) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
 	fake.createMutex.RLock()
 	defer fake.createMutex.RUnlock()
+	fake.removeMutex.RLock()
+	defer fake.removeMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
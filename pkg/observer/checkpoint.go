@@ -0,0 +1,120 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package observer
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/common"
+)
+
+const (
+	metaDataColName = "meta_data"
+
+	// checkpointKeyPrefix is prepended to the peer ID in order to form the key of the observer's meta-data.
+	// (The monitor uses the peer ID alone as the key of its meta-data.)
+	checkpointKeyPrefix = "observer~"
+)
+
+// MetaData contains the observer's meta-data
+type MetaData struct {
+	LastBlockProcessed uint64
+}
+
+// checkpoint persists the number of the last block that was completely processed by the observer so that the
+// observer may replay the blocks that it missed (while the peer was down or the observer was stopped)
+type checkpoint struct {
+	channelID   string
+	peerID      string
+	provider    common.OffLedgerClientProvider
+	last        uint64
+	exists      bool
+	failedBlock uint64
+}
+
+func newCheckpoint(channelID, peerID string, provider common.OffLedgerClientProvider) *checkpoint {
+	return &checkpoint{
+		channelID: channelID,
+		peerID:    peerID,
+		provider:  provider,
+	}
+}
+
+// load loads the last block processed from the meta-data collection
+func (c *checkpoint) load() error {
+	olClient, err := c.provider.ForChannel(c.channelID)
+	if err != nil {
+		return err
+	}
+
+	data, err := olClient.Get(common.DocNs, metaDataColName, c.key())
+	if err != nil {
+		return errors.WithMessage(err, "error retrieving observer meta-data")
+	}
+
+	if len(data) == 0 {
+		logger.Debugf("[%s] No observer meta-data exists for peer [%s]", c.channelID, c.peerID)
+		return nil
+	}
+
+	metaData := &MetaData{}
+	if err := json.Unmarshal(data, metaData); err != nil {
+		return errors.WithMessage(err, "error unmarshalling observer meta-data")
+	}
+
+	c.last = metaData.LastBlockProcessed
+	c.exists = true
+
+	return nil
+}
+
+// failed records that an anchor in the given block could not be processed. The checkpoint won't advance
+// past the first failed block so that the block is replayed (and the anchor retried) when the observer restarts.
+func (c *checkpoint) failed(bNum uint64) {
+	if c.failedBlock == 0 || bNum < c.failedBlock {
+		c.failedBlock = bNum
+	}
+}
+
+// advance persists the given block number as the last block processed
+func (c *checkpoint) advance(bNum uint64) error {
+	if c.failedBlock != 0 && bNum >= c.failedBlock {
+		bNum = c.failedBlock - 1
+	}
+
+	if bNum <= c.last {
+		return nil
+	}
+
+	metaData := &MetaData{LastBlockProcessed: bNum}
+	logger.Debugf("[%s] Updating observer meta-data: %+v", c.channelID, metaData)
+
+	bytes, err := json.Marshal(metaData)
+	if err != nil {
+		return errors.WithMessage(err, "error marshalling observer meta-data")
+	}
+
+	olClient, err := c.provider.ForChannel(c.channelID)
+	if err != nil {
+		return err
+	}
+
+	if err := olClient.Put(common.DocNs, metaDataColName, c.key(), bytes); err != nil {
+		return errors.WithMessage(err, "error persisting observer meta-data")
+	}
+
+	c.last = bNum
+	c.exists = true
+
+	return nil
+}
+
+func (c *checkpoint) key() string {
+	return checkpointKeyPrefix + c.peerID
+}
@@ -0,0 +1,82 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package observer
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/common"
+	obmocks "github.com/trustbloc/sidetree-fabric/pkg/observer/mocks"
+)
+
+func TestCheckpoint(t *testing.T) {
+	olClient := obmocks.NewMockOffLedgerClient()
+	olProvider := &obmocks.OffLedgerClientProvider{}
+	olProvider.ForChannelReturns(olClient, nil)
+
+	t.Run("Success", func(t *testing.T) {
+		cp := newCheckpoint(channel, peer1, olProvider)
+		require.NoError(t, cp.load())
+		require.Zero(t, cp.last)
+
+		require.NoError(t, cp.advance(10))
+		require.Equal(t, uint64(10), cp.last)
+
+		// The checkpoint never goes backwards
+		require.NoError(t, cp.advance(5))
+		require.Equal(t, uint64(10), cp.last)
+
+		cp.failed(15)
+		cp.failed(20)
+		require.NoError(t, cp.advance(30))
+		require.Equal(t, uint64(14), cp.last)
+
+		cp2 := newCheckpoint(channel, peer1, olProvider)
+		require.NoError(t, cp2.load())
+		require.Equal(t, uint64(14), cp2.last)
+
+		// The monitor's meta-data isn't affected
+		data, err := olClient.Get(common.DocNs, metaDataColName, peer1)
+		require.NoError(t, err)
+		require.Empty(t, data)
+	})
+
+	t.Run("Invalid meta-data", func(t *testing.T) {
+		cp := newCheckpoint(channel, "peer2", olProvider)
+		require.NoError(t, olClient.Put(common.DocNs, metaDataColName, cp.key(), []byte("{")))
+
+		err := cp.load()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "error unmarshalling observer meta-data")
+	})
+
+	t.Run("Off-ledger error", func(t *testing.T) {
+		errExpected := errors.New("injected off-ledger error")
+
+		c := obmocks.NewMockOffLedgerClient().WithGetError(errExpected).WithPutError(errExpected)
+		p := &obmocks.OffLedgerClientProvider{}
+		p.ForChannelReturns(c, nil)
+
+		cp := newCheckpoint(channel, peer1, p)
+
+		err := cp.load()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errExpected.Error())
+
+		err = cp.advance(10)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errExpected.Error())
+		require.Zero(t, cp.last)
+
+		p.ForChannelReturns(nil, errExpected)
+		require.EqualError(t, cp.load(), errExpected.Error())
+		require.EqualError(t, cp.advance(10), errExpected.Error())
+	})
+}
@@ -0,0 +1,574 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package consistency
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/pkg/errors"
+	"github.com/trustbloc/fabric-peer-ext/pkg/collections/offledger/dcas"
+
+	bcclient "github.com/trustbloc/sidetree-fabric/pkg/client"
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/common"
+)
+
+var logger = flogging.MustGetLogger("sidetree_observer")
+
+const (
+	// digestColName is the off-ledger collection (in the document namespace) in which the peers publish
+	// the digests of their operation sets
+	digestColName = "consistency"
+
+	// allIDsQuery is a CouchDB query that returns the IDs of all of the operations in the document store
+	allIDsQuery = `{"selector":{"id":{"$gt":null}},"use_index":["_design/indexIDDoc","indexID"],"fields":["id"]}`
+
+	// keysByIDTemplate is a CouchDB query that returns the keys of all operations of a document. The
+	// placeholder is replaced with the JSON-encoded document ID.
+	keysByIDTemplate = `{"selector":{"id":%s},"use_index":["_design/indexIDDoc","indexID"],"fields":["id"]}`
+
+	// maxDigestAgePeriods is the default maximum age of a digest, as a multiple of the period
+	maxDigestAgePeriods = 3
+)
+
+// ClientProviders contains the providers for the off-ledger and DCAS clients
+type ClientProviders struct {
+	OffLedger common.OffLedgerClientProvider
+	DCAS      common.DCASClientProvider
+}
+
+// Config holds the consistency checker configuration
+type Config struct {
+	// Period is the interval at which the checker runs
+	Period time.Duration
+
+	// Peers contains the IDs of the peers whose operation sets are compared with the local operation set
+	Peers []string
+
+	// SampleSize is the number of documents that are sampled for each period. The sample is derived from the
+	// period so that all peers check the same documents. Each run checks the samples of the current and the
+	// previous period (since the peers don't run at the same time). If 0 then all documents are checked.
+	SampleSize int
+
+	// MaxDigestAge is the maximum age of a digest published by another peer. Older digests are
+	// considered to be unavailable. Defaults to 3 times the period.
+	MaxDigestAge time.Duration
+
+	// Repair indicates that operations that exist on another peer but are missing from the local store
+	// should be retrieved from the other peer. If false then divergences are only reported.
+	Repair bool
+}
+
+// Digest is published by each peer for each document that it checks. It contains the DCAS keys of
+// all of the operations of the document that are in the peer's store along with a hash of the keys.
+type Digest struct {
+	ID        string
+	PeerID    string
+	Digest    string
+	Keys      []string
+	Timestamp time.Time
+}
+
+// Divergence describes a document whose operation set differs between the local peer and another peer
+type Divergence struct {
+	// ID is the ID of the document
+	ID string
+
+	// PeerID is the ID of the other peer
+	PeerID string
+
+	// MissingLocally contains the keys of the operations that exist on the other peer but not on the local peer
+	MissingLocally []string
+
+	// MissingRemotely contains the keys of the operations that exist on the local peer but not on the other peer
+	MissingRemotely []string
+
+	// Repaired contains the keys of the operations that were retrieved from the other peer
+	Repaired []string
+}
+
+// Report contains the results of a single consistency check
+type Report struct {
+	// Checked is the number of documents that were checked
+	Checked int
+	// Compared is the number of (document, peer) pairs that were compared
+	Compared int
+	// Consistent is the number of (document, peer) pairs whose operation sets are the same
+	Consistent int
+	// Unavailable is the number of (document, peer) pairs for which the other peer's digest was missing or too old
+	Unavailable int
+	// Divergences contains the (document, peer) pairs whose operation sets differ
+	Divergences []*Divergence
+	// Repaired is the number of operations that were retrieved from other peers
+	Repaired int
+}
+
+// Checker periodically compares the operation sets of documents in the local document store with those of
+// other peers (possibly in other orgs). Each peer publishes a digest of the operation set of every document
+// that it checks to the consistency off-ledger collection, keyed by document ID and peer ID. The digests of
+// the other peers are retrieved from the same collection (which falls back to gossip if the digest isn't
+// in the local store) and compared with the local digest. Divergences are reported and, optionally, operations
+// that are missing from the local store are retrieved from the DCAS document collection (again using gossip).
+// Operations that are missing from another peer are repaired by the checker running on that peer.
+type Checker struct {
+	*ClientProviders
+	Config
+
+	channelID string
+	peerID    string
+	mutex     sync.Mutex
+	done      chan struct{}
+}
+
+// New returns a new consistency checker
+func New(channelID, peerID string, cfg Config, providers *ClientProviders) *Checker {
+	if cfg.MaxDigestAge == 0 {
+		cfg.MaxDigestAge = maxDigestAgePeriods * cfg.Period
+	}
+
+	return &Checker{
+		ClientProviders: providers,
+		Config:          cfg,
+		channelID:       channelID,
+		peerID:          peerID,
+		done:            make(chan struct{}, 1),
+	}
+}
+
+// Start starts the consistency checker
+func (c *Checker) Start() error {
+	if c.Period == 0 {
+		logger.Infof("[%s] Consistency checker is disabled", c.channelID)
+		return nil
+	}
+
+	logger.Infof("[%s] Starting consistency checker - Period: %s, Peers: %s, Sample size: %d, Max digest age: %s, Repair: %t",
+		c.channelID, c.Period, c.Peers, c.SampleSize, c.MaxDigestAge, c.Repair)
+
+	go c.run()
+
+	return nil
+}
+
+// Stop stops the consistency checker
+func (c *Checker) Stop() {
+	if c.Period == 0 {
+		return
+	}
+
+	logger.Infof("[%s] Stopping consistency checker", c.channelID)
+
+	c.done <- struct{}{}
+}
+
+func (c *Checker) run() {
+	ticker := time.NewTicker(c.Period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := c.Check(); err != nil {
+				if errors.Cause(err) == bcclient.ErrNoLedger {
+					logger.Infof("[%s] Unable to check consistency since the channel doesn't exist", c.channelID)
+				} else {
+					logger.Warnf("[%s] Error checking consistency: %s", c.channelID, err)
+				}
+			}
+		case <-c.done:
+			logger.Infof("[%s] Exiting consistency checker", c.channelID)
+			return
+		}
+	}
+}
+
+// Check compares the operation sets of the given documents with those of the configured peers. If no document
+// IDs are provided then the documents are chosen from the local document store (according to the sample size).
+func (c *Checker) Check(ids ...string) (*Report, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(ids) == 0 {
+		var err error
+		ids, err = c.selectIDs()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report := &Report{}
+
+	for _, id := range ids {
+		if err := c.check(id, report); err != nil {
+			return nil, errors.WithMessagef(err, "error checking document [%s]", id)
+		}
+
+		report.Checked++
+	}
+
+	logger.Infof("[%s] Consistency check completed - Checked: %d, Compared: %d, Consistent: %d, Unavailable: %d, Divergent: %d, Repaired: %d",
+		c.channelID, report.Checked, report.Compared, report.Consistent, report.Unavailable, len(report.Divergences), report.Repaired)
+
+	return report, nil
+}
+
+func (c *Checker) check(id string, report *Report) error {
+	keys, err := c.query(keysByIDQuery(id))
+	if err != nil {
+		return err
+	}
+
+	local := newDigest(id, c.peerID, keys)
+
+	published, err := c.retrieve(id, c.peerID)
+	if err != nil {
+		return err
+	}
+
+	if c.isCurrent(published, local) {
+		logger.Debugf("[%s] Digest of document [%s] is unchanged and was published recently", c.channelID, id)
+	} else if err := c.publish(local); err != nil {
+		return err
+	}
+
+	for _, peerID := range c.Peers {
+		if peerID == c.peerID {
+			continue
+		}
+
+		remote, err := c.retrieve(id, peerID)
+		if err != nil {
+			return err
+		}
+
+		if remote == nil || (c.MaxDigestAge > 0 && time.Since(remote.Timestamp) > c.MaxDigestAge) {
+			logger.Debugf("[%s] Digest of document [%s] is unavailable for peer [%s]", c.channelID, id, peerID)
+			report.Unavailable++
+			continue
+		}
+
+		report.Compared++
+
+		if remote.Digest == local.Digest {
+			report.Consistent++
+			continue
+		}
+
+		divergence := diff(local, remote)
+
+		logger.Warnf("[%s] Operations of document [%s] diverge from peer [%s] - Missing locally: %s, Missing remotely: %s",
+			c.channelID, id, peerID, divergence.MissingLocally, divergence.MissingRemotely)
+
+		if c.Repair && len(divergence.MissingLocally) > 0 {
+			if err := c.repair(divergence); err != nil {
+				return err
+			}
+
+			report.Repaired += len(divergence.Repaired)
+		}
+
+		report.Divergences = append(report.Divergences, divergence)
+	}
+
+	return nil
+}
+
+// selectIDs returns the IDs of the documents in the local store. If a sample size is configured
+// then the samples of the current and the previous period are returned.
+func (c *Checker) selectIDs() ([]string, error) {
+	dcasClient, err := c.DCAS.ForChannel(c.channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := dcasClient.Query(common.DocNs, common.DocColl, allIDsQuery)
+	if err != nil {
+		return nil, errors.WithMessage(err, "error querying document IDs")
+	}
+	defer it.Close()
+
+	idMap := make(map[string]struct{})
+	for {
+		result, err := it.Next()
+		if err != nil {
+			return nil, errors.WithMessage(err, "error iterating document IDs")
+		}
+
+		if result == nil {
+			break
+		}
+
+		op := &struct {
+			ID string `json:"id"`
+		}{}
+
+		if err := json.Unmarshal(result.(*queryresult.KV).Value, op); err != nil || op.ID == "" {
+			logger.Warnf("[%s] Ignoring invalid operation [%s] in document store", c.channelID, result.(*queryresult.KV).Key)
+			continue
+		}
+
+		idMap[op.ID] = struct{}{}
+	}
+
+	ids := make([]string, 0, len(idMap))
+	for id := range idMap {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	if c.SampleSize <= 0 || c.SampleSize >= len(ids) {
+		return ids, nil
+	}
+
+	period := c.periodIndex(time.Now())
+
+	return union(sample(ids, c.SampleSize, period-1), sample(ids, c.SampleSize, period)), nil
+}
+
+// periodIndex returns the index of the period that contains the given time
+func (c *Checker) periodIndex(t time.Time) int64 {
+	if c.Period <= 0 {
+		return 0
+	}
+
+	return t.UnixNano() / int64(c.Period)
+}
+
+// isCurrent returns true if the published digest matches the local digest and it isn't close to
+// expiring, in which case it needn't be published again
+func (c *Checker) isCurrent(published, local *Digest) bool {
+	return published != nil && c.MaxDigestAge > 0 &&
+		published.Digest == local.Digest && time.Since(published.Timestamp) < c.MaxDigestAge/2
+}
+
+func (c *Checker) query(query string) ([]string, error) {
+	dcasClient, err := c.DCAS.ForChannel(c.channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := dcasClient.Query(common.DocNs, common.DocColl, query)
+	if err != nil {
+		return nil, errors.WithMessage(err, "error querying document operations")
+	}
+	defer it.Close()
+
+	var keys []string
+	for {
+		result, err := it.Next()
+		if err != nil {
+			return nil, errors.WithMessage(err, "error iterating document operations")
+		}
+
+		if result == nil {
+			return keys, nil
+		}
+
+		keys = append(keys, result.(*queryresult.KV).Key)
+	}
+}
+
+func (c *Checker) publish(d *Digest) error {
+	bytes, err := json.Marshal(d)
+	if err != nil {
+		return errors.WithMessage(err, "error marshalling digest")
+	}
+
+	olClient, err := c.OffLedger.ForChannel(c.channelID)
+	if err != nil {
+		return err
+	}
+
+	if err := olClient.Put(common.DocNs, digestColName, digestKey(d.ID, d.PeerID), bytes); err != nil {
+		return errors.WithMessage(err, "error publishing digest")
+	}
+
+	return nil
+}
+
+func (c *Checker) retrieve(id, peerID string) (*Digest, error) {
+	olClient, err := c.OffLedger.ForChannel(c.channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := olClient.Get(common.DocNs, digestColName, digestKey(id, peerID))
+	if err != nil {
+		return nil, errors.WithMessagef(err, "error retrieving digest for peer [%s]", peerID)
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	d := &Digest{}
+	if err := json.Unmarshal(data, d); err != nil {
+		logger.Warnf("[%s] Ignoring invalid digest of document [%s] for peer [%s]: %s", c.channelID, id, peerID, err)
+		return nil, nil
+	}
+
+	return d, nil
+}
+
+// repair retrieves the operations that are missing from the local store. The content of each operation is
+// verified against its key before it's stored.
+func (c *Checker) repair(divergence *Divergence) error {
+	dcasClient, err := c.DCAS.ForChannel(c.channelID)
+	if err != nil {
+		return err
+	}
+
+	values, err := dcasClient.GetMultipleKeys(common.DocNs, common.DocColl, divergence.MissingLocally...)
+	if err != nil {
+		return errors.WithMessage(err, "error retrieving missing operations")
+	}
+
+	for i, key := range divergence.MissingLocally {
+		value := values[i]
+		if len(value) == 0 {
+			logger.Warnf("[%s] Operation [%s] of document [%s] could not be retrieved from peer [%s]", c.channelID, key, divergence.ID, divergence.PeerID)
+			continue
+		}
+
+		if casKey, _, err := dcas.GetCASKeyAndValue(value); err != nil || casKey != key {
+			logger.Warnf("[%s] Content of operation [%s] of document [%s] retrieved from peer [%s] doesn't match its key", c.channelID, key, divergence.ID, divergence.PeerID)
+			continue
+		}
+
+		if _, err := dcasClient.Put(common.DocNs, common.DocColl, value); err != nil {
+			return errors.WithMessagef(err, "error storing operation [%s]", key)
+		}
+
+		logger.Infof("[%s] Repaired operation [%s] of document [%s] from peer [%s]", c.channelID, key, divergence.ID, divergence.PeerID)
+
+		divergence.Repaired = append(divergence.Repaired, key)
+	}
+
+	return nil
+}
+
+func newDigest(id, peerID string, keys []string) *Digest {
+	sorted := make([]string, len(keys))
+	copy(sorted, keys)
+	sort.Strings(sorted)
+
+	hash := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+
+	return &Digest{
+		ID:        id,
+		PeerID:    peerID,
+		Digest:    base64.URLEncoding.EncodeToString(hash[:]),
+		Keys:      sorted,
+		Timestamp: time.Now(),
+	}
+}
+
+func diff(local, remote *Digest) *Divergence {
+	localKeys := make(map[string]struct{})
+	for _, key := range local.Keys {
+		localKeys[key] = struct{}{}
+	}
+
+	remoteKeys := make(map[string]struct{})
+	for _, key := range remote.Keys {
+		remoteKeys[key] = struct{}{}
+	}
+
+	divergence := &Divergence{
+		ID:     local.ID,
+		PeerID: remote.PeerID,
+	}
+
+	for _, key := range remote.Keys {
+		if _, ok := localKeys[key]; !ok {
+			divergence.MissingLocally = append(divergence.MissingLocally, key)
+		}
+	}
+
+	for _, key := range local.Keys {
+		if _, ok := remoteKeys[key]; !ok {
+			divergence.MissingRemotely = append(divergence.MissingRemotely, key)
+		}
+	}
+
+	return divergence
+}
+
+// sample returns the given number of IDs for the given period. The IDs are ranked by a hash of the period
+// and the ID so that all peers choose the same sample, even if their sets of IDs differ slightly.
+func sample(ids []string, size int, period int64) []string {
+	type rankedID struct {
+		id   string
+		rank uint64
+	}
+
+	ranked := make([]rankedID, len(ids))
+	for i, id := range ids {
+		hash := sha256.Sum256([]byte(fmt.Sprintf("%d~%s", period, id)))
+		ranked[i] = rankedID{id: id, rank: binary.BigEndian.Uint64(hash[:8])}
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].rank != ranked[j].rank {
+			return ranked[i].rank < ranked[j].rank
+		}
+
+		return ranked[i].id < ranked[j].id
+	})
+
+	if size > len(ranked) {
+		size = len(ranked)
+	}
+
+	sampled := make([]string, size)
+	for i := range sampled {
+		sampled[i] = ranked[i].id
+	}
+
+	return sampled
+}
+
+// union returns the sorted, distinct IDs of the given sets
+func union(sets ...[]string) []string {
+	idMap := make(map[string]struct{})
+	for _, set := range sets {
+		for _, id := range set {
+			idMap[id] = struct{}{}
+		}
+	}
+
+	ids := make([]string, 0, len(idMap))
+	for id := range idMap {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// keysByIDQuery returns the query for the keys of the operations of the given document
+func keysByIDQuery(id string) string {
+	// Marshalling a string can't fail
+	idBytes, _ := json.Marshal(id)
+
+	return fmt.Sprintf(keysByIDTemplate, idBytes)
+}
+
+func digestKey(id, peerID string) string {
+	return id + "~" + peerID
+}
@@ -0,0 +1,291 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package consistency
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	stmocks "github.com/trustbloc/sidetree-fabric/pkg/mocks"
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/common"
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/mocks"
+)
+
+const (
+	channel1 = "channel1"
+	peer1    = "peer1"
+	peer2    = "peer2"
+	peer3    = "peer3"
+	did1     = "did:sidetree:1234"
+	did2     = "did:sidetree:5678"
+)
+
+func TestChecker_Check(t *testing.T) {
+	dcasClient := mocks.NewMockDCASClient()
+	olClient := mocks.NewMockOffLedgerClient()
+
+	op1 := putOperation(t, dcasClient, did1, 1)
+	op2 := putOperation(t, dcasClient, did1, 2)
+	op3 := putOperation(t, dcasClient, did2, 3)
+
+	// The content of op4 is only available from another peer (i.e. it's not returned by a local query)
+	op4 := putOperation(t, dcasClient, did1, 4)
+
+	dcasClient.WithQueryResults(common.DocNs, common.DocColl, allIDsQuery, []*queryresult.KV{
+		{Key: op1, Value: []byte(fmt.Sprintf(`{"id":"%s"}`, did1))},
+		{Key: op2, Value: []byte(fmt.Sprintf(`{"id":"%s"}`, did1))},
+		{Key: op3, Value: []byte(fmt.Sprintf(`{"id":"%s"}`, did2))},
+		{Key: "invalid", Value: []byte(`{}`)},
+	})
+	dcasClient.WithQueryResults(common.DocNs, common.DocColl, keysByIDQuery(did1), []*queryresult.KV{{Key: op1}, {Key: op2}})
+	dcasClient.WithQueryResults(common.DocNs, common.DocColl, keysByIDQuery(did2), []*queryresult.KV{{Key: op3}})
+
+	publishDigest(t, olClient, newDigest(did1, peer2, []string{op1, op2, op4, "missing"}))
+	publishDigest(t, olClient, newDigest(did2, peer2, []string{op3}))
+
+	staleDigest := newDigest(did1, peer3, []string{op1})
+	staleDigest.Timestamp = time.Now().Add(-time.Hour)
+	publishDigest(t, olClient, staleDigest)
+
+	providers := newProviders(olClient, dcasClient)
+
+	t.Run("Report only", func(t *testing.T) {
+		c := New(channel1, peer1, Config{Peers: []string{peer1, peer2, peer3}, MaxDigestAge: time.Minute}, providers)
+
+		report, err := c.Check()
+		require.NoError(t, err)
+		require.Equal(t, 2, report.Checked)
+		require.Equal(t, 2, report.Compared)
+		require.Equal(t, 1, report.Consistent)
+		require.Equal(t, 2, report.Unavailable)
+		require.Zero(t, report.Repaired)
+		require.Len(t, report.Divergences, 1)
+
+		divergence := report.Divergences[0]
+		require.Equal(t, did1, divergence.ID)
+		require.Equal(t, peer2, divergence.PeerID)
+		require.ElementsMatch(t, []string{op4, "missing"}, divergence.MissingLocally)
+		require.Empty(t, divergence.MissingRemotely)
+		require.Empty(t, divergence.Repaired)
+
+		// The local digests should have been published
+		d := retrieveDigest(t, olClient, did1, peer1)
+		require.ElementsMatch(t, []string{op1, op2}, d.Keys)
+		d = retrieveDigest(t, olClient, did2, peer1)
+		require.Equal(t, []string{op3}, d.Keys)
+	})
+
+	t.Run("Repair", func(t *testing.T) {
+		c := New(channel1, peer1, Config{Peers: []string{peer2}, Repair: true}, providers)
+
+		report, err := c.Check(did1)
+		require.NoError(t, err)
+		require.Equal(t, 1, report.Checked)
+		require.Equal(t, 1, report.Compared)
+		require.Equal(t, 1, report.Repaired)
+		require.Len(t, report.Divergences, 1)
+		require.Equal(t, []string{op4}, report.Divergences[0].Repaired)
+	})
+
+	t.Run("Missing remotely", func(t *testing.T) {
+		c := New(channel1, peer2, Config{Peers: []string{peer1}}, providers)
+
+		// peer2 has the digest of did1 published by peer1 in the previous test
+		dcasClient.WithQueryResults(common.DocNs, common.DocColl, keysByIDQuery(did1), []*queryresult.KV{{Key: op1}, {Key: op2}, {Key: op4}})
+
+		report, err := c.Check(did1)
+		require.NoError(t, err)
+		require.Len(t, report.Divergences, 1)
+		require.Empty(t, report.Divergences[0].MissingLocally)
+		require.Equal(t, []string{op4}, report.Divergences[0].MissingRemotely)
+	})
+
+	t.Run("Sample", func(t *testing.T) {
+		c := New(channel1, peer1, Config{Peers: []string{peer2}, SampleSize: 1}, providers)
+
+		// The samples of the current and previous periods are checked
+		ids, err := c.selectIDs()
+		require.NoError(t, err)
+		require.Equal(t, union(sample([]string{did1, did2}, 1, -1), sample([]string{did1, did2}, 1, 0)), ids)
+	})
+
+	t.Run("Unchanged digest isn't published again", func(t *testing.T) {
+		c := New(channel1, peer1, Config{Period: time.Minute, Peers: []string{peer2}}, providers)
+		require.Equal(t, 3*time.Minute, c.MaxDigestAge)
+
+		_, err := c.Check(did2)
+		require.NoError(t, err)
+
+		published := retrieveDigest(t, olClient, did2, peer1)
+
+		_, err = c.Check(did2)
+		require.NoError(t, err)
+		require.Equal(t, published.Timestamp.UnixNano(), retrieveDigest(t, olClient, did2, peer1).Timestamp.UnixNano())
+
+		// The digest is published again if it changes
+		dcasClient.WithQueryResults(common.DocNs, common.DocColl, keysByIDQuery(did2), []*queryresult.KV{{Key: op3}, {Key: op4}})
+
+		_, err = c.Check(did2)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{op3, op4}, retrieveDigest(t, olClient, did2, peer1).Keys)
+	})
+
+	t.Run("Publish error", func(t *testing.T) {
+		errExpected := errors.New("injected put error")
+		olClient := mocks.NewMockOffLedgerClient().WithPutError(errExpected)
+
+		c := New(channel1, peer1, Config{Peers: []string{peer2}}, newProviders(olClient, dcasClient))
+
+		_, err := c.Check(did1)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errExpected.Error())
+	})
+
+	t.Run("Retrieve error", func(t *testing.T) {
+		errExpected := errors.New("injected get error")
+		olClient := mocks.NewMockOffLedgerClient().WithGetError(errExpected)
+
+		c := New(channel1, peer1, Config{Peers: []string{peer2}}, newProviders(olClient, dcasClient))
+
+		_, err := c.Check(did1)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errExpected.Error())
+	})
+
+	t.Run("Provider error", func(t *testing.T) {
+		errExpected := errors.New("injected provider error")
+		dcasProvider := &stmocks.DCASClientProvider{}
+		dcasProvider.ForChannelReturns(nil, errExpected)
+
+		c := New(channel1, peer1, Config{Peers: []string{peer2}}, &ClientProviders{DCAS: dcasProvider})
+
+		_, err := c.Check()
+		require.EqualError(t, err, errExpected.Error())
+	})
+}
+
+func TestChecker_StartStop(t *testing.T) {
+	providers := newProviders(mocks.NewMockOffLedgerClient(), mocks.NewMockDCASClient())
+
+	t.Run("Disabled", func(t *testing.T) {
+		c := New(channel1, peer1, Config{}, providers)
+		require.NoError(t, c.Start())
+		c.Stop()
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		c := New(channel1, peer1, Config{Period: 10 * time.Millisecond, Peers: []string{peer2}}, providers)
+		require.NoError(t, c.Start())
+		time.Sleep(50 * time.Millisecond)
+		c.Stop()
+	})
+}
+
+func TestSample(t *testing.T) {
+	var ids []string
+	for i := 0; i < 100; i++ {
+		ids = append(ids, fmt.Sprintf("did:sidetree:%03d", i))
+	}
+
+	s1 := sample(ids, 10, 1000)
+	require.Len(t, s1, 10)
+
+	// The sample doesn't depend on the order of the IDs
+	reversed := make([]string, len(ids))
+	for i, id := range ids {
+		reversed[len(ids)-1-i] = id
+	}
+
+	require.Equal(t, s1, sample(reversed, 10, 1000))
+
+	// The sample mostly survives a divergence in the sets of IDs
+	require.Equal(t, s1[:9], sample(removeID(ids, s1[9]), 10, 1000)[:9])
+
+	// The sample of another period is different
+	require.NotEqual(t, s1, sample(ids, 10, 1001))
+
+	require.Len(t, sample(ids[:5], 10, 1000), 5)
+}
+
+func TestKeysByIDQuery(t *testing.T) {
+	id := `did:sidetree:"},"$or":[{"id":{"$gt":null}}]`
+
+	query := &struct {
+		Selector map[string]interface{} `json:"selector"`
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(keysByIDQuery(id)), query))
+	require.Equal(t, map[string]interface{}{"id": id}, query.Selector)
+}
+
+func TestDiff(t *testing.T) {
+	local := newDigest(did1, peer1, []string{"k3", "k1", "k2"})
+	remote := newDigest(did1, peer2, []string{"k2", "k4", "k1"})
+
+	require.Equal(t, []string{"k1", "k2", "k3"}, local.Keys)
+	require.NotEqual(t, local.Digest, remote.Digest)
+	require.Equal(t, local.Digest, newDigest(did1, peer2, []string{"k2", "k1", "k3"}).Digest)
+
+	divergence := diff(local, remote)
+	require.Equal(t, did1, divergence.ID)
+	require.Equal(t, peer2, divergence.PeerID)
+	require.Equal(t, []string{"k4"}, divergence.MissingLocally)
+	require.Equal(t, []string{"k3"}, divergence.MissingRemotely)
+}
+
+func putOperation(t *testing.T, dcasClient *mocks.MockDCASClient, id string, n int) string {
+	key, err := dcasClient.Put(common.DocNs, common.DocColl, []byte(fmt.Sprintf(`{"id":"%s","operationIndex":%d}`, id, n)))
+	require.NoError(t, err)
+
+	return key
+}
+
+func publishDigest(t *testing.T, olClient *mocks.MockOffLedgerClient, d *Digest) {
+	bytes, err := json.Marshal(d)
+	require.NoError(t, err)
+	require.NoError(t, olClient.Put(common.DocNs, digestColName, digestKey(d.ID, d.PeerID), bytes))
+}
+
+func retrieveDigest(t *testing.T, olClient *mocks.MockOffLedgerClient, id, peerID string) *Digest {
+	bytes, err := olClient.Get(common.DocNs, digestColName, digestKey(id, peerID))
+	require.NoError(t, err)
+	require.NotEmpty(t, bytes)
+
+	d := &Digest{}
+	require.NoError(t, json.Unmarshal(bytes, d))
+
+	return d
+}
+
+func newProviders(olClient *mocks.MockOffLedgerClient, dcasClient *mocks.MockDCASClient) *ClientProviders {
+	olProvider := &mocks.OffLedgerClientProvider{}
+	olProvider.ForChannelReturns(olClient, nil)
+
+	dcasProvider := &stmocks.DCASClientProvider{}
+	dcasProvider.ForChannelReturns(dcasClient, nil)
+
+	return &ClientProviders{
+		OffLedger: olProvider,
+		DCAS:      dcasProvider,
+	}
+}
+
+func removeID(ids []string, id string) []string {
+	var result []string
+	for _, i := range ids {
+		if i != id {
+			result = append(result, i)
+		}
+	}
+
+	return result
+}
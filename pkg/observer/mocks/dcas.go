@@ -33,5 +33,15 @@ func (m *MockDCASClient) Put(ns, coll string, content []byte) (string, error) {
 
 // PutMultipleValues puts the DCAS values and returns the keys for the values
 func (m *MockDCASClient) PutMultipleValues(ns, coll string, values [][]byte) ([]string, error) {
-	panic("not implemented")
+	keys := make([]string, len(values))
+	for i, value := range values {
+		key, err := m.Put(ns, coll, value)
+		if err != nil {
+			return nil, err
+		}
+
+		keys[i] = key
+	}
+
+	return keys, nil
 }
@@ -120,17 +120,44 @@ func (m *MockOffLedgerClient) GetMap(ns, coll string) (map[string][]byte, error)
 
 // PutMultipleValues puts the given key/values
 func (m *MockOffLedgerClient) PutMultipleValues(ns, coll string, kvs []*client.KeyValue) error {
-	panic("not implemented")
+	for _, kv := range kvs {
+		if err := m.Put(ns, coll, kv.Key, kv.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // Delete deletes the given key(s)
 func (m *MockOffLedgerClient) Delete(ns, coll string, keys ...string) error {
-	panic("not implemented")
+	if m.PutErr != nil {
+		return m.PutErr
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	for _, key := range keys {
+		delete(m.m[ns+coll], key)
+	}
+
+	return nil
 }
 
 // GetMultipleKeys retrieves the values for the given keys
 func (m *MockOffLedgerClient) GetMultipleKeys(ns, coll string, keys ...string) ([][]byte, error) {
-	panic("not implemented")
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		value, err := m.Get(ns, coll, key)
+		if err != nil {
+			return nil, err
+		}
+
+		values[i] = value
+	}
+
+	return values, nil
 }
 
 // Query executes the given query and returns an iterator that contains results.
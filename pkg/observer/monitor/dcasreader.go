@@ -39,7 +39,7 @@ func (r *SidetreeDCASReader) Read(key string) ([]byte, error) {
 	}
 
 	if len(content) == 0 {
-		return nil, newMonitorError(errors.Errorf("content not found for key [%s]", key), false)
+		return nil, newNotFoundError(errors.Errorf("content not found for key [%s]", key))
 	}
 
 	return content, nil
@@ -0,0 +1,176 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package monitor
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/common"
+)
+
+const (
+	deadLetterColName = "dead_letters"
+)
+
+// ErrDeadLetterNotFound indicates that the requested dead letter does not exist
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter holds an anchor that the monitor was unable to process due to a persistent error
+type DeadLetter struct {
+	BlockNum      uint64
+	TxNum         uint64
+	AnchorAddress string
+	Error         string
+	Attempts      int
+	FirstFailed   time.Time
+	LastAttempt   time.Time
+}
+
+// deadLetterStore persists dead letters in the dead-letter off-ledger collection. All of the dead letters for
+// a peer are stored in a single document (keyed by peer ID) since dead letters are expected to be rare and
+// only the local monitor updates the document.
+type deadLetterStore struct {
+	channelID string
+	peerID    string
+	provider  common.OffLedgerClientProvider
+	mutex     sync.Mutex
+}
+
+func newDeadLetterStore(channelID, peerID string, provider common.OffLedgerClientProvider) *deadLetterStore {
+	return &deadLetterStore{
+		channelID: channelID,
+		peerID:    peerID,
+		provider:  provider,
+	}
+}
+
+// add adds the given dead letter. If a dead letter already exists for the same block and transaction
+// then its error and attempt count are updated.
+func (s *deadLetterStore) add(dl *DeadLetter) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dls, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range dls {
+		if existing.BlockNum == dl.BlockNum && existing.TxNum == dl.TxNum {
+			existing.AnchorAddress = dl.AnchorAddress
+			existing.Error = dl.Error
+			existing.Attempts++
+			existing.LastAttempt = dl.LastAttempt
+
+			return s.save(dls)
+		}
+	}
+
+	dl.Attempts = 1
+
+	return s.save(append(dls, dl))
+}
+
+// get returns the dead letter for the given block and transaction
+func (s *deadLetterStore) get(blockNum, txNum uint64) (*DeadLetter, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dls, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dl := range dls {
+		if dl.BlockNum == blockNum && dl.TxNum == txNum {
+			return dl, nil
+		}
+	}
+
+	return nil, ErrDeadLetterNotFound
+}
+
+// list returns all dead letters ordered by block and transaction number
+func (s *deadLetterStore) list() ([]*DeadLetter, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.load()
+}
+
+// remove removes the dead letter for the given block and transaction
+func (s *deadLetterStore) remove(blockNum, txNum uint64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dls, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	for i, dl := range dls {
+		if dl.BlockNum == blockNum && dl.TxNum == txNum {
+			return s.save(append(dls[:i], dls[i+1:]...))
+		}
+	}
+
+	return nil
+}
+
+func (s *deadLetterStore) load() ([]*DeadLetter, error) {
+	olClient, err := s.provider.ForChannel(s.channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := olClient.Get(common.DocNs, deadLetterColName, s.peerID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "error retrieving dead letters")
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var dls []*DeadLetter
+	if err := json.Unmarshal(data, &dls); err != nil {
+		return nil, errors.WithMessage(err, "error unmarshalling dead letters")
+	}
+
+	return dls, nil
+}
+
+func (s *deadLetterStore) save(dls []*DeadLetter) error {
+	sort.Slice(dls, func(i, j int) bool {
+		if dls[i].BlockNum == dls[j].BlockNum {
+			return dls[i].TxNum < dls[j].TxNum
+		}
+
+		return dls[i].BlockNum < dls[j].BlockNum
+	})
+
+	bytes, err := json.Marshal(dls)
+	if err != nil {
+		return errors.WithMessage(err, "error marshalling dead letters")
+	}
+
+	olClient, err := s.provider.ForChannel(s.channelID)
+	if err != nil {
+		return err
+	}
+
+	if err := olClient.Put(common.DocNs, deadLetterColName, s.peerID, bytes); err != nil {
+		return errors.WithMessage(err, "error persisting dead letters")
+	}
+
+	return nil
+}
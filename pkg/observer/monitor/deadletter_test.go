@@ -0,0 +1,133 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/common"
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/mocks"
+)
+
+func TestDeadLetterStore(t *testing.T) {
+	olClient := mocks.NewMockOffLedgerClient()
+	olProvider := &mocks.OffLedgerClientProvider{}
+	olProvider.ForChannelReturns(olClient, nil)
+
+	s := newDeadLetterStore(channel1, peer1, olProvider)
+
+	dls, err := s.list()
+	require.NoError(t, err)
+	require.Empty(t, dls)
+
+	now := time.Now()
+
+	require.NoError(t, s.add(&DeadLetter{BlockNum: 20, TxNum: 1, AnchorAddress: "anchor2", Error: "error1", FirstFailed: now, LastAttempt: now}))
+	require.NoError(t, s.add(&DeadLetter{BlockNum: 10, TxNum: 3, AnchorAddress: anchor1, Error: "error1", FirstFailed: now, LastAttempt: now}))
+	require.NoError(t, s.add(&DeadLetter{BlockNum: 20, TxNum: 0, AnchorAddress: "anchor3", Error: "error1", FirstFailed: now, LastAttempt: now}))
+
+	dls, err = s.list()
+	require.NoError(t, err)
+	require.Len(t, dls, 3)
+	require.Equal(t, anchor1, dls[0].AnchorAddress)
+	require.Equal(t, "anchor3", dls[1].AnchorAddress)
+	require.Equal(t, "anchor2", dls[2].AnchorAddress)
+
+	t.Run("Update", func(t *testing.T) {
+		require.NoError(t, s.add(&DeadLetter{BlockNum: 10, TxNum: 3, AnchorAddress: anchor1, Error: "error2", LastAttempt: time.Now()}))
+
+		dl, err := s.get(10, 3)
+		require.NoError(t, err)
+		require.Equal(t, "error2", dl.Error)
+		require.Equal(t, 2, dl.Attempts)
+		require.True(t, dl.FirstFailed.Equal(now))
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		dl, err := s.get(10, 4)
+		require.Equal(t, ErrDeadLetterNotFound, err)
+		require.Nil(t, dl)
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		require.NoError(t, s.remove(20, 0))
+		require.NoError(t, s.remove(20, 5))
+
+		dls, err := s.list()
+		require.NoError(t, err)
+		require.Len(t, dls, 2)
+		require.Equal(t, anchor1, dls[0].AnchorAddress)
+		require.Equal(t, "anchor2", dls[1].AnchorAddress)
+	})
+
+	t.Run("Other peer", func(t *testing.T) {
+		dls, err := newDeadLetterStore(channel1, "peer2.org1.com", olProvider).list()
+		require.NoError(t, err)
+		require.Empty(t, dls)
+	})
+}
+
+func TestDeadLetterStore_Error(t *testing.T) {
+	errExpected := errors.New("injected off-ledger error")
+
+	t.Run("Off-ledger error", func(t *testing.T) {
+		c := mocks.NewMockOffLedgerClient().WithGetError(errExpected)
+		p := &mocks.OffLedgerClientProvider{}
+		p.ForChannelReturns(c, nil)
+
+		s := newDeadLetterStore(channel1, peer1, p)
+
+		_, err := s.list()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errExpected.Error())
+
+		err = s.add(&DeadLetter{BlockNum: 10})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errExpected.Error())
+
+		_, err = s.get(10, 0)
+		require.Error(t, err)
+
+		require.Error(t, s.remove(10, 0))
+	})
+
+	t.Run("Put error", func(t *testing.T) {
+		c := mocks.NewMockOffLedgerClient().WithPutError(errExpected)
+		p := &mocks.OffLedgerClientProvider{}
+		p.ForChannelReturns(c, nil)
+
+		err := newDeadLetterStore(channel1, peer1, p).add(&DeadLetter{BlockNum: 10})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "error persisting dead letters")
+	})
+
+	t.Run("Invalid dead letters", func(t *testing.T) {
+		c := mocks.NewMockOffLedgerClient()
+		p := &mocks.OffLedgerClientProvider{}
+		p.ForChannelReturns(c, nil)
+
+		require.NoError(t, c.Put(common.DocNs, deadLetterColName, peer1, []byte("{")))
+
+		_, err := newDeadLetterStore(channel1, peer1, p).list()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "error unmarshalling dead letters")
+	})
+
+	t.Run("Provider error", func(t *testing.T) {
+		p := &mocks.OffLedgerClientProvider{}
+		p.ForChannelReturns(nil, errExpected)
+
+		s := newDeadLetterStore(channel1, peer1, p)
+
+		_, err := s.list()
+		require.EqualError(t, err, errExpected.Error())
+	})
+}
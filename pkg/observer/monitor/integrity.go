@@ -0,0 +1,93 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package monitor
+
+import (
+	"sync"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/opstore"
+)
+
+// maxRecentMismatches is the maximum number of mismatches that are included in the integrity report
+const maxRecentMismatches = 100
+
+// IntegrityReport summarizes the verification of the operations in the document store against the anchored batches
+type IntegrityReport struct {
+	ChannelID string
+
+	// Enabled indicates whether or not integrity verification is enabled for the channel
+	Enabled bool
+
+	// Verified is the number of stored operations whose content was verified
+	Verified uint64
+
+	// Mismatched is the number of stored operations whose content didn't match the anchored operation
+	Mismatched uint64
+
+	// HashMismatches is the number of stored operations whose content didn't match the DCAS key
+	HashMismatches uint64
+
+	// IDMismatches is the number of stored operations whose 'id' field didn't match the anchored operation
+	IDMismatches uint64
+
+	// Repaired is the number of stored operations that were replaced with the anchored operation
+	Repaired uint64
+
+	// RecentMismatches contains the most recent mismatches
+	RecentMismatches []*opstore.Mismatch
+}
+
+// integrityTracker accumulates the mismatches reported by the operation store
+type integrityTracker struct {
+	mutex          sync.RWMutex
+	mismatched     uint64
+	hashMismatches uint64
+	idMismatches   uint64
+	recent         []*opstore.Mismatch
+}
+
+func (t *integrityTracker) handleMismatch(mismatch *opstore.Mismatch) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.mismatched++
+
+	if mismatch.HashMismatch {
+		t.hashMismatches++
+	}
+
+	if mismatch.IDMismatch {
+		t.idMismatches++
+	}
+
+	t.recent = append(t.recent, mismatch)
+	if len(t.recent) > maxRecentMismatches {
+		t.recent = t.recent[len(t.recent)-maxRecentMismatches:]
+	}
+}
+
+func (t *integrityTracker) report(channelID string, stats opstore.Stats) *IntegrityReport {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	recent := make([]*opstore.Mismatch, len(t.recent))
+	for i, mismatch := range t.recent {
+		m := *mismatch
+		recent[i] = &m
+	}
+
+	return &IntegrityReport{
+		ChannelID:        channelID,
+		Enabled:          true,
+		Verified:         stats.Verified,
+		Mismatched:       t.mismatched,
+		HashMismatches:   t.hashMismatches,
+		IDMismatches:     t.idMismatches,
+		Repaired:         stats.Repaired,
+		RecentMismatches: recent,
+	}
+}
@@ -0,0 +1,43 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package monitor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/opstore"
+)
+
+func TestIntegrityTracker(t *testing.T) {
+	tracker := &integrityTracker{}
+
+	for i := 0; i < maxRecentMismatches+10; i++ {
+		tracker.handleMismatch(&opstore.Mismatch{
+			Key:          fmt.Sprintf("key%d", i),
+			HashMismatch: true,
+			IDMismatch:   i%2 == 0,
+			Repaired:     true,
+		})
+	}
+
+	report := tracker.report(channel1, opstore.Stats{Verified: 200, Repaired: maxRecentMismatches + 10})
+	require.Equal(t, channel1, report.ChannelID)
+	require.True(t, report.Enabled)
+	require.Equal(t, uint64(200), report.Verified)
+	require.Equal(t, uint64(maxRecentMismatches+10), report.Mismatched)
+	require.Equal(t, uint64(maxRecentMismatches+10), report.HashMismatches)
+	require.Equal(t, uint64((maxRecentMismatches+10)/2), report.IDMismatches)
+	require.Equal(t, uint64(maxRecentMismatches+10), report.Repaired)
+
+	// Only the most recent mismatches are kept
+	require.Len(t, report.RecentMismatches, maxRecentMismatches)
+	require.Equal(t, "key10", report.RecentMismatches[0].Key)
+	require.Equal(t, fmt.Sprintf("key%d", maxRecentMismatches+9), report.RecentMismatches[maxRecentMismatches-1].Key)
+}
@@ -9,6 +9,7 @@ package monitor
 import (
 	"encoding/json"
 	"strings"
+	"sync"
 	"time"
 
 	cb "github.com/hyperledger/fabric-protos-go/common"
@@ -19,10 +20,16 @@ import (
 	"github.com/trustbloc/sidetree-core-go/pkg/observer"
 	"github.com/trustbloc/sidetree-fabric/pkg/client"
 	"github.com/trustbloc/sidetree-fabric/pkg/observer/common"
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/opstore"
 )
 
 var logger = flogging.MustGetLogger("sidetree_observer")
 
+var errStopped = errors.New("monitor was stopped")
+
+// errAborted is returned by a block worker that stopped retrying because another block failed
+var errAborted = errors.New("block processing was aborted")
+
 const (
 	docsMetaDataColName = "meta_data"
 )
@@ -49,22 +56,107 @@ type Monitor struct {
 	peerID       string
 	period       time.Duration
 	blockVisitor *blockvisitor.Visitor
+	finalVisitor *blockvisitor.Visitor
 	done         chan struct{}
+	stopOnce     sync.Once
 	txnProcessor *observer.TxnProcessor
+	opStore      *OperationStore
+	verify       bool
+	integrity    *integrityTracker
+	lastReport   uint64
+	deadLetters  *deadLetterStore
+	retryPeriod  time.Duration
+	parallelism  uint
+	retry        RetryConfig
+	breaker      *circuitBreaker
+	rescanner    rescanner
+
+	// errClasses holds the class of the error that halted the visit of a block, by block number. (The block
+	// visitor wraps the errors returned by the handlers in an error that doesn't expose the cause, so the
+	// class is recorded by the error handler.)
+	errClasses map[uint64]errClass
+	classMutex sync.Mutex
+
+	// metaMutex guards the generation, which is incremented when the last block processed is reset. A pass
+	// of the monitor stops committing blocks as soon as it sees that the generation has changed.
+	metaMutex      sync.Mutex
+	generation     uint64
+	passGeneration uint64
+}
+
+// Option is a monitor option
+type Option func(m *Monitor)
+
+// WithDeadLetterRetryPeriod sets the interval at which dead-lettered anchors are retried.
+// If not set (or set to 0) then dead letters are only retried when they are re-driven manually.
+func WithDeadLetterRetryPeriod(period time.Duration) Option {
+	return func(m *Monitor) {
+		m.retryPeriod = period
+	}
+}
+
+// WithParallelism sets the maximum number of blocks that are processed concurrently. Blocks are still
+// committed (i.e. the last block processed is updated) in order. If not set (or set to 0 or 1) then
+// blocks are processed one at a time.
+func WithParallelism(n uint) Option {
+	return func(m *Monitor) {
+		m.parallelism = n
+	}
+}
+
+// WithRetry sets the parameters for retrying blocks that fail to be processed.
+// Zero values are replaced with defaults.
+func WithRetry(cfg RetryConfig) Option {
+	return func(m *Monitor) {
+		m.retry = cfg
+	}
+}
+
+// WithCircuitBreaker sets the number of consecutive failures after which the monitor stops processing blocks
+// and the cool-down period after which processing is attempted again. Zero values are replaced with defaults.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(m *Monitor) {
+		m.breaker = newCircuitBreaker(m.channelID, threshold, cooldown)
+	}
+}
+
+// WithIntegrityVerification enables verification of the operations that already exist in the document store.
+// The stored content is compared with the anchored operations and mismatches are repaired.
+func WithIntegrityVerification() Option {
+	return func(m *Monitor) {
+		m.verify = true
+	}
 }
 
 // New returns a new document monitor
-func New(channelID, localPeerID string, period time.Duration, clientProviders *ClientProviders) *Monitor {
+func New(channelID, localPeerID string, period time.Duration, clientProviders *ClientProviders, opts ...Option) *Monitor {
 	m := &Monitor{
 		channelID:       channelID,
 		peerID:          localPeerID,
 		period:          period,
 		ClientProviders: clientProviders,
-		txnProcessor: observer.NewTxnProcessor(
-			NewSidetreeDCASReader(channelID, clientProviders.DCAS),
-			NewOperationStore(channelID, clientProviders.DCAS),
-		),
-		done: make(chan struct{}, 1),
+		deadLetters:     newDeadLetterStore(channelID, localPeerID, clientProviders.OffLedger),
+		errClasses:      make(map[uint64]errClass),
+		done:            make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	var storeOpts []opstore.Option
+	if m.verify {
+		m.integrity = &integrityTracker{}
+		storeOpts = append(storeOpts, opstore.WithVerification(m.integrity.handleMismatch))
+	}
+
+	m.opStore = NewOperationStore(channelID, clientProviders.DCAS, storeOpts...)
+	m.txnProcessor = observer.NewTxnProcessor(NewSidetreeDCASReader(channelID, clientProviders.DCAS), m.opStore)
+
+	m.retry = m.retry.withDefaults()
+
+	if m.breaker == nil {
+		m.breaker = newCircuitBreaker(channelID, 0, 0)
 	}
 
 	m.blockVisitor = blockvisitor.New(channelID,
@@ -72,6 +164,13 @@ func New(channelID, localPeerID string, period time.Duration, clientProviders *C
 		blockvisitor.WithErrorHandler(m.handleError),
 	)
 
+	// The final visitor is used on the last attempt at a block. Anchors whose content is
+	// still not found are dead-lettered instead of the block being retried.
+	m.finalVisitor = blockvisitor.New(channelID,
+		blockvisitor.WithWriteHandler(m.handleWrite),
+		blockvisitor.WithErrorHandler(m.handleFinalError),
+	)
+
 	return m
 }
 
@@ -93,7 +192,21 @@ func (m *Monitor) Start() error {
 func (m *Monitor) Stop() {
 	logger.Infof("[%s] Stopping monitor", m.channelID)
 
-	m.done <- struct{}{}
+	m.stopOnce.Do(func() { close(m.done) })
+}
+
+// IntegrityReport returns the integrity report for the channel
+func (m *Monitor) IntegrityReport() *IntegrityReport {
+	if !m.verify {
+		return &IntegrityReport{ChannelID: m.channelID}
+	}
+
+	return m.integrity.report(m.channelID, m.opStore.Stats())
+}
+
+// CircuitState returns the current state of the monitor's circuit breaker
+func (m *Monitor) CircuitState() CircuitState {
+	return m.breaker.State()
 }
 
 func (m *Monitor) run() {
@@ -102,14 +215,33 @@ func (m *Monitor) run() {
 	ticker := time.NewTicker(m.period)
 	defer ticker.Stop()
 
+	var retryC <-chan time.Time
+	if m.retryPeriod > 0 {
+		logger.Infof("[%s] Dead letters will be retried with a period of %s", m.channelID, m.retryPeriod)
+
+		retryTicker := time.NewTicker(m.retryPeriod)
+		defer retryTicker.Stop()
+
+		retryC = retryTicker.C
+	}
+
 	for {
 		select {
+		case <-retryC:
+			m.retryDeadLetters()
 		case <-ticker.C:
-			if err := m.check(); err != nil {
-				if errors.Cause(err) == client.ErrNoLedger {
+			err := m.check()
+			m.logIntegrityReport()
+			if err != nil {
+				switch {
+				case errors.Cause(err) == client.ErrNoLedger:
 					// This happens before the channel is created. Just log an info since it's not serious.
 					logger.Infof("[%s] Unable to check blocks since the channel doesn't exist", m.channelID)
-				} else {
+				case errors.Cause(err) == errReset:
+					logger.Infof("[%s] Stopped checking blocks since the last block processed was reset", m.channelID)
+				case errors.Cause(err) == errStopped:
+					logger.Debugf("[%s] Stopped checking blocks since the monitor was stopped", m.channelID)
+				default:
 					logger.Warnf("[%s] Error checking blocks: %s", m.channelID, err)
 				}
 			}
@@ -120,7 +252,37 @@ func (m *Monitor) run() {
 	}
 }
 
+// logIntegrityReport logs the integrity report if any operations were verified since the report was last logged
+func (m *Monitor) logIntegrityReport() {
+	if !m.verify {
+		return
+	}
+
+	report := m.IntegrityReport()
+	if report.Verified == m.lastReport {
+		return
+	}
+
+	m.lastReport = report.Verified
+
+	if report.Mismatched > 0 {
+		logger.Warnf("[%s] Integrity report - Verified: %d, Mismatched: %d, Hash mismatches: %d, ID mismatches: %d, Repaired: %d",
+			m.channelID, report.Verified, report.Mismatched, report.HashMismatches, report.IDMismatches, report.Repaired)
+	} else {
+		logger.Infof("[%s] Integrity report - Verified: %d, Mismatched: 0", m.channelID, report.Verified)
+	}
+}
+
 func (m *Monitor) check() error {
+	if !m.breaker.allow() {
+		logger.Debugf("[%s] Not checking blocks since the circuit breaker is %s", m.channelID, CircuitOpen)
+		return nil
+	}
+
+	m.metaMutex.Lock()
+	m.passGeneration = m.generation
+	m.metaMutex.Unlock()
+
 	bcInfo, err := m.getBlockchainInfo()
 	if err != nil {
 		return err
@@ -132,6 +294,10 @@ func (m *Monitor) check() error {
 
 	logger.Debugf("[%s] Checking documents - Block height [%d], last block processed [%d]", m.channelID, bcInfo.Height, lastBlockNum)
 
+	if m.parallelism > 1 && bcInfo.Height > lastBlockNum+2 {
+		return m.checkBlocksConcurrently(lastBlockNum+1, bcInfo.Height)
+	}
+
 	for bNum := lastBlockNum + 1; bNum < bcInfo.Height; bNum++ {
 		logger.Debugf("[%s] Checking block [%d]", m.channelID, bNum)
 		if err = m.checkBlock(bNum); err != nil {
@@ -143,16 +309,147 @@ func (m *Monitor) check() error {
 	return nil
 }
 
+type blockResult struct {
+	bNum uint64
+	err  chan error
+}
+
+// checkBlocksConcurrently processes blocks from (and including) 'from' up to (but not including) 'to' using up to
+// 'parallelism' concurrent workers. The results are consumed in block order so that the last block processed is
+// only ever advanced past blocks that were successfully processed.
+func (m *Monitor) checkBlocksConcurrently(from, to uint64) error {
+	logger.Debugf("[%s] Checking blocks [%d] to [%d] with a parallelism of %d", m.channelID, from, to-1, m.parallelism)
+
+	// The committer holds one result while it waits for it so the buffer allows for
+	// a total of 'parallelism' blocks to be in progress at any one time
+	pending := make(chan *blockResult, m.parallelism-1)
+	abort := make(chan struct{})
+
+	go func() {
+		defer close(pending)
+
+		for bNum := from; bNum < to; bNum++ {
+			r := &blockResult{bNum: bNum, err: make(chan error, 1)}
+
+			select {
+			case pending <- r:
+			case <-abort:
+				return
+			}
+
+			go func() {
+				logger.Debugf("[%s] Checking block [%d]", m.channelID, r.bNum)
+				r.err <- m.processBlock(r.bNum, abort)
+			}()
+		}
+	}()
+
+	for r := range pending {
+		err := <-r.err
+		if err == nil {
+			err = m.commitBlock(r.bNum)
+		}
+
+		if err != nil {
+			logger.Errorf("[%s] Error checking block [%d]: %s", m.channelID, r.bNum, err)
+
+			close(abort)
+
+			// Wait for the blocks that are still in progress
+			for r := range pending {
+				<-r.err
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (m *Monitor) checkBlock(bNum uint64) error {
+	if err := m.processBlock(bNum, nil); err != nil {
+		return err
+	}
+
+	return m.commitBlock(bNum)
+}
+
+// processBlock processes the given block, retrying with exponential backoff on failure. The circuit breaker
+// is notified of the outcome of each attempt and retries stop as soon as the circuit is opened. Retries also
+// stop when the monitor is stopped or when the given abort channel is closed (a nil channel is never closed).
+func (m *Monitor) processBlock(bNum uint64, abort <-chan struct{}) error {
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-m.done:
+			return errStopped
+		case <-abort:
+			return errAborted
+		default:
+		}
+
+		visitor := m.blockVisitor
+		if attempt >= m.retry.MaxAttempts {
+			visitor = m.finalVisitor
+		}
+
+		err := m.visitBlock(bNum, visitor)
+		if err == nil {
+			m.breaker.success()
+			return nil
+		}
+
+		class := m.errClassOf(bNum, err)
+
+		switch class {
+		case errClassNoLedger:
+			return err
+		case errClassNotFound:
+			// Missing content doesn't indicate that the peer is unhealthy
+		default:
+			m.breaker.failure()
+		}
+
+		if attempt >= m.retry.MaxAttempts {
+			return errors.WithMessagef(err, "giving up on block [%d] after %d attempts", bNum, attempt)
+		}
+
+		if !m.breaker.allow() {
+			return errors.WithMessagef(err, "giving up on block [%d] since the circuit breaker is %s", bNum, CircuitOpen)
+		}
+
+		backoff := m.retry.backoff(attempt)
+
+		logger.Warnf("[%s] Will retry block [%d] in %s (attempt %d of %d) on %s error: %s", m.channelID, bNum, backoff, attempt, m.retry.MaxAttempts, class, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-m.done:
+			return errStopped
+		case <-abort:
+			return errAborted
+		}
+	}
+}
+
+func (m *Monitor) visitBlock(bNum uint64, visitor *blockvisitor.Visitor) error {
 	var block *cb.Block
 	var err error
 	if block, err = m.getBlockByNumber(bNum); err != nil {
 		return errors.WithMessagef(err, "error getting block [%d]", bNum)
 	}
-	if err = m.blockVisitor.Visit(block); err != nil {
-		return err
+	return visitor.Visit(block)
+}
+
+func (m *Monitor) commitBlock(bNum uint64) error {
+	m.metaMutex.Lock()
+	defer m.metaMutex.Unlock()
+
+	if m.generation != m.passGeneration {
+		return errReset
 	}
-	if err = m.setLastBlockProcessed(bNum); err != nil {
+
+	if err := m.setLastBlockProcessed(bNum); err != nil {
 		return errors.WithMessagef(err, "error setting last block processed for block [%d]", bNum)
 	}
 	return nil
@@ -169,33 +466,162 @@ func (m *Monitor) handleWrite(w *blockvisitor.Write) error {
 	}
 
 	logger.Debugf("[%s] Handling write to anchor [%s] in block [%d] and TxNum [%d]", m.channelID, w.Write.Value, w.BlockNum, w.TxNum)
+
+	return m.processAnchor(w.BlockNum, w.TxNum, string(w.Write.Value))
+}
+
+func (m *Monitor) processAnchor(blockNum, txNum uint64, anchorAddress string) error {
 	sidetreeTxn := observer.SidetreeTxn{
-		TransactionTime:   w.BlockNum,
-		TransactionNumber: w.TxNum,
-		AnchorAddress:     string(w.Write.Value),
+		TransactionTime:   blockNum,
+		TransactionNumber: txNum,
+		AnchorAddress:     anchorAddress,
 	}
 	if err := m.txnProcessor.Process(sidetreeTxn); err != nil {
-		return errors.WithMessagef(err, "error processing Txn for anchor [%s] in block [%d] and TxNum [%d]", w.Write.Key, w.BlockNum, w.TxNum)
+		return errors.WithMessagef(err, "error processing Txn for anchor [%s] in block [%d] and TxNum [%d]", anchorAddress, blockNum, txNum)
 	}
 	return nil
 }
 
 func (m *Monitor) handleError(err error, ctx *blockvisitor.Context) error {
+	return m.doHandleError(err, ctx, false)
+}
+
+func (m *Monitor) handleFinalError(err error, ctx *blockvisitor.Context) error {
+	return m.doHandleError(err, ctx, true)
+}
+
+func (m *Monitor) doHandleError(err error, ctx *blockvisitor.Context, final bool) error {
 	if ctx.Category == blockvisitor.UnmarshalErr {
 		logger.Errorf("[%s] Ignoring persistent error: %s. Context: %s", m.channelID, err, ctx)
 		return nil
 	}
 
-	merr, ok := errors.Cause(err).(monitorError)
-	if !ok || !merr.Transient() {
-		logger.Errorf("[%s] Ignoring persistent error: %s. Context: %s", m.channelID, err, ctx)
+	class := classify(err)
+
+	switch class {
+	case errClassTransient, errClassTimeout, errClassNoLedger:
+		logger.Debugf("[%s] Transient error [%s] will be retried. Context: %s", m.channelID, err, ctx)
+		return m.halt(ctx.BlockNum, class, err)
+	case errClassNotFound:
+		if !final {
+			logger.Debugf("[%s] Content not found [%s] - will retry. Context: %s", m.channelID, err, ctx)
+			return m.halt(ctx.BlockNum, class, err)
+		}
+	}
+
+	if ctx.Category == blockvisitor.WriteHandlerErr && ctx.Write != nil {
+		if e := m.deadLetter(err, ctx.Write); e != nil {
+			return m.halt(ctx.BlockNum, classify(e), e)
+		}
+
 		return nil
 	}
 
-	logger.Warnf("[%s] Will retry on transient error [%s] in %s. Context: %s", m.channelID, err, m.period, ctx)
+	logger.Errorf("[%s] Ignoring persistent error: %s. Context: %s", m.channelID, err, ctx)
+	return nil
+}
+
+// halt records the class of the given error for the given block and returns the error
+// so that the visit of the block is halted
+func (m *Monitor) halt(blockNum uint64, class errClass, err error) error {
+	m.classMutex.Lock()
+	defer m.classMutex.Unlock()
+
+	m.errClasses[blockNum] = class
+
 	return err
 }
 
+// errClassOf returns (and clears) the class that was recorded by the error handler for the given block.
+// If no class was recorded (e.g. the block couldn't be retrieved) then the given error is classified.
+func (m *Monitor) errClassOf(blockNum uint64, err error) errClass {
+	m.classMutex.Lock()
+	defer m.classMutex.Unlock()
+
+	class, ok := m.errClasses[blockNum]
+	if !ok {
+		return classify(err)
+	}
+
+	delete(m.errClasses, blockNum)
+
+	return class
+}
+
+// DeadLetters returns the anchors that the monitor was unable to process, ordered by block and transaction number
+func (m *Monitor) DeadLetters() ([]*DeadLetter, error) {
+	return m.deadLetters.list()
+}
+
+// Redrive attempts to process the dead-lettered anchor at the given block and transaction number. The dead letter
+// is removed if the anchor is processed successfully; otherwise the dead letter is updated and the error is returned.
+func (m *Monitor) Redrive(blockNum, txNum uint64) error {
+	dl, err := m.deadLetters.get(blockNum, txNum)
+	if err != nil {
+		return err
+	}
+
+	return m.redrive(dl)
+}
+
+func (m *Monitor) redrive(dl *DeadLetter) error {
+	logger.Debugf("[%s] Re-driving dead-lettered anchor [%s] in block [%d] and TxNum [%d]", m.channelID, dl.AnchorAddress, dl.BlockNum, dl.TxNum)
+
+	if err := m.processAnchor(dl.BlockNum, dl.TxNum, dl.AnchorAddress); err != nil {
+		if e := m.deadLetters.add(&DeadLetter{
+			BlockNum:      dl.BlockNum,
+			TxNum:         dl.TxNum,
+			AnchorAddress: dl.AnchorAddress,
+			Error:         err.Error(),
+			FirstFailed:   dl.FirstFailed,
+			LastAttempt:   time.Now(),
+		}); e != nil {
+			logger.Errorf("[%s] Error updating dead letter for anchor [%s] in block [%d] and TxNum [%d]: %s", m.channelID, dl.AnchorAddress, dl.BlockNum, dl.TxNum, e)
+		}
+
+		return err
+	}
+
+	logger.Infof("[%s] Successfully processed dead-lettered anchor [%s] in block [%d] and TxNum [%d]", m.channelID, dl.AnchorAddress, dl.BlockNum, dl.TxNum)
+
+	return m.deadLetters.remove(dl.BlockNum, dl.TxNum)
+}
+
+func (m *Monitor) retryDeadLetters() {
+	dls, err := m.deadLetters.list()
+	if err != nil {
+		logger.Warnf("[%s] Error retrieving dead letters: %s", m.channelID, err)
+		return
+	}
+
+	for _, dl := range dls {
+		if err := m.redrive(dl); err != nil {
+			logger.Warnf("[%s] Error retrying dead-lettered anchor [%s] in block [%d] and TxNum [%d]: %s", m.channelID, dl.AnchorAddress, dl.BlockNum, dl.TxNum, err)
+		}
+	}
+}
+
+// deadLetter records the anchor of the given write in the dead-letter collection. An error is returned only if the
+// dead letter could not be persisted, in which case the block is retried.
+func (m *Monitor) deadLetter(err error, w *blockvisitor.Write) error {
+	logger.Errorf("[%s] Dead-lettering anchor [%s] in block [%d] and TxNum [%d] due to persistent error: %s", m.channelID, w.Write.Value, w.BlockNum, w.TxNum, err)
+
+	now := time.Now()
+
+	if e := m.deadLetters.add(&DeadLetter{
+		BlockNum:      w.BlockNum,
+		TxNum:         w.TxNum,
+		AnchorAddress: string(w.Write.Value),
+		Error:         err.Error(),
+		FirstFailed:   now,
+		LastAttempt:   now,
+	}); e != nil {
+		return errors.WithMessagef(e, "unable to dead-letter anchor [%s] in block [%d] and TxNum [%d]", w.Write.Value, w.BlockNum, w.TxNum)
+	}
+
+	return nil
+}
+
 func (m *Monitor) getBlockchainInfo() (*cb.BlockchainInfo, error) {
 	bcClient, err := m.blockchainClient()
 	if err != nil {
@@ -7,8 +7,10 @@ SPDX-License-Identifier: Apache-2.0
 package monitor
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -19,6 +21,8 @@ import (
 	peerextmocks "github.com/trustbloc/fabric-peer-ext/pkg/mocks"
 	"github.com/trustbloc/sidetree-core-go/pkg/api/batch"
 	"github.com/trustbloc/sidetree-core-go/pkg/observer"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/client"
 	stmocks "github.com/trustbloc/sidetree-fabric/pkg/mocks"
 	"github.com/trustbloc/sidetree-fabric/pkg/observer/common"
 	"github.com/trustbloc/sidetree-fabric/pkg/observer/mocks"
@@ -33,6 +37,12 @@ const (
 	sleepTime     = 200 * time.Millisecond
 )
 
+var testRetryConfig = RetryConfig{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+}
+
 func TestMonitor(t *testing.T) {
 	bcInfo := &cb.BlockchainInfo{
 		Height: 1002,
@@ -83,8 +93,7 @@ func TestMonitor(t *testing.T) {
 
 	clients.dcas.GetReturnsOnCall(0, anchorFileBytes, nil)
 	clients.dcas.GetReturnsOnCall(1, batchFileBytes, nil)
-	clients.dcas.GetReturnsOnCall(2, op1Bytes, nil)
-	clients.dcas.GetReturnsOnCall(3, op2Bytes, nil)
+	clients.dcas.GetMultipleKeysReturns([][]byte{op1Bytes, op2Bytes}, nil)
 
 	t.Run("Success", func(t *testing.T) {
 		m := newMonitorWithMocks(t, channel1, monitorPeriod, clients)
@@ -345,6 +354,401 @@ func TestMonitor_Error(t *testing.T) {
 	})
 }
 
+func TestMonitor_DeadLetter(t *testing.T) {
+	b := peerextmocks.NewBlockBuilder(channel1, 1001)
+	b.Transaction(txID1, pb.TxValidationCode_VALID).
+		ChaincodeAction(common.SidetreeNs).
+		Write(common.AnchorAddrPrefix+anchor1, []byte(anchor1))
+
+	op1 := &batch.Operation{ID: "op1"}
+	op1Bytes, err := json.Marshal(op1)
+	require.NoError(t, err)
+
+	batchFileBytes, err := json.Marshal(&observer.BatchFile{
+		Operations: []string{base64.URLEncoding.EncodeToString(op1Bytes)},
+	})
+	require.NoError(t, err)
+
+	anchorFileBytes, err := json.Marshal(&observer.AnchorFile{})
+	require.NoError(t, err)
+
+	clients := newMockClients()
+	clients.blockchain.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1002}, nil)
+	clients.blockchain.GetBlockByNumberReturns(b.Build(), nil)
+	clients.dcas.GetMultipleKeysReturns([][]byte{op1Bytes}, nil)
+
+	m := newMonitorWithMocks(t, channel1, monitorPeriod, clients)
+	require.NoError(t, m.setLastBlockProcessed(1000))
+
+	// The anchor file isn't found
+	require.NoError(t, m.check())
+
+	lastBlock, err := m.lastBlockProcessed()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1001), lastBlock)
+
+	dls, err := m.DeadLetters()
+	require.NoError(t, err)
+	require.Len(t, dls, 1)
+	require.Equal(t, uint64(1001), dls[0].BlockNum)
+	require.Equal(t, uint64(0), dls[0].TxNum)
+	require.Equal(t, anchor1, dls[0].AnchorAddress)
+	require.Contains(t, dls[0].Error, "content not found")
+	require.Equal(t, 1, dls[0].Attempts)
+
+	t.Run("Redrive error", func(t *testing.T) {
+		err := m.Redrive(1001, 0)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "content not found")
+
+		dls, err := m.DeadLetters()
+		require.NoError(t, err)
+		require.Len(t, dls, 1)
+		require.Equal(t, 2, dls[0].Attempts)
+
+		require.Equal(t, ErrDeadLetterNotFound, m.Redrive(1001, 1))
+	})
+
+	clients.dcas.GetStub = func(ns, coll, key string) ([]byte, error) {
+		if key == anchor1 {
+			return anchorFileBytes, nil
+		}
+		return batchFileBytes, nil
+	}
+
+	t.Run("Redrive", func(t *testing.T) {
+		require.NoError(t, m.Redrive(1001, 0))
+
+		dls, err := m.DeadLetters()
+		require.NoError(t, err)
+		require.Empty(t, dls)
+	})
+
+	t.Run("Periodic retry", func(t *testing.T) {
+		var available int32
+		clients.dcas.GetStub = func(ns, coll, key string) ([]byte, error) {
+			if atomic.LoadInt32(&available) == 0 {
+				return nil, nil
+			}
+			if key == anchor1 {
+				return anchorFileBytes, nil
+			}
+			return batchFileBytes, nil
+		}
+		clients.blockchain.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1003}, nil)
+
+		m := newMonitorWithMocks(t, channel1, monitorPeriod, clients, WithDeadLetterRetryPeriod(monitorPeriod))
+		require.NoError(t, m.Start())
+		defer m.Stop()
+
+		time.Sleep(sleepTime)
+
+		dls, err := m.DeadLetters()
+		require.NoError(t, err)
+		require.Len(t, dls, 1)
+		require.True(t, dls[0].Attempts > 1)
+
+		atomic.StoreInt32(&available, 1)
+
+		time.Sleep(sleepTime)
+
+		dls, err = m.DeadLetters()
+		require.NoError(t, err)
+		require.Empty(t, dls)
+	})
+
+	t.Run("Dead-letter error", func(t *testing.T) {
+		clients := newMockClients()
+		clients.blockchain.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1002}, nil)
+		clients.blockchain.GetBlockByNumberReturns(b.Build(), nil)
+		clients.offLedger.WithPutErrorForKey(common.DocNs, deadLetterColName, peer1, errors.New("injected off-ledger error"))
+
+		m := newMonitorWithMocks(t, channel1, monitorPeriod, clients)
+		require.NoError(t, m.setLastBlockProcessed(1000))
+
+		// The block isn't marked as processed if the dead letter can't be persisted
+		err := m.check()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unable to dead-letter anchor")
+
+		lastBlock, err := m.lastBlockProcessed()
+		require.NoError(t, err)
+		require.Equal(t, uint64(1000), lastBlock)
+	})
+}
+
+func TestMonitor_Parallel(t *testing.T) {
+	const (
+		lastBlock = 1000
+		height    = 1021
+	)
+
+	blocks := make(map[uint64]*cb.Block)
+	for bNum := uint64(lastBlock + 1); bNum < height; bNum++ {
+		b := peerextmocks.NewBlockBuilder(channel1, bNum)
+		b.Transaction(txID1, pb.TxValidationCode_VALID).
+			ChaincodeAction(common.SidetreeNs).
+			Write(common.AnchorAddrPrefix+anchor1, []byte(anchor1))
+		blocks[bNum] = b.Build()
+	}
+
+	op1Bytes, err := json.Marshal(&batch.Operation{ID: "op1"})
+	require.NoError(t, err)
+
+	batchFileBytes, err := json.Marshal(&observer.BatchFile{
+		Operations: []string{base64.URLEncoding.EncodeToString(op1Bytes)},
+	})
+	require.NoError(t, err)
+
+	anchorFileBytes, err := json.Marshal(&observer.AnchorFile{})
+	require.NoError(t, err)
+
+	newClients := func(failBlock uint64) *mockClients {
+		clients := newMockClients()
+		clients.blockchain.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: height}, nil)
+		clients.blockchain.GetBlockByNumberStub = func(bNum uint64) (*cb.Block, error) {
+			if bNum == failBlock {
+				return nil, errors.New("injected blockchain error")
+			}
+			return blocks[bNum], nil
+		}
+		clients.dcas.GetStub = func(ns, coll, key string) ([]byte, error) {
+			if key == anchor1 {
+				return anchorFileBytes, nil
+			}
+			return batchFileBytes, nil
+		}
+		clients.dcas.GetMultipleKeysReturns([][]byte{op1Bytes}, nil)
+
+		return clients
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		clients := newClients(0)
+
+		m := newMonitorWithMocks(t, channel1, monitorPeriod, clients, WithParallelism(4))
+		require.NoError(t, m.setLastBlockProcessed(lastBlock))
+		require.NoError(t, m.check())
+
+		last, err := m.lastBlockProcessed()
+		require.NoError(t, err)
+		require.Equal(t, uint64(height-1), last)
+		require.Equal(t, height-lastBlock-1, clients.blockchain.GetBlockByNumberCallCount())
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		clients := newClients(1010)
+
+		m := newMonitorWithMocks(t, channel1, monitorPeriod, clients, WithParallelism(4))
+		require.NoError(t, m.setLastBlockProcessed(lastBlock))
+
+		err := m.check()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "injected blockchain error")
+
+		// The last block processed doesn't advance past the failed block
+		last, err := m.lastBlockProcessed()
+		require.NoError(t, err)
+		require.Equal(t, uint64(1009), last)
+
+		clients.blockchain.GetBlockByNumberStub = func(bNum uint64) (*cb.Block, error) {
+			return blocks[bNum], nil
+		}
+
+		require.NoError(t, m.check())
+
+		last, err = m.lastBlockProcessed()
+		require.NoError(t, err)
+		require.Equal(t, uint64(height-1), last)
+	})
+
+	t.Run("Abort", func(t *testing.T) {
+		clients := newClients(0)
+		clients.blockchain.GetBlockByNumberStub = func(bNum uint64) (*cb.Block, error) {
+			if bNum == lastBlock+1 {
+				// The first block fails without being retried
+				return nil, client.ErrNoLedger
+			}
+
+			return nil, errors.New("injected blockchain error")
+		}
+
+		m := newMonitorWithMocks(t, channel1, monitorPeriod, clients,
+			WithParallelism(4),
+			WithCircuitBreaker(100, time.Minute),
+			WithRetry(RetryConfig{MaxAttempts: 5, InitialBackoff: 10 * time.Second, MaxBackoff: 10 * time.Second}),
+		)
+		require.NoError(t, m.setLastBlockProcessed(lastBlock))
+
+		start := time.Now()
+
+		err := m.check()
+		require.Error(t, err)
+		require.Equal(t, client.ErrNoLedger, errors.Cause(err))
+
+		// The workers that were in progress stop retrying as soon as the first block fails
+		require.True(t, time.Since(start) < 5*time.Second)
+		require.True(t, clients.blockchain.GetBlockByNumberCallCount() <= 4)
+	})
+}
+
+func TestMonitor_CircuitBreaker(t *testing.T) {
+	const cooldown = 100 * time.Millisecond
+
+	b := peerextmocks.NewBlockBuilder(channel1, 1001)
+	b.Transaction(txID1, pb.TxValidationCode_VALID).
+		ChaincodeAction(common.SidetreeNs).
+		Write(common.AnchorAddrPrefix+anchor1, []byte(anchor1))
+
+	clients := newMockClients()
+	clients.blockchain.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1002}, nil)
+	clients.blockchain.GetBlockByNumberReturns(b.Build(), nil)
+	clients.dcas.GetReturns(nil, context.DeadlineExceeded)
+
+	m := newMonitorWithMocks(t, channel1, monitorPeriod, clients, WithCircuitBreaker(2, cooldown))
+	require.NoError(t, m.setLastBlockProcessed(1000))
+
+	err := m.check()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "circuit breaker is OPEN")
+	require.Equal(t, CircuitOpen, m.CircuitState())
+	require.Equal(t, 2, clients.dcas.GetCallCount())
+
+	// Blocks aren't checked while the circuit is open
+	require.NoError(t, m.check())
+	require.Equal(t, 2, clients.dcas.GetCallCount())
+
+	time.Sleep(cooldown)
+
+	anchorFileBytes, err := json.Marshal(&observer.AnchorFile{})
+	require.NoError(t, err)
+	batchFileBytes, err := json.Marshal(&observer.BatchFile{})
+	require.NoError(t, err)
+
+	clients.dcas.GetReturnsOnCall(2, anchorFileBytes, nil)
+	clients.dcas.GetReturnsOnCall(3, batchFileBytes, nil)
+
+	require.NoError(t, m.check())
+	require.Equal(t, CircuitClosed, m.CircuitState())
+
+	lastBlock, err := m.lastBlockProcessed()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1001), lastBlock)
+
+	t.Run("Content not found doesn't trip the breaker", func(t *testing.T) {
+		clients := newMockClients()
+		clients.blockchain.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1002}, nil)
+		clients.blockchain.GetBlockByNumberReturns(b.Build(), nil)
+
+		m := newMonitorWithMocks(t, channel1, monitorPeriod, clients,
+			WithCircuitBreaker(2, cooldown),
+			WithRetry(RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}),
+		)
+		require.NoError(t, m.setLastBlockProcessed(1000))
+
+		// The anchor is dead-lettered after the last attempt
+		require.NoError(t, m.check())
+		require.Equal(t, CircuitClosed, m.CircuitState())
+		require.Equal(t, 3, clients.dcas.GetCallCount())
+
+		dls, err := m.DeadLetters()
+		require.NoError(t, err)
+		require.Len(t, dls, 1)
+
+		lastBlock, err := m.lastBlockProcessed()
+		require.NoError(t, err)
+		require.Equal(t, uint64(1001), lastBlock)
+	})
+
+	t.Run("Timeouts trip the breaker", func(t *testing.T) {
+		clients := newMockClients()
+		clients.blockchain.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1002}, nil)
+		clients.blockchain.GetBlockByNumberReturns(b.Build(), nil)
+		clients.dcas.GetReturns(nil, context.DeadlineExceeded)
+
+		m := newMonitorWithMocks(t, channel1, monitorPeriod, clients, WithCircuitBreaker(2, cooldown))
+		require.NoError(t, m.setLastBlockProcessed(1000))
+
+		err := m.check()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "circuit breaker is OPEN")
+		require.Contains(t, err.Error(), "giving up on block [1001]")
+		require.Empty(t, m.errClasses)
+	})
+}
+
+func TestMonitor_Integrity(t *testing.T) {
+	dcasClient := mocks.NewMockDCASClient()
+
+	op1Bytes, err := json.Marshal(&batch.Operation{ID: "op1", UniqueSuffix: "suffix1"})
+	require.NoError(t, err)
+
+	batchFileBytes, err := json.Marshal(&observer.BatchFile{
+		Operations: []string{base64.URLEncoding.EncodeToString(op1Bytes)},
+	})
+	require.NoError(t, err)
+
+	batchKey, err := dcasClient.Put(common.SidetreeNs, common.SidetreeColl, batchFileBytes)
+	require.NoError(t, err)
+
+	anchorFileBytes, err := json.Marshal(&observer.AnchorFile{BatchFileHash: batchKey})
+	require.NoError(t, err)
+
+	anchorKey, err := dcasClient.Put(common.SidetreeNs, common.SidetreeColl, anchorFileBytes)
+	require.NoError(t, err)
+
+	b := peerextmocks.NewBlockBuilder(channel1, 1001)
+	b.Transaction(txID1, pb.TxValidationCode_VALID).
+		ChaincodeAction(common.SidetreeNs).
+		Write(common.AnchorAddrPrefix+anchorKey, []byte(anchorKey))
+
+	clients := newMockClients()
+	clients.blockchain.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1002}, nil)
+	clients.blockchain.GetBlockByNumberReturns(b.Build(), nil)
+	clients.dcasProvider.ForChannelReturns(dcasClient, nil)
+
+	m := newMonitorWithMocks(t, channel1, monitorPeriod, clients)
+	require.Equal(t, &IntegrityReport{ChannelID: channel1}, m.IntegrityReport())
+
+	require.NoError(t, m.setLastBlockProcessed(1000))
+	require.NoError(t, m.check())
+
+	docs, err := dcasClient.GetMap(common.DocNs, common.DocColl)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+
+	var opKey string
+	var opValue []byte
+	for k, v := range docs {
+		opKey, opValue = k, v
+	}
+
+	// Corrupt the stored operation
+	require.NoError(t, dcasClient.MockOffLedgerClient.Put(common.DocNs, common.DocColl, opKey, []byte(`{"id":"op2"}`)))
+
+	m = newMonitorWithMocks(t, channel1, monitorPeriod, clients, WithIntegrityVerification())
+	require.NoError(t, m.setLastBlockProcessed(1000))
+	require.NoError(t, m.check())
+
+	report := m.IntegrityReport()
+	require.True(t, report.Enabled)
+	require.Equal(t, uint64(1), report.Verified)
+	require.Equal(t, uint64(1), report.Mismatched)
+	require.Equal(t, uint64(1), report.HashMismatches)
+	require.Equal(t, uint64(1), report.IDMismatches)
+	require.Equal(t, uint64(1), report.Repaired)
+	require.Len(t, report.RecentMismatches, 1)
+	require.Equal(t, opKey, report.RecentMismatches[0].Key)
+	require.True(t, report.RecentMismatches[0].Repaired)
+
+	m.logIntegrityReport()
+	require.Equal(t, uint64(1), m.lastReport)
+
+	stored, err := dcasClient.Get(common.DocNs, common.DocColl, opKey)
+	require.NoError(t, err)
+	require.Equal(t, opValue, stored)
+}
+
 type mockClients struct {
 	offLedgerProvider  *mocks.OffLedgerClientProvider
 	dcasProvider       *stmocks.DCASClientProvider
@@ -373,7 +777,7 @@ func newMockClients() *mockClients {
 	return clients
 }
 
-func newMonitorWithMocks(t *testing.T, channelID string, period time.Duration, clients *mockClients) *Monitor {
+func newMonitorWithMocks(t *testing.T, channelID string, period time.Duration, clients *mockClients, opts ...Option) *Monitor {
 	m := New(
 		channelID, peer1, period,
 		&ClientProviders{
@@ -381,6 +785,7 @@ func newMonitorWithMocks(t *testing.T, channelID string, period time.Duration, c
 			DCAS:       clients.dcasProvider,
 			Blockchain: clients.blockchainProvider,
 		},
+		append([]Option{WithRetry(testRetryConfig)}, opts...)...,
 	)
 	require.NotNil(t, m)
 
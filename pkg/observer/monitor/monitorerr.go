@@ -9,6 +9,7 @@ package monitor
 type monitorError struct {
 	cause     error
 	transient bool
+	notFound  bool
 }
 
 func newMonitorError(cause error, transient bool) monitorError {
@@ -18,6 +19,15 @@ func newMonitorError(cause error, transient bool) monitorError {
 	}
 }
 
+// newNotFoundError returns an error indicating that content was not found in DCAS. The error is not transient
+// but the content may still be in the process of being distributed to this peer.
+func newNotFoundError(cause error) monitorError {
+	return monitorError{
+		cause:    cause,
+		notFound: true,
+	}
+}
+
 func (e monitorError) Error() string {
 	return e.cause.Error()
 }
@@ -25,3 +35,7 @@ func (e monitorError) Error() string {
 func (e monitorError) Transient() bool {
 	return e.transient
 }
+
+func (e monitorError) NotFound() bool {
+	return e.notFound
+}
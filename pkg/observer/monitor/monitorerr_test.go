@@ -20,3 +20,11 @@ func TestMonitorError(t *testing.T) {
 	require.Equal(t, err.Error(), merr.Error())
 	require.True(t, merr.Transient())
 }
+
+func TestNotFoundError(t *testing.T) {
+	err := errors.New("content not found")
+	merr := newNotFoundError(err)
+	require.Equal(t, err.Error(), merr.Error())
+	require.False(t, merr.Transient())
+	require.True(t, merr.NotFound())
+}
@@ -0,0 +1,161 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalidBlockRange indicates that the requested block (or range of blocks) is not valid for the ledger
+	ErrInvalidBlockRange = errors.New("invalid block range")
+
+	// ErrRescanInProgress indicates that a rescan was requested while another rescan is still in progress
+	ErrRescanInProgress = errors.New("a rescan is already in progress")
+
+	// errReset is returned by a pass of the monitor that was interrupted because the last block processed was reset
+	errReset = errors.New("last block processed was reset")
+)
+
+// RescanStatus holds the status of a bounded rescan
+type RescanStatus struct {
+	From             uint64
+	To               uint64
+	LastBlockScanned uint64
+	InProgress       bool
+	Error            string
+	StartedAt        time.Time
+	CompletedAt      time.Time
+}
+
+// rescanner tracks the bounded rescan that runs alongside the live monitor
+type rescanner struct {
+	mutex  sync.RWMutex
+	status *RescanStatus
+}
+
+// Reset sets the last block processed so that the monitor re-verifies all blocks after the given block on
+// its next pass. If the monitor is in the middle of a pass then the pass is interrupted so that the last
+// block processed isn't overwritten by the blocks that are still in progress.
+func (m *Monitor) Reset(lastBlockProcessed uint64) error {
+	bcInfo, err := m.getBlockchainInfo()
+	if err != nil {
+		return err
+	}
+
+	if lastBlockProcessed >= bcInfo.Height {
+		return errors.WithMessagef(ErrInvalidBlockRange, "block [%d] is not less than the block height [%d]", lastBlockProcessed, bcInfo.Height)
+	}
+
+	m.metaMutex.Lock()
+	defer m.metaMutex.Unlock()
+
+	logger.Infof("[%s] Resetting the last block processed by the monitor to [%d]", m.channelID, lastBlockProcessed)
+
+	if err := m.setLastBlockProcessed(lastBlockProcessed); err != nil {
+		return err
+	}
+
+	m.generation++
+
+	return nil
+}
+
+// Rescan starts a one-off rescan of the blocks from (and including) 'from' to (and including) 'to'. The rescan
+// runs in the background alongside the live monitor and doesn't affect the last block processed. Only one
+// rescan may be in progress at a time. The progress of the rescan is available from RescanStatus.
+func (m *Monitor) Rescan(from, to uint64) error {
+	if from > to {
+		return errors.WithMessagef(ErrInvalidBlockRange, "from block [%d] is greater than to block [%d]", from, to)
+	}
+
+	bcInfo, err := m.getBlockchainInfo()
+	if err != nil {
+		return err
+	}
+
+	if to >= bcInfo.Height {
+		return errors.WithMessagef(ErrInvalidBlockRange, "to block [%d] is not less than the block height [%d]", to, bcInfo.Height)
+	}
+
+	m.rescanner.mutex.Lock()
+	defer m.rescanner.mutex.Unlock()
+
+	if m.rescanner.status != nil && m.rescanner.status.InProgress {
+		return ErrRescanInProgress
+	}
+
+	logger.Infof("[%s] Starting rescan of blocks [%d] to [%d]", m.channelID, from, to)
+
+	m.rescanner.status = &RescanStatus{
+		From:       from,
+		To:         to,
+		InProgress: true,
+		StartedAt:  time.Now(),
+	}
+
+	go m.rescan(from, to)
+
+	return nil
+}
+
+// RescanStatus returns the status of the current (or last) rescan or nil if no rescan was ever requested
+func (m *Monitor) RescanStatus() *RescanStatus {
+	m.rescanner.mutex.RLock()
+	defer m.rescanner.mutex.RUnlock()
+
+	if m.rescanner.status == nil {
+		return nil
+	}
+
+	status := *m.rescanner.status
+
+	return &status
+}
+
+func (m *Monitor) rescan(from, to uint64) {
+	for bNum := from; bNum <= to; bNum++ {
+		select {
+		case <-m.done:
+			m.rescanCompleted(errStopped)
+			return
+		default:
+		}
+
+		if err := m.processBlock(bNum, nil); err != nil {
+			m.rescanCompleted(errors.WithMessagef(err, "error rescanning block [%d]", bNum))
+			return
+		}
+
+		m.rescanner.mutex.Lock()
+		m.rescanner.status.LastBlockScanned = bNum
+		m.rescanner.mutex.Unlock()
+	}
+
+	m.rescanCompleted(nil)
+}
+
+func (m *Monitor) rescanCompleted(err error) {
+	m.rescanner.mutex.Lock()
+	defer m.rescanner.mutex.Unlock()
+
+	m.rescanner.status.InProgress = false
+	m.rescanner.status.CompletedAt = time.Now()
+
+	if err != nil {
+		logger.Errorf("[%s] Rescan of blocks [%d] to [%d] failed: %s", m.channelID, m.rescanner.status.From, m.rescanner.status.To, err)
+
+		m.rescanner.status.Error = err.Error()
+
+		return
+	}
+
+	logger.Infof("[%s] Completed rescan of blocks [%d] to [%d]", m.channelID, m.rescanner.status.From, m.rescanner.status.To)
+}
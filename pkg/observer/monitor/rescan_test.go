@@ -0,0 +1,149 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	peerextmocks "github.com/trustbloc/fabric-peer-ext/pkg/mocks"
+)
+
+func TestMonitor_Reset(t *testing.T) {
+	clients := newMockClients()
+	clients.blockchain.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1002}, nil)
+
+	m := newMonitorWithMocks(t, channel1, monitorPeriod, clients)
+	require.NoError(t, m.setLastBlockProcessed(1001))
+
+	t.Run("Invalid block", func(t *testing.T) {
+		err := m.Reset(1002)
+		require.Error(t, err)
+		require.Equal(t, ErrInvalidBlockRange, errors.Cause(err))
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		// Simulate a pass of the monitor that started before the reset
+		m.passGeneration = m.generation
+
+		require.NoError(t, m.Reset(500))
+
+		last, err := m.lastBlockProcessed()
+		require.NoError(t, err)
+		require.Equal(t, uint64(500), last)
+
+		// The pass doesn't overwrite the last block processed
+		require.Equal(t, errReset, m.commitBlock(1001))
+
+		last, err = m.lastBlockProcessed()
+		require.NoError(t, err)
+		require.Equal(t, uint64(500), last)
+	})
+
+	t.Run("Blockchain error", func(t *testing.T) {
+		errExpected := errors.New("injected blockchain error")
+		clients.blockchain.GetBlockchainInfoReturns(nil, errExpected)
+		defer clients.blockchain.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1002}, nil)
+
+		err := m.Reset(500)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errExpected.Error())
+	})
+}
+
+func TestMonitor_Rescan(t *testing.T) {
+	b := peerextmocks.NewBlockBuilder(channel1, 1001)
+	b.Transaction(txID1, pb.TxValidationCode_VALID).
+		ChaincodeAction("some_other_cc").
+		Write("some_key", []byte("some value"))
+	block := b.Build()
+
+	clients := newMockClients()
+	clients.blockchain.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1002}, nil)
+
+	m := newMonitorWithMocks(t, channel1, monitorPeriod, clients)
+	require.NoError(t, m.setLastBlockProcessed(1001))
+	require.Nil(t, m.RescanStatus())
+
+	t.Run("Invalid range", func(t *testing.T) {
+		err := m.Rescan(20, 10)
+		require.Equal(t, ErrInvalidBlockRange, errors.Cause(err))
+
+		err = m.Rescan(10, 1002)
+		require.Equal(t, ErrInvalidBlockRange, errors.Cause(err))
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		release := make(chan struct{})
+		clients.blockchain.GetBlockByNumberStub = func(uint64) (*cb.Block, error) {
+			<-release
+			return block, nil
+		}
+
+		require.NoError(t, m.Rescan(10, 19))
+
+		status := m.RescanStatus()
+		require.NotNil(t, status)
+		require.True(t, status.InProgress)
+		require.Equal(t, uint64(10), status.From)
+		require.Equal(t, uint64(19), status.To)
+
+		require.Equal(t, ErrRescanInProgress, m.Rescan(10, 19))
+
+		close(release)
+		time.Sleep(sleepTime)
+
+		status = m.RescanStatus()
+		require.False(t, status.InProgress)
+		require.Empty(t, status.Error)
+		require.Equal(t, uint64(19), status.LastBlockScanned)
+		require.Equal(t, 10, clients.blockchain.GetBlockByNumberCallCount())
+
+		// The live monitor's last block processed isn't affected
+		last, err := m.lastBlockProcessed()
+		require.NoError(t, err)
+		require.Equal(t, uint64(1001), last)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		errExpected := errors.New("injected blockchain error")
+		clients.blockchain.GetBlockByNumberStub = func(bNum uint64) (*cb.Block, error) {
+			if bNum == 15 {
+				return nil, errExpected
+			}
+			return block, nil
+		}
+
+		require.NoError(t, m.Rescan(10, 19))
+		time.Sleep(sleepTime)
+
+		status := m.RescanStatus()
+		require.False(t, status.InProgress)
+		require.Contains(t, status.Error, "error rescanning block [15]")
+		require.Contains(t, status.Error, errExpected.Error())
+		require.Equal(t, uint64(14), status.LastBlockScanned)
+	})
+
+	t.Run("Stopped", func(t *testing.T) {
+		clients.blockchain.GetBlockByNumberStub = nil
+		clients.blockchain.GetBlockByNumberReturns(block, nil)
+
+		m := newMonitorWithMocks(t, channel1, monitorPeriod, clients)
+		m.Stop()
+
+		require.NoError(t, m.Rescan(10, 19))
+		time.Sleep(sleepTime)
+
+		status := m.RescanStatus()
+		require.False(t, status.InProgress)
+		require.Equal(t, errStopped.Error(), status.Error)
+	})
+}
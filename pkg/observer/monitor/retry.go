@@ -0,0 +1,252 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package monitor
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/client"
+)
+
+const (
+	defaultMaxAttempts      = 5
+	defaultInitialBackoff   = time.Second
+	defaultMaxBackoff       = 30 * time.Second
+	defaultBreakerThreshold = 10
+	defaultBreakerCooldown  = time.Minute
+)
+
+// errClass classifies the errors encountered by the monitor in order to decide how they're handled
+type errClass string
+
+const (
+	// errClassNoLedger indicates that the channel doesn't exist (yet). The block isn't retried until the next period.
+	errClassNoLedger errClass = "NO_LEDGER"
+
+	// errClassTimeout indicates that a request (e.g. to DCAS) timed out. The block is retried with backoff
+	// and the failure counts towards opening the circuit breaker.
+	errClassTimeout errClass = "TIMEOUT"
+
+	// errClassNotFound indicates that content wasn't found in DCAS. The content may not have been distributed to
+	// this peer yet so the block is retried with backoff, but the failure doesn't count towards opening the
+	// circuit breaker since it doesn't indicate that the peer is unhealthy. If the content is still missing after
+	// the last attempt then the anchor is dead-lettered.
+	errClassNotFound errClass = "NOT_FOUND"
+
+	// errClassTransient indicates any other transient error. The block is retried with backoff and the failure
+	// counts towards opening the circuit breaker.
+	errClassTransient errClass = "TRANSIENT"
+
+	// errClassPersistent indicates that retrying won't help
+	errClassPersistent errClass = "PERSISTENT"
+)
+
+func classify(err error) errClass {
+	cause := errors.Cause(err)
+
+	if cause == client.ErrNoLedger {
+		return errClassNoLedger
+	}
+
+	merr, ok := cause.(monitorError)
+	if !ok {
+		if isTimeout(cause) {
+			return errClassTimeout
+		}
+
+		return errClassPersistent
+	}
+
+	switch {
+	case merr.NotFound():
+		return errClassNotFound
+	case isTimeout(errors.Cause(merr.cause)):
+		return errClassTimeout
+	case merr.Transient():
+		return errClassTransient
+	default:
+		return errClassPersistent
+	}
+}
+
+func isTimeout(err error) bool {
+	if err == context.DeadlineExceeded {
+		return true
+	}
+
+	terr, ok := err.(interface{ Timeout() bool })
+
+	return ok && terr.Timeout()
+}
+
+// RetryConfig holds the parameters for retrying a block that failed to be processed
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of times that a block is attempted before giving up until the next period
+	MaxAttempts int
+
+	// InitialBackoff is the backoff after the first failed attempt. The backoff is doubled after each subsequent attempt.
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the maximum backoff between attempts
+	MaxBackoff time.Duration
+}
+
+// backoff returns the time to wait after the given (1-based) attempt. The backoff grows exponentially
+// up to the maximum backoff and a random jitter of up to half of the backoff is applied so that
+// concurrent workers don't retry in lockstep.
+func (c RetryConfig) backoff(attempt int) time.Duration {
+	backoff := c.InitialBackoff
+	for i := 1; i < attempt && backoff < c.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > c.MaxBackoff {
+		backoff = c.MaxBackoff
+	}
+
+	half := int64(backoff / 2)
+	if half == 0 {
+		return backoff
+	}
+
+	return time.Duration(half + rand.Int63n(half))
+}
+
+func (c RetryConfig) withDefaults() RetryConfig {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultMaxAttempts
+	}
+
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = defaultInitialBackoff
+	}
+
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultMaxBackoff
+	}
+
+	if c.MaxBackoff < c.InitialBackoff {
+		c.MaxBackoff = c.InitialBackoff
+	}
+
+	return c
+}
+
+// CircuitState is the state of the monitor's circuit breaker
+type CircuitState string
+
+const (
+	// CircuitClosed indicates that blocks are being processed normally
+	CircuitClosed CircuitState = "CLOSED"
+
+	// CircuitOpen indicates that too many consecutive failures occurred and so blocks
+	// aren't processed until the cool-down period has elapsed
+	CircuitOpen CircuitState = "OPEN"
+
+	// CircuitHalfOpen indicates that the cool-down period has elapsed and the next attempt
+	// determines whether the circuit is closed or opened again
+	CircuitHalfOpen CircuitState = "HALF_OPEN"
+)
+
+// circuitBreaker stops the monitor from hammering DCAS and the ledger when the peer is unhealthy
+type circuitBreaker struct {
+	channelID string
+	threshold int
+	cooldown  time.Duration
+	mutex     sync.Mutex
+	state     CircuitState
+	failures  int
+	openedAt  time.Time
+}
+
+func newCircuitBreaker(channelID string, threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+
+	return &circuitBreaker{
+		channelID: channelID,
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     CircuitClosed,
+	}
+}
+
+// allow returns true if an attempt may be made. If the circuit is open and the cool-down period
+// has elapsed then the circuit becomes half-open and the attempt is allowed.
+func (b *circuitBreaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state != CircuitOpen {
+		return true
+	}
+
+	if time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+
+	b.setState(CircuitHalfOpen)
+
+	return true
+}
+
+// success closes the circuit
+func (b *circuitBreaker) success() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.failures = 0
+	b.setState(CircuitClosed)
+}
+
+// failure records a failed attempt. The circuit is opened if the number of consecutive failures reaches
+// the threshold or if the attempt was made while the circuit was half-open.
+func (b *circuitBreaker) failure() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.failures++
+
+	if b.state == CircuitHalfOpen || (b.state == CircuitClosed && b.failures >= b.threshold) {
+		b.openedAt = time.Now()
+		b.setState(CircuitOpen)
+	}
+}
+
+func (b *circuitBreaker) State() CircuitState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.state
+}
+
+func (b *circuitBreaker) setState(state CircuitState) {
+	if b.state == state {
+		return
+	}
+
+	switch state {
+	case CircuitOpen:
+		logger.Warnf("[%s] Monitor circuit breaker is %s after %d consecutive failures. Blocks won't be processed for %s.", b.channelID, state, b.failures, b.cooldown)
+	case CircuitHalfOpen:
+		logger.Infof("[%s] Monitor circuit breaker is %s. Attempting to process blocks.", b.channelID, state)
+	default:
+		logger.Infof("[%s] Monitor circuit breaker is %s", b.channelID, state)
+	}
+
+	b.state = state
+}
@@ -0,0 +1,97 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/client"
+)
+
+func TestClassify(t *testing.T) {
+	require.Equal(t, errClassNoLedger, classify(errors.WithMessage(client.ErrNoLedger, "some context")))
+	require.Equal(t, errClassTimeout, classify(errors.WithMessage(context.DeadlineExceeded, "some context")))
+	require.Equal(t, errClassTimeout, classify(newMonitorError(timeoutError{}, true)))
+	require.Equal(t, errClassNotFound, classify(errors.WithMessage(newNotFoundError(errors.New("not found")), "some context")))
+	require.Equal(t, errClassTransient, classify(newMonitorError(errors.New("transient"), true)))
+	require.Equal(t, errClassPersistent, classify(newMonitorError(errors.New("persistent"), false)))
+	require.Equal(t, errClassPersistent, classify(errors.New("some error")))
+}
+
+func TestRetryConfig(t *testing.T) {
+	cfg := RetryConfig{}.withDefaults()
+	require.Equal(t, defaultMaxAttempts, cfg.MaxAttempts)
+	require.Equal(t, defaultInitialBackoff, cfg.InitialBackoff)
+	require.Equal(t, defaultMaxBackoff, cfg.MaxBackoff)
+
+	cfg = RetryConfig{InitialBackoff: time.Second, MaxBackoff: time.Millisecond}.withDefaults()
+	require.Equal(t, time.Second, cfg.MaxBackoff)
+
+	cfg = RetryConfig{MaxAttempts: 10, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	for i := 0; i < 100; i++ {
+		backoff := cfg.backoff(1)
+		require.True(t, backoff >= 50*time.Millisecond && backoff < 100*time.Millisecond, "unexpected backoff: %s", backoff)
+
+		backoff = cfg.backoff(3)
+		require.True(t, backoff >= 200*time.Millisecond && backoff < 400*time.Millisecond, "unexpected backoff: %s", backoff)
+
+		backoff = cfg.backoff(10)
+		require.True(t, backoff >= 500*time.Millisecond && backoff < time.Second, "unexpected backoff: %s", backoff)
+	}
+
+	require.Equal(t, time.Duration(1), RetryConfig{InitialBackoff: 1, MaxBackoff: 1}.backoff(1))
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+
+	b := newCircuitBreaker(channel1, 3, cooldown)
+	require.Equal(t, CircuitClosed, b.State())
+
+	b.failure()
+	b.failure()
+	b.success()
+	b.failure()
+	b.failure()
+	require.Equal(t, CircuitClosed, b.State())
+	require.True(t, b.allow())
+
+	b.failure()
+	require.Equal(t, CircuitOpen, b.State())
+	require.False(t, b.allow())
+
+	time.Sleep(cooldown)
+
+	require.True(t, b.allow())
+	require.Equal(t, CircuitHalfOpen, b.State())
+
+	// A failure while half-open opens the circuit again
+	b.failure()
+	require.Equal(t, CircuitOpen, b.State())
+	require.False(t, b.allow())
+
+	time.Sleep(cooldown)
+
+	require.True(t, b.allow())
+	b.success()
+	require.Equal(t, CircuitClosed, b.State())
+
+	b = newCircuitBreaker(channel1, 0, 0)
+	require.Equal(t, defaultBreakerThreshold, b.threshold)
+	require.Equal(t, defaultBreakerCooldown, b.cooldown)
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "timed out" }
+func (timeoutError) Timeout() bool { return true }
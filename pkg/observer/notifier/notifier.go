@@ -8,46 +8,412 @@ package notifier
 
 import (
 	"strings"
+	"sync"
+	"time"
 
+	cb "github.com/hyperledger/fabric-protos-go/common"
 	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
 	"github.com/hyperledger/fabric/common/flogging"
 	gossipapi "github.com/hyperledger/fabric/extensions/gossip/api"
+	"github.com/trustbloc/fabric-peer-ext/pkg/common/blockvisitor"
 	sidetreeobserver "github.com/trustbloc/sidetree-core-go/pkg/observer"
 	"github.com/trustbloc/sidetree-fabric/pkg/observer/common"
 )
 
 var logger = flogging.MustGetLogger("sidetree_observer")
 
+const defaultBufferSize = 100
+
+var (
+	// coalesceWindow is the amount of time that the anchors of the most recent block are held in the buffer
+	// (waiting for more anchors from the same block) before they're delivered. The anchors of a block are delivered
+	// immediately once an anchor from a subsequent block is received. It may be overridden by unit tests.
+	coalesceWindow = 50 * time.Millisecond
+
+	// catchUpRetryInterval is the amount of time to wait before retrying to read missed blocks from the ledger.
+	// It may be overridden by unit tests.
+	catchUpRetryInterval = time.Second
+)
+
 // blockPublisher allows clients to add handlers for various block events
 type blockPublisher interface {
 	// AddWriteHandler adds a handler for KV writes
 	AddWriteHandler(handler gossipapi.WriteHandler)
 }
 
+// Option is a notifier option
+type Option func(n *Notifier)
+
+// WithBufferSize sets the maximum number of blocks (containing anchors) that are buffered for each registration
+func WithBufferSize(size int) Option {
+	return func(n *Notifier) {
+		n.bufferSize = size
+	}
+}
+
+// WithBlockchain sets the blockchain client provider that's used to read missed blocks from the ledger
+// when the buffer overflows
+func WithBlockchain(channelID string, provider common.BlockchainClientProvider) Option {
+	return func(n *Notifier) {
+		n.channelID = channelID
+		n.bcProvider = provider
+	}
+}
+
 // Notifier holds the gossip adapter and channel id
 type Notifier struct {
-	publisher blockPublisher
+	publisher     blockPublisher
+	channelID     string
+	bcProvider    common.BlockchainClientProvider
+	bufferSize    int
+	subscriptions []*subscription
+	closed        bool
+	mutex         sync.RWMutex
 }
 
 // New return new instance of Notifier
-func New(publisher blockPublisher) *Notifier {
-	return &Notifier{publisher: publisher}
+func New(publisher blockPublisher, opts ...Option) *Notifier {
+	n := &Notifier{
+		publisher:  publisher,
+		bufferSize: defaultBufferSize,
+	}
+
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	return n
 }
 
-// RegisterForSidetreeTxn register to get AnchorFileAddress value from writeset in the block committed by sidetreetxn_cc
+// RegisterForSidetreeTxn register to get AnchorFileAddress value from writeset in the block committed by sidetreetxn_cc.
+// The block committer is never blocked by the consumer of the returned channel: the anchors are held in a bounded buffer
+// and the anchors of the same block are coalesced into one slice. If the buffer overflows then the anchors of the
+// dropped blocks are read from the ledger (if a blockchain provider was supplied) and delivered in order before
+// switching back to live events. The returned channel is closed when the notifier is closed.
 func (n *Notifier) RegisterForSidetreeTxn() <-chan []sidetreeobserver.SidetreeTxn {
-	anchorFileAddressChan := make(chan []sidetreeobserver.SidetreeTxn, 100)
+	n.mutex.Lock()
+	if n.closed {
+		n.mutex.Unlock()
+
+		logger.Warnf("Attempt to register for Sidetree transactions on a closed notifier")
+
+		c := make(chan []sidetreeobserver.SidetreeTxn)
+		close(c)
+
+		return c
+	}
+
+	s := newSubscription(n.channelID, n.bufferSize, n.bcProvider)
+	n.subscriptions = append(n.subscriptions, s)
+	n.mutex.Unlock()
+
+	go s.run()
+
 	n.publisher.AddWriteHandler(func(txMetadata gossipapi.TxMetadata, namespace string, kvWrite *kvrwset.KVWrite) error {
 		if namespace != common.SidetreeNs {
 			logger.Debugf("write NameSpace: %s not equal %s will skip this kvrwset", namespace, common.SidetreeNs)
 			return nil
 		}
+
 		if !kvWrite.IsDelete && strings.HasPrefix(kvWrite.Key, common.AnchorAddrPrefix) {
 			logger.Debugf("found anchor address key[%s], value [%s]", kvWrite.Key, string(kvWrite.Value))
-			anchorFileAddressChan <- []sidetreeobserver.SidetreeTxn{{TransactionTime: txMetadata.BlockNum, TransactionNumber: txMetadata.TxNum, AnchorAddress: string(kvWrite.Value)}}
+
+			n.publish(s, sidetreeobserver.SidetreeTxn{TransactionTime: txMetadata.BlockNum, TransactionNumber: txMetadata.TxNum, AnchorAddress: string(kvWrite.Value)})
 		}
+
 		return nil
 	})
 
-	return anchorFileAddressChan
+	return s.out
+}
+
+// Close closes all of the channels that were returned from RegisterForSidetreeTxn. The block publisher doesn't
+// support removing a handler, so the handlers remain registered but they ignore all events after the notifier is closed.
+// Transactions that were buffered before the notifier was closed are delivered before the channels are closed.
+func (n *Notifier) Close() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.closed {
+		logger.Debugf("Notifier is already closed")
+		return
+	}
+
+	n.closed = true
+
+	for _, s := range n.subscriptions {
+		close(s.done)
+	}
+
+	n.subscriptions = nil
+}
+
+func (n *Notifier) publish(s *subscription, txn sidetreeobserver.SidetreeTxn) {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	if n.closed {
+		logger.Debugf("Notifier is closed. Ignoring Sidetree transaction: %+v", txn)
+		return
+	}
+
+	s.add(txn)
+}
+
+// entry holds the anchors of a block
+type entry struct {
+	blockNum uint64
+	txns     []sidetreeobserver.SidetreeTxn
+}
+
+// subscription buffers the anchors for one registration and delivers them to the registration's channel
+type subscription struct {
+	channelID  string
+	bcProvider common.BlockchainClientProvider
+	bufferSize int
+	out        chan []sidetreeobserver.SidetreeTxn
+	notify     chan struct{}
+	done       chan struct{}
+
+	mutex        sync.Mutex
+	buffer       []*entry
+	lastWrite    time.Time
+	overflowed   bool
+	overflowFrom uint64
+	lastDropped  uint64
+	nextBlock    uint64
+}
+
+func newSubscription(channelID string, bufferSize int, bcProvider common.BlockchainClientProvider) *subscription {
+	return &subscription{
+		channelID:  channelID,
+		bcProvider: bcProvider,
+		bufferSize: bufferSize,
+		out:        make(chan []sidetreeobserver.SidetreeTxn),
+		notify:     make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+}
+
+// add adds the anchor to the buffer without blocking
+func (s *subscription) add(txn sidetreeobserver.SidetreeTxn) {
+	s.mutex.Lock()
+
+	switch {
+	case txn.TransactionTime < s.nextBlock:
+		logger.Debugf("[%s] Ignoring anchor [%s] in block [%d] since the block was read from the ledger", s.channelID, txn.AnchorAddress, txn.TransactionTime)
+
+	case s.overflowed:
+		if txn.TransactionTime > s.lastDropped {
+			s.lastDropped = txn.TransactionTime
+		}
+
+	case len(s.buffer) > 0 && s.buffer[len(s.buffer)-1].blockNum == txn.TransactionTime:
+		tail := s.buffer[len(s.buffer)-1]
+		tail.txns = append(tail.txns, txn)
+
+	case len(s.buffer) >= s.bufferSize:
+		logger.Warnf("[%s] Sidetree transaction buffer overflowed at block [%d]. The anchors will be read from the ledger.", s.channelID, txn.TransactionTime)
+
+		s.overflowed = true
+		s.overflowFrom = txn.TransactionTime
+		s.lastDropped = txn.TransactionTime
+
+	default:
+		s.buffer = append(s.buffer, &entry{blockNum: txn.TransactionTime, txns: []sidetreeobserver.SidetreeTxn{txn}})
+	}
+
+	s.lastWrite = time.Now()
+	s.mutex.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) run() {
+	defer close(s.out)
+
+	for {
+		e, wait, overflowed := s.next(false)
+		if e != nil {
+			s.out <- e.txns
+			continue
+		}
+
+		if overflowed {
+			select {
+			case <-s.done:
+				s.drain()
+				return
+			default:
+				s.catchUp()
+				continue
+			}
+		}
+
+		var timer <-chan time.Time
+		if wait > 0 {
+			timer = time.After(wait)
+		}
+
+		select {
+		case <-s.notify:
+		case <-timer:
+		case <-s.done:
+			s.drain()
+			return
+		}
+	}
+}
+
+// next returns the next entry that's ready to be delivered. If the oldest entry isn't ready yet (i.e. it's for the most
+// recent block and more anchors for the block may still arrive) then the amount of time to wait is returned. True is
+// returned if the buffer is empty and blocks were dropped due to an overflow.
+func (s *subscription) next(force bool) (*entry, time.Duration, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.buffer) == 0 {
+		return nil, 0, s.overflowed
+	}
+
+	sinceLastWrite := time.Since(s.lastWrite)
+
+	if !force && len(s.buffer) == 1 && !s.overflowed && sinceLastWrite < coalesceWindow {
+		return nil, coalesceWindow - sinceLastWrite, false
+	}
+
+	e := s.buffer[0]
+	s.buffer = s.buffer[1:]
+
+	return e, 0, false
+}
+
+// drain delivers all of the buffered entries
+func (s *subscription) drain() {
+	for {
+		e, _, overflowed := s.next(true)
+		if e == nil {
+			if overflowed {
+				logger.Infof("[%s] Notifier closed while blocks were dropped due to an overflow", s.channelID)
+			}
+
+			return
+		}
+
+		s.out <- e.txns
+	}
+}
+
+// catchUp reads the blocks that were dropped due to an overflow from the ledger and delivers their anchors
+func (s *subscription) catchUp() {
+	s.mutex.Lock()
+	next := s.overflowFrom
+	s.mutex.Unlock()
+
+	if s.bcProvider == nil {
+		s.mutex.Lock()
+		logger.Errorf("[%s] Anchors in blocks [%d-%d] were dropped due to an overflow and no blockchain provider was supplied to read them from the ledger", s.channelID, next, s.lastDropped)
+		s.endOverflow(s.lastDropped + 1)
+		s.mutex.Unlock()
+
+		return
+	}
+
+	logger.Infof("[%s] Reading missed blocks from the ledger starting at block [%d]", s.channelID, next)
+
+	for {
+		var err error
+		next, err = s.readBlocks(next)
+		if err != nil {
+			logger.Warnf("[%s] Error reading missed blocks from the ledger: %s. Will retry in %s.", s.channelID, err, catchUpRetryInterval)
+		} else {
+			s.mutex.Lock()
+			if s.lastDropped < next {
+				s.endOverflow(next)
+				s.mutex.Unlock()
+
+				logger.Infof("[%s] ... done reading missed blocks from the ledger up to block [%d]", s.channelID, next-1)
+
+				return
+			}
+			s.mutex.Unlock()
+		}
+
+		select {
+		case <-s.done:
+			return
+		case <-time.After(catchUpRetryInterval):
+		}
+	}
+}
+
+// readBlocks reads the blocks from the given block number up to the current height, delivers the anchors in
+// the blocks, and returns the next block number to read
+func (s *subscription) readBlocks(from uint64) (uint64, error) {
+	bcClient, err := s.bcProvider.ForChannel(s.channelID)
+	if err != nil {
+		return from, err
+	}
+
+	bcInfo, err := bcClient.GetBlockchainInfo()
+	if err != nil {
+		return from, err
+	}
+
+	next := from
+	for ; next < bcInfo.Height; next++ {
+		select {
+		case <-s.done:
+			return next, nil
+		default:
+		}
+
+		block, err := bcClient.GetBlockByNumber(next)
+		if err != nil {
+			return next, err
+		}
+
+		txns, err := anchorsInBlock(s.channelID, block)
+		if err != nil {
+			return next, err
+		}
+
+		if len(txns) > 0 {
+			s.out <- txns
+		}
+	}
+
+	return next, nil
+}
+
+// endOverflow switches back to live events. Live events for blocks before the given block number are ignored
+// since those blocks were already read from the ledger.
+func (s *subscription) endOverflow(nextBlock uint64) {
+	s.overflowed = false
+	s.nextBlock = nextBlock
+}
+
+func anchorsInBlock(channelID string, block *cb.Block) ([]sidetreeobserver.SidetreeTxn, error) {
+	var txns []sidetreeobserver.SidetreeTxn
+
+	visitor := blockvisitor.New(channelID, blockvisitor.WithWriteHandler(func(w *blockvisitor.Write) error {
+		if w.Namespace == common.SidetreeNs && !w.Write.IsDelete && strings.HasPrefix(w.Write.Key, common.AnchorAddrPrefix) {
+			txns = append(txns, sidetreeobserver.SidetreeTxn{
+				TransactionTime:   w.BlockNum,
+				TransactionNumber: w.TxNum,
+				AnchorAddress:     string(w.Write.Value),
+			})
+		}
+
+		return nil
+	}))
+
+	if err := visitor.Visit(block); err != nil {
+		return nil, err
+	}
+
+	return txns, nil
 }
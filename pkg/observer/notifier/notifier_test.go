@@ -7,14 +7,20 @@ SPDX-License-Identifier: Apache-2.0
 package notifier
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
+	cb "github.com/hyperledger/fabric-protos-go/common"
 	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
 	gossipapi "github.com/hyperledger/fabric/extensions/gossip/api"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
+	extmocks "github.com/trustbloc/fabric-peer-ext/pkg/mocks"
 	sidetreeobserver "github.com/trustbloc/sidetree-core-go/pkg/observer"
 	"github.com/trustbloc/sidetree-fabric/pkg/observer/common"
+	obmocks "github.com/trustbloc/sidetree-fabric/pkg/observer/mocks"
 )
 
 const (
@@ -86,6 +92,137 @@ func TestRegisterForAnchorFileAddress(t *testing.T) {
 
 }
 
+func TestNotifier_Close(t *testing.T) {
+	p := &mockBlockPublisher{}
+	notifier := New(p)
+
+	sideTreeTxnCh := notifier.RegisterForSidetreeTxn()
+
+	require.NoError(t, p.writeHandler(gossipapi.TxMetadata{BlockNum: 1, ChannelID: testChannel, TxID: "tx1"}, common.SidetreeNs, &kvrwset.KVWrite{Key: common.AnchorAddrPrefix + k1, Value: []byte(v1)}))
+
+	notifier.Close()
+	require.NotPanics(t, notifier.Close)
+
+	// Events are ignored after the notifier is closed
+	require.NoError(t, p.writeHandler(gossipapi.TxMetadata{BlockNum: 2, ChannelID: testChannel, TxID: "tx2"}, common.SidetreeNs, &kvrwset.KVWrite{Key: common.AnchorAddrPrefix + k1, Value: []byte(v1)}))
+
+	// The transactions that were published before the notifier was closed are drained from the channel
+	txns, ok := <-sideTreeTxnCh
+	require.True(t, ok)
+	require.Len(t, txns, 1)
+	require.Equal(t, uint64(1), txns[0].TransactionTime)
+
+	_, ok = <-sideTreeTxnCh
+	require.False(t, ok)
+
+	_, ok = <-notifier.RegisterForSidetreeTxn()
+	require.False(t, ok)
+}
+
+func TestNotifier_Coalesce(t *testing.T) {
+	p := &mockBlockPublisher{}
+	notifier := New(p)
+	defer notifier.Close()
+
+	sideTreeTxnCh := notifier.RegisterForSidetreeTxn()
+
+	require.NoError(t, p.writeHandler(gossipapi.TxMetadata{BlockNum: 1, TxNum: 0}, common.SidetreeNs, &kvrwset.KVWrite{Key: common.AnchorAddrPrefix + "k1", Value: []byte("anchor1")}))
+	require.NoError(t, p.writeHandler(gossipapi.TxMetadata{BlockNum: 1, TxNum: 1}, common.SidetreeNs, &kvrwset.KVWrite{Key: common.AnchorAddrPrefix + "k2", Value: []byte("anchor2")}))
+	require.NoError(t, p.writeHandler(gossipapi.TxMetadata{BlockNum: 2, TxNum: 0}, common.SidetreeNs, &kvrwset.KVWrite{Key: common.AnchorAddrPrefix + "k3", Value: []byte("anchor3")}))
+
+	txns := receive(t, sideTreeTxnCh)
+	require.Len(t, txns, 2)
+	require.Equal(t, "anchor1", txns[0].AnchorAddress)
+	require.Equal(t, "anchor2", txns[1].AnchorAddress)
+
+	txns = receive(t, sideTreeTxnCh)
+	require.Len(t, txns, 1)
+	require.Equal(t, "anchor3", txns[0].AnchorAddress)
+}
+
+func TestNotifier_Overflow(t *testing.T) {
+	restoreRetryInterval := catchUpRetryInterval
+	catchUpRetryInterval = 10 * time.Millisecond
+	defer func() { catchUpRetryInterval = restoreRetryInterval }()
+
+	t.Run("Catch up from ledger", func(t *testing.T) {
+		bcClient := &obmocks.BlockchainClient{}
+		bcClient.GetBlockchainInfoReturnsOnCall(0, nil, errors.New("injected blockchain error"))
+		bcClient.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 6}, nil)
+		bcClient.GetBlockByNumberStub = func(bNum uint64) (*cb.Block, error) {
+			b := extmocks.NewBlockBuilder(testChannel, bNum)
+			if bNum >= 3 {
+				b.Transaction("tx1", pb.TxValidationCode_VALID).
+					ChaincodeAction(common.SidetreeNs).
+					Write(common.AnchorAddrPrefix+k1, []byte(fmt.Sprintf("anchor%d", bNum)))
+			}
+			return b.Build(), nil
+		}
+
+		bcProvider := &obmocks.BlockchainClientProvider{}
+		bcProvider.ForChannelReturns(bcClient, nil)
+
+		p := &mockBlockPublisher{}
+		notifier := New(p, WithBufferSize(2), WithBlockchain(testChannel, bcProvider))
+		defer notifier.Close()
+
+		sideTreeTxnCh := notifier.RegisterForSidetreeTxn()
+
+		// Nobody is reading from the channel so the buffer overflows at block 3. The committer must not be blocked.
+		for bNum := uint64(1); bNum <= 5; bNum++ {
+			require.NoError(t, p.writeHandler(gossipapi.TxMetadata{BlockNum: bNum}, common.SidetreeNs, &kvrwset.KVWrite{Key: common.AnchorAddrPrefix + k1, Value: []byte(fmt.Sprintf("anchor%d", bNum))}))
+		}
+
+		// The buffered blocks are delivered followed by the blocks that were read from the ledger
+		for bNum := uint64(1); bNum <= 5; bNum++ {
+			txns := receive(t, sideTreeTxnCh)
+			require.Len(t, txns, 1)
+			require.Equal(t, bNum, txns[0].TransactionTime)
+			require.Equal(t, fmt.Sprintf("anchor%d", bNum), txns[0].AnchorAddress)
+		}
+
+		// Live events for blocks that were read from the ledger are ignored
+		require.NoError(t, p.writeHandler(gossipapi.TxMetadata{BlockNum: 5}, common.SidetreeNs, &kvrwset.KVWrite{Key: common.AnchorAddrPrefix + k1, Value: []byte("anchor5")}))
+		require.NoError(t, p.writeHandler(gossipapi.TxMetadata{BlockNum: 6}, common.SidetreeNs, &kvrwset.KVWrite{Key: common.AnchorAddrPrefix + k1, Value: []byte("anchor6")}))
+
+		txns := receive(t, sideTreeTxnCh)
+		require.Len(t, txns, 1)
+		require.Equal(t, uint64(6), txns[0].TransactionTime)
+	})
+
+	t.Run("No blockchain provider", func(t *testing.T) {
+		p := &mockBlockPublisher{}
+		notifier := New(p, WithBufferSize(1))
+		defer notifier.Close()
+
+		sideTreeTxnCh := notifier.RegisterForSidetreeTxn()
+
+		for bNum := uint64(1); bNum <= 3; bNum++ {
+			require.NoError(t, p.writeHandler(gossipapi.TxMetadata{BlockNum: bNum}, common.SidetreeNs, &kvrwset.KVWrite{Key: common.AnchorAddrPrefix + k1, Value: []byte(v1)}))
+		}
+
+		txns := receive(t, sideTreeTxnCh)
+		require.Equal(t, uint64(1), txns[0].TransactionTime)
+
+		// The dropped blocks are lost but subsequent live events are delivered
+		require.NoError(t, p.writeHandler(gossipapi.TxMetadata{BlockNum: 4}, common.SidetreeNs, &kvrwset.KVWrite{Key: common.AnchorAddrPrefix + k1, Value: []byte(v1)}))
+
+		txns = receive(t, sideTreeTxnCh)
+		require.Equal(t, uint64(4), txns[0].TransactionTime)
+	})
+}
+
+func receive(t *testing.T, c <-chan []sidetreeobserver.SidetreeTxn) []sidetreeobserver.SidetreeTxn {
+	select {
+	case txns, ok := <-c:
+		require.True(t, ok)
+		return txns
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for Sidetree transactions")
+		return nil
+	}
+}
+
 type mockBlockPublisher struct {
 	writeHandler gossipapi.WriteHandler
 }
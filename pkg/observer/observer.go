@@ -7,15 +7,16 @@ SPDX-License-Identifier: Apache-2.0
 package observer
 
 import (
-	"encoding/json"
+	"strings"
+	"sync"
 
 	"github.com/hyperledger/fabric/common/flogging"
-	"github.com/pkg/errors"
 	dcasclient "github.com/trustbloc/fabric-peer-ext/pkg/collections/offledger/dcas/client"
-	"github.com/trustbloc/sidetree-core-go/pkg/api/batch"
+	"github.com/trustbloc/fabric-peer-ext/pkg/common/blockvisitor"
 	sidetreeobserver "github.com/trustbloc/sidetree-core-go/pkg/observer"
 	"github.com/trustbloc/sidetree-fabric/pkg/observer/common"
 	"github.com/trustbloc/sidetree-fabric/pkg/observer/notifier"
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/opstore"
 )
 
 var logger = flogging.MustGetLogger("sidetree_observer")
@@ -23,12 +24,14 @@ var logger = flogging.MustGetLogger("sidetree_observer")
 type dcas struct {
 	channelID      string
 	clientProvider common.DCASClientProvider
+	*opstore.OperationStore
 }
 
 func newDCAS(channelID string, provider common.DCASClientProvider) *dcas {
 	return &dcas{
 		channelID:      channelID,
 		clientProvider: provider,
+		OperationStore: opstore.New(channelID, provider),
 	}
 }
 
@@ -40,33 +43,24 @@ func (d *dcas) Read(key string) ([]byte, error) {
 	return dcasClient.Get(common.SidetreeNs, common.SidetreeColl, key)
 }
 
-func (d *dcas) Put(ops []*batch.Operation) error {
-	for _, op := range ops {
-		bytes, err := json.Marshal(op)
-		if err != nil {
-			return errors.Wrapf(err, "json marshal for op failed")
-		}
-		dcasClient, err := d.getDCASClient()
-		if err != nil {
-			return err
-		}
-		_, err = dcasClient.Put(common.DocNs, common.DocColl, bytes)
-		if err != nil {
-			return errors.Wrapf(err, "dcas put failed")
-		}
-	}
-	return nil
-}
-
 func (d *dcas) getDCASClient() (dcasclient.DCAS, error) {
 	return d.clientProvider.ForChannel(d.channelID)
 }
 
-// Observer observes the ledger for new anchor files and updates the document store accordingly
+// Observer observes the ledger for new anchor files and updates the document store accordingly. The observer
+// persists the last block that it processed and, when started, replays the blocks that it missed from the ledger
+// before processing live block events.
 type Observer struct {
-	channelID    string
-	dcasProvider common.DCASClientProvider
-	bpProvider   common.BlockPublisherProvider
+	channelID         string
+	peerID            string
+	bpProvider        common.BlockPublisherProvider
+	offLedgerProvider common.OffLedgerClientProvider
+	bcProvider        common.BlockchainClientProvider
+	dcas              *dcas
+	notifier          *notifier.Notifier
+	done              chan struct{}
+	stopped           chan struct{}
+	mutex             sync.Mutex
 }
 
 // Providers are the providers required by the observer
@@ -78,27 +72,251 @@ type Providers struct {
 }
 
 // New returns a new Observer
-func New(channelID string, providers *Providers) *Observer {
+func New(channelID, peerID string, providers *Providers) *Observer {
 	return &Observer{
-		channelID:    channelID,
-		dcasProvider: providers.DCAS,
-		bpProvider:   providers.BlockPublisher,
+		channelID:         channelID,
+		peerID:            peerID,
+		bpProvider:        providers.BlockPublisher,
+		offLedgerProvider: providers.OffLedger,
+		bcProvider:        providers.Blockchain,
+		dcas:              newDCAS(channelID, providers.DCAS),
 	}
 }
 
-// Start starts channel observer
+// OperationStats returns the number of operations that were written to (and skipped from) the document store
+func (o *Observer) OperationStats() opstore.Stats {
+	return o.dcas.Stats()
+}
+
+// Start starts channel observer. The observer may be restarted after it has been stopped.
 func (o *Observer) Start() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.notifier != nil {
+		logger.Debugf("[%s] Observer is already started", o.channelID)
+		return nil
+	}
+
 	logger.Infof("[%s] Starting observer for channel", o.channelID)
 
-	// register to receive Sidetree transactions from blocks
-	n := notifier.New(o.bpProvider.ForChannel(o.channelID))
-	dcasVal := newDCAS(o.channelID, o.dcasProvider)
-	sidetreeobserver.Start(n, dcasVal, dcasVal)
+	// register to receive Sidetree transactions from blocks. The live events are buffered while the missed blocks are replayed.
+	var opts []notifier.Option
+	if o.bcProvider != nil {
+		// The notifier reads missed blocks from the ledger if its buffer overflows
+		opts = append(opts, notifier.WithBlockchain(o.channelID, o.bcProvider))
+	}
+
+	n := notifier.New(o.bpProvider.ForChannel(o.channelID), opts...)
+
+	o.notifier = n
+	o.done = make(chan struct{})
+	o.stopped = make(chan struct{})
+
+	go o.listen(n.RegisterForSidetreeTxn(), sidetreeobserver.NewTxnProcessor(o.dcas, o.dcas), o.done, o.stopped)
 
 	return nil
 }
 
-// Stop stops the channel observer routines
+// Stop stops the channel observer routines. Sidetree transactions that were received before the observer
+// was stopped are processed before this function returns.
 func (o *Observer) Stop() {
-	// TODO: Need to have a way of stopping the Observer
+	o.mutex.Lock()
+	n, done, stopped := o.notifier, o.done, o.stopped
+	o.notifier, o.done, o.stopped = nil, nil, nil
+	o.mutex.Unlock()
+
+	if n == nil {
+		logger.Debugf("[%s] Observer is not started", o.channelID)
+		return
+	}
+
+	logger.Infof("[%s] Stopping observer for channel", o.channelID)
+
+	close(done)
+	n.Close()
+
+	<-stopped
+
+	stats := o.OperationStats()
+
+	logger.Infof("[%s] ... observer stopped for channel - Operations written: %d, skipped: %d", o.channelID, stats.Written, stats.Skipped)
+}
+
+func (o *Observer) listen(txnsCh <-chan []sidetreeobserver.SidetreeTxn, processor *sidetreeobserver.TxnProcessor, done, stopped chan struct{}) {
+	defer close(stopped)
+
+	cp := o.newCheckpoint()
+
+	// Live events for blocks that were already replayed are ignored
+	replayedTo := o.catchUp(cp, processor, done)
+
+	for txns := range txnsCh {
+		for _, txn := range txns {
+			if txn.TransactionTime <= replayedTo {
+				logger.Debugf("[%s] Ignoring anchor [%s] in block [%d] since the block was already replayed", o.channelID, txn.AnchorAddress, txn.TransactionTime)
+				continue
+			}
+
+			// The events are received in block order so all of the blocks before this one have been processed
+			if txn.TransactionTime > 0 {
+				o.advance(cp, txn.TransactionTime-1)
+			}
+
+			if err := processor.Process(txn); err != nil {
+				logger.Warnf("[%s] Failed to process anchor [%s]: %s", o.channelID, txn.AnchorAddress, err)
+
+				if cp != nil {
+					cp.failed(txn.TransactionTime)
+				}
+
+				continue
+			}
+
+			logger.Debugf("[%s] Successfully processed anchor [%s]", o.channelID, txn.AnchorAddress)
+		}
+	}
+
+	logger.Debugf("[%s] Sidetree transaction channel was closed", o.channelID)
+}
+
+// catchUp replays the blocks from the ledger that were committed after the last checkpoint and returns
+// the number of the last block that was replayed. If the replay is aborted then the first block that wasn't
+// replayed is marked as failed so that the checkpoint doesn't advance past it (and the block is replayed
+// when the observer restarts).
+func (o *Observer) catchUp(cp *checkpoint, processor *sidetreeobserver.TxnProcessor, done chan struct{}) uint64 {
+	if cp == nil {
+		return 0
+	}
+
+	bcClient, err := o.bcProvider.ForChannel(o.channelID)
+	if err != nil {
+		logger.Warnf("[%s] Unable to replay missed blocks: %s", o.channelID, err)
+		o.abortCatchUp(cp, cp.last+1)
+		return 0
+	}
+
+	bcInfo, err := bcClient.GetBlockchainInfo()
+	if err != nil {
+		logger.Warnf("[%s] Unable to replay missed blocks: failed to get blockchain info: %s", o.channelID, err)
+		o.abortCatchUp(cp, cp.last+1)
+		return 0
+	}
+
+	if !cp.exists {
+		// The observer has never run on this peer (or it ran before checkpoints were introduced) so there's
+		// no way of knowing which blocks were missed. Start from the current height instead of replaying the
+		// entire ledger - the monitor role is responsible for verifying historical blocks.
+		logger.Infof("[%s] No observer checkpoint exists - starting from block height [%d]", o.channelID, bcInfo.Height)
+
+		if bcInfo.Height > 0 {
+			cp.last = bcInfo.Height - 1
+		}
+
+		return 0
+	}
+
+	if cp.last+1 >= bcInfo.Height {
+		logger.Debugf("[%s] No missed blocks to replay - Block height [%d], last block processed [%d]", o.channelID, bcInfo.Height, cp.last)
+		return cp.last
+	}
+
+	logger.Infof("[%s] Replaying missed blocks - Block height [%d], last block processed [%d]", o.channelID, bcInfo.Height, cp.last)
+
+	visitor := blockvisitor.New(o.channelID, blockvisitor.WithWriteHandler(func(w *blockvisitor.Write) error {
+		return o.handleWrite(w, cp, processor)
+	}))
+
+	var replayedTo uint64
+	for bNum := cp.last + 1; bNum < bcInfo.Height; bNum++ {
+		select {
+		case <-done:
+			logger.Infof("[%s] Observer was stopped while replaying missed blocks", o.channelID)
+			o.abortCatchUp(cp, bNum)
+			return replayedTo
+		default:
+		}
+
+		block, err := bcClient.GetBlockByNumber(bNum)
+		if err != nil {
+			logger.Warnf("[%s] Unable to replay missed block [%d]: %s", o.channelID, bNum, err)
+			o.abortCatchUp(cp, bNum)
+			return replayedTo
+		}
+
+		if err := visitor.Visit(block); err != nil {
+			logger.Warnf("[%s] Error replaying missed block [%d]: %s", o.channelID, bNum, err)
+			o.abortCatchUp(cp, bNum)
+			return replayedTo
+		}
+
+		replayedTo = bNum
+
+		o.advance(cp, bNum)
+	}
+
+	logger.Infof("[%s] ... done replaying missed blocks up to block [%d]", o.channelID, replayedTo)
+
+	return replayedTo
+}
+
+// abortCatchUp marks the given block (the first block that wasn't replayed) as failed so that the live
+// events don't advance the checkpoint past the blocks that were missed
+func (o *Observer) abortCatchUp(cp *checkpoint, bNum uint64) {
+	if !cp.exists {
+		// There's no checkpoint so there's nothing to hold back
+		return
+	}
+
+	logger.Warnf("[%s] The observer checkpoint won't advance past block [%d] until the missed blocks are replayed (when the observer restarts)", o.channelID, bNum-1)
+
+	cp.failed(bNum)
+}
+
+func (o *Observer) handleWrite(w *blockvisitor.Write, cp *checkpoint, processor *sidetreeobserver.TxnProcessor) error {
+	if w.Namespace != common.SidetreeNs || w.Write.IsDelete || !strings.HasPrefix(w.Write.Key, common.AnchorAddrPrefix) {
+		return nil
+	}
+
+	logger.Debugf("[%s] Replaying anchor [%s] in block [%d] and TxNum [%d]", o.channelID, w.Write.Value, w.BlockNum, w.TxNum)
+
+	txn := sidetreeobserver.SidetreeTxn{
+		TransactionTime:   w.BlockNum,
+		TransactionNumber: w.TxNum,
+		AnchorAddress:     string(w.Write.Value),
+	}
+
+	if err := processor.Process(txn); err != nil {
+		logger.Warnf("[%s] Failed to process anchor [%s] in block [%d]: %s", o.channelID, txn.AnchorAddress, w.BlockNum, err)
+		cp.failed(w.BlockNum)
+	}
+
+	return nil
+}
+
+// newCheckpoint loads the observer's checkpoint. Nil is returned if the checkpoint isn't available,
+// in which case the observer only processes live block events.
+func (o *Observer) newCheckpoint() *checkpoint {
+	if o.offLedgerProvider == nil || o.bcProvider == nil {
+		logger.Warnf("[%s] Observer checkpoints are disabled since the off-ledger or blockchain provider isn't set", o.channelID)
+		return nil
+	}
+
+	cp := newCheckpoint(o.channelID, o.peerID, o.offLedgerProvider)
+	if err := cp.load(); err != nil {
+		logger.Warnf("[%s] Unable to load observer checkpoint. Missed blocks won't be replayed: %s", o.channelID, err)
+		return nil
+	}
+
+	return cp
+}
+
+func (o *Observer) advance(cp *checkpoint, bNum uint64) {
+	if cp == nil {
+		return
+	}
+
+	if err := cp.advance(bNum); err != nil {
+		logger.Warnf("[%s] Unable to update observer checkpoint to block [%d]: %s", o.channelID, bNum, err)
+	}
 }
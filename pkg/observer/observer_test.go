@@ -13,8 +13,11 @@ import (
 	"testing"
 	"time"
 
+	cb "github.com/hyperledger/fabric-protos-go/common"
 	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
 	gossipapi "github.com/hyperledger/fabric/extensions/gossip/api"
+	"github.com/pkg/errors"
 	viper "github.com/spf13/viper2015"
 	"github.com/stretchr/testify/require"
 	offledgerdcas "github.com/trustbloc/fabric-peer-ext/pkg/collections/offledger/dcas"
@@ -26,11 +29,13 @@ import (
 	stmocks "github.com/trustbloc/sidetree-fabric/pkg/mocks"
 	"github.com/trustbloc/sidetree-fabric/pkg/observer/common"
 	obmocks "github.com/trustbloc/sidetree-fabric/pkg/observer/mocks"
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/opstore"
 	"github.com/trustbloc/sidetree-fabric/pkg/role"
 )
 
 const (
 	channel      = "diddoc"
+	peer1        = "peer1.org1.com"
 	uniqueSuffix = "abc123"
 
 	sideTreeTxnCCName = "sidetreetxn_cc"
@@ -58,7 +63,7 @@ func TestObserver(t *testing.T) {
 		OffLedger:      &obmocks.OffLedgerClientProvider{},
 		BlockPublisher: mocks.NewBlockPublisherProvider().WithBlockPublisher(p),
 	}
-	observer := New(channel, providers)
+	observer := New(channel, peer1, providers)
 	require.NotNil(t, observer)
 
 	observer.Start()
@@ -74,6 +79,242 @@ func TestObserver(t *testing.T) {
 
 }
 
+func TestObserver_Restart(t *testing.T) {
+	p := mocks.NewBlockPublisher()
+
+	c := getDefaultDCASClient()
+	dcasProvider := &stmocks.DCASClientProvider{}
+	dcasProvider.ForChannelReturns(c, nil)
+
+	providers := &Providers{
+		DCAS:           dcasProvider,
+		OffLedger:      &obmocks.OffLedgerClientProvider{},
+		BlockPublisher: mocks.NewBlockPublisherProvider().WithBlockPublisher(p),
+	}
+
+	observer := New(channel, peer1, providers)
+	require.NotNil(t, observer)
+
+	require.NoError(t, observer.Start())
+	require.NoError(t, observer.Start())
+
+	handleWrite := p.HandleWrite
+	require.NotNil(t, handleWrite)
+
+	observer.Stop()
+	require.NotPanics(t, observer.Stop)
+
+	anchor := getAnchorAddress(uniqueSuffix)
+
+	// The handler of the stopped observer is still registered with the block publisher but it should ignore all events
+	require.NoError(t, handleWrite(gossipapi.TxMetadata{BlockNum: 1, ChannelID: channel, TxID: "tx1"}, sideTreeTxnCCName, &kvrwset.KVWrite{Key: anchorAddrPrefix + k1, IsDelete: false, Value: []byte(anchor)}))
+	time.Sleep(100 * time.Millisecond)
+
+	m, err := c.GetMap(common.DocNs, common.DocColl)
+	require.NoError(t, err)
+	require.Empty(t, m)
+
+	require.NoError(t, observer.Start())
+	defer observer.Stop()
+
+	require.NoError(t, p.HandleWrite(gossipapi.TxMetadata{BlockNum: 1, ChannelID: channel, TxID: "tx1"}, sideTreeTxnCCName, &kvrwset.KVWrite{Key: anchorAddrPrefix + k1, IsDelete: false, Value: []byte(anchor)}))
+	time.Sleep(200 * time.Millisecond)
+
+	m, err = c.GetMap(common.DocNs, common.DocColl)
+	require.NoError(t, err)
+	require.Len(t, m, 2)
+	require.Equal(t, opstore.Stats{Written: 2}, observer.OperationStats())
+}
+
+func TestObserver_CatchUp(t *testing.T) {
+	p := mocks.NewBlockPublisher()
+
+	c := getDefaultDCASClient()
+	dcasProvider := &stmocks.DCASClientProvider{}
+	dcasProvider.ForChannelReturns(c, nil)
+
+	olClient := obmocks.NewMockOffLedgerClient()
+	olProvider := &obmocks.OffLedgerClientProvider{}
+	olProvider.ForChannelReturns(olClient, nil)
+
+	anchor := getAnchorAddress(uniqueSuffix)
+
+	bcClient := &obmocks.BlockchainClient{}
+	bcClient.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1003}, nil)
+	bcClient.GetBlockByNumberStub = func(bNum uint64) (*cb.Block, error) {
+		b := mocks.NewBlockBuilder(channel, bNum)
+		if bNum == 1001 {
+			b.Transaction("tx1", pb.TxValidationCode_VALID).
+				ChaincodeAction(common.SidetreeNs).
+				Write(anchorAddrPrefix+k1, []byte(anchor))
+		}
+
+		return b.Build(), nil
+	}
+
+	bcProvider := &obmocks.BlockchainClientProvider{}
+	bcProvider.ForChannelReturns(bcClient, nil)
+
+	providers := &Providers{
+		DCAS:           dcasProvider,
+		OffLedger:      olProvider,
+		BlockPublisher: mocks.NewBlockPublisherProvider().WithBlockPublisher(p),
+		Blockchain:     bcProvider,
+	}
+
+	cp := newCheckpoint(channel, peer1, olProvider)
+	require.NoError(t, cp.advance(1000))
+
+	lastBlockProcessed := func() uint64 {
+		cp := newCheckpoint(channel, peer1, olProvider)
+		require.NoError(t, cp.load())
+		return cp.last
+	}
+
+	observer := New(channel, peer1, providers)
+	require.NotNil(t, observer)
+
+	require.NoError(t, observer.Start())
+	time.Sleep(200 * time.Millisecond)
+
+	// The anchor in the missed block was processed
+	m, err := c.GetMap(common.DocNs, common.DocColl)
+	require.NoError(t, err)
+	require.Len(t, m, 2)
+	require.Equal(t, uint64(1002), lastBlockProcessed())
+	require.Equal(t, 2, bcClient.GetBlockByNumberCallCount())
+
+	// Live events for blocks that were already replayed are ignored. (This anchor doesn't exist so it would fail if it were processed.)
+	require.NoError(t, p.HandleWrite(gossipapi.TxMetadata{BlockNum: 1002, ChannelID: channel, TxID: "tx2"}, sideTreeTxnCCName, &kvrwset.KVWrite{Key: anchorAddrPrefix + k1, Value: []byte("invalid")}))
+	require.NoError(t, p.HandleWrite(gossipapi.TxMetadata{BlockNum: 1005, ChannelID: channel, TxID: "tx3"}, sideTreeTxnCCName, &kvrwset.KVWrite{Key: anchorAddrPrefix + k1, Value: []byte(anchor)}))
+	time.Sleep(200 * time.Millisecond)
+	require.Equal(t, uint64(1004), lastBlockProcessed())
+
+	// The checkpoint doesn't advance past a block that failed
+	require.NoError(t, p.HandleWrite(gossipapi.TxMetadata{BlockNum: 1006, ChannelID: channel, TxID: "tx4"}, sideTreeTxnCCName, &kvrwset.KVWrite{Key: anchorAddrPrefix + k1, Value: []byte("invalid")}))
+	require.NoError(t, p.HandleWrite(gossipapi.TxMetadata{BlockNum: 1008, ChannelID: channel, TxID: "tx5"}, sideTreeTxnCCName, &kvrwset.KVWrite{Key: anchorAddrPrefix + k1, Value: []byte(anchor)}))
+	time.Sleep(200 * time.Millisecond)
+	require.Equal(t, uint64(1005), lastBlockProcessed())
+
+	observer.Stop()
+
+	t.Run("Blockchain error", func(t *testing.T) {
+		bcClient.GetBlockchainInfoReturns(nil, errors.New("injected blockchain error"))
+		defer bcClient.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1003}, nil)
+
+		require.NoError(t, observer.Start())
+		time.Sleep(100 * time.Millisecond)
+		observer.Stop()
+
+		require.Equal(t, uint64(1005), lastBlockProcessed())
+	})
+
+	t.Run("No checkpoint", func(t *testing.T) {
+		olProvider.ForChannelReturns(obmocks.NewMockOffLedgerClient(), nil)
+		defer olProvider.ForChannelReturns(olClient, nil)
+
+		numCalls := bcClient.GetBlockByNumberCallCount()
+
+		require.NoError(t, observer.Start())
+		time.Sleep(100 * time.Millisecond)
+		observer.Stop()
+
+		// The ledger isn't replayed if the observer has never run
+		require.Equal(t, numCalls, bcClient.GetBlockByNumberCallCount())
+	})
+
+	t.Run("Off-ledger error", func(t *testing.T) {
+		olClient.WithGetError(errors.New("injected off-ledger error"))
+		defer olClient.WithGetError(nil)
+
+		require.NoError(t, observer.Start())
+		time.Sleep(100 * time.Millisecond)
+		observer.Stop()
+	})
+}
+
+func TestObserver_CatchUpAborted(t *testing.T) {
+	p := mocks.NewBlockPublisher()
+
+	c := getDefaultDCASClient()
+	dcasProvider := &stmocks.DCASClientProvider{}
+	dcasProvider.ForChannelReturns(c, nil)
+
+	olClient := obmocks.NewMockOffLedgerClient()
+	olProvider := &obmocks.OffLedgerClientProvider{}
+	olProvider.ForChannelReturns(olClient, nil)
+
+	anchor := getAnchorAddress(uniqueSuffix)
+
+	bcClient := &obmocks.BlockchainClient{}
+	bcClient.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1004}, nil)
+	bcClient.GetBlockByNumberStub = func(bNum uint64) (*cb.Block, error) {
+		if bNum == 1002 {
+			return nil, errors.New("injected block error")
+		}
+
+		b := mocks.NewBlockBuilder(channel, bNum)
+		if bNum == 1001 {
+			b.Transaction("tx1", pb.TxValidationCode_VALID).
+				ChaincodeAction(common.SidetreeNs).
+				Write(anchorAddrPrefix+k1, []byte(anchor))
+		}
+
+		return b.Build(), nil
+	}
+
+	bcProvider := &obmocks.BlockchainClientProvider{}
+	bcProvider.ForChannelReturns(bcClient, nil)
+
+	providers := &Providers{
+		DCAS:           dcasProvider,
+		OffLedger:      olProvider,
+		BlockPublisher: mocks.NewBlockPublisherProvider().WithBlockPublisher(p),
+		Blockchain:     bcProvider,
+	}
+
+	cp := newCheckpoint(channel, peer1, olProvider)
+	require.NoError(t, cp.advance(1000))
+
+	lastBlockProcessed := func() uint64 {
+		cp := newCheckpoint(channel, peer1, olProvider)
+		require.NoError(t, cp.load())
+		return cp.last
+	}
+
+	observer := New(channel, peer1, providers)
+	require.NotNil(t, observer)
+
+	t.Run("Block error", func(t *testing.T) {
+		require.NoError(t, observer.Start())
+		time.Sleep(200 * time.Millisecond)
+
+		require.Equal(t, uint64(1001), lastBlockProcessed())
+
+		// A live event mustn't advance the checkpoint past the block that wasn't replayed
+		require.NoError(t, p.HandleWrite(gossipapi.TxMetadata{BlockNum: 1005, ChannelID: channel, TxID: "tx2"}, sideTreeTxnCCName, &kvrwset.KVWrite{Key: anchorAddrPrefix + k1, Value: []byte(anchor)}))
+		time.Sleep(200 * time.Millisecond)
+
+		require.Equal(t, uint64(1001), lastBlockProcessed())
+
+		observer.Stop()
+	})
+
+	t.Run("Blockchain info error", func(t *testing.T) {
+		bcClient.GetBlockchainInfoReturns(nil, errors.New("injected blockchain error"))
+
+		require.NoError(t, observer.Start())
+		time.Sleep(100 * time.Millisecond)
+
+		require.NoError(t, p.HandleWrite(gossipapi.TxMetadata{BlockNum: 1006, ChannelID: channel, TxID: "tx3"}, sideTreeTxnCCName, &kvrwset.KVWrite{Key: anchorAddrPrefix + k1, Value: []byte(anchor)}))
+		time.Sleep(200 * time.Millisecond)
+
+		require.Equal(t, uint64(1001), lastBlockProcessed())
+
+		observer.Stop()
+	})
+}
+
 func TestDCASPut(t *testing.T) {
 	c := getDefaultDCASClient()
 	c.PutErr = fmt.Errorf("put error")
@@ -104,7 +345,7 @@ func TestObserver_Start(t *testing.T) {
 			OffLedger:      &obmocks.OffLedgerClientProvider{},
 			BlockPublisher: mocks.NewBlockPublisherProvider(),
 		}
-		observer := New(channel, providers)
+		observer := New(channel, peer1, providers)
 		require.NotNil(t, observer)
 
 		observer.Start()
@@ -126,7 +367,7 @@ func TestObserver_Start(t *testing.T) {
 			OffLedger:      &obmocks.OffLedgerClientProvider{},
 			BlockPublisher: mocks.NewBlockPublisherProvider(),
 		}
-		observer := New(channel, providers)
+		observer := New(channel, peer1, providers)
 		require.NotNil(t, observer)
 
 		viper.Set("peer.id", "peer0.org1.com")
@@ -0,0 +1,239 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package opstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/pkg/errors"
+	"github.com/trustbloc/fabric-peer-ext/pkg/collections/offledger/dcas"
+	"github.com/trustbloc/sidetree-core-go/pkg/api/batch"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/common"
+)
+
+var logger = flogging.MustGetLogger("sidetree_observer")
+
+// ErrInvalidOperation indicates that an operation could not be marshalled. The error is persistent
+// (i.e. retrying won't help).
+var ErrInvalidOperation = errors.New("invalid operation")
+
+// Stats contains the number of operations that were written to the document store and the
+// number of operations that were skipped since they were already in the store. If verification
+// is enabled then Verified is the number of existing operations whose content was verified and
+// Repaired is the number of existing operations that were re-written since their content was invalid.
+type Stats struct {
+	Written  uint64
+	Skipped  uint64
+	Verified uint64
+	Repaired uint64
+}
+
+// Mismatch describes an operation whose stored content doesn't match the content of the anchored operation
+type Mismatch struct {
+	// Key is the DCAS key of the operation
+	Key string
+
+	// OperationID is the ID of the anchored operation
+	OperationID string
+
+	// HashMismatch indicates that the hash of the stored content doesn't match the key
+	HashMismatch bool
+
+	// IDMismatch indicates that the 'id' field of the stored operation (which is used to index the
+	// operations of a document) doesn't match the ID of the anchored operation
+	IDMismatch bool
+
+	// Repaired indicates that the stored content was replaced with the content of the anchored operation
+	Repaired bool
+}
+
+// MismatchHandler is invoked for each operation whose stored content doesn't match the anchored operation
+type MismatchHandler func(mismatch *Mismatch)
+
+// Option is an operation store option
+type Option func(s *OperationStore)
+
+// WithVerification enables verification of operations that already exist in the store. The stored content is
+// compared with the content of the anchored operation and, if they don't match, the stored content is replaced
+// (repaired). The given handler is invoked for each mismatch.
+func WithVerification(handler MismatchHandler) Option {
+	return func(s *OperationStore) {
+		s.verify = true
+		s.mismatchHandler = handler
+	}
+}
+
+// OperationStore persists operations in the document DCAS store. Operations that already exist in the store
+// are skipped so that the same operation isn't written (and gossiped) more than once - for example, when both
+// the observer and the monitor process the same anchor.
+type OperationStore struct {
+	channelID          string
+	dcasClientProvider common.DCASClientProvider
+	verify             bool
+	mismatchHandler    MismatchHandler
+	written            uint64
+	skipped            uint64
+	verified           uint64
+	repaired           uint64
+}
+
+// New returns a new operation store
+func New(channelID string, dcasClientProvider common.DCASClientProvider, opts ...Option) *OperationStore {
+	s := &OperationStore{
+		channelID:          channelID,
+		dcasClientProvider: dcasClientProvider,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Put persists the given operations (which are typically the operations of one anchor) if they don't already exist
+// in the document store. The existence check and the write are each done in a single call to the store.
+func (s *OperationStore) Put(ops []*batch.Operation) error {
+	var keys []string
+	var values [][]byte
+	var opIDs []string
+
+	exists := make(map[string]struct{})
+	for _, op := range ops {
+		key, opBytes, err := common.MarshalDCAS(op)
+		if err != nil {
+			return errors.WithMessagef(ErrInvalidOperation, "failed to get DCAS key and value for operation [%s]: %s", op.ID, err)
+		}
+
+		if _, ok := exists[key]; ok {
+			logger.Debugf("[%s] Operation [%s] is duplicated in the batch", s.channelID, op.ID)
+			continue
+		}
+
+		exists[key] = struct{}{}
+		keys = append(keys, key)
+		values = append(values, opBytes)
+		opIDs = append(opIDs, op.ID)
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	dcasClient, err := s.dcasClientProvider.ForChannel(s.channelID)
+	if err != nil {
+		return err
+	}
+
+	retrieved, err := dcasClient.GetMultipleKeys(common.DocNs, common.DocColl, keys...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to retrieve %d operations", len(keys))
+	}
+
+	if len(retrieved) != len(keys) {
+		return errors.Errorf("expecting %d values for operations but got %d", len(keys), len(retrieved))
+	}
+
+	var missing [][]byte
+	var mismatches []*Mismatch
+	var numVerified uint64
+
+	for i, value := range retrieved {
+		if len(value) == 0 {
+			missing = append(missing, values[i])
+			continue
+		}
+
+		if !s.verify {
+			continue
+		}
+
+		numVerified++
+
+		if mismatch := verify(keys[i], opIDs[i], values[i], value); mismatch != nil {
+			logger.Warnf("[%s] Stored content of operation [%s] with key [%s] doesn't match the anchored operation - HashMismatch: %t, IDMismatch: %t", s.channelID, mismatch.OperationID, mismatch.Key, mismatch.HashMismatch, mismatch.IDMismatch)
+
+			mismatches = append(mismatches, mismatch)
+			missing = append(missing, values[i])
+		}
+	}
+
+	numWritten := uint64(len(missing) - len(mismatches))
+	numSkipped := uint64(len(ops) - len(missing))
+
+	if len(missing) > 0 {
+		logger.Debugf("[%s] Persisting %d of %d operations (%d repaired)", s.channelID, len(missing), len(ops), len(mismatches))
+
+		if _, err := dcasClient.PutMultipleValues(common.DocNs, common.DocColl, missing); err != nil {
+			s.notifyMismatches(mismatches)
+
+			return errors.Wrapf(err, "dcas put failed for %d operations", len(missing))
+		}
+	} else {
+		logger.Debugf("[%s] All %d operations were found in DCAS", s.channelID, len(ops))
+	}
+
+	for _, mismatch := range mismatches {
+		mismatch.Repaired = true
+	}
+
+	s.notifyMismatches(mismatches)
+
+	atomic.AddUint64(&s.written, numWritten)
+	atomic.AddUint64(&s.skipped, numSkipped)
+	atomic.AddUint64(&s.verified, numVerified)
+	atomic.AddUint64(&s.repaired, uint64(len(mismatches)))
+
+	return nil
+}
+
+func (s *OperationStore) notifyMismatches(mismatches []*Mismatch) {
+	if s.mismatchHandler == nil {
+		return
+	}
+
+	for _, mismatch := range mismatches {
+		s.mismatchHandler(mismatch)
+	}
+}
+
+// verify compares the stored content of an operation with the expected (normalized) content and
+// returns a Mismatch if they differ
+func verify(key, opID string, expected, stored []byte) *Mismatch {
+	if bytes.Equal(expected, stored) {
+		return nil
+	}
+
+	mismatch := &Mismatch{
+		Key:         key,
+		OperationID: opID,
+	}
+
+	storedKey, _, err := dcas.GetCASKeyAndValue(stored)
+	mismatch.HashMismatch = err != nil || storedKey != key
+
+	storedOp := &struct {
+		ID string `json:"id"`
+	}{}
+	mismatch.IDMismatch = json.Unmarshal(stored, storedOp) != nil || storedOp.ID != opID
+
+	return mismatch
+}
+
+// Stats returns the number of operations that were written and skipped by this store
+func (s *OperationStore) Stats() Stats {
+	return Stats{
+		Written:  atomic.LoadUint64(&s.written),
+		Skipped:  atomic.LoadUint64(&s.skipped),
+		Verified: atomic.LoadUint64(&s.verified),
+		Repaired: atomic.LoadUint64(&s.repaired),
+	}
+}
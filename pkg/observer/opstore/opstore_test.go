@@ -0,0 +1,162 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package opstore
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/sidetree-core-go/pkg/api/batch"
+
+	stmocks "github.com/trustbloc/sidetree-fabric/pkg/mocks"
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/common"
+	obmocks "github.com/trustbloc/sidetree-fabric/pkg/observer/mocks"
+)
+
+const channel1 = "channel1"
+
+func TestOperationStore_Put(t *testing.T) {
+	dcasClient := obmocks.NewMockDCASClient()
+	dcasClientProvider := &stmocks.DCASClientProvider{}
+	dcasClientProvider.ForChannelReturns(dcasClient, nil)
+
+	op1 := &batch.Operation{ID: "op1"}
+	op2 := &batch.Operation{ID: "op2"}
+	op3 := &batch.Operation{ID: "op3"}
+
+	s1 := New(channel1, dcasClientProvider)
+	require.NoError(t, s1.Put([]*batch.Operation{op1, op2, op1}))
+	require.Equal(t, Stats{Written: 2, Skipped: 1}, s1.Stats())
+
+	m, err := dcasClient.GetMap(common.DocNs, common.DocColl)
+	require.NoError(t, err)
+	require.Len(t, m, 2)
+
+	// Another store (e.g. the monitor's) skips the operations that were already written
+	s2 := New(channel1, dcasClientProvider)
+	require.NoError(t, s2.Put([]*batch.Operation{op1, op2, op3}))
+	require.Equal(t, Stats{Written: 1, Skipped: 2}, s2.Stats())
+
+	require.NoError(t, s2.Put(nil))
+	require.Equal(t, Stats{Written: 1, Skipped: 2}, s2.Stats())
+
+	m, err = dcasClient.GetMap(common.DocNs, common.DocColl)
+	require.NoError(t, err)
+	require.Len(t, m, 3)
+}
+
+func TestOperationStore_Verify(t *testing.T) {
+	dcasClient := obmocks.NewMockDCASClient()
+	dcasClientProvider := &stmocks.DCASClientProvider{}
+	dcasClientProvider.ForChannelReturns(dcasClient, nil)
+
+	op1 := &batch.Operation{ID: "op1", UniqueSuffix: "suffix1"}
+	op2 := &batch.Operation{ID: "op2", UniqueSuffix: "suffix2"}
+	op3 := &batch.Operation{ID: "op3", UniqueSuffix: "suffix3"}
+
+	require.NoError(t, New(channel1, dcasClientProvider).Put([]*batch.Operation{op1, op2, op3}))
+
+	key1, op1Bytes, err := common.MarshalDCAS(op1)
+	require.NoError(t, err)
+	key2, _, err := common.MarshalDCAS(op2)
+	require.NoError(t, err)
+
+	// Corrupt the stored content of op1 and op2. The content of op2 is replaced with the
+	// content of another document so that the index (id field) is also wrong.
+	require.NoError(t, dcasClient.MockOffLedgerClient.Put(common.DocNs, common.DocColl, key1, []byte(`{"id":"op1","uniqueSuffix":"corrupt"}`)))
+	require.NoError(t, dcasClient.MockOffLedgerClient.Put(common.DocNs, common.DocColl, key2, op1Bytes))
+
+	var mismatches []*Mismatch
+	s := New(channel1, dcasClientProvider, WithVerification(func(mismatch *Mismatch) {
+		mismatches = append(mismatches, mismatch)
+	}))
+
+	require.NoError(t, s.Put([]*batch.Operation{op1, op2, op3}))
+	require.Equal(t, Stats{Skipped: 1, Verified: 3, Repaired: 2}, s.Stats())
+
+	require.Len(t, mismatches, 2)
+	require.Equal(t, &Mismatch{Key: key1, OperationID: "op1", HashMismatch: true, Repaired: true}, mismatches[0])
+	require.Equal(t, &Mismatch{Key: key2, OperationID: "op2", HashMismatch: true, IDMismatch: true, Repaired: true}, mismatches[1])
+
+	// The stored operations were repaired
+	require.NoError(t, s.Put([]*batch.Operation{op1, op2, op3}))
+	require.Equal(t, Stats{Skipped: 4, Verified: 6, Repaired: 2}, s.Stats())
+	require.Len(t, mismatches, 2)
+
+	stored, err := dcasClient.Get(common.DocNs, common.DocColl, key1)
+	require.NoError(t, err)
+	require.Equal(t, op1Bytes, stored)
+
+	t.Run("Put error", func(t *testing.T) {
+		require.NoError(t, dcasClient.MockOffLedgerClient.Put(common.DocNs, common.DocColl, key1, []byte("corrupt")))
+
+		dcasClient.WithPutError(errors.New("injected DCAS error"))
+		defer dcasClient.WithPutError(nil)
+
+		mismatches = nil
+
+		err := s.Put([]*batch.Operation{op1})
+		require.Error(t, err)
+		require.Len(t, mismatches, 1)
+		require.True(t, mismatches[0].HashMismatch)
+		require.True(t, mismatches[0].IDMismatch)
+		require.False(t, mismatches[0].Repaired)
+	})
+}
+
+func TestOperationStore_PutError(t *testing.T) {
+	errExpected := errors.New("injected DCAS error")
+	op1 := &batch.Operation{ID: "op1"}
+
+	t.Run("Provider error", func(t *testing.T) {
+		dcasClientProvider := &stmocks.DCASClientProvider{}
+		dcasClientProvider.ForChannelReturns(nil, errExpected)
+
+		s := New(channel1, dcasClientProvider)
+		require.EqualError(t, s.Put([]*batch.Operation{op1}), errExpected.Error())
+	})
+
+	t.Run("Get error", func(t *testing.T) {
+		dcasClient := obmocks.NewMockDCASClient()
+		dcasClient.WithGetError(errExpected)
+
+		dcasClientProvider := &stmocks.DCASClientProvider{}
+		dcasClientProvider.ForChannelReturns(dcasClient, nil)
+
+		s := New(channel1, dcasClientProvider)
+		err := s.Put([]*batch.Operation{op1})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to retrieve 1 operations")
+		require.Equal(t, errExpected, errors.Cause(err))
+	})
+
+	t.Run("Put error", func(t *testing.T) {
+		dcasClient := obmocks.NewMockDCASClient()
+		dcasClient.WithPutError(errExpected)
+
+		dcasClientProvider := &stmocks.DCASClientProvider{}
+		dcasClientProvider.ForChannelReturns(dcasClient, nil)
+
+		s := New(channel1, dcasClientProvider)
+		err := s.Put([]*batch.Operation{op1})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "dcas put failed")
+		require.Equal(t, errExpected, errors.Cause(err))
+		require.Zero(t, s.Stats().Written)
+	})
+
+	t.Run("Unexpected number of values", func(t *testing.T) {
+		dcasClient := &stmocks.DCASClient{}
+		dcasClientProvider := &stmocks.DCASClientProvider{}
+		dcasClientProvider.ForChannelReturns(dcasClient, nil)
+
+		s := New(channel1, dcasClientProvider)
+		err := s.Put([]*batch.Operation{op1})
+		require.EqualError(t, err, "expecting 1 values for operations but got 0")
+	})
+}
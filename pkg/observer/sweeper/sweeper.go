@@ -0,0 +1,540 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sweeper
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/pkg/errors"
+	"github.com/trustbloc/fabric-peer-ext/pkg/common/blockvisitor"
+	"github.com/trustbloc/sidetree-core-go/pkg/observer"
+
+	bcclient "github.com/trustbloc/sidetree-fabric/pkg/client"
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/common"
+)
+
+var logger = flogging.MustGetLogger("sidetree_observer")
+
+const (
+	// allContentQuery is a CouchDB query that returns all of the content in the DCAS collection
+	allContentQuery = `{"selector":{"_id":{"$gt":null}}}`
+
+	metaDataColName = "meta_data"
+
+	// metaDataKeyPrefix is prepended to the peer ID in order to form the key of the sweeper's meta-data
+	metaDataKeyPrefix = "sweeper~"
+)
+
+// ClientProviders contains the providers for the off-ledger, DCAS and blockchain clients
+type ClientProviders struct {
+	OffLedger  common.OffLedgerClientProvider
+	DCAS       common.DCASClientProvider
+	Blockchain common.BlockchainClientProvider
+}
+
+// MetaData contains the sweeper's progress. The referenced and unresolved anchors are persisted along with the
+// last block scanned since content that's referenced by the blocks that were already scanned would otherwise
+// appear to be orphaned when the sweeper resumes.
+type MetaData struct {
+	LastBlockScanned uint64
+	Referenced       []string
+	Unresolved       []string
+}
+
+// Config holds the sweeper configuration
+type Config struct {
+	// Period is the interval at which the sweeper runs
+	Period time.Duration
+
+	// GracePeriod is the amount of time that content must remain unreferenced before it is considered orphaned
+	GracePeriod time.Duration
+
+	// Purge indicates that orphaned content should be deleted. If false then orphaned content is only reported.
+	Purge bool
+}
+
+// Report contains the results of a single sweep
+type Report struct {
+	// Scanned is the number of items found in the DCAS collection
+	Scanned int
+	// Referenced is the number of items that are referenced by an anchor on the ledger
+	Referenced int
+	// Pending is the number of unreferenced items that are still within the grace period
+	Pending int
+	// Orphaned contains the keys of the items that have been unreferenced for longer than the grace period
+	Orphaned []string
+	// Purged is the number of orphaned items that were deleted from the DCAS collection
+	Purged int
+	// Unresolved is the number of anchors whose batch file couldn't be determined (since the anchor wasn't
+	// found in DCAS or is invalid). Orphaned content isn't purged while any anchors are unresolved.
+	Unresolved int
+}
+
+// Sweeper periodically scans the Sidetree DCAS collection for content (batch and anchor files) that is not
+// referenced by any anchor on the ledger. This may happen, for example, if the batch and anchor files were
+// written to DCAS but the anchor transaction failed. Content that has remained unreferenced for longer than
+// the configured grace period is reported and, optionally, purged.
+//
+// If the batch file of an anchor can't be determined (for example, if the anchor hasn't yet been replicated
+// to the local DCAS collection) then the anchor is retried on each sweep and, in the meantime, nothing is purged
+// since the batch file may appear to be orphaned.
+//
+// The progress of the sweeper is persisted to the meta-data collection so that the blocks that were already
+// scanned aren't scanned again when the sweeper restarts.
+type Sweeper struct {
+	*ClientProviders
+	Config
+
+	channelID    string
+	peerID       string
+	blockVisitor *blockvisitor.Visitor
+	loaded       bool
+	dirty        bool
+	nextBlock    uint64
+	referenced   map[string]struct{}
+	unresolved   map[string]struct{}
+	candidates   map[string]time.Time
+	mutex        sync.Mutex
+	done         chan struct{}
+	stopOnce     sync.Once
+}
+
+// New returns a new DCAS sweeper
+func New(channelID, peerID string, cfg Config, providers *ClientProviders) *Sweeper {
+	s := &Sweeper{
+		ClientProviders: providers,
+		Config:          cfg,
+		channelID:       channelID,
+		peerID:          peerID,
+		referenced:      make(map[string]struct{}),
+		unresolved:      make(map[string]struct{}),
+		candidates:      make(map[string]time.Time),
+		done:            make(chan struct{}),
+	}
+
+	s.blockVisitor = blockvisitor.New(channelID,
+		blockvisitor.WithWriteHandler(s.handleWrite),
+		blockvisitor.WithErrorHandler(s.handleError),
+	)
+
+	return s
+}
+
+// Start starts the sweeper
+func (s *Sweeper) Start() error {
+	if s.Period == 0 {
+		logger.Infof("[%s] DCAS sweeper is disabled", s.channelID)
+		return nil
+	}
+
+	if s.GracePeriod == 0 {
+		return errors.New("grace period must be greater than 0")
+	}
+
+	logger.Infof("[%s] Starting DCAS sweeper - Period: %s, Grace period: %s, Purge: %t", s.channelID, s.Period, s.GracePeriod, s.Purge)
+
+	go s.run()
+
+	return nil
+}
+
+// Stop stops the sweeper. Subsequent calls have no effect.
+func (s *Sweeper) Stop() {
+	if s.Period == 0 {
+		return
+	}
+
+	s.stopOnce.Do(func() {
+		logger.Infof("[%s] Stopping DCAS sweeper", s.channelID)
+
+		close(s.done)
+	})
+}
+
+func (s *Sweeper) run() {
+	ticker := time.NewTicker(s.Period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.sweep(); err != nil {
+				if errors.Cause(err) == bcclient.ErrNoLedger {
+					logger.Infof("[%s] Unable to sweep DCAS since the channel doesn't exist", s.channelID)
+				} else {
+					logger.Warnf("[%s] Error sweeping DCAS: %s", s.channelID, err)
+				}
+			}
+		case <-s.done:
+			logger.Infof("[%s] Exiting DCAS sweeper", s.channelID)
+			return
+		}
+	}
+}
+
+func (s *Sweeper) sweep() (*Report, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	if err := s.resolveAnchors(); err != nil {
+		return nil, err
+	}
+
+	if err := s.scanBlocks(); err != nil {
+		return nil, err
+	}
+
+	if s.dirty {
+		if err := s.save(); err != nil {
+			// The blocks will be scanned again when the sweeper restarts
+			logger.Warnf("[%s] Unable to persist DCAS sweeper meta-data: %s", s.channelID, err)
+		}
+	}
+
+	keys, err := s.queryContent()
+	if err != nil {
+		return nil, err
+	}
+
+	report := s.evaluate(keys, time.Now())
+	report.Unresolved = len(s.unresolved)
+
+	if len(report.Orphaned) > 0 {
+		if err := s.purge(report); err != nil {
+			return nil, err
+		}
+	}
+
+	logger.Infof("[%s] DCAS sweep completed - Scanned: %d, Referenced: %d, Pending: %d, Orphaned: %d, Purged: %d, Unresolved anchors: %d",
+		s.channelID, report.Scanned, report.Referenced, report.Pending, len(report.Orphaned), report.Purged, report.Unresolved)
+
+	return report, nil
+}
+
+// scanBlocks visits all blocks that haven't yet been scanned and records the anchors (and the batch files
+// referenced by the anchors) that were written to the ledger
+func (s *Sweeper) scanBlocks() error {
+	bcClient, err := s.Blockchain.ForChannel(s.channelID)
+	if err != nil {
+		return err
+	}
+
+	bcInfo, err := bcClient.GetBlockchainInfo()
+	if err != nil {
+		return errors.WithMessage(err, "failed to get blockchain info")
+	}
+
+	logger.Debugf("[%s] Scanning blocks [%d:%d] for anchors", s.channelID, s.nextBlock, bcInfo.Height)
+
+	for ; s.nextBlock < bcInfo.Height; s.nextBlock++ {
+		block, err := bcClient.GetBlockByNumber(s.nextBlock)
+		if err != nil {
+			return errors.WithMessagef(err, "failed to get block number [%d]", s.nextBlock)
+		}
+
+		if err := s.blockVisitor.Visit(block); err != nil {
+			return errors.WithMessagef(err, "error visiting block [%d]", s.nextBlock)
+		}
+
+		s.dirty = true
+	}
+
+	return nil
+}
+
+// load loads the sweeper's progress from the meta-data collection. The progress is loaded only once.
+func (s *Sweeper) load() error {
+	if s.loaded {
+		return nil
+	}
+
+	if s.OffLedger == nil {
+		logger.Warnf("[%s] The off-ledger provider isn't set. All blocks will be scanned again when the DCAS sweeper restarts.", s.channelID)
+
+		s.loaded = true
+
+		return nil
+	}
+
+	olClient, err := s.OffLedger.ForChannel(s.channelID)
+	if err != nil {
+		return err
+	}
+
+	data, err := olClient.Get(common.DocNs, metaDataColName, s.metaDataKey())
+	if err != nil {
+		return errors.WithMessage(err, "error retrieving DCAS sweeper meta-data")
+	}
+
+	s.loaded = true
+
+	if len(data) == 0 {
+		logger.Debugf("[%s] No DCAS sweeper meta-data exists for peer [%s]", s.channelID, s.peerID)
+		return nil
+	}
+
+	metaData := &MetaData{}
+	if err := json.Unmarshal(data, metaData); err != nil {
+		return errors.WithMessage(err, "error unmarshalling DCAS sweeper meta-data")
+	}
+
+	s.nextBlock = metaData.LastBlockScanned + 1
+
+	for _, key := range metaData.Referenced {
+		s.referenced[key] = struct{}{}
+	}
+
+	for _, anchorAddr := range metaData.Unresolved {
+		s.unresolved[anchorAddr] = struct{}{}
+	}
+
+	logger.Infof("[%s] Resuming DCAS sweeper after block [%d] - Referenced: %d, Unresolved anchors: %d",
+		s.channelID, metaData.LastBlockScanned, len(s.referenced), len(s.unresolved))
+
+	return nil
+}
+
+// save persists the sweeper's progress to the meta-data collection
+func (s *Sweeper) save() error {
+	if s.OffLedger == nil {
+		return nil
+	}
+
+	metaData := &MetaData{
+		LastBlockScanned: s.nextBlock - 1,
+		Referenced:       sortedKeys(s.referenced),
+		Unresolved:       sortedKeys(s.unresolved),
+	}
+
+	logger.Debugf("[%s] Updating DCAS sweeper meta-data - Last block scanned: %d, Referenced: %d, Unresolved anchors: %d",
+		s.channelID, metaData.LastBlockScanned, len(metaData.Referenced), len(metaData.Unresolved))
+
+	bytes, err := json.Marshal(metaData)
+	if err != nil {
+		return errors.WithMessage(err, "error marshalling DCAS sweeper meta-data")
+	}
+
+	olClient, err := s.OffLedger.ForChannel(s.channelID)
+	if err != nil {
+		return err
+	}
+
+	if err := olClient.Put(common.DocNs, metaDataColName, s.metaDataKey(), bytes); err != nil {
+		return errors.WithMessage(err, "error persisting DCAS sweeper meta-data")
+	}
+
+	s.dirty = false
+
+	return nil
+}
+
+func (s *Sweeper) metaDataKey() string {
+	return metaDataKeyPrefix + s.peerID
+}
+
+func (s *Sweeper) handleWrite(w *blockvisitor.Write) error {
+	if w.Namespace != common.SidetreeNs || w.Write.IsDelete || !strings.HasPrefix(w.Write.Key, common.AnchorAddrPrefix) {
+		return nil
+	}
+
+	anchorAddr := string(w.Write.Value)
+
+	logger.Debugf("[%s] Found anchor [%s] in block [%d] and TxNum [%d]", s.channelID, anchorAddr, w.BlockNum, w.TxNum)
+
+	s.referenced[anchorAddr] = struct{}{}
+
+	resolved, err := s.resolveAnchor(anchorAddr)
+	if err != nil {
+		return err
+	}
+
+	if !resolved {
+		logger.Warnf("[%s] Unable to resolve the batch file of anchor [%s] in block [%d] and TxNum [%d]. Orphaned content won't be purged until the anchor is resolved.",
+			s.channelID, anchorAddr, w.BlockNum, w.TxNum)
+
+		s.unresolved[anchorAddr] = struct{}{}
+	}
+
+	return nil
+}
+
+// resolveAnchors retries the anchors that couldn't previously be resolved
+func (s *Sweeper) resolveAnchors() error {
+	for anchorAddr := range s.unresolved {
+		resolved, err := s.resolveAnchor(anchorAddr)
+		if err != nil {
+			return err
+		}
+
+		if resolved {
+			logger.Infof("[%s] Resolved anchor [%s]", s.channelID, anchorAddr)
+
+			delete(s.unresolved, anchorAddr)
+			s.dirty = true
+		}
+	}
+
+	return nil
+}
+
+// resolveAnchor records the batch file that's referenced by the given anchor. False is returned if
+// the anchor isn't found in DCAS or is invalid.
+func (s *Sweeper) resolveAnchor(anchorAddr string) (bool, error) {
+	dcasClient, err := s.DCAS.ForChannel(s.channelID)
+	if err != nil {
+		return false, err
+	}
+
+	content, err := dcasClient.Get(common.SidetreeNs, common.SidetreeColl, anchorAddr)
+	if err != nil {
+		return false, errors.WithMessagef(err, "failed to retrieve anchor [%s]", anchorAddr)
+	}
+
+	if len(content) == 0 {
+		logger.Debugf("[%s] Anchor [%s] was not found in DCAS", s.channelID, anchorAddr)
+		return false, nil
+	}
+
+	af := &observer.AnchorFile{}
+	if err := json.Unmarshal(content, af); err != nil {
+		logger.Warnf("[%s] Unable to unmarshal anchor [%s]: %s", s.channelID, anchorAddr, err)
+		return false, nil
+	}
+
+	if af.BatchFileHash != "" {
+		s.referenced[af.BatchFileHash] = struct{}{}
+	}
+
+	return true, nil
+}
+
+func (s *Sweeper) handleError(err error, ctx *blockvisitor.Context) error {
+	if ctx.Category == blockvisitor.UnmarshalErr {
+		logger.Errorf("[%s] Ignoring persistent error: %s. Context: %s", s.channelID, err, ctx)
+		return nil
+	}
+
+	// Abort the scan. The block will be scanned again on the next sweep.
+	return err
+}
+
+func (s *Sweeper) queryContent() ([]string, error) {
+	dcasClient, err := s.DCAS.ForChannel(s.channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := dcasClient.Query(common.SidetreeNs, common.SidetreeColl, allContentQuery)
+	if err != nil {
+		return nil, errors.WithMessage(err, "error querying DCAS content")
+	}
+	defer it.Close()
+
+	var keys []string
+	for {
+		result, err := it.Next()
+		if err != nil {
+			return nil, errors.WithMessage(err, "error iterating DCAS content")
+		}
+
+		if result == nil {
+			return keys, nil
+		}
+
+		keys = append(keys, result.(*queryresult.KV).Key)
+	}
+}
+
+// evaluate determines which of the given keys are orphaned. An unreferenced key is tracked from the
+// first time it was seen and is considered orphaned only after the grace period has elapsed.
+func (s *Sweeper) evaluate(keys []string, now time.Time) *Report {
+	report := &Report{Scanned: len(keys)}
+
+	candidates := make(map[string]time.Time)
+
+	for _, key := range keys {
+		if _, ok := s.referenced[key]; ok {
+			report.Referenced++
+			continue
+		}
+
+		firstSeen, ok := s.candidates[key]
+		if !ok {
+			firstSeen = now
+		}
+
+		if now.Sub(firstSeen) < s.GracePeriod {
+			candidates[key] = firstSeen
+			report.Pending++
+			continue
+		}
+
+		report.Orphaned = append(report.Orphaned, key)
+
+		// Keep tracking the orphan in case it's not purged
+		candidates[key] = firstSeen
+	}
+
+	// Content that was referenced or removed since the last sweep is no longer tracked
+	s.candidates = candidates
+
+	return report
+}
+
+func (s *Sweeper) purge(report *Report) error {
+	for _, key := range report.Orphaned {
+		logger.Warnf("[%s] DCAS content [%s] has not been referenced by any anchor for at least %s", s.channelID, key, s.GracePeriod)
+	}
+
+	if !s.Purge {
+		logger.Infof("[%s] Dry run - %d orphaned item(s) will not be purged", s.channelID, len(report.Orphaned))
+		return nil
+	}
+
+	if len(s.unresolved) > 0 {
+		logger.Warnf("[%s] %d orphaned item(s) will not be purged since %d anchor(s) are unresolved", s.channelID, len(report.Orphaned), len(s.unresolved))
+		return nil
+	}
+
+	dcasClient, err := s.DCAS.ForChannel(s.channelID)
+	if err != nil {
+		return err
+	}
+
+	if err := dcasClient.Delete(common.SidetreeNs, common.SidetreeColl, report.Orphaned...); err != nil {
+		return errors.WithMessage(err, "error purging orphaned DCAS content")
+	}
+
+	for _, key := range report.Orphaned {
+		delete(s.candidates, key)
+	}
+
+	report.Purged = len(report.Orphaned)
+
+	return nil
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,394 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sweeper
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	peerextmocks "github.com/trustbloc/fabric-peer-ext/pkg/mocks"
+	"github.com/trustbloc/sidetree-core-go/pkg/observer"
+
+	stmocks "github.com/trustbloc/sidetree-fabric/pkg/mocks"
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/common"
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/mocks"
+)
+
+const (
+	channel1 = "channel1"
+	peer1    = "peer1"
+	txID1    = "tx1"
+)
+
+func TestSweeper(t *testing.T) {
+	dcasClient := mocks.NewMockDCASClient()
+
+	batchKey, err := dcasClient.Put(common.SidetreeNs, common.SidetreeColl, []byte(`{"operations":[]}`))
+	require.NoError(t, err)
+
+	anchorBytes, err := json.Marshal(&observer.AnchorFile{BatchFileHash: batchKey})
+	require.NoError(t, err)
+
+	anchorKey, err := dcasClient.Put(common.SidetreeNs, common.SidetreeColl, anchorBytes)
+	require.NoError(t, err)
+
+	orphanKey, err := dcasClient.Put(common.SidetreeNs, common.SidetreeColl, []byte(`{"operations":["orphan"]}`))
+	require.NoError(t, err)
+
+	dcasClient.WithQueryResults(common.SidetreeNs, common.SidetreeColl, allContentQuery,
+		[]*queryresult.KV{{Key: batchKey}, {Key: anchorKey}, {Key: orphanKey}},
+	)
+
+	b := peerextmocks.NewBlockBuilder(channel1, 0)
+	b.Transaction(txID1, pb.TxValidationCode_VALID).
+		ChaincodeAction(common.SidetreeNs).
+		Write(common.AnchorAddrPrefix+anchorKey, []byte(anchorKey))
+
+	bcClient := &mocks.BlockchainClient{}
+	bcClient.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1}, nil)
+	bcClient.GetBlockByNumberReturns(b.Build(), nil)
+
+	providers := newProviders(bcClient, dcasClient)
+
+	t.Run("Dry run", func(t *testing.T) {
+		s := New(channel1, peer1, Config{Period: time.Second, GracePeriod: 50 * time.Millisecond}, providers)
+
+		report, err := s.sweep()
+		require.NoError(t, err)
+		require.Equal(t, 3, report.Scanned)
+		require.Equal(t, 2, report.Referenced)
+		require.Equal(t, 1, report.Pending)
+		require.Empty(t, report.Orphaned)
+
+		time.Sleep(100 * time.Millisecond)
+
+		report, err = s.sweep()
+		require.NoError(t, err)
+		require.Equal(t, 2, report.Referenced)
+		require.Zero(t, report.Pending)
+		require.Equal(t, []string{orphanKey}, report.Orphaned)
+		require.Zero(t, report.Purged)
+
+		content, err := dcasClient.Get(common.SidetreeNs, common.SidetreeColl, orphanKey)
+		require.NoError(t, err)
+		require.NotEmpty(t, content)
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		s := New(channel1, peer1, Config{Period: time.Second, GracePeriod: 50 * time.Millisecond, Purge: true}, providers)
+
+		report, err := s.sweep()
+		require.NoError(t, err)
+		require.Empty(t, report.Orphaned)
+
+		time.Sleep(100 * time.Millisecond)
+
+		report, err = s.sweep()
+		require.NoError(t, err)
+		require.Equal(t, []string{orphanKey}, report.Orphaned)
+		require.Equal(t, 1, report.Purged)
+
+		content, err := dcasClient.Get(common.SidetreeNs, common.SidetreeColl, orphanKey)
+		require.NoError(t, err)
+		require.Empty(t, content)
+
+		content, err = dcasClient.Get(common.SidetreeNs, common.SidetreeColl, batchKey)
+		require.NoError(t, err)
+		require.NotEmpty(t, content)
+	})
+
+	t.Run("Start and stop", func(t *testing.T) {
+		s := New(channel1, peer1, Config{Period: 20 * time.Millisecond, GracePeriod: time.Minute}, providers)
+		require.NoError(t, s.Start())
+		time.Sleep(50 * time.Millisecond)
+		s.Stop()
+
+		// Stopping again has no effect
+		s.Stop()
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		s := New(channel1, peer1, Config{}, providers)
+		require.NoError(t, s.Start())
+		s.Stop()
+	})
+
+	t.Run("No grace period", func(t *testing.T) {
+		s := New(channel1, peer1, Config{Period: time.Second}, providers)
+		require.Error(t, s.Start())
+	})
+}
+
+func TestSweeper_UnresolvedAnchor(t *testing.T) {
+	dcasClient := mocks.NewMockDCASClient()
+
+	batchKey, err := dcasClient.Put(common.SidetreeNs, common.SidetreeColl, []byte(`{"operations":[]}`))
+	require.NoError(t, err)
+
+	anchorBytes, err := json.Marshal(&observer.AnchorFile{BatchFileHash: batchKey})
+	require.NoError(t, err)
+
+	anchorKey, err := dcasClient.Put(common.SidetreeNs, common.SidetreeColl, anchorBytes)
+	require.NoError(t, err)
+
+	// The anchor hasn't been replicated to DCAS yet
+	require.NoError(t, dcasClient.Delete(common.SidetreeNs, common.SidetreeColl, anchorKey))
+
+	dcasClient.WithQueryResults(common.SidetreeNs, common.SidetreeColl, allContentQuery, []*queryresult.KV{{Key: batchKey}})
+
+	b := peerextmocks.NewBlockBuilder(channel1, 0)
+	b.Transaction(txID1, pb.TxValidationCode_VALID).
+		ChaincodeAction(common.SidetreeNs).
+		Write(common.AnchorAddrPrefix+anchorKey, []byte(anchorKey))
+
+	bcClient := &mocks.BlockchainClient{}
+	bcClient.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1}, nil)
+	bcClient.GetBlockByNumberReturns(b.Build(), nil)
+
+	s := New(channel1, peer1, Config{Period: time.Second, GracePeriod: 50 * time.Millisecond, Purge: true}, newProviders(bcClient, dcasClient))
+
+	report, err := s.sweep()
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Unresolved)
+	require.Equal(t, 1, report.Pending)
+
+	time.Sleep(100 * time.Millisecond)
+
+	// The batch file appears to be orphaned but it isn't purged since the anchor is unresolved
+	report, err = s.sweep()
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Unresolved)
+	require.Equal(t, []string{batchKey}, report.Orphaned)
+	require.Zero(t, report.Purged)
+
+	content, err := dcasClient.Get(common.SidetreeNs, common.SidetreeColl, batchKey)
+	require.NoError(t, err)
+	require.NotEmpty(t, content)
+
+	// The anchor is replicated
+	_, err = dcasClient.Put(common.SidetreeNs, common.SidetreeColl, anchorBytes)
+	require.NoError(t, err)
+
+	report, err = s.sweep()
+	require.NoError(t, err)
+	require.Zero(t, report.Unresolved)
+	require.Equal(t, 1, report.Referenced)
+	require.Empty(t, report.Orphaned)
+}
+
+func TestSweeper_Resume(t *testing.T) {
+	dcasClient := mocks.NewMockDCASClient()
+
+	batchKey, err := dcasClient.Put(common.SidetreeNs, common.SidetreeColl, []byte(`{"operations":[]}`))
+	require.NoError(t, err)
+
+	anchorBytes, err := json.Marshal(&observer.AnchorFile{BatchFileHash: batchKey})
+	require.NoError(t, err)
+
+	anchorKey, err := dcasClient.Put(common.SidetreeNs, common.SidetreeColl, anchorBytes)
+	require.NoError(t, err)
+
+	dcasClient.WithQueryResults(common.SidetreeNs, common.SidetreeColl, allContentQuery,
+		[]*queryresult.KV{{Key: batchKey}, {Key: anchorKey}},
+	)
+
+	b := peerextmocks.NewBlockBuilder(channel1, 0)
+	b.Transaction(txID1, pb.TxValidationCode_VALID).
+		ChaincodeAction(common.SidetreeNs).
+		Write(common.AnchorAddrPrefix+anchorKey, []byte(anchorKey))
+
+	bcClient := &mocks.BlockchainClient{}
+	bcClient.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1}, nil)
+	bcClient.GetBlockByNumberReturns(b.Build(), nil)
+
+	olClient := mocks.NewMockOffLedgerClient()
+	olProvider := &mocks.OffLedgerClientProvider{}
+	olProvider.ForChannelReturns(olClient, nil)
+
+	providers := newProviders(bcClient, dcasClient)
+	providers.OffLedger = olProvider
+
+	cfg := Config{Period: time.Second, GracePeriod: 50 * time.Millisecond, Purge: true}
+
+	s := New(channel1, peer1, cfg, providers)
+
+	report, err := s.sweep()
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Referenced)
+	require.Equal(t, 1, bcClient.GetBlockByNumberCallCount())
+
+	data, err := olClient.Get(common.DocNs, metaDataColName, metaDataKeyPrefix+peer1)
+	require.NoError(t, err)
+
+	metaData := &MetaData{}
+	require.NoError(t, json.Unmarshal(data, metaData))
+	require.Zero(t, metaData.LastBlockScanned)
+	require.ElementsMatch(t, []string{anchorKey, batchKey}, metaData.Referenced)
+	require.Empty(t, metaData.Unresolved)
+
+	// A new sweeper (e.g. after a restart) resumes after the last block scanned and
+	// still considers the content referenced by the previously scanned blocks
+	s = New(channel1, peer1, cfg, providers)
+
+	time.Sleep(100 * time.Millisecond)
+
+	report, err = s.sweep()
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Referenced)
+	require.Empty(t, report.Orphaned)
+	require.Equal(t, 1, bcClient.GetBlockByNumberCallCount())
+
+	content, err := dcasClient.Get(common.SidetreeNs, common.SidetreeColl, batchKey)
+	require.NoError(t, err)
+	require.NotEmpty(t, content)
+}
+
+func TestSweeper_Error(t *testing.T) {
+	cfg := Config{Period: time.Second, GracePeriod: time.Minute}
+
+	t.Run("Blockchain.ForChannel error", func(t *testing.T) {
+		bcProvider := &mocks.BlockchainClientProvider{}
+		bcProvider.ForChannelReturns(nil, errors.New("injected ForChannel error"))
+
+		s := New(channel1, peer1, cfg, &ClientProviders{Blockchain: bcProvider})
+
+		_, err := s.sweep()
+		require.EqualError(t, err, "injected ForChannel error")
+	})
+
+	t.Run("GetBlockchainInfo error", func(t *testing.T) {
+		bcClient := &mocks.BlockchainClient{}
+		bcClient.GetBlockchainInfoReturns(nil, errors.New("injected GetBlockchainInfo error"))
+
+		s := New(channel1, peer1, cfg, newProviders(bcClient, mocks.NewMockDCASClient()))
+
+		_, err := s.sweep()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "injected GetBlockchainInfo error")
+	})
+
+	t.Run("GetBlockByNumber error", func(t *testing.T) {
+		bcClient := &mocks.BlockchainClient{}
+		bcClient.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1}, nil)
+		bcClient.GetBlockByNumberReturns(nil, errors.New("injected GetBlockByNumber error"))
+
+		s := New(channel1, peer1, cfg, newProviders(bcClient, mocks.NewMockDCASClient()))
+
+		_, err := s.sweep()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "injected GetBlockByNumber error")
+	})
+
+	t.Run("DCAS Get error", func(t *testing.T) {
+		b := peerextmocks.NewBlockBuilder(channel1, 0)
+		b.Transaction(txID1, pb.TxValidationCode_VALID).
+			ChaincodeAction(common.SidetreeNs).
+			Write(common.AnchorAddrPrefix+"anchor1", []byte("anchor1"))
+
+		bcClient := &mocks.BlockchainClient{}
+		bcClient.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1}, nil)
+		bcClient.GetBlockByNumberReturns(b.Build(), nil)
+
+		dcasClient := &stmocks.DCASClient{}
+		dcasClient.GetReturns(nil, errors.New("injected DCAS error"))
+
+		dcasProvider := &stmocks.DCASClientProvider{}
+		dcasProvider.ForChannelReturns(dcasClient, nil)
+
+		bcProvider := &mocks.BlockchainClientProvider{}
+		bcProvider.ForChannelReturns(bcClient, nil)
+
+		s := New(channel1, peer1, cfg, &ClientProviders{Blockchain: bcProvider, DCAS: dcasProvider})
+
+		_, err := s.sweep()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "injected DCAS error")
+	})
+
+	t.Run("Meta-data Get error", func(t *testing.T) {
+		bcClient := &mocks.BlockchainClient{}
+		bcClient.GetBlockchainInfoReturns(&cb.BlockchainInfo{}, nil)
+
+		olProvider := &mocks.OffLedgerClientProvider{}
+		olProvider.ForChannelReturns(mocks.NewMockOffLedgerClient().WithGetError(errors.New("injected Get error")), nil)
+
+		providers := newProviders(bcClient, mocks.NewMockDCASClient())
+		providers.OffLedger = olProvider
+
+		s := New(channel1, peer1, cfg, providers)
+
+		_, err := s.sweep()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "injected Get error")
+		require.Zero(t, bcClient.GetBlockchainInfoCallCount())
+	})
+
+	t.Run("Meta-data Put error", func(t *testing.T) {
+		b := peerextmocks.NewBlockBuilder(channel1, 0)
+		b.Transaction(txID1, pb.TxValidationCode_VALID)
+
+		bcClient := &mocks.BlockchainClient{}
+		bcClient.GetBlockchainInfoReturns(&cb.BlockchainInfo{Height: 1}, nil)
+		bcClient.GetBlockByNumberReturns(b.Build(), nil)
+
+		olProvider := &mocks.OffLedgerClientProvider{}
+		olProvider.ForChannelReturns(mocks.NewMockOffLedgerClient().WithPutError(errors.New("injected Put error")), nil)
+
+		providers := newProviders(bcClient, mocks.NewMockDCASClient())
+		providers.OffLedger = olProvider
+
+		s := New(channel1, peer1, cfg, providers)
+
+		// The error is logged and the progress is persisted on the next sweep
+		_, err := s.sweep()
+		require.NoError(t, err)
+		require.True(t, s.dirty)
+	})
+
+	t.Run("DCAS Query error", func(t *testing.T) {
+		bcClient := &mocks.BlockchainClient{}
+		bcClient.GetBlockchainInfoReturns(&cb.BlockchainInfo{}, nil)
+
+		dcasClient := &stmocks.DCASClient{}
+		dcasClient.QueryReturns(nil, errors.New("injected Query error"))
+
+		dcasProvider := &stmocks.DCASClientProvider{}
+		dcasProvider.ForChannelReturns(dcasClient, nil)
+
+		bcProvider := &mocks.BlockchainClientProvider{}
+		bcProvider.ForChannelReturns(bcClient, nil)
+
+		s := New(channel1, peer1, cfg, &ClientProviders{Blockchain: bcProvider, DCAS: dcasProvider})
+
+		_, err := s.sweep()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "injected Query error")
+	})
+}
+
+func newProviders(bcClient *mocks.BlockchainClient, dcasClient *mocks.MockDCASClient) *ClientProviders {
+	bcProvider := &mocks.BlockchainClientProvider{}
+	bcProvider.ForChannelReturns(bcClient, nil)
+
+	dcasProvider := &stmocks.DCASClientProvider{}
+	dcasProvider.ForChannelReturns(dcasClient, nil)
+
+	olProvider := &mocks.OffLedgerClientProvider{}
+	olProvider.ForChannelReturns(mocks.NewMockOffLedgerClient(), nil)
+
+	return &ClientProviders{
+		OffLedger:  olProvider,
+		Blockchain: bcProvider,
+		DCAS:       dcasProvider,
+	}
+}
@@ -31,20 +31,189 @@ const (
 type Namespace struct {
 	Namespace string
 	BasePath  string
+
+	// Roles contains the roles (sidetree-batch-writer and/or sidetree-resolver) that the peer has for the namespace.
+	// If empty then the roles of the peer for the channel apply. The observer and monitor roles apply to all namespaces
+	// in the channel and are rejected here.
+	Roles []string
+
+	// Authorization holds the authorization rules of the namespace's REST endpoints
+	Authorization NamespaceAuthorization
+}
+
+// NamespaceAuthorization holds the authorization rules of the resolve and update endpoints of a namespace
+type NamespaceAuthorization struct {
+	// Resolve holds the authorization rules of the document resolution endpoint
+	Resolve Authorization
+
+	// Update holds the authorization rules of the document update endpoint
+	Update Authorization
+}
+
+// Authorization holds the rules for authorizing requests to a REST endpoint. A request is authorized if it satisfies
+// any of the configured rules. If no rules are configured then all requests are authorized.
+type Authorization struct {
+	// TokenHashes contains the base64URL-encoded SHA-256 hashes of static bearer tokens. (Hashes are configured
+	// rather than the tokens themselves since the config is visible to all members of the channel.)
+	TokenHashes []string
+
+	// JWT holds the rules for authorizing requests with a JWT bearer token
+	JWT JWTAuthorization
+
+	// ClientCertSubjects contains rules for the subject of the (verified) client certificate of a mutual TLS
+	// request, for example "CN=admin,O=org1.example.com"
+	ClientCertSubjects []string
+}
+
+// IsEmpty returns true if no authorization rules are configured
+func (a Authorization) IsEmpty() bool {
+	return len(a.TokenHashes) == 0 && len(a.JWT.PublicKeys) == 0 && len(a.ClientCertSubjects) == 0
+}
+
+// JWTAuthorization holds the rules for authorizing requests with a JWT bearer token
+type JWTAuthorization struct {
+	// Issuer is the expected issuer ("iss") of the token. If empty then the issuer isn't checked.
+	Issuer string
+
+	// Audience is the audience that must be contained in the token ("aud"). If empty then the audience isn't checked.
+	Audience string
+
+	// PublicKeys contains the PEM-encoded public keys (or certificates) that are trusted to sign tokens.
+	// JWT authorization is disabled if empty.
+	PublicKeys []string
 }
 
 // Monitor holds Sidetree monitor config
 type Monitor struct {
 	Period time.Duration
+
+	// DeadLetterRetryPeriod is the interval at which anchors that the monitor was unable to process are retried.
+	// If set to 0 then dead-lettered anchors are only retried when they are re-driven manually.
+	DeadLetterRetryPeriod time.Duration
+
+	// Parallelism is the maximum number of blocks that the monitor processes concurrently. If set to 0 or 1
+	// then blocks are processed one at a time.
+	Parallelism uint
+
+	// MaxBlockAttempts is the number of times that a block is attempted (with exponential backoff) before the
+	// monitor gives up on it until the next period. Defaults to 5.
+	MaxBlockAttempts int
+
+	// RetryInitialBackoff is the backoff after the first failed attempt at a block. Defaults to 1s.
+	RetryInitialBackoff time.Duration
+
+	// RetryMaxBackoff is the maximum backoff between attempts at a block. Defaults to 30s.
+	RetryMaxBackoff time.Duration
+
+	// CircuitBreakerThreshold is the number of consecutive failures after which the monitor stops
+	// processing blocks for the duration of the cool-down period. Defaults to 10.
+	CircuitBreakerThreshold int
+
+	// CircuitBreakerCooldown is the time after which the monitor attempts to process blocks
+	// again once the circuit breaker has opened. Defaults to 1m.
+	CircuitBreakerCooldown time.Duration
+
+	// VerifyIntegrity indicates that the monitor verifies the content of operations that already exist in the
+	// document store against the anchored batches and repairs any mismatches. (Use the monitor's reset or rescan
+	// operation in order to verify blocks that were already processed.)
+	VerifyIntegrity bool
+
+	// AdminEnabled indicates that the REST endpoints for resetting the monitor's last block processed and
+	// for rescanning a range of blocks are exposed, as well as the endpoints for retrieving the integrity report
+	// and for listing and re-driving dead-lettered anchors (under /monitor/<channel ID>). AdminAuthorization must contain at least one rule if enabled.
+	AdminEnabled bool
+
+	// AdminAuthorization holds the authorization rules of the monitor admin REST endpoints
+	AdminAuthorization Authorization
+}
+
+// DCASSweeper holds the config for the sweeper that finds orphaned content in the Sidetree DCAS collection
+type DCASSweeper struct {
+	// Period is the interval at which the sweeper runs. The sweeper is disabled if set to 0.
+	Period time.Duration
+
+	// GracePeriod is the amount of time that content must remain unreferenced by any anchor
+	// before it is considered to be orphaned.
+	GracePeriod time.Duration
+
+	// Purge indicates that orphaned content should be deleted from the DCAS collection. If false then
+	// the sweeper runs in dry-run mode, i.e. orphaned content is only reported.
+	Purge bool
+}
+
+// ConsistencyChecker holds the config for the checker that compares the operation sets of documents in the local
+// document store with those of other peers
+type ConsistencyChecker struct {
+	// Period is the interval at which the checker runs. The checker is disabled if set to 0.
+	Period time.Duration
+
+	// Peers contains the IDs of the peers (possibly in other orgs) with which the local operation sets are compared
+	Peers []string
+
+	// SampleSize is the number of documents that are sampled for each period. All peers sample the same
+	// documents for a period, and each run checks the samples of the current and the previous period.
+	// If 0 then all documents are checked.
+	SampleSize int
+
+	// MaxDigestAge is the maximum age of a digest published by another peer. Older digests are ignored.
+	// If set, it must not be less than the period. Defaults to 3 times the period.
+	MaxDigestAge time.Duration
+
+	// Repair indicates that operations that are missing from the local store are retrieved from the other
+	// peers. If false then divergences are only reported.
+	Repair bool
 }
 
 // SidetreePeer holds peer-specific Sidetree config
 type SidetreePeer struct {
-	Monitor    Monitor
-	Namespaces []Namespace
+	// Roles contains the Sidetree roles that the peer has for the channel. The batch-writer and resolver roles
+	// apply to all namespaces that don't specify their own roles. If empty then the roles from the peer's
+	// static config apply.
+	Roles []string
+
+	Monitor            Monitor
+	DCASSweeper        DCASSweeper
+	ConsistencyChecker ConsistencyChecker
+	Namespaces         []Namespace
+}
+
+// OperationQueue holds the capacity limits of the operation queue. A value of 0 means that there is no limit.
+type OperationQueue struct {
+	// MaxLength is the maximum number of operations in the queue
+	MaxLength uint
+
+	// MaxSize is the maximum total size (in bytes) of the operations in the queue
+	MaxSize uint64
+
+	// MaxAge is the maximum amount of time that an operation may remain in the queue before it expires
+	MaxAge time.Duration
+
+	// DeadLetterExpired indicates that expired operations should be retained (in a dead-letter area of the
+	// queue) rather than being discarded
+	DeadLetterExpired bool
+
+	// HighPriorityWeight is the maximum number of high-priority operations (recover and delete) that are added to
+	// a batch before a normal-priority operation (create and update) is added. If 0 then a default value is used.
+	HighPriorityWeight uint
+}
+
+// LeaderElection holds the config for electing a single batch writer (per org) for a Sidetree namespace
+type LeaderElection struct {
+	// Enabled indicates that only the elected leader among the batch writers of an org cuts batches. The other
+	// batch writers add the operations to the operation queue so that the leader may process them. Leader election
+	// requires the shared offledger operation queue backend (and the offledger backend requires leader election).
+	Enabled bool
+
+	// Collection is the off-ledger collection (in the document_cc namespace) that holds the leader lease
+	Collection string
+
+	// LeaseTimeout is the amount of time after which the lease expires if it isn't renewed by the leader
+	LeaseTimeout time.Duration
 }
 
 // Sidetree holds general Sidetree configuration
 type Sidetree struct {
 	BatchWriterTimeout time.Duration
+	OperationQueue     OperationQueue
+	LeaderElection     LeaderElection
 }
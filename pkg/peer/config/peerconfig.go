@@ -10,7 +10,9 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"time"
 
+	fabricconfig "github.com/hyperledger/fabric/core/config"
 	viper "github.com/spf13/viper2015"
 )
 
@@ -18,22 +20,72 @@ const (
 	sidetreeHostKey = "sidetree.host"
 	sidetreePortKey = "sidetree.port"
 
+	sidetreeOperationQueueBackendKey    = "sidetree.operationQueue.backend"
+	sidetreeOperationQueueCollectionKey = "sidetree.operationQueue.collection"
+	defaultOperationQueueBackend        = "leveldb"
+	offLedgerOperationQueueBackend      = "offledger"
+	defaultOperationQueueCollection     = "opqueue"
+
+	sidetreeTLSEnabledKey            = "sidetree.tls.enabled"
+	sidetreeTLSCertFileKey           = "sidetree.tls.cert.file"
+	sidetreeTLSKeyFileKey            = "sidetree.tls.key.file"
+	sidetreeTLSClientAuthRequiredKey = "sidetree.tls.clientAuthRequired"
+	sidetreeTLSClientRootCAsKey      = "sidetree.tls.clientRootCAs.files"
+	sidetreeTLSReloadIntervalKey     = "sidetree.tls.reloadInterval"
+
+	// The peer's own TLS material is used if the Sidetree TLS material isn't specified
+	confPeerTLSCertFile      = "peer.tls.cert.file"
+	confPeerTLSKeyFile       = "peer.tls.key.file"
+	confPeerTLSClientRootCAs = "peer.tls.clientRootCAs.files"
+
+	confPeerID = "peer.id"
+
 	confPeerFileSystemPath = "peer.fileSystemPath"
 	sidetreeOperationsDir  = "sidetree_ops"
 )
 
+// TLS holds the TLS config of the Sidetree REST service
+type TLS struct {
+	// Enabled indicates that the REST service is served over HTTPS
+	Enabled bool
+
+	// CertFile is the path of the server certificate. Defaults to the peer's TLS certificate.
+	CertFile string
+
+	// KeyFile is the path of the server's private key. Defaults to the peer's TLS key.
+	KeyFile string
+
+	// ClientAuthRequired indicates that clients must present a certificate that is signed by one of the client root CAs
+	ClientAuthRequired bool
+
+	// ClientRootCAFiles contains the paths of the CA certificates used to verify client certificates.
+	// Defaults to the peer's TLS client root CAs.
+	ClientRootCAFiles []string
+
+	// ReloadInterval is the interval at which the files are checked for changes (and reloaded)
+	ReloadInterval time.Duration
+}
+
 // Peer holds the Sidetree peer config
 type Peer struct {
+	peerID                 string
 	sidetreeHost           string
 	sidetreePort           int
+	sidetreeTLS            TLS
+	opQueueBackend         string
+	opQueueCollection      string
 	levelDBOpQueueBasePath string
 }
 
 // NewPeer returns a new peer config
 func NewPeer() *Peer {
 	return &Peer{
+		peerID:                 viper.GetString(confPeerID),
 		sidetreeHost:           viper.GetString(sidetreeHostKey),
 		sidetreePort:           viper.GetInt(sidetreePortKey),
+		sidetreeTLS:            getTLS(),
+		opQueueBackend:         getOperationQueueBackend(),
+		opQueueCollection:      getOperationQueueCollection(),
 		levelDBOpQueueBasePath: filepath.Join(filepath.Clean(viper.GetString(confPeerFileSystemPath)), sidetreeOperationsDir),
 	}
 }
@@ -52,7 +104,86 @@ func (c *Peer) SidetreeListenURL() (string, error) {
 	return fmt.Sprintf("%s:%d", host, c.sidetreePort), nil
 }
 
+// SidetreeTLS returns the TLS config of the Sidetree REST service
+func (c *Peer) SidetreeTLS() TLS {
+	return c.sidetreeTLS
+}
+
+// PeerID returns the ID of the peer
+func (c *Peer) PeerID() string {
+	return c.peerID
+}
+
+// OperationQueueBackend returns the type of backend for operation queues (leveldb, memory or offledger)
+func (c *Peer) OperationQueueBackend() string {
+	return c.opQueueBackend
+}
+
+// OperationQueueCollection returns the name of the off-ledger collection that holds the shared operation pool
+// (only applicable to the offledger operation queue backend)
+func (c *Peer) OperationQueueCollection() string {
+	return c.opQueueCollection
+}
+
 // LevelDBOpQueueBasePath returns the base path of the directory to store LevelDB operation queues
 func (c *Peer) LevelDBOpQueueBasePath() string {
 	return c.levelDBOpQueueBasePath
 }
+
+func getOperationQueueBackend() string {
+	backend := viper.GetString(sidetreeOperationQueueBackendKey)
+	if backend == "" {
+		return defaultOperationQueueBackend
+	}
+
+	return backend
+}
+
+func getOperationQueueCollection() string {
+	coll := viper.GetString(sidetreeOperationQueueCollectionKey)
+	if coll == "" {
+		return defaultOperationQueueCollection
+	}
+
+	return coll
+}
+
+func getTLS() TLS {
+	if !viper.GetBool(sidetreeTLSEnabledKey) {
+		return TLS{}
+	}
+
+	tls := TLS{
+		Enabled:            true,
+		CertFile:           getPath(sidetreeTLSCertFileKey, confPeerTLSCertFile),
+		KeyFile:            getPath(sidetreeTLSKeyFileKey, confPeerTLSKeyFile),
+		ClientAuthRequired: viper.GetBool(sidetreeTLSClientAuthRequiredKey),
+		ClientRootCAFiles:  getPaths(sidetreeTLSClientRootCAsKey),
+		ReloadInterval:     viper.GetDuration(sidetreeTLSReloadIntervalKey),
+	}
+
+	if len(tls.ClientRootCAFiles) == 0 {
+		tls.ClientRootCAFiles = getPaths(confPeerTLSClientRootCAs)
+	}
+
+	return tls
+}
+
+// getPath returns the (config-file relative) path for the given key or, if not set, for the default key
+func getPath(key, defaultKey string) string {
+	if p := fabricconfig.GetPath(key); p != "" {
+		return p
+	}
+
+	return fabricconfig.GetPath(defaultKey)
+}
+
+// getPaths returns the (config-file relative) paths for the given key
+func getPaths(key string) []string {
+	var paths []string
+	for _, p := range viper.GetStringSlice(key) {
+		paths = append(paths, fabricconfig.TranslatePath(filepath.Dir(viper.ConfigFileUsed()), p))
+	}
+
+	return paths
+}
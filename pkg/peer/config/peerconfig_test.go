@@ -9,6 +9,7 @@ package config
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	viper "github.com/spf13/viper2015"
 	"github.com/stretchr/testify/require"
@@ -54,4 +55,71 @@ func TestPeerConfig(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, fmt.Sprintf("%s:%d", host, port), url)
 	})
+
+	t.Run("Operation queue backend", func(t *testing.T) {
+		viper.Reset()
+
+		cfg := NewPeer()
+		require.NotNil(t, cfg)
+		require.Equal(t, "leveldb", cfg.OperationQueueBackend())
+
+		require.Equal(t, "opqueue", cfg.OperationQueueCollection())
+
+		viper.Set("sidetree.operationQueue.backend", "offledger")
+		viper.Set("sidetree.operationQueue.collection", "opcoll")
+		viper.Set("peer.id", "peer1")
+
+		cfg = NewPeer()
+		require.NotNil(t, cfg)
+		require.Equal(t, "offledger", cfg.OperationQueueBackend())
+		require.Equal(t, "opcoll", cfg.OperationQueueCollection())
+		require.Equal(t, "peer1", cfg.PeerID())
+	})
+
+	t.Run("TLS disabled", func(t *testing.T) {
+		viper.Reset()
+		viper.Set("sidetree.tls.cert.file", "/etc/sidetree/tls/server.crt")
+
+		cfg := NewPeer()
+		require.NotNil(t, cfg)
+		require.False(t, cfg.SidetreeTLS().Enabled)
+		require.Empty(t, cfg.SidetreeTLS().CertFile)
+	})
+
+	t.Run("TLS with Sidetree certificates", func(t *testing.T) {
+		viper.Reset()
+		viper.Set("sidetree.tls.enabled", true)
+		viper.Set("sidetree.tls.cert.file", "/etc/sidetree/tls/server.crt")
+		viper.Set("sidetree.tls.key.file", "/etc/sidetree/tls/server.key")
+		viper.Set("sidetree.tls.clientAuthRequired", true)
+		viper.Set("sidetree.tls.clientRootCAs.files", []string{"/etc/sidetree/tls/ca1.crt", "/etc/sidetree/tls/ca2.crt"})
+		viper.Set("sidetree.tls.reloadInterval", "10s")
+		viper.Set("peer.tls.cert.file", "/etc/peer/tls/server.crt")
+		viper.Set("peer.tls.key.file", "/etc/peer/tls/server.key")
+		viper.Set("peer.tls.clientRootCAs.files", []string{"/etc/peer/tls/ca.crt"})
+
+		tls := NewPeer().SidetreeTLS()
+		require.True(t, tls.Enabled)
+		require.Equal(t, "/etc/sidetree/tls/server.crt", tls.CertFile)
+		require.Equal(t, "/etc/sidetree/tls/server.key", tls.KeyFile)
+		require.True(t, tls.ClientAuthRequired)
+		require.Equal(t, []string{"/etc/sidetree/tls/ca1.crt", "/etc/sidetree/tls/ca2.crt"}, tls.ClientRootCAFiles)
+		require.Equal(t, 10*time.Second, tls.ReloadInterval)
+	})
+
+	t.Run("TLS with peer certificates", func(t *testing.T) {
+		viper.Reset()
+		viper.Set("sidetree.tls.enabled", true)
+		viper.Set("peer.tls.cert.file", "/etc/peer/tls/server.crt")
+		viper.Set("peer.tls.key.file", "/etc/peer/tls/server.key")
+		viper.Set("peer.tls.clientRootCAs.files", []string{"/etc/peer/tls/ca.crt"})
+
+		tls := NewPeer().SidetreeTLS()
+		require.True(t, tls.Enabled)
+		require.Equal(t, "/etc/peer/tls/server.crt", tls.CertFile)
+		require.Equal(t, "/etc/peer/tls/server.key", tls.KeyFile)
+		require.False(t, tls.ClientAuthRequired)
+		require.Equal(t, []string{"/etc/peer/tls/ca.crt"}, tls.ClientRootCAFiles)
+		require.Zero(t, tls.ReloadInterval)
+	})
 }
@@ -42,7 +42,7 @@ type SidetreeService interface {
 func NewSidetreeProvider(configProvider configServiceProvider, registry validatorRegistry) *SidetreeProvider {
 	logger.Info("Creating Sidetree config provider")
 
-	registry.Register(&sidetreeValidator{})
+	registry.Register(&sidetreeValidator{opQueueBackend: getOperationQueueBackend()})
 	registry.Register(&sidetreePeerValidator{})
 
 	return &SidetreeProvider{
@@ -32,7 +32,7 @@ const (
 	didSidetreeCfgJSON               = `{"batchWriterTimeout":"5s"}`
 	didSidetreeProtocol_V0_4_CfgJSON = `{"startingBlockchainTime":200000,"hashAlgorithmInMultihashCode":18,"maxOperationByteSize":2000,"maxOperationsPerBatch":10}`
 	didSidetreeProtocol_V0_5_CfgJSON = `{"startingBlockchainTime":500000,"hashAlgorithmInMultihashCode":18,"maxOperationByteSize":10000,"maxOperationsPerBatch":100}`
-	peerCfgJson                      = `{"Monitor":{"Period":"5s"},"Rest":{"Host":"0.0.0.0","Port":"48326"},"Namespaces":[{"Namespace":"did:sidetree","BasePath":"/document"},{"Namespace":"did:bloc:trustbloc.dev","BasePath":"/trustbloc.dev/document"}]}`
+	peerCfgJson                      = `{"Monitor":{"Period":"5s","DeadLetterRetryPeriod":"1m","Parallelism":4},"Rest":{"Host":"0.0.0.0","Port":"48326"},"Namespaces":[{"Namespace":"did:sidetree","BasePath":"/document"},{"Namespace":"did:bloc:trustbloc.dev","BasePath":"/trustbloc.dev/document"}]}`
 )
 
 func TestNewSidetreeProvider(t *testing.T) {
@@ -124,6 +124,8 @@ func TestNewSidetreeProvider(t *testing.T) {
 		require.NoError(t, err)
 		require.Len(t, cfg.Namespaces, 2)
 		require.Equal(t, 5*time.Second, cfg.Monitor.Period)
+		require.Equal(t, time.Minute, cfg.Monitor.DeadLetterRetryPeriod)
+		require.Equal(t, uint(4), cfg.Monitor.Parallelism)
 	})
 
 	t.Run("LoadProtocols service error", func(t *testing.T) {
@@ -7,8 +7,22 @@ SPDX-License-Identifier: Apache-2.0
 package config
 
 import (
+	"strings"
+
 	"github.com/pkg/errors"
 	"github.com/trustbloc/fabric-peer-ext/pkg/config/ledgerconfig/config"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/httpserver"
+	"github.com/trustbloc/sidetree-fabric/pkg/role"
+)
+
+var (
+	// channelRoles are the roles that may be assigned to a peer for a channel
+	channelRoles = []string{role.BatchWriter, role.Resolver, role.Observer, role.Monitor}
+
+	// namespaceRoles are the roles that may be assigned to a peer for a namespace. (The observer and monitor
+	// process the anchors of all namespaces in the channel and so they may only be assigned for the channel.)
+	namespaceRoles = []string{role.BatchWriter, role.Resolver}
 )
 
 // sidetreePeerValidator validates the SidetreePeer configuration
@@ -39,8 +53,20 @@ func (v *sidetreePeerValidator) Validate(kv *config.KeyValue) error {
 		return errors.WithMessagef(err, "invalid config %s", kv.Key)
 	}
 
-	if sidetreeCfg.Monitor.Period == 0 {
-		logger.Infof("The Sidetree monitor period is set to 0 and therefore will be disabled for peer [%s].", kv.PeerID)
+	if err := validateRoles(kv, "Roles", sidetreeCfg.Roles, channelRoles); err != nil {
+		return err
+	}
+
+	if err := v.validateMonitor(kv, sidetreeCfg.Monitor); err != nil {
+		return err
+	}
+
+	if err := v.validateDCASSweeper(kv, sidetreeCfg.DCASSweeper); err != nil {
+		return err
+	}
+
+	if err := v.validateConsistencyChecker(kv, sidetreeCfg.ConsistencyChecker); err != nil {
+		return err
 	}
 
 	for _, ns := range sidetreeCfg.Namespaces {
@@ -65,5 +91,121 @@ func (v *sidetreePeerValidator) validateNamespace(kv *config.KeyValue, ns Namesp
 		return errors.Errorf("field 'BasePath' must begin with '/' for %s", kv.Key)
 	}
 
+	for _, r := range ns.Roles {
+		if containsRole(channelRoles, r) && !containsRole(namespaceRoles, r) {
+			return errors.Errorf("invalid role [%s] in field 'Namespaces.Roles' for %s - the role applies to all namespaces in the channel and may only be assigned in field 'Roles'", r, kv.Key)
+		}
+	}
+
+	if err := validateRoles(kv, "Namespaces.Roles", ns.Roles, namespaceRoles); err != nil {
+		return err
+	}
+
+	if err := validateAuthorization(kv, "Namespaces.Authorization.Resolve", ns.Authorization.Resolve); err != nil {
+		return err
+	}
+
+	return validateAuthorization(kv, "Namespaces.Authorization.Update", ns.Authorization.Update)
+}
+
+func (v *sidetreePeerValidator) validateMonitor(kv *config.KeyValue, cfg Monitor) error {
+	if cfg.Period == 0 {
+		logger.Infof("The Sidetree monitor period is set to 0 and therefore will be disabled for peer [%s].", kv.PeerID)
+	}
+
+	if err := validateAuthorization(kv, "Monitor.AdminAuthorization", cfg.AdminAuthorization); err != nil {
+		return err
+	}
+
+	if cfg.AdminEnabled && cfg.AdminAuthorization.IsEmpty() {
+		return errors.Errorf("field 'Monitor.AdminAuthorization' must contain at least one rule when the monitor admin endpoints are enabled for %s", kv.Key)
+	}
+
+	return nil
+}
+
+func (v *sidetreePeerValidator) validateDCASSweeper(kv *config.KeyValue, cfg DCASSweeper) error {
+	if cfg.Period == 0 {
+		logger.Debugf("The DCAS sweeper period is set to 0 and therefore will be disabled for peer [%s].", kv.PeerID)
+		return nil
+	}
+
+	if cfg.GracePeriod == 0 {
+		return errors.Errorf("field 'DCASSweeper.GracePeriod' must contain a value greater than 0 for %s", kv.Key)
+	}
+
+	if !cfg.Purge {
+		logger.Infof("The DCAS sweeper is running in dry-run mode for peer [%s]. Orphaned content will be reported but not purged.", kv.PeerID)
+	}
+
 	return nil
 }
+
+func (v *sidetreePeerValidator) validateConsistencyChecker(kv *config.KeyValue, cfg ConsistencyChecker) error {
+	if cfg.Period == 0 {
+		logger.Debugf("The consistency checker period is set to 0 and therefore will be disabled for peer [%s].", kv.PeerID)
+		return nil
+	}
+
+	if len(cfg.Peers) == 0 {
+		return errors.Errorf("field 'ConsistencyChecker.Peers' must contain at least one peer for %s", kv.Key)
+	}
+
+	if cfg.SampleSize < 0 {
+		return errors.Errorf("field 'ConsistencyChecker.SampleSize' must not be negative for %s", kv.Key)
+	}
+
+	if cfg.MaxDigestAge != 0 && cfg.MaxDigestAge < cfg.Period {
+		return errors.Errorf("field 'ConsistencyChecker.MaxDigestAge' must not be less than the period for %s", kv.Key)
+	}
+
+	if !cfg.Repair {
+		logger.Infof("The consistency checker is running in report-only mode for peer [%s]. Divergences will be reported but not repaired.", kv.PeerID)
+	}
+
+	return nil
+}
+
+func validateAuthorization(kv *config.KeyValue, field string, cfg Authorization) error {
+	if len(cfg.TokenHashes) > 0 {
+		if _, err := httpserver.NewTokenAuthorizer(cfg.TokenHashes...); err != nil {
+			return errors.WithMessagef(err, "invalid field '%s.TokenHashes' for %s", field, kv.Key)
+		}
+	}
+
+	if len(cfg.JWT.PublicKeys) > 0 {
+		if _, err := httpserver.NewJWTAuthorizer(cfg.JWT.Issuer, cfg.JWT.Audience, cfg.JWT.PublicKeys...); err != nil {
+			return errors.WithMessagef(err, "invalid field '%s.JWT' for %s", field, kv.Key)
+		}
+	} else if cfg.JWT.Issuer != "" || cfg.JWT.Audience != "" {
+		return errors.Errorf("field '%s.JWT.PublicKeys' is required for %s", field, kv.Key)
+	}
+
+	if len(cfg.ClientCertSubjects) > 0 {
+		if _, err := httpserver.NewClientCertAuthorizer(cfg.ClientCertSubjects...); err != nil {
+			return errors.WithMessagef(err, "invalid field '%s.ClientCertSubjects' for %s", field, kv.Key)
+		}
+	}
+
+	return nil
+}
+
+func validateRoles(kv *config.KeyValue, field string, roles, validRoles []string) error {
+	for _, r := range roles {
+		if !containsRole(validRoles, r) {
+			return errors.Errorf("invalid role [%s] in field '%s' for %s - valid roles are %s", r, field, kv.Key, validRoles)
+		}
+	}
+
+	return nil
+}
+
+func containsRole(roles []string, r string) bool {
+	for _, role := range roles {
+		if strings.EqualFold(role, r) {
+			return true
+		}
+	}
+
+	return false
+}
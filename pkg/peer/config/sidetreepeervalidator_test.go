@@ -22,6 +22,25 @@ const (
 	org1Peer1NoNamespaceCfg     = `{"Namespaces":[{"BasePath":"/document"}]}`
 	org1Peer1NoBasePathCfg      = `{"Namespaces":[{"Namespace":"did:sidetree"}]}`
 	org1Peer1InvalidBasePathCfg = `{"Namespaces":[{"Namespace":"did:sidetree","BasePath":"document"}]}`
+	org1Peer1SweeperCfg         = `{"DCASSweeper":{"Period":"1m","GracePeriod":"10m"}}`
+	org1Peer1NoGracePeriodCfg   = `{"DCASSweeper":{"Period":"1m"}}`
+	org1Peer1CheckerCfg         = `{"ConsistencyChecker":{"Period":"1m","Peers":["peer2"],"SampleSize":10}}`
+	org1Peer1CheckerNoPeersCfg  = `{"ConsistencyChecker":{"Period":"1m"}}`
+	org1Peer1RolesCfg           = `{"Roles":["sidetree-observer","sidetree-monitor"],"Namespaces":[{"Namespace":"did:sidetree","BasePath":"/document","Roles":["sidetree-batch-writer"]}]}`
+	org1Peer1InvalidRoleCfg     = `{"Roles":["sidetree-writer"]}`
+	org1Peer1InvalidNsRoleCfg   = `{"Namespaces":[{"Namespace":"did:sidetree","BasePath":"/document","Roles":["sidetree-observer"]}]}`
+	org1Peer1MonitorNsRoleCfg   = `{"Namespaces":[{"Namespace":"did:sidetree","BasePath":"/document","Roles":["sidetree-resolver","sidetree-monitor"]}]}`
+	org1Peer1UnknownNsRoleCfg   = `{"Namespaces":[{"Namespace":"did:sidetree","BasePath":"/document","Roles":["sidetree-writer"]}]}`
+	org1Peer1CheckerSampleCfg   = `{"ConsistencyChecker":{"Period":"1m","Peers":["peer2"],"SampleSize":-1}}`
+	org1Peer1CheckerMaxAgeCfg   = `{"ConsistencyChecker":{"Period":"1m","Peers":["peer2"],"MaxDigestAge":"30s"}}`
+	org1Peer1AuthCfg            = `{"Namespaces":[{"Namespace":"did:sidetree","BasePath":"/document","Authorization":{"Resolve":{"ClientCertSubjects":["O=org1.example.com"]},"Update":{"TokenHashes":["G_3WV7NvZzqZNZ5v_WvrJoIIxBV3pGz6NGjDkMCRcLM"],"ClientCertSubjects":["CN=admin,O=org1.example.com"]}}}]}`
+	org1Peer1InvalidTokenCfg    = `{"Namespaces":[{"Namespace":"did:sidetree","BasePath":"/document","Authorization":{"Update":{"TokenHashes":["token1"]}}}]}`
+	org1Peer1InvalidJWTCfg      = `{"Namespaces":[{"Namespace":"did:sidetree","BasePath":"/document","Authorization":{"Update":{"JWT":{"Issuer":"issuer1","PublicKeys":["invalid"]}}}}]}`
+	org1Peer1NoJWTKeysCfg       = `{"Namespaces":[{"Namespace":"did:sidetree","BasePath":"/document","Authorization":{"Update":{"JWT":{"Issuer":"issuer1"}}}}]}`
+	org1Peer1InvalidSubjectCfg  = `{"Namespaces":[{"Namespace":"did:sidetree","BasePath":"/document","Authorization":{"Resolve":{"ClientCertSubjects":["admin"]}}}]}`
+	org1Peer1MonitorAdminCfg    = `{"Monitor":{"Period":"3s","AdminEnabled":true,"AdminAuthorization":{"ClientCertSubjects":["CN=admin,O=org1.example.com"]}}}`
+	org1Peer1MonitorNoAuthzCfg  = `{"Monitor":{"Period":"3s","AdminEnabled":true}}`
+	org1Peer1MonitorBadAuthzCfg = `{"Monitor":{"Period":"3s","AdminEnabled":true,"AdminAuthorization":{"TokenHashes":["token1"]}}}`
 )
 
 func TestSidetreePeerValidator_Validate(t *testing.T) {
@@ -42,6 +61,75 @@ func TestSidetreePeerValidator_Validate(t *testing.T) {
 		require.NoError(t, v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1Cfg, config.FormatJSON))))
 	})
 
+	t.Run("Config with DCAS sweeper -> success", func(t *testing.T) {
+		require.NoError(t, v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1SweeperCfg, config.FormatJSON))))
+	})
+
+	t.Run("Config with consistency checker -> success", func(t *testing.T) {
+		require.NoError(t, v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1CheckerCfg, config.FormatJSON))))
+	})
+
+	t.Run("Config with roles -> success", func(t *testing.T) {
+		require.NoError(t, v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1RolesCfg, config.FormatJSON))))
+	})
+
+	t.Run("Invalid role -> error", func(t *testing.T) {
+		err := v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1InvalidRoleCfg, config.FormatJSON)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid role [sidetree-writer] in field 'Roles'")
+	})
+
+	t.Run("Invalid namespace role -> error", func(t *testing.T) {
+		err := v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1InvalidNsRoleCfg, config.FormatJSON)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid role [sidetree-observer] in field 'Namespaces.Roles'")
+		require.Contains(t, err.Error(), "may only be assigned in field 'Roles'")
+
+		err = v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1MonitorNsRoleCfg, config.FormatJSON)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid role [sidetree-monitor] in field 'Namespaces.Roles'")
+		require.Contains(t, err.Error(), "may only be assigned in field 'Roles'")
+
+		err = v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1UnknownNsRoleCfg, config.FormatJSON)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid role [sidetree-writer] in field 'Namespaces.Roles'")
+		require.Contains(t, err.Error(), "valid roles are")
+	})
+
+	t.Run("Config with authorization -> success", func(t *testing.T) {
+		require.NoError(t, v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1AuthCfg, config.FormatJSON))))
+	})
+
+	t.Run("Invalid authorization -> error", func(t *testing.T) {
+		err := v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1InvalidTokenCfg, config.FormatJSON)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid field 'Namespaces.Authorization.Update.TokenHashes'")
+
+		err = v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1InvalidJWTCfg, config.FormatJSON)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid field 'Namespaces.Authorization.Update.JWT'")
+
+		err = v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1NoJWTKeysCfg, config.FormatJSON)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "field 'Namespaces.Authorization.Update.JWT.PublicKeys' is required")
+
+		err = v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1InvalidSubjectCfg, config.FormatJSON)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid field 'Namespaces.Authorization.Resolve.ClientCertSubjects'")
+	})
+
+	t.Run("Monitor admin endpoints", func(t *testing.T) {
+		require.NoError(t, v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1MonitorAdminCfg, config.FormatJSON))))
+
+		err := v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1MonitorNoAuthzCfg, config.FormatJSON)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "field 'Monitor.AdminAuthorization' must contain at least one rule")
+
+		err = v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1MonitorBadAuthzCfg, config.FormatJSON)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid field 'Monitor.AdminAuthorization.TokenHashes'")
+	})
+
 	t.Run("No peer ID -> error", func(t *testing.T) {
 		k1 := config.NewPeerKey(mspID, "", SidetreePeerAppName, SidetreePeerAppVersion)
 		err := v.Validate(config.NewKeyValue(k1, config.NewValue(txID, `{}`, config.FormatJSON)))
@@ -86,4 +174,28 @@ func TestSidetreePeerValidator_Validate(t *testing.T) {
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "field 'BasePath' must begin with '/'")
 	})
+
+	t.Run("DCAS sweeper with no grace period -> error", func(t *testing.T) {
+		err := v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1NoGracePeriodCfg, config.FormatJSON)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "field 'DCASSweeper.GracePeriod' must contain a value greater than 0")
+	})
+
+	t.Run("Consistency checker with no peers -> error", func(t *testing.T) {
+		err := v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1CheckerNoPeersCfg, config.FormatJSON)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "field 'ConsistencyChecker.Peers' must contain at least one peer")
+	})
+
+	t.Run("Consistency checker with negative sample size -> error", func(t *testing.T) {
+		err := v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1CheckerSampleCfg, config.FormatJSON)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "field 'ConsistencyChecker.SampleSize' must not be negative")
+	})
+
+	t.Run("Consistency checker with max digest age less than period -> error", func(t *testing.T) {
+		err := v.Validate(config.NewKeyValue(key, config.NewValue(txID, org1Peer1CheckerMaxAgeCfg, config.FormatJSON)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "field 'ConsistencyChecker.MaxDigestAge' must not be less than the period")
+	})
 }
@@ -18,6 +18,9 @@ const (
 
 // sidetreeValidator validates the Sidetree configuration including Protocols
 type sidetreeValidator struct {
+	// opQueueBackend is the operation queue backend of this peer. Leader election is only
+	// valid with the shared (offledger) backend.
+	opQueueBackend string
 }
 
 func (v *sidetreeValidator) Validate(kv *config.KeyValue) error {
@@ -57,6 +60,22 @@ func (v *sidetreeValidator) validateConfig(kv *config.KeyValue) error {
 		return errors.Errorf("field 'BatchWriterTimeout' must contain a value greater than 0 for %s", kv.Key)
 	}
 
+	if sidetreeCfg.LeaderElection.Enabled {
+		if sidetreeCfg.LeaderElection.Collection == "" {
+			return errors.Errorf("field 'LeaderElection.Collection' is required for %s", kv.Key)
+		}
+
+		if sidetreeCfg.LeaderElection.LeaseTimeout == 0 {
+			return errors.Errorf("field 'LeaderElection.LeaseTimeout' must contain a value greater than 0 for %s", kv.Key)
+		}
+
+		// The operations accepted by the batch writers that aren't the leader are only processed by
+		// the leader if the operation queue is shared
+		if v.opQueueBackend != offLedgerOperationQueueBackend {
+			return errors.Errorf("leader election requires the [%s] operation queue backend but the backend is [%s] for %s", offLedgerOperationQueueBackend, v.opQueueBackend, kv.Key)
+		}
+	}
+
 	return nil
 }
 
@@ -22,7 +22,7 @@ const (
 )
 
 func TestSidetreeValidator_Validate(t *testing.T) {
-	v := &sidetreeValidator{}
+	v := &sidetreeValidator{opQueueBackend: offLedgerOperationQueueBackend}
 
 	appKey := config.NewAppKey(GlobalMSPID, "did:sidetree", SidetreeAppVersion)
 
@@ -69,6 +69,34 @@ func TestSidetreeValidator_Validate(t *testing.T) {
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "field 'BatchWriterTimeout' must contain a value greater than 0")
 	})
+
+	t.Run("Leader election -> success", func(t *testing.T) {
+		cfg := `{"batchWriterTimeout":"1s","leaderElection":{"enabled":true,"collection":"leases","leaseTimeout":"10s"}}`
+		require.NoError(t, v.Validate(config.NewKeyValue(appKey, config.NewValue(txID, cfg, config.FormatYAML, sidetreeTag))))
+	})
+
+	t.Run("Invalid LeaderElection.Collection -> error", func(t *testing.T) {
+		cfg := `{"batchWriterTimeout":"1s","leaderElection":{"enabled":true,"leaseTimeout":"10s"}}`
+		err := v.Validate(config.NewKeyValue(appKey, config.NewValue(txID, cfg, config.FormatYAML, sidetreeTag)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "field 'LeaderElection.Collection' is required")
+	})
+
+	t.Run("Invalid LeaderElection.LeaseTimeout -> error", func(t *testing.T) {
+		cfg := `{"batchWriterTimeout":"1s","leaderElection":{"enabled":true,"collection":"leases"}}`
+		err := v.Validate(config.NewKeyValue(appKey, config.NewValue(txID, cfg, config.FormatYAML, sidetreeTag)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "field 'LeaderElection.LeaseTimeout' must contain a value greater than 0")
+	})
+
+	t.Run("Leader election without shared operation queue -> error", func(t *testing.T) {
+		v := &sidetreeValidator{opQueueBackend: defaultOperationQueueBackend}
+
+		cfg := `{"batchWriterTimeout":"1s","leaderElection":{"enabled":true,"collection":"leases","leaseTimeout":"10s"}}`
+		err := v.Validate(config.NewKeyValue(appKey, config.NewValue(txID, cfg, config.FormatYAML, sidetreeTag)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "leader election requires the [offledger] operation queue backend but the backend is [leveldb]")
+	})
 }
 
 func TestSidetreeValidator_ValidateProtocol(t *testing.T) {
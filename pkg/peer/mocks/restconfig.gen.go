@@ -3,6 +3,8 @@ package mocks
 
 import (
 	"sync"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
 )
 
 type RestConfig struct {
@@ -17,6 +19,15 @@ type RestConfig struct {
 		result1 string
 		result2 error
 	}
+	SidetreeTLSStub        func() config.TLS
+	sidetreeTLSMutex       sync.RWMutex
+	sidetreeTLSArgsForCall []struct{}
+	sidetreeTLSReturns     struct {
+		result1 config.TLS
+	}
+	sidetreeTLSReturnsOnCall map[int]struct {
+		result1 config.TLS
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -64,11 +75,53 @@ func (fake *RestConfig) SidetreeListenURLReturnsOnCall(i int, result1 string, re
 	}{result1, result2}
 }
 
+func (fake *RestConfig) SidetreeTLS() config.TLS {
+	fake.sidetreeTLSMutex.Lock()
+	ret, specificReturn := fake.sidetreeTLSReturnsOnCall[len(fake.sidetreeTLSArgsForCall)]
+	fake.sidetreeTLSArgsForCall = append(fake.sidetreeTLSArgsForCall, struct{}{})
+	fake.recordInvocation("SidetreeTLS", []interface{}{})
+	fake.sidetreeTLSMutex.Unlock()
+	if fake.SidetreeTLSStub != nil {
+		return fake.SidetreeTLSStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.sidetreeTLSReturns.result1
+}
+
+func (fake *RestConfig) SidetreeTLSCallCount() int {
+	fake.sidetreeTLSMutex.RLock()
+	defer fake.sidetreeTLSMutex.RUnlock()
+	return len(fake.sidetreeTLSArgsForCall)
+}
+
+func (fake *RestConfig) SidetreeTLSReturns(result1 config.TLS) {
+	fake.SidetreeTLSStub = nil
+	fake.sidetreeTLSReturns = struct {
+		result1 config.TLS
+	}{result1}
+}
+
+func (fake *RestConfig) SidetreeTLSReturnsOnCall(i int, result1 config.TLS) {
+	fake.SidetreeTLSStub = nil
+	if fake.sidetreeTLSReturnsOnCall == nil {
+		fake.sidetreeTLSReturnsOnCall = make(map[int]struct {
+			result1 config.TLS
+		})
+	}
+	fake.sidetreeTLSReturnsOnCall[i] = struct {
+		result1 config.TLS
+	}{result1}
+}
+
 func (fake *RestConfig) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
 	fake.sidetreeListenURLMutex.RLock()
 	defer fake.sidetreeListenURLMutex.RUnlock()
+	fake.sidetreeTLSMutex.RLock()
+	defer fake.sidetreeTLSMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
@@ -0,0 +1,60 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sidetreesvc
+
+import (
+	"github.com/pkg/errors"
+	"github.com/trustbloc/sidetree-core-go/pkg/restapi/common"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/httpserver"
+	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
+)
+
+// newAuthorizers returns the authorizers for the given authorization config. An empty slice is
+// returned if no authorization rules are configured.
+func newAuthorizers(cfg config.Authorization) ([]httpserver.Authorizer, error) {
+	var authorizers []httpserver.Authorizer
+
+	if len(cfg.TokenHashes) > 0 {
+		a, err := httpserver.NewTokenAuthorizer(cfg.TokenHashes...)
+		if err != nil {
+			return nil, errors.WithMessage(err, "invalid token authorization")
+		}
+
+		authorizers = append(authorizers, a)
+	}
+
+	if len(cfg.JWT.PublicKeys) > 0 {
+		a, err := httpserver.NewJWTAuthorizer(cfg.JWT.Issuer, cfg.JWT.Audience, cfg.JWT.PublicKeys...)
+		if err != nil {
+			return nil, errors.WithMessage(err, "invalid JWT authorization")
+		}
+
+		authorizers = append(authorizers, a)
+	}
+
+	if len(cfg.ClientCertSubjects) > 0 {
+		a, err := httpserver.NewClientCertAuthorizer(cfg.ClientCertSubjects...)
+		if err != nil {
+			return nil, errors.WithMessage(err, "invalid client certificate authorization")
+		}
+
+		authorizers = append(authorizers, a)
+	}
+
+	return authorizers, nil
+}
+
+// withAuthorization wraps the given handler so that requests are authorized according to the given config
+func withAuthorization(handler common.HTTPHandler, cfg config.Authorization) (common.HTTPHandler, error) {
+	authorizers, err := newAuthorizers(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return httpserver.NewAuthHandler(handler, authorizers...), nil
+}
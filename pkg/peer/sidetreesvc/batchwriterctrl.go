@@ -7,57 +7,215 @@ SPDX-License-Identifier: Apache-2.0
 package sidetreesvc
 
 import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	batchapi "github.com/trustbloc/sidetree-core-go/pkg/api/batch"
 	"github.com/trustbloc/sidetree-core-go/pkg/batch"
-	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
 
+	"github.com/trustbloc/sidetree-fabric/pkg/context/operationqueue"
+	"github.com/trustbloc/sidetree-fabric/pkg/leader"
+	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
 	"github.com/trustbloc/sidetree-fabric/pkg/role"
 )
 
-type batchWriterController struct {
-	*batch.Writer
+type elector interface {
+	Start()
+	Stop()
+}
 
+// electorFactory creates a leader elector for the given namespace
+type electorFactory func(namespace string, cfg leader.Config, listener leader.Listener) (elector, error)
+
+type batchWriterController struct {
 	channelID string
 	namespace string
+	ctx       batch.Context
+	timeout   time.Duration
+	elector   elector
+	writer    *batch.Writer
+	mutex     sync.RWMutex
 }
 
-func newBatchWriter(channelID, namespace string, ctx batch.Context, configService config.SidetreeService) (*batchWriterController, error) {
-	var bw *batch.Writer
-	if role.IsBatchWriter() {
-		logger.Debugf("[%s] Creating Sidetree batch writer for [%s]", channelID, namespace)
+// newBatchWriter creates the batch writer controller for the given namespace. Leader election must be enabled if
+// (and only if) the operation queue backend is shared by the batch writers (offledger). Otherwise the operations
+// accepted by the batch writers that aren't the leader would never be processed or, with a shared queue and no
+// leader, more than one peer would cut batches from the same operations.
+func newBatchWriter(channelID, namespace string, roles role.Roles, ctx batch.Context, configService config.SidetreeService, opQueueBackend string, newElector electorFactory) (*batchWriterController, error) {
+	bw := &batchWriterController{
+		channelID: channelID,
+		namespace: namespace,
+		ctx:       ctx,
+	}
+
+	if !roles.IsBatchWriter() {
+		return bw, nil
+	}
 
-		sidetreeCfg, err := configService.LoadSidetree(namespace)
-		if err != nil {
-			return nil, err
-		}
+	logger.Debugf("[%s] Creating Sidetree batch writer for [%s]", channelID, namespace)
+
+	sidetreeCfg, err := configService.LoadSidetree(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	bw.timeout = sidetreeCfg.BatchWriterTimeout
 
-		bw, err = batch.New(channelID+"_"+namespace, ctx, batch.WithBatchTimeout(sidetreeCfg.BatchWriterTimeout))
+	sharedQueue := opQueueBackend == operationqueue.OffLedgerBackend
+
+	if sidetreeCfg.LeaderElection.Enabled && !sharedQueue {
+		return nil, errors.Errorf("leader election is enabled for [%s] but the operation queue backend [%s] isn't shared by the batch writers (the [%s] backend is required)",
+			namespace, opQueueBackend, operationqueue.OffLedgerBackend)
+	}
+
+	if !sidetreeCfg.LeaderElection.Enabled && sharedQueue {
+		return nil, errors.Errorf("leader election must be enabled for [%s] since the operation queue backend [%s] is shared by the batch writers",
+			namespace, opQueueBackend)
+	}
+
+	if !sidetreeCfg.LeaderElection.Enabled {
+		bw.writer, err = bw.newWriter()
 		if err != nil {
 			return nil, err
 		}
+
+		return bw, nil
 	}
 
-	return &batchWriterController{
-		Writer:    bw,
-		channelID: channelID,
-		namespace: namespace,
-	}, nil
+	if newElector == nil {
+		return nil, errors.Errorf("leader election is enabled for [%s] but no leader elector is available", namespace)
+	}
+
+	logger.Debugf("[%s] Leader election is enabled for the batch writer of [%s]", channelID, namespace)
+
+	// Make sure that the batch writer can be created before taking part in the election
+	if _, err := bw.newWriter(); err != nil {
+		return nil, err
+	}
+
+	bw.elector, err = newElector(
+		namespace,
+		leader.Config{
+			Collection:   sidetreeCfg.LeaderElection.Collection,
+			LeaseTimeout: sidetreeCfg.LeaderElection.LeaseTimeout,
+		},
+		bw.handleLeadershipChange,
+	)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "unable to create leader elector for [%s]", namespace)
+	}
+
+	return bw, nil
 }
 
-// Start starts the batch writer if it is set
+// Start starts the batch writer if it is set. If leader election is enabled then the
+// batch writer is started only when this peer is elected leader.
 func (bw *batchWriterController) Start() error {
-	if bw.Writer != nil {
+	if bw.elector != nil {
+		logger.Infof("[%s] Starting leader election for the batch writer of Sidetree [%s]", bw.channelID, bw.namespace)
+
+		bw.elector.Start()
+
+		return nil
+	}
+
+	if w := bw.getWriter(); w != nil {
 		logger.Infof("[%s] Starting batch writer for Sidetree [%s]", bw.channelID, bw.namespace)
 
-		bw.Writer.Start()
+		w.Start()
 	}
+
 	return nil
 }
 
-// STop stops the batch writer if it is set
+// Stop stops the batch writer if it is set
 func (bw *batchWriterController) Stop() {
-	if bw.Writer != nil {
+	if bw.elector != nil {
+		logger.Infof("[%s] Stopping leader election for the batch writer of Sidetree [%s]", bw.channelID, bw.namespace)
+
+		bw.elector.Stop()
+	}
+
+	bw.mutex.Lock()
+	w := bw.writer
+	if bw.elector != nil {
+		bw.writer = nil
+	}
+	bw.mutex.Unlock()
+
+	if w != nil {
 		logger.Infof("[%s] Stopping batch writer for Sidetree [%s]", bw.channelID, bw.namespace)
 
-		bw.Writer.Start()
+		w.Stop()
+	}
+}
+
+// Add adds the given operation to the batch writer. If leader election is enabled and this peer
+// isn't the leader then the operation is added to the operation queue so that it's processed by
+// the leader (the operation queue must be shared among the batch writers).
+func (bw *batchWriterController) Add(op *batchapi.OperationInfo) error {
+	if w := bw.getWriter(); w != nil {
+		return w.Add(op)
+	}
+
+	if bw.elector == nil {
+		return errors.Errorf("batch writer is not available for [%s]", bw.namespace)
 	}
+
+	logger.Debugf("[%s] This peer is not the leader for [%s]. Adding operation [%s] to the operation queue.", bw.channelID, bw.namespace, op.UniqueSuffix)
+
+	_, err := bw.ctx.OperationQueue().Add(op)
+
+	return err
+}
+
+// IsLeader returns true if this peer is currently cutting batches for the namespace
+func (bw *batchWriterController) IsLeader() bool {
+	return bw.getWriter() != nil
+}
+
+// handleLeadershipChange starts a new batch writer when this peer becomes the leader
+// and stops the batch writer when it loses leadership
+func (bw *batchWriterController) handleLeadershipChange(isLeader bool) {
+	bw.mutex.Lock()
+	defer bw.mutex.Unlock()
+
+	if !isLeader {
+		if bw.writer != nil {
+			logger.Infof("[%s] Lost leadership - stopping batch writer for Sidetree [%s]", bw.channelID, bw.namespace)
+
+			bw.writer.Stop()
+			bw.writer = nil
+		}
+
+		return
+	}
+
+	if bw.writer != nil {
+		return
+	}
+
+	// A batch writer can't be restarted after it was stopped so a new one is created each time this peer becomes the leader
+	w, err := bw.newWriter()
+	if err != nil {
+		logger.Errorf("[%s] Unable to create batch writer for Sidetree [%s]: %s", bw.channelID, bw.namespace, err)
+		return
+	}
+
+	logger.Infof("[%s] Elected leader - starting batch writer for Sidetree [%s]", bw.channelID, bw.namespace)
+
+	w.Start()
+	bw.writer = w
+}
+
+func (bw *batchWriterController) newWriter() (*batch.Writer, error) {
+	return batch.New(bw.channelID+"_"+bw.namespace, bw.ctx, batch.WithBatchTimeout(bw.timeout))
+}
+
+func (bw *batchWriterController) getWriter() *batch.Writer {
+	bw.mutex.RLock()
+	defer bw.mutex.RUnlock()
+
+	return bw.writer
 }
@@ -13,10 +13,13 @@ import (
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/trustbloc/sidetree-core-go/pkg/api/batch"
 	"github.com/trustbloc/sidetree-core-go/pkg/batch/opqueue"
 
 	extroles "github.com/trustbloc/fabric-peer-ext/pkg/roles"
 
+	"github.com/trustbloc/sidetree-fabric/pkg/context/operationqueue"
+	"github.com/trustbloc/sidetree-fabric/pkg/leader"
 	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
 	"github.com/trustbloc/sidetree-fabric/pkg/peer/mocks"
 	"github.com/trustbloc/sidetree-fabric/pkg/role"
@@ -51,7 +54,7 @@ func TestBatchWriter(t *testing.T) {
 		cfgService := &mocks.SidetreeConfigService{}
 		cfgService.LoadSidetreeReturns(config.Sidetree{BatchWriterTimeout: time.Second}, nil)
 
-		bw, err := newBatchWriter(channel1, namespace, ctx, cfgService)
+		bw, err := newBatchWriter(channel1, namespace, nil, ctx, cfgService, "", nil)
 		require.NoError(t, err)
 		require.NotNil(t, bw)
 
@@ -60,14 +63,150 @@ func TestBatchWriter(t *testing.T) {
 		bw.Stop()
 	})
 
+	t.Run("Batch-writer role not assigned in config", func(t *testing.T) {
+		cfgService := &mocks.SidetreeConfigService{}
+
+		bw, err := newBatchWriter(channel1, namespace, role.Roles{role.Resolver}, ctx, cfgService, "", nil)
+		require.NoError(t, err)
+		require.NotNil(t, bw)
+		require.Nil(t, bw.writer)
+		require.Zero(t, cfgService.LoadSidetreeCallCount())
+	})
+
 	t.Run("sidetreeService error", func(t *testing.T) {
 		errExpected := errors.New("injected sidetreeCfgService service error")
 		cfgService := &mocks.SidetreeConfigService{}
 		cfgService.LoadSidetreeReturns(config.Sidetree{}, errExpected)
 
-		bw, err := newBatchWriter(channel1, namespace, ctx, cfgService)
+		bw, err := newBatchWriter(channel1, namespace, nil, ctx, cfgService, "", nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errExpected.Error())
+		require.Nil(t, bw)
+	})
+
+	t.Run("Leader election", func(t *testing.T) {
+		q := &opqueue.MemQueue{}
+		ctx := &mocks.BatchContext{}
+		ctx.OperationQueueReturns(q)
+		ctx.ProtocolReturns(pc)
+
+		cfgService := &mocks.SidetreeConfigService{}
+		cfgService.LoadSidetreeReturns(config.Sidetree{
+			BatchWriterTimeout: time.Second,
+			LeaderElection: config.LeaderElection{
+				Enabled:      true,
+				Collection:   "leases",
+				LeaseTimeout: time.Second,
+			},
+		}, nil)
+
+		e := &mockElector{}
+		var listener leader.Listener
+
+		bw, err := newBatchWriter(channel1, namespace, nil, ctx, cfgService, operationqueue.OffLedgerBackend, func(ns string, cfg leader.Config, l leader.Listener) (elector, error) {
+			require.Equal(t, namespace, ns)
+			require.Equal(t, "leases", cfg.Collection)
+			require.Equal(t, time.Second, cfg.LeaseTimeout)
+
+			listener = l
+
+			return e, nil
+		})
+		require.NoError(t, err)
+		require.NotNil(t, bw)
+		require.NotNil(t, listener)
+
+		require.NoError(t, bw.Start())
+		require.True(t, e.started)
+		require.False(t, bw.IsLeader())
+
+		// Operations submitted to a follower are added to the operation queue
+		require.NoError(t, bw.Add(&batch.OperationInfo{UniqueSuffix: "suffix1"}))
+		require.Equal(t, uint(1), q.Len())
+
+		listener(true)
+		require.True(t, bw.IsLeader())
+
+		listener(false)
+		require.False(t, bw.IsLeader())
+
+		// A new batch writer is started when leadership is regained
+		listener(true)
+		require.True(t, bw.IsLeader())
+
+		bw.Stop()
+		require.True(t, e.stopped)
+		require.False(t, bw.IsLeader())
+	})
+
+	t.Run("Leader election error", func(t *testing.T) {
+		cfgService := &mocks.SidetreeConfigService{}
+		cfgService.LoadSidetreeReturns(config.Sidetree{
+			BatchWriterTimeout: time.Second,
+			LeaderElection:     config.LeaderElection{Enabled: true},
+		}, nil)
+
+		bw, err := newBatchWriter(channel1, namespace, nil, ctx, cfgService, operationqueue.OffLedgerBackend, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "no leader elector is available")
+		require.Nil(t, bw)
+
+		errExpected := errors.New("injected elector error")
+
+		bw, err = newBatchWriter(channel1, namespace, nil, ctx, cfgService, operationqueue.OffLedgerBackend, func(string, leader.Config, leader.Listener) (elector, error) {
+			return nil, errExpected
+		})
 		require.Error(t, err)
 		require.Contains(t, err.Error(), errExpected.Error())
 		require.Nil(t, bw)
 	})
+
+	t.Run("Operation queue backend mismatch", func(t *testing.T) {
+		cfgService := &mocks.SidetreeConfigService{}
+		cfgService.LoadSidetreeReturns(config.Sidetree{
+			BatchWriterTimeout: time.Second,
+			LeaderElection:     config.LeaderElection{Enabled: true, Collection: "leases", LeaseTimeout: time.Second},
+		}, nil)
+
+		newElector := func(string, leader.Config, leader.Listener) (elector, error) { return &mockElector{}, nil }
+
+		bw, err := newBatchWriter(channel1, namespace, nil, ctx, cfgService, "leveldb", newElector)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "the operation queue backend [leveldb] isn't shared by the batch writers")
+		require.Nil(t, bw)
+
+		cfgService.LoadSidetreeReturns(config.Sidetree{BatchWriterTimeout: time.Second}, nil)
+
+		bw, err = newBatchWriter(channel1, namespace, nil, ctx, cfgService, operationqueue.OffLedgerBackend, newElector)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "leader election must be enabled")
+		require.Nil(t, bw)
+	})
+}
+
+func TestBatchWriter_NotBatchWriter(t *testing.T) {
+	bw, err := newBatchWriter(channel1, namespace, nil, &mocks.BatchContext{}, &mocks.SidetreeConfigService{}, "", nil)
+	require.NoError(t, err)
+	require.NotNil(t, bw)
+
+	require.NoError(t, bw.Start())
+
+	err = bw.Add(&batch.OperationInfo{UniqueSuffix: "suffix1"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "batch writer is not available")
+
+	bw.Stop()
+}
+
+type mockElector struct {
+	started bool
+	stopped bool
+}
+
+func (e *mockElector) Start() {
+	e.started = true
+}
+
+func (e *mockElector) Stop() {
+	e.stopped = true
 }
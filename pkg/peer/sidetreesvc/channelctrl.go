@@ -9,12 +9,15 @@ package sidetreesvc
 import (
 	"sync"
 
+	"github.com/pkg/errors"
 	ledgerconfig "github.com/trustbloc/fabric-peer-ext/pkg/config/ledgerconfig/config"
 	"github.com/trustbloc/fabric-peer-ext/pkg/config/ledgerconfig/service"
 
 	"github.com/trustbloc/sidetree-core-go/pkg/restapi/common"
 
+	"github.com/trustbloc/sidetree-fabric/pkg/leader"
 	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
+	"github.com/trustbloc/sidetree-fabric/pkg/role"
 )
 
 type restServiceController interface {
@@ -28,8 +31,11 @@ type channelController struct {
 
 	mutex     sync.RWMutex
 	channelID string
+	roles     role.Roles
 	observer  *observerController
 	monitor   *monitorController
+	sweeper   *sweeperController
+	checker   *consistencyController
 	contexts  map[string]*context
 }
 
@@ -54,15 +60,7 @@ func (c *channelController) Close() {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	if c.observer != nil {
-		c.observer.Stop()
-		c.observer = nil
-	}
-
-	if c.monitor != nil {
-		c.monitor.Stop()
-		c.monitor = nil
-	}
+	c.stopChannelComponents()
 
 	for _, ctx := range c.contexts {
 		ctx.Stop()
@@ -83,6 +81,10 @@ func (c *channelController) RESTHandlers() []common.HTTPHandler {
 		}
 	}
 
+	if c.monitor != nil {
+		restHandlers = append(restHandlers, c.monitor.HTTPHandlers()...)
+	}
+
 	return restHandlers
 }
 
@@ -94,7 +96,9 @@ func (c *channelController) load() error {
 		if err == service.ErrConfigNotFound {
 			// No Sidetree components defined for this peer. Stop all running channelController.
 			logger.Info("No Sidetree configuration found for this peer.")
+			namespaces := c.namespaces()
 			c.Close()
+			c.removeOperationQueues(namespaces)
 			return nil
 		}
 
@@ -106,23 +110,59 @@ func (c *channelController) load() error {
 
 	logger.Debugf("[%s] Updating Sidetree service channelController ...", c.channelID)
 
-	modified, err := c.loadContexts(cfg.Namespaces)
+	roles := role.Roles(cfg.Roles)
+
+	modified, err := c.loadContexts(roles, cfg.Namespaces)
 	if err != nil {
 		return err
 	}
 
+	if !roles.Equals(c.roles) {
+		logger.Infof("[%s] Sidetree roles for the channel changed from %s to %s", c.channelID, c.roles, roles)
+
+		if c.monitor != nil && len(c.monitor.HTTPHandlers()) > 0 {
+			modified = true
+		}
+
+		c.stopChannelComponents()
+		c.roles = roles
+	}
+
 	if c.observer == nil {
-		c.observer = newObserverController(c.channelID, c.ObserverProviders)
+		c.observer = newObserverController(c.channelID, roles, c.PeerConfig, c.ObserverProviders)
 		if err := c.observer.Start(); err != nil {
 			return err
 		}
 	}
 
 	if c.monitor == nil {
-		c.monitor = newMonitorController(c.channelID, c.PeerConfig, cfg.Monitor, c.MonitorProviders)
+		monitorCtrl, err := newMonitorController(c.channelID, roles, c.PeerConfig, cfg.Monitor, c.MonitorProviders)
+		if err != nil {
+			return err
+		}
+
+		c.monitor = monitorCtrl
 		if err := c.monitor.Start(); err != nil {
 			return err
 		}
+
+		if len(c.monitor.HTTPHandlers()) > 0 {
+			modified = true
+		}
+	}
+
+	if c.sweeper == nil {
+		c.sweeper = newSweeperController(c.channelID, roles, c.PeerConfig, cfg.DCASSweeper, c.MonitorProviders)
+		if err := c.sweeper.Start(); err != nil {
+			return err
+		}
+	}
+
+	if c.checker == nil {
+		c.checker = newConsistencyController(c.channelID, roles, c.PeerConfig, cfg.ConsistencyChecker, c.MonitorProviders)
+		if err := c.checker.Start(); err != nil {
+			return err
+		}
 	}
 
 	if modified {
@@ -139,8 +179,31 @@ type contextPair struct {
 	oldCtx *context
 }
 
-func (c *channelController) loadContexts(namespaces []config.Namespace) (modified bool, err error) {
-	loadedContexts, err := c.loadNewContexts(namespaces)
+// stopChannelComponents stops the components that run for the channel as a whole (as opposed to per namespace)
+func (c *channelController) stopChannelComponents() {
+	if c.observer != nil {
+		c.observer.Stop()
+		c.observer = nil
+	}
+
+	if c.monitor != nil {
+		c.monitor.Stop()
+		c.monitor = nil
+	}
+
+	if c.sweeper != nil {
+		c.sweeper.Stop()
+		c.sweeper = nil
+	}
+
+	if c.checker != nil {
+		c.checker.Stop()
+		c.checker = nil
+	}
+}
+
+func (c *channelController) loadContexts(roles role.Roles, namespaces []config.Namespace) (modified bool, err error) {
+	loadedContexts, err := c.loadNewContexts(roles, namespaces)
 	if err != nil {
 		return false, err
 	}
@@ -158,12 +221,20 @@ func (c *channelController) loadContexts(namespaces []config.Namespace) (modifie
 		}
 	}
 
+	var removedNamespaces []string
+
 	for _, ctx := range oldContexts {
 		ctx.Stop()
 
 		delete(c.contexts, ctx.Namespace())
+
+		if !containsNamespace(newContexts, ctx.Namespace()) {
+			removedNamespaces = append(removedNamespaces, ctx.Namespace())
+		}
 	}
 
+	c.removeOperationQueues(removedNamespaces)
+
 	for _, ctx := range newContexts {
 		if err := ctx.Start(); err != nil {
 			return false, err
@@ -175,11 +246,44 @@ func (c *channelController) loadContexts(namespaces []config.Namespace) (modifie
 	return len(newContexts) > 0 || len(oldContexts) > 0, nil
 }
 
-func (c *channelController) loadNewContexts(namespaces []config.Namespace) ([]*context, error) {
+// removeOperationQueues removes the operation queues of namespaces that were removed from the peer config
+func (c *channelController) removeOperationQueues(namespaces []string) {
+	for _, ns := range namespaces {
+		logger.Infof("[%s] Namespace [%s] was removed. Removing operation queue.", c.channelID, ns)
+
+		if err := c.OperationQueueProvider.Remove(c.channelID, ns); err != nil {
+			logger.Errorf("[%s] Error removing operation queue for namespace [%s]: %s", c.channelID, ns, err)
+		}
+	}
+}
+
+func (c *channelController) namespaces() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var namespaces []string
+	for ns := range c.contexts {
+		namespaces = append(namespaces, ns)
+	}
+
+	return namespaces
+}
+
+func containsNamespace(contexts []*context, namespace string) bool {
+	for _, ctx := range contexts {
+		if ctx.Namespace() == namespace {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *channelController) loadNewContexts(roles role.Roles, namespaces []config.Namespace) ([]*context, error) {
 	var contexts []*context
 
 	for _, nsCfg := range namespaces {
-		ctx, err := newContext(c.channelID, nsCfg, c.sidetreeCfgService, c.TxnProvider, c.DcasProvider, c.OperationQueueProvider)
+		ctx, err := newContext(c.channelID, nsCfg, roles, c.sidetreeCfgService, c.TxnProvider, c.DcasProvider, c.OperationQueueProvider, c.OperationQueueConfig.OperationQueueBackend(), c.newElector)
 		if err != nil {
 			return nil, err
 		}
@@ -192,6 +296,21 @@ func (c *channelController) loadNewContexts(namespaces []config.Namespace) ([]*c
 	return contexts, nil
 }
 
+// newElector creates a leader elector for the batch writers of the given namespace. The lease is
+// held in an off-ledger collection so that a leader is elected among the peers of this peer's org.
+func (c *channelController) newElector(namespace string, cfg leader.Config, listener leader.Listener) (elector, error) {
+	if c.ObserverProviders == nil || c.ObserverProviders.OffLedger == nil {
+		return nil, errors.New("off-ledger client provider is not available")
+	}
+
+	e, err := leader.New(c.channelID, namespace, c.PeerConfig.MSPID(), c.PeerConfig.PeerID(), cfg, c.ObserverProviders.OffLedger, listener)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
 func (c *channelController) createContextMap(newContexts []*context) map[string]*contextPair {
 	contextMap := make(map[string]*contextPair)
 	for _, ctx := range newContexts {
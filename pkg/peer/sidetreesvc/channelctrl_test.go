@@ -20,6 +20,7 @@ import (
 	protocolApi "github.com/trustbloc/sidetree-core-go/pkg/api/protocol"
 	"github.com/trustbloc/sidetree-core-go/pkg/batch/opqueue"
 
+	opqmocks "github.com/trustbloc/sidetree-fabric/pkg/context/operationqueue/mocks"
 	"github.com/trustbloc/sidetree-fabric/pkg/mocks"
 	"github.com/trustbloc/sidetree-fabric/pkg/observer"
 	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
@@ -87,6 +88,7 @@ func TestChannelManager(t *testing.T) {
 		ConfigProvider:         configProvider,
 		ObserverProviders:      observerProviders,
 		OperationQueueProvider: opQueueProvider,
+		OperationQueueConfig:   &opqmocks.PeerConfig{},
 	}
 
 	stConfigService := &peermocks.SidetreeConfigService{}
@@ -138,7 +140,52 @@ func TestChannelManager(t *testing.T) {
 		require.Len(t, ctrl.Invocations()[eventMethod], count)
 	})
 
+	t.Run("Namespace removed -> operation queue removed", func(t *testing.T) {
+		stConfigService.LoadSidetreePeerReturns(config.SidetreePeer{}, nil)
+		m.handleUpdate(&ledgerconfig.KeyValue{
+			Key: ledgerconfig.NewPeerKey(msp1, peer1, config.SidetreePeerAppName, config.SidetreePeerAppVersion),
+		})
+
+		time.Sleep(20 * time.Millisecond)
+		require.Equal(t, 1, opQueueProvider.RemoveCallCount())
+		channelID, ns := opQueueProvider.RemoveArgsForCall(0)
+		require.Equal(t, channel1, channelID)
+		require.Equal(t, didTrustblocNamespace, ns)
+		require.Empty(t, m.RESTHandlers())
+
+		stConfigService.LoadSidetreePeerReturns(sidetreePeerCfg, nil)
+		require.NoError(t, m.load())
+		require.Len(t, m.RESTHandlers(), 2)
+	})
+
+	t.Run("Roles assigned in config", func(t *testing.T) {
+		require.NotNil(t, m.observer.observer)
+
+		cfg := config.SidetreePeer{
+			Roles: []string{role.BatchWriter, role.Resolver},
+			Namespaces: []config.Namespace{
+				{
+					Namespace: didTrustblocNamespace,
+					BasePath:  didTrustblocBasePath,
+					Roles:     []string{role.Resolver},
+				},
+			},
+		}
+
+		stConfigService.LoadSidetreePeerReturns(cfg, nil)
+		require.NoError(t, m.load())
+		require.Len(t, m.RESTHandlers(), 1)
+		require.Nil(t, m.observer.observer)
+
+		stConfigService.LoadSidetreePeerReturns(sidetreePeerCfg, nil)
+		require.NoError(t, m.load())
+		require.Len(t, m.RESTHandlers(), 2)
+		require.NotNil(t, m.observer.observer)
+	})
+
 	t.Run("Peer sidetreeCfgService not found", func(t *testing.T) {
+		removeCount := opQueueProvider.RemoveCallCount()
+
 		count := len(ctrl.Invocations()[eventMethod])
 
 		stConfigService.LoadSidetreePeerReturns(config.SidetreePeer{}, service.ErrConfigNotFound)
@@ -148,5 +195,6 @@ func TestChannelManager(t *testing.T) {
 
 		time.Sleep(20 * time.Millisecond)
 		require.Len(t, ctrl.Invocations()[eventMethod], count)
+		require.Equal(t, removeCount+1, opQueueProvider.RemoveCallCount())
 	})
 }
@@ -0,0 +1,61 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sidetreesvc
+
+import (
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/consistency"
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/monitor"
+	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
+	"github.com/trustbloc/sidetree-fabric/pkg/role"
+)
+
+type consistencyController struct {
+	channelID string
+	checker   *consistency.Checker
+}
+
+func newConsistencyController(channelID string, roles role.Roles, peerConfig peerConfig, checkerCfg config.ConsistencyChecker, providers *monitor.ClientProviders) *consistencyController {
+	var c *consistency.Checker
+	if roles.IsMonitor() && checkerCfg.Period > 0 {
+		c = consistency.New(channelID, peerConfig.PeerID(),
+			consistency.Config{
+				Period:       checkerCfg.Period,
+				Peers:        checkerCfg.Peers,
+				SampleSize:   checkerCfg.SampleSize,
+				MaxDigestAge: checkerCfg.MaxDigestAge,
+				Repair:       checkerCfg.Repair,
+			},
+			&consistency.ClientProviders{
+				OffLedger: providers.OffLedger,
+				DCAS:      providers.DCAS,
+			},
+		)
+	}
+
+	return &consistencyController{
+		channelID: channelID,
+		checker:   c,
+	}
+}
+
+// Start starts the consistency checker if it is set
+func (c *consistencyController) Start() error {
+	if c.checker != nil {
+		logger.Debugf("[%s] Starting consistency checker ...", c.channelID)
+		return c.checker.Start()
+	}
+
+	return nil
+}
+
+// Stop stops the consistency checker if it is set
+func (c *consistencyController) Stop() {
+	if c.checker != nil {
+		logger.Debugf("[%s] Stopping consistency checker ...", c.channelID)
+		c.checker.Stop()
+	}
+}
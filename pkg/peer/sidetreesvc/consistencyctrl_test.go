@@ -0,0 +1,76 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sidetreesvc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	extroles "github.com/trustbloc/fabric-peer-ext/pkg/roles"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/monitor"
+	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
+	"github.com/trustbloc/sidetree-fabric/pkg/peer/mocks"
+	"github.com/trustbloc/sidetree-fabric/pkg/role"
+)
+
+func TestConsistencyController(t *testing.T) {
+	peerCfg := &mocks.PeerConfig{}
+	peerCfg.PeerIDReturns(peer1)
+	peerCfg.MSPIDReturns(msp1)
+
+	checkerCfg := config.ConsistencyChecker{Period: time.Second, Peers: []string{"peer2.example.com"}}
+	providers := &monitor.ClientProviders{}
+
+	t.Run("Checker is started", func(t *testing.T) {
+		rolesValue := make(map[extroles.Role]struct{})
+		rolesValue[role.Monitor] = struct{}{}
+		extroles.SetRoles(rolesValue)
+		defer func() {
+			extroles.SetRoles(nil)
+		}()
+
+		c := newConsistencyController(channel1, nil, peerCfg, checkerCfg, providers)
+		require.NotNil(t, c)
+		require.NotNil(t, c.checker)
+		require.NoError(t, c.Start())
+		time.Sleep(100 * time.Millisecond)
+		c.Stop()
+	})
+
+	t.Run("Checker is not started", func(t *testing.T) {
+		rolesValue := make(map[extroles.Role]struct{})
+		rolesValue[extroles.CommitterRole] = struct{}{}
+		rolesValue[role.BatchWriter] = struct{}{}
+		extroles.SetRoles(rolesValue)
+		defer func() {
+			extroles.SetRoles(nil)
+		}()
+
+		c := newConsistencyController(channel1, nil, peerCfg, checkerCfg, providers)
+		require.NotNil(t, c)
+		require.Nil(t, c.checker)
+		require.NoError(t, c.Start())
+		c.Stop()
+	})
+
+	t.Run("Checker is disabled", func(t *testing.T) {
+		rolesValue := make(map[extroles.Role]struct{})
+		rolesValue[role.Monitor] = struct{}{}
+		extroles.SetRoles(rolesValue)
+		defer func() {
+			extroles.SetRoles(nil)
+		}()
+
+		c := newConsistencyController(channel1, nil, peerCfg, config.ConsistencyChecker{}, nil)
+		require.NotNil(t, c)
+		require.Nil(t, c.checker)
+		require.NoError(t, c.Start())
+		c.Stop()
+	})
+}
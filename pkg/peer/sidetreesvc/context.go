@@ -12,9 +12,16 @@ import (
 	"github.com/trustbloc/sidetree-core-go/pkg/dochandler"
 
 	sidetreectx "github.com/trustbloc/sidetree-fabric/pkg/context"
+	"github.com/trustbloc/sidetree-fabric/pkg/context/operationqueue"
 	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
+	"github.com/trustbloc/sidetree-fabric/pkg/role"
 )
 
+// limitedOperationQueue is implemented by operation queues that support capacity and age limits
+type limitedOperationQueue interface {
+	SetLimits(limits operationqueue.Limits)
+}
+
 type batchWriter interface {
 	dochandler.BatchWriter
 
@@ -49,7 +56,7 @@ func (c *context) Stop() {
 	c.batchWriter.Stop()
 }
 
-func newContext(channelID string, nsCfg config.Namespace, cfg config.SidetreeService, txnProvider txnServiceProvider, dcasProvider dcasClientProvider, opQueueProvider operationQueueProvider) (*context, error) {
+func newContext(channelID string, nsCfg config.Namespace, channelRoles role.Roles, cfg config.SidetreeService, txnProvider txnServiceProvider, dcasProvider dcasClientProvider, opQueueProvider operationQueueProvider, opQueueBackend string, newElector electorFactory) (*context, error) {
 	logger.Debugf("[%s] Creating Sidetree context for [%s]", channelID, nsCfg.Namespace)
 
 	ctx, err := newSidetreeContext(channelID, nsCfg.Namespace, cfg, txnProvider, dcasProvider, opQueueProvider)
@@ -57,16 +64,27 @@ func newContext(channelID string, nsCfg config.Namespace, cfg config.SidetreeSer
 		return nil, err
 	}
 
+	// The queue limits are applied regardless of role so that operations left in the
+	// queue (for example, if the batch writer role was removed) still expire
+	if err := configureOperationQueue(channelID, nsCfg.Namespace, ctx, cfg); err != nil {
+		return nil, err
+	}
+
+	roles := role.Roles(nsCfg.Roles).Or(channelRoles)
+
 	logger.Debugf("[%s] Creating Sidetree batch writer for [%s]", channelID, nsCfg.Namespace)
 
-	bw, err := newBatchWriter(channelID, nsCfg.Namespace, ctx, cfg)
+	bw, err := newBatchWriter(channelID, nsCfg.Namespace, roles, ctx, cfg, opQueueBackend, newElector)
 	if err != nil {
 		return nil, err
 	}
 
 	logger.Debugf("[%s] Creating Sidetree REST handlers [%s]", channelID, nsCfg.Namespace)
 
-	restHandlers := newRESTHandlers(channelID, nsCfg, dcasProvider, bw, ctx)
+	restHandlers, err := newRESTHandlers(channelID, nsCfg, roles, dcasProvider, bw, ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	return &context{
 		SidetreeContext: ctx,
@@ -88,3 +106,26 @@ func newSidetreeContext(channelID, namespace string, cfg config.SidetreeService,
 
 	return sidetreectx.New(channelID, namespace, protocolVersions, txnProvider, dcasProvider, opQueueProvider)
 }
+
+func configureOperationQueue(channelID, namespace string, ctx *sidetreectx.SidetreeContext, cfg config.SidetreeService) error {
+	q, ok := ctx.OperationQueue().(limitedOperationQueue)
+	if !ok {
+		logger.Debugf("[%s] The operation queue for [%s] doesn't support limits", channelID, namespace)
+		return nil
+	}
+
+	sidetreeCfg, err := cfg.LoadSidetree(namespace)
+	if err != nil {
+		return err
+	}
+
+	q.SetLimits(operationqueue.Limits{
+		MaxLength:          sidetreeCfg.OperationQueue.MaxLength,
+		MaxSize:            sidetreeCfg.OperationQueue.MaxSize,
+		MaxAge:             sidetreeCfg.OperationQueue.MaxAge,
+		DeadLetterExpired:  sidetreeCfg.OperationQueue.DeadLetterExpired,
+		HighPriorityWeight: sidetreeCfg.OperationQueue.HighPriorityWeight,
+	})
+
+	return nil
+}
@@ -14,7 +14,9 @@ import (
 	"github.com/stretchr/testify/require"
 
 	protocolApi "github.com/trustbloc/sidetree-core-go/pkg/api/protocol"
+	"github.com/trustbloc/sidetree-core-go/pkg/batch/opqueue"
 
+	"github.com/trustbloc/sidetree-fabric/pkg/context/operationqueue"
 	"github.com/trustbloc/sidetree-fabric/pkg/mocks"
 	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
 	peermocks "github.com/trustbloc/sidetree-fabric/pkg/peer/mocks"
@@ -46,7 +48,7 @@ func TestContext(t *testing.T) {
 		stConfigService := &peermocks.SidetreeConfigService{}
 		stConfigService.LoadProtocolsReturns(protocolVersions, nil)
 
-		ctx, err := newContext(channel1, nsCfg, stConfigService, txnProvider, dcasProvider, opQueueProvider)
+		ctx, err := newContext(channel1, nsCfg, nil, stConfigService, txnProvider, dcasProvider, opQueueProvider, "", nil)
 		require.NoError(t, err)
 		require.NotNil(t, ctx)
 
@@ -59,10 +61,51 @@ func TestContext(t *testing.T) {
 		ctx.Stop()
 	})
 
+	t.Run("Queue limits", func(t *testing.T) {
+		protocolVersions := map[string]protocolApi.Protocol{
+			"0.5": {
+				HashAlgorithmInMultiHashCode: 18,
+				MaxOperationsPerBatch:        100,
+				MaxOperationByteSize:         1000,
+			},
+		}
+
+		q := &limitedQueue{}
+		opQueueProvider := &mocks.OperationQueueProvider{}
+		opQueueProvider.CreateReturns(q, nil)
+
+		stConfigService := &peermocks.SidetreeConfigService{}
+		stConfigService.LoadProtocolsReturns(protocolVersions, nil)
+		stConfigService.LoadSidetreeReturns(config.Sidetree{
+			BatchWriterTimeout: time.Second,
+			OperationQueue: config.OperationQueue{
+				MaxLength:          100,
+				MaxSize:            1000,
+				MaxAge:             time.Hour,
+				DeadLetterExpired:  true,
+				HighPriorityWeight: 3,
+			},
+		}, nil)
+
+		ctx, err := newContext(channel1, nsCfg, nil, stConfigService, txnProvider, dcasProvider, opQueueProvider, "", nil)
+		require.NoError(t, err)
+		require.NotNil(t, ctx)
+		require.Equal(t, operationqueue.Limits{MaxLength: 100, MaxSize: 1000, MaxAge: time.Hour, DeadLetterExpired: true, HighPriorityWeight: 3}, q.limits)
+
+		t.Run("LoadSidetree error", func(t *testing.T) {
+			errExpected := errors.New("injected LoadSidetree error")
+			stConfigService.LoadSidetreeReturns(config.Sidetree{}, errExpected)
+
+			ctx, err := newContext(channel1, nsCfg, nil, stConfigService, txnProvider, dcasProvider, opQueueProvider, "", nil)
+			require.EqualError(t, err, errExpected.Error())
+			require.Nil(t, ctx)
+		})
+	})
+
 	t.Run("No protocols -> error", func(t *testing.T) {
 		stConfigService := &peermocks.SidetreeConfigService{}
 
-		ctx, err := newContext(channel1, nsCfg, stConfigService, txnProvider, dcasProvider, opQueueProvider)
+		ctx, err := newContext(channel1, nsCfg, nil, stConfigService, txnProvider, dcasProvider, opQueueProvider, "", nil)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "no protocols defined")
 		require.Nil(t, ctx)
@@ -73,8 +116,17 @@ func TestContext(t *testing.T) {
 		stConfigService := &peermocks.SidetreeConfigService{}
 		stConfigService.LoadProtocolsReturns(nil, errExpected)
 
-		ctx, err := newContext(channel1, nsCfg, stConfigService, txnProvider, dcasProvider, opQueueProvider)
+		ctx, err := newContext(channel1, nsCfg, nil, stConfigService, txnProvider, dcasProvider, opQueueProvider, "", nil)
 		require.EqualError(t, err, errExpected.Error())
 		require.Nil(t, ctx)
 	})
 }
+
+type limitedQueue struct {
+	opqueue.MemQueue
+	limits operationqueue.Limits
+}
+
+func (q *limitedQueue) SetLimits(limits operationqueue.Limits) {
+	q.limits = limits
+}
@@ -7,26 +7,77 @@ SPDX-License-Identifier: Apache-2.0
 package sidetreesvc
 
 import (
+	"github.com/pkg/errors"
+	"github.com/trustbloc/sidetree-core-go/pkg/restapi/common"
+
 	"github.com/trustbloc/sidetree-fabric/pkg/observer/monitor"
 	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
+	"github.com/trustbloc/sidetree-fabric/pkg/rest/monitorhandler"
 	"github.com/trustbloc/sidetree-fabric/pkg/role"
 )
 
 type monitorController struct {
-	channelID string
-	monitor   *monitor.Monitor
+	channelID    string
+	monitor      *monitor.Monitor
+	httpHandlers []common.HTTPHandler
 }
 
-func newMonitorController(channelID string, peerConfig peerConfig, monitorCfg config.Monitor, providers *monitor.ClientProviders) *monitorController {
+func newMonitorController(channelID string, roles role.Roles, peerConfig peerConfig, monitorCfg config.Monitor, providers *monitor.ClientProviders) (*monitorController, error) {
 	var m *monitor.Monitor
-	if role.IsMonitor() {
-		m = monitor.New(channelID, peerConfig.PeerID(), monitorCfg.Period, providers)
+	if roles.IsMonitor() {
+		opts := []monitor.Option{
+			monitor.WithDeadLetterRetryPeriod(monitorCfg.DeadLetterRetryPeriod),
+			monitor.WithParallelism(monitorCfg.Parallelism),
+			monitor.WithRetry(monitor.RetryConfig{
+				MaxAttempts:    monitorCfg.MaxBlockAttempts,
+				InitialBackoff: monitorCfg.RetryInitialBackoff,
+				MaxBackoff:     monitorCfg.RetryMaxBackoff,
+			}),
+			monitor.WithCircuitBreaker(monitorCfg.CircuitBreakerThreshold, monitorCfg.CircuitBreakerCooldown),
+		}
+
+		if monitorCfg.VerifyIntegrity {
+			opts = append(opts, monitor.WithIntegrityVerification())
+		}
+
+		m = monitor.New(channelID, peerConfig.PeerID(), monitorCfg.Period, providers, opts...)
 	}
 
-	return &monitorController{
-		channelID: channelID,
-		monitor:   m,
+	var handlers []common.HTTPHandler
+	if m != nil && monitorCfg.AdminEnabled {
+		if monitorCfg.AdminAuthorization.IsEmpty() {
+			return nil, errors.Errorf("the monitor admin endpoints are enabled for channel [%s] but no authorization rules are configured", channelID)
+		}
+
+		logger.Debugf("[%s] Adding monitor admin REST endpoints", channelID)
+
+		for _, h := range []common.HTTPHandler{
+			monitorhandler.NewResetHandler(channelID, m),
+			monitorhandler.NewRescanHandler(channelID, m),
+			monitorhandler.NewRescanStatusHandler(channelID, m),
+			monitorhandler.NewIntegrityReportHandler(channelID, m),
+			monitorhandler.NewDeadLettersHandler(channelID, m),
+			monitorhandler.NewRedriveHandler(channelID, m),
+		} {
+			handler, err := withAuthorization(h, monitorCfg.AdminAuthorization)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "invalid authorization for the monitor admin endpoints of channel [%s]", channelID)
+			}
+
+			handlers = append(handlers, handler)
+		}
 	}
+
+	return &monitorController{
+		channelID:    channelID,
+		monitor:      m,
+		httpHandlers: handlers,
+	}, nil
+}
+
+// HTTPHandlers returns the monitor admin HTTP handlers (if enabled)
+func (m *monitorController) HTTPHandlers() []common.HTTPHandler {
+	return m.httpHandlers
 }
 
 // Start starts the Sidetree monitor if it is set
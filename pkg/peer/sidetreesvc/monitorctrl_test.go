@@ -7,11 +7,14 @@ SPDX-License-Identifier: Apache-2.0
 package sidetreesvc
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 	extroles "github.com/trustbloc/fabric-peer-ext/pkg/roles"
+	"github.com/trustbloc/sidetree-fabric/pkg/httpserver"
 	"github.com/trustbloc/sidetree-fabric/pkg/observer/monitor"
 	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
 	"github.com/trustbloc/sidetree-fabric/pkg/peer/mocks"
@@ -45,14 +48,76 @@ func TestMonitorController(t *testing.T) {
 			extroles.SetRoles(nil)
 		}()
 
-		m := newMonitorController(channel1, peerCfg, monitorCfg, providers)
+		m, err := newMonitorController(channel1, nil, peerCfg, monitorCfg, providers)
+		require.NoError(t, err)
 		require.NotNil(t, m)
+		require.Empty(t, m.HTTPHandlers())
 
 		require.NoError(t, m.Start())
 		time.Sleep(100 * time.Millisecond)
 		m.Stop()
 	})
 
+	t.Run("Dedicated monitor is started", func(t *testing.T) {
+		rolesValue := make(map[extroles.Role]struct{})
+		rolesValue[extroles.CommitterRole] = struct{}{}
+		rolesValue[role.Monitor] = struct{}{}
+		extroles.SetRoles(rolesValue)
+		defer func() {
+			extroles.SetRoles(nil)
+		}()
+
+		require.False(t, role.IsResolver())
+
+		m, err := newMonitorController(channel1, nil, peerCfg, monitorCfg, providers)
+		require.NoError(t, err)
+		require.NotNil(t, m)
+		require.NotNil(t, m.monitor)
+
+		require.NoError(t, m.Start())
+		time.Sleep(100 * time.Millisecond)
+		m.Stop()
+	})
+
+	t.Run("Admin handlers", func(t *testing.T) {
+		rolesValue := make(map[extroles.Role]struct{})
+		rolesValue[extroles.CommitterRole] = struct{}{}
+		rolesValue[role.Resolver] = struct{}{}
+		extroles.SetRoles(rolesValue)
+		defer func() {
+			extroles.SetRoles(nil)
+		}()
+
+		adminAuthz := config.Authorization{TokenHashes: []string{httpserver.HashToken("token1")}}
+
+		m, err := newMonitorController(channel1, nil, peerCfg, config.Monitor{Period: time.Second, AdminEnabled: true, AdminAuthorization: adminAuthz, VerifyIntegrity: true}, providers)
+		require.NoError(t, err)
+		require.NotNil(t, m)
+		require.Len(t, m.HTTPHandlers(), 6)
+
+		for _, h := range m.HTTPHandlers() {
+			rw := httptest.NewRecorder()
+			h.Handler()(rw, httptest.NewRequest(h.Method(), h.Path(), nil))
+			require.Equal(t, http.StatusUnauthorized, rw.Code)
+		}
+
+		t.Run("No authorization rules -> error", func(t *testing.T) {
+			m, err := newMonitorController(channel1, nil, peerCfg, config.Monitor{Period: time.Second, AdminEnabled: true}, providers)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), "no authorization rules are configured")
+			require.Nil(t, m)
+		})
+
+		t.Run("Invalid authorization -> error", func(t *testing.T) {
+			invalidAuthz := config.Authorization{ClientCertSubjects: []string{"XX=invalid"}}
+
+			m, err := newMonitorController(channel1, nil, peerCfg, config.Monitor{Period: time.Second, AdminEnabled: true, AdminAuthorization: invalidAuthz}, providers)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), "invalid authorization for the monitor admin endpoints")
+			require.Nil(t, m)
+		})
+	})
+
 	t.Run("Monitor is not started", func(t *testing.T) {
 		rolesValue := make(map[extroles.Role]struct{})
 		rolesValue[extroles.EndorserRole] = struct{}{}
@@ -62,8 +127,10 @@ func TestMonitorController(t *testing.T) {
 			extroles.SetRoles(nil)
 		}()
 
-		m := newMonitorController(channel1, peerCfg, monitorCfg, providers)
+		m, err := newMonitorController(channel1, nil, peerCfg, config.Monitor{Period: time.Second, AdminEnabled: true}, providers)
+		require.NoError(t, err)
 		require.NotNil(t, m)
+		require.Empty(t, m.HTTPHandlers())
 
 		require.NoError(t, m.Start())
 		time.Sleep(100 * time.Millisecond)
@@ -16,11 +16,11 @@ type observerController struct {
 	observer  *observer.Observer
 }
 
-func newObserverController(channelID string, providers *observer.Providers) *observerController {
+func newObserverController(channelID string, roles role.Roles, peerConfig peerConfig, providers *observer.Providers) *observerController {
 	var o *observer.Observer
 
-	if role.IsObserver() {
-		o = observer.New(channelID, providers)
+	if roles.IsObserver() {
+		o = observer.New(channelID, peerConfig.PeerID(), providers)
 	}
 
 	return &observerController{
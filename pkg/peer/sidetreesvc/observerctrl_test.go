@@ -14,6 +14,7 @@ import (
 	extmocks "github.com/trustbloc/fabric-peer-ext/pkg/mocks"
 	extroles "github.com/trustbloc/fabric-peer-ext/pkg/roles"
 	"github.com/trustbloc/sidetree-fabric/pkg/observer"
+	"github.com/trustbloc/sidetree-fabric/pkg/peer/mocks"
 	"github.com/trustbloc/sidetree-fabric/pkg/role"
 )
 
@@ -24,6 +25,9 @@ func TestObserverController(t *testing.T) {
 		BlockPublisher: bp,
 	}
 
+	peerCfg := &mocks.PeerConfig{}
+	peerCfg.PeerIDReturns(peer1)
+
 	t.Run("Observer role", func(t *testing.T) {
 		rolesValue := make(map[extroles.Role]struct{})
 		rolesValue[role.Observer] = struct{}{}
@@ -32,7 +36,7 @@ func TestObserverController(t *testing.T) {
 			extroles.SetRoles(nil)
 		}()
 
-		o := newObserverController(channel1, providers)
+		o := newObserverController(channel1, nil, peerCfg, providers)
 		require.NotNil(t, o)
 
 		require.NoError(t, o.Start())
@@ -47,7 +51,7 @@ func TestObserverController(t *testing.T) {
 			extroles.SetRoles(nil)
 		}()
 
-		o := newObserverController(channel1, providers)
+		o := newObserverController(channel1, nil, peerCfg, providers)
 		require.NotNil(t, o)
 
 		require.NoError(t, o.Start())
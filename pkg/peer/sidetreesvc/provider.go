@@ -38,12 +38,17 @@ type peerConfig interface {
 	MSPID() string
 }
 
+type operationQueueConfig interface {
+	OperationQueueBackend() string
+}
+
 type dcasClientProvider interface {
 	ForChannel(channelID string) (dcas.DCAS, error)
 }
 
 type restConfig interface {
 	SidetreeListenURL() (string, error)
+	SidetreeTLS() config.TLS
 }
 
 type sidetreeConfigProvider interface {
@@ -52,6 +57,7 @@ type sidetreeConfigProvider interface {
 
 type operationQueueProvider interface {
 	Create(channelID string, namespace string) (cutter.OperationQueue, error)
+	Remove(channelID string, namespace string) error
 }
 
 type providers struct {
@@ -63,6 +69,7 @@ type providers struct {
 	ObserverProviders      *observer.Providers
 	MonitorProviders       *monitor.ClientProviders
 	OperationQueueProvider operationQueueProvider
+	OperationQueueConfig   operationQueueConfig
 }
 
 // Provider implements a Sidetree services provider which is responsible for managing Sidetree
@@ -18,6 +18,7 @@ import (
 	protocolApi "github.com/trustbloc/sidetree-core-go/pkg/api/protocol"
 	"github.com/trustbloc/sidetree-core-go/pkg/batch/opqueue"
 
+	opqmocks "github.com/trustbloc/sidetree-fabric/pkg/context/operationqueue/mocks"
 	"github.com/trustbloc/sidetree-fabric/pkg/mocks"
 	"github.com/trustbloc/sidetree-fabric/pkg/observer"
 	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
@@ -84,6 +85,7 @@ func TestProvider(t *testing.T) {
 		ObserverProviders:      observerProviders,
 		RESTConfig:             restConfig,
 		OperationQueueProvider: opQueueProvider,
+		OperationQueueConfig:   &opqmocks.PeerConfig{},
 	}
 
 	sidetreeCfgService2 := &peermocks.SidetreeConfigService{}
@@ -9,6 +9,7 @@ package sidetreesvc
 import (
 	reqctx "context"
 
+	"github.com/pkg/errors"
 	"github.com/trustbloc/sidetree-core-go/pkg/api/protocol"
 	"github.com/trustbloc/sidetree-core-go/pkg/dochandler"
 	"github.com/trustbloc/sidetree-core-go/pkg/dochandler/didvalidator"
@@ -19,6 +20,7 @@ import (
 	"github.com/trustbloc/sidetree-fabric/pkg/context/store"
 	"github.com/trustbloc/sidetree-fabric/pkg/httpserver"
 	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
+	fabricdiddochandler "github.com/trustbloc/sidetree-fabric/pkg/rest/diddochandler"
 	"github.com/trustbloc/sidetree-fabric/pkg/role"
 )
 
@@ -35,7 +37,19 @@ func newRESTService(cfg restConfig, handlers ...common.HTTPHandler) (*restServic
 
 	var httpServer *httpserver.Server
 	if len(handlers) > 0 {
-		httpServer = httpserver.New(listenURL, handlers...)
+		var opts []httpserver.Option
+
+		if tlsCfg := cfg.SidetreeTLS(); tlsCfg.Enabled {
+			opts = append(opts, httpserver.WithTLS(httpserver.TLSConfig{
+				CertFile:           tlsCfg.CertFile,
+				KeyFile:            tlsCfg.KeyFile,
+				ClientAuthRequired: tlsCfg.ClientAuthRequired,
+				ClientCAFiles:      tlsCfg.ClientRootCAFiles,
+				ReloadInterval:     tlsCfg.ReloadInterval,
+			}))
+		}
+
+		httpServer = httpserver.New(listenURL, handlers, opts...)
 	}
 
 	return &restService{
@@ -79,15 +93,16 @@ type protocolProvider interface {
 func newRESTHandlers(
 	channelID string,
 	cfg config.Namespace,
+	roles role.Roles,
 	dcasProvider dcasClientProvider,
 	batchWriter dochandler.BatchWriter,
-	protocolProvider protocolProvider) *restHandlers {
+	protocolProvider protocolProvider) (*restHandlers, error) {
 
-	if !role.IsResolver() && !role.IsBatchWriter() {
+	if !roles.IsResolver() && !roles.IsBatchWriter() {
 		return &restHandlers{
 			channelID: channelID,
 			namespace: cfg.Namespace,
-		}
+		}, nil
 	}
 
 	logger.Debugf("[%s] Creating document store for namespace [%s]", channelID, cfg.Namespace)
@@ -105,23 +120,33 @@ func newRESTHandlers(
 
 	var handlers []common.HTTPHandler
 
-	if role.IsResolver() {
+	if roles.IsResolver() {
 		logger.Debugf("Adding a Sidetree document resolver REST endpoint for namespace [%s].", cfg.Namespace)
 
-		handlers = append(handlers, diddochandler.NewResolveHandler(cfg.BasePath, didDocHandler))
+		handler, err := withAuthorization(diddochandler.NewResolveHandler(cfg.BasePath, didDocHandler), cfg.Authorization.Resolve)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "invalid authorization for the resolve endpoint of namespace [%s]", cfg.Namespace)
+		}
+
+		handlers = append(handlers, handler)
 	}
 
-	if role.IsBatchWriter() {
+	if roles.IsBatchWriter() {
 		logger.Debugf("Adding a Sidetree document update REST endpoint for namespace [%s].", cfg.Namespace)
 
-		handlers = append(handlers, diddochandler.NewUpdateHandler(cfg.BasePath, didDocHandler))
+		handler, err := withAuthorization(fabricdiddochandler.NewUpdateHandler(cfg.BasePath, didDocHandler), cfg.Authorization.Update)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "invalid authorization for the update endpoint of namespace [%s]", cfg.Namespace)
+		}
+
+		handlers = append(handlers, handler)
 	}
 
 	return &restHandlers{
 		channelID:    channelID,
 		namespace:    cfg.Namespace,
 		httpHandlers: handlers,
-	}
+	}, nil
 }
 
 // HTTPHandlers returns the HTTP handlers
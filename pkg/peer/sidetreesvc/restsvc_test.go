@@ -8,11 +8,14 @@ package sidetreesvc
 
 import (
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 	extroles "github.com/trustbloc/fabric-peer-ext/pkg/roles"
+	"github.com/trustbloc/sidetree-fabric/pkg/httpserver"
 	"github.com/trustbloc/sidetree-fabric/pkg/mocks"
 	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
 	peermocks "github.com/trustbloc/sidetree-fabric/pkg/peer/mocks"
@@ -45,6 +48,20 @@ func TestRESTService(t *testing.T) {
 		rs.Stop()
 	})
 
+	t.Run("TLS", func(t *testing.T) {
+		cfg := &peermocks.RestConfig{}
+		cfg.SidetreeListenURLReturns("localhost:7394", nil)
+		cfg.SidetreeTLSReturns(config.TLS{Enabled: true, CertFile: "./invalid/cert.pem", KeyFile: "./invalid/key.pem"})
+
+		rs, err := newRESTService(cfg, handler)
+		require.NoError(t, err)
+		require.NotNil(t, rs)
+
+		err = rs.Start()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid TLS configuration")
+	})
+
 	t.Run("No handlers", func(t *testing.T) {
 		rs, err := newRESTService(cfg)
 		require.NoError(t, err)
@@ -78,11 +95,27 @@ func TestRESTHandlers(t *testing.T) {
 			extroles.SetRoles(nil)
 		}()
 
-		rh := newRESTHandlers(channel1, nsCfg, dcasProvider, bw, pp)
+		rh, err := newRESTHandlers(channel1, nsCfg, nil, dcasProvider, bw, pp)
+		require.NoError(t, err)
 		require.NotNil(t, rh)
 		require.Len(t, rh.HTTPHandlers(), 2)
 	})
 
+	t.Run("Roles assigned in config -> batch-writer handler only", func(t *testing.T) {
+		rolesValue := make(map[extroles.Role]struct{})
+		rolesValue[role.Resolver] = struct{}{}
+		rolesValue[role.BatchWriter] = struct{}{}
+		extroles.SetRoles(rolesValue)
+		defer func() {
+			extroles.SetRoles(nil)
+		}()
+
+		rh, err := newRESTHandlers(channel1, nsCfg, role.Roles{role.BatchWriter}, dcasProvider, bw, pp)
+		require.NoError(t, err)
+		require.NotNil(t, rh)
+		require.Len(t, rh.HTTPHandlers(), 1)
+	})
+
 	t.Run("No resolver or batch-writer role -> no handlers", func(t *testing.T) {
 		rolesValue := make(map[extroles.Role]struct{})
 		rolesValue[role.Observer] = struct{}{}
@@ -91,8 +124,55 @@ func TestRESTHandlers(t *testing.T) {
 			extroles.SetRoles(nil)
 		}()
 
-		rh := newRESTHandlers(channel1, nsCfg, dcasProvider, bw, pp)
+		rh, err := newRESTHandlers(channel1, nsCfg, nil, dcasProvider, bw, pp)
+		require.NoError(t, err)
 		require.NotNil(t, rh)
 		require.Empty(t, rh.HTTPHandlers())
 	})
+
+	t.Run("Authorization", func(t *testing.T) {
+		nsCfg := config.Namespace{
+			BasePath: "/document",
+			Authorization: config.NamespaceAuthorization{
+				Update: config.Authorization{TokenHashes: []string{httpserver.HashToken("token1")}},
+			},
+		}
+
+		rh, err := newRESTHandlers(channel1, nsCfg, role.Roles{role.Resolver, role.BatchWriter}, dcasProvider, bw, pp)
+		require.NoError(t, err)
+		require.Len(t, rh.HTTPHandlers(), 2)
+
+		for _, h := range rh.HTTPHandlers() {
+			rw := httptest.NewRecorder()
+			h.Handler()(rw, httptest.NewRequest(h.Method(), nsCfg.BasePath, nil))
+
+			if h.Method() == http.MethodPost {
+				require.Equal(t, http.StatusUnauthorized, rw.Code)
+			} else {
+				require.NotEqual(t, http.StatusUnauthorized, rw.Code)
+			}
+		}
+	})
+
+	t.Run("Invalid authorization", func(t *testing.T) {
+		nsCfg := config.Namespace{
+			Authorization: config.NamespaceAuthorization{
+				Resolve: config.Authorization{ClientCertSubjects: []string{"XX=invalid"}},
+			},
+		}
+
+		_, err := newRESTHandlers(channel1, nsCfg, role.Roles{role.Resolver}, dcasProvider, bw, pp)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid authorization for the resolve endpoint")
+
+		nsCfg = config.Namespace{
+			Authorization: config.NamespaceAuthorization{
+				Update: config.Authorization{JWT: config.JWTAuthorization{PublicKeys: []string{"invalid"}}},
+			},
+		}
+
+		_, err = newRESTHandlers(channel1, nsCfg, role.Roles{role.BatchWriter}, dcasProvider, bw, pp)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid authorization for the update endpoint")
+	})
 }
@@ -0,0 +1,60 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sidetreesvc
+
+import (
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/monitor"
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/sweeper"
+	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
+	"github.com/trustbloc/sidetree-fabric/pkg/role"
+)
+
+type sweeperController struct {
+	channelID string
+	sweeper   *sweeper.Sweeper
+}
+
+func newSweeperController(channelID string, roles role.Roles, peerConfig peerConfig, sweeperCfg config.DCASSweeper, providers *monitor.ClientProviders) *sweeperController {
+	var s *sweeper.Sweeper
+	if roles.IsMonitor() {
+		s = sweeper.New(channelID, peerConfig.PeerID(),
+			sweeper.Config{
+				Period:      sweeperCfg.Period,
+				GracePeriod: sweeperCfg.GracePeriod,
+				Purge:       sweeperCfg.Purge,
+			},
+			&sweeper.ClientProviders{
+				OffLedger:  providers.OffLedger,
+				DCAS:       providers.DCAS,
+				Blockchain: providers.Blockchain,
+			},
+		)
+	}
+
+	return &sweeperController{
+		channelID: channelID,
+		sweeper:   s,
+	}
+}
+
+// Start starts the DCAS sweeper if it is set
+func (s *sweeperController) Start() error {
+	if s.sweeper != nil {
+		logger.Debugf("[%s] Starting DCAS sweeper ...", s.channelID)
+		return s.sweeper.Start()
+	}
+
+	return nil
+}
+
+// Stop stops the DCAS sweeper if it is set
+func (s *sweeperController) Stop() {
+	if s.sweeper != nil {
+		logger.Debugf("[%s] Stopping DCAS sweeper ...", s.channelID)
+		s.sweeper.Stop()
+	}
+}
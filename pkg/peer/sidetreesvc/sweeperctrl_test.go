@@ -0,0 +1,61 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sidetreesvc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	extroles "github.com/trustbloc/fabric-peer-ext/pkg/roles"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/monitor"
+	"github.com/trustbloc/sidetree-fabric/pkg/peer/config"
+	"github.com/trustbloc/sidetree-fabric/pkg/peer/mocks"
+	"github.com/trustbloc/sidetree-fabric/pkg/role"
+)
+
+func TestSweeperController(t *testing.T) {
+	peerCfg := &mocks.PeerConfig{}
+	peerCfg.PeerIDReturns(peer1)
+
+	sweeperCfg := config.DCASSweeper{Period: time.Second, GracePeriod: time.Minute}
+	providers := &monitor.ClientProviders{}
+
+	t.Run("Sweeper is started", func(t *testing.T) {
+		rolesValue := make(map[extroles.Role]struct{})
+		rolesValue[extroles.CommitterRole] = struct{}{}
+		rolesValue[role.Resolver] = struct{}{}
+		extroles.SetRoles(rolesValue)
+		defer func() {
+			extroles.SetRoles(nil)
+		}()
+
+		s := newSweeperController(channel1, nil, peerCfg, sweeperCfg, providers)
+		require.NotNil(t, s)
+		require.NotNil(t, s.sweeper)
+		require.NoError(t, s.Start())
+		time.Sleep(100 * time.Millisecond)
+		s.Stop()
+	})
+
+	t.Run("Sweeper is not started", func(t *testing.T) {
+		rolesValue := make(map[extroles.Role]struct{})
+		rolesValue[extroles.EndorserRole] = struct{}{}
+		rolesValue[role.Resolver] = struct{}{}
+		extroles.SetRoles(rolesValue)
+		defer func() {
+			extroles.SetRoles(nil)
+		}()
+
+		s := newSweeperController(channel1, nil, peerCfg, sweeperCfg, providers)
+		require.NotNil(t, s)
+		require.Nil(t, s.sweeper)
+		require.NoError(t, s.Start())
+		s.Stop()
+	})
+}
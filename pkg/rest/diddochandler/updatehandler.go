@@ -0,0 +1,115 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package diddochandler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/pkg/errors"
+	"github.com/trustbloc/sidetree-core-go/pkg/api/batch"
+	"github.com/trustbloc/sidetree-core-go/pkg/document"
+	"github.com/trustbloc/sidetree-core-go/pkg/restapi/common"
+	sidetreehandler "github.com/trustbloc/sidetree-core-go/pkg/restapi/diddochandler"
+	"github.com/trustbloc/sidetree-core-go/pkg/restapi/dochandler"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/context/operationqueue"
+)
+
+var logger = flogging.MustGetLogger("sidetree_rest")
+
+// retryAfter is the value of the Retry-After header that is returned along with a Service Unavailable status
+const retryAfter = 5 * time.Second
+
+// statusCodes maps the errors returned by the document processor to HTTP status codes.
+// All other errors result in an internal server error.
+var statusCodes = map[error]int{
+	operationqueue.ErrDuplicateOperation:   http.StatusConflict,
+	operationqueue.ErrConflictingOperation: http.StatusConflict,
+	operationqueue.ErrQueueFull:            http.StatusServiceUnavailable,
+}
+
+// UpdateHandler handles the creation and update of DID documents. It wraps the Sidetree update handler
+// and responds with the appropriate HTTP status code for errors that are caused by the client
+// (for example, submitting an operation for a DID that already has an operation pending).
+type UpdateHandler struct {
+	basePath  string
+	processor dochandler.Processor
+}
+
+// NewUpdateHandler returns a new DID document update handler
+func NewUpdateHandler(basePath string, processor dochandler.Processor) *UpdateHandler {
+	return &UpdateHandler{
+		basePath:  basePath,
+		processor: processor,
+	}
+}
+
+// Path returns the context path
+func (h *UpdateHandler) Path() string {
+	return h.basePath
+}
+
+// Method returns the HTTP method
+func (h *UpdateHandler) Method() string {
+	return http.MethodPost
+}
+
+// Handler returns the handler
+func (h *UpdateHandler) Handler() common.HTTPRequestHandler {
+	return h.update
+}
+
+func (h *UpdateHandler) update(rw http.ResponseWriter, req *http.Request) {
+	// The processor and response writer are created per request so that the
+	// error returned by the processor may be correlated with the response
+	p := &errorCapturingProcessor{Processor: h.processor}
+
+	sidetreehandler.NewUpdateHandler(h.basePath, p).Update(
+		&statusMappingWriter{ResponseWriter: rw, processor: p}, req,
+	)
+}
+
+// errorCapturingProcessor records the error returned by the underlying processor
+type errorCapturingProcessor struct {
+	dochandler.Processor
+	err error
+}
+
+// ProcessOperation processes the operation and records the error (if any)
+func (p *errorCapturingProcessor) ProcessOperation(operation *batch.Operation) (document.Document, error) {
+	doc, err := p.Processor.ProcessOperation(operation)
+	p.err = err
+
+	return doc, err
+}
+
+// statusMappingWriter replaces the internal server error status code with the
+// status code that corresponds to the error returned by the processor
+type statusMappingWriter struct {
+	http.ResponseWriter
+	processor *errorCapturingProcessor
+}
+
+// WriteHeader writes the (possibly mapped) status code
+func (w *statusMappingWriter) WriteHeader(statusCode int) {
+	if statusCode == http.StatusInternalServerError && w.processor.err != nil {
+		if mapped, ok := statusCodes[errors.Cause(w.processor.err)]; ok {
+			logger.Debugf("Responding with status %d for error: %s", mapped, w.processor.err)
+
+			statusCode = mapped
+		}
+
+		if statusCode == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
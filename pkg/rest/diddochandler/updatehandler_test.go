@@ -0,0 +1,107 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package diddochandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/sidetree-core-go/pkg/docutil"
+	"github.com/trustbloc/sidetree-core-go/pkg/mocks"
+	"github.com/trustbloc/sidetree-core-go/pkg/restapi/model"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/context/operationqueue"
+)
+
+const (
+	namespace = "did:sidetree"
+	basePath  = "/document"
+)
+
+func TestUpdateHandler(t *testing.T) {
+	h := NewUpdateHandler(basePath, mocks.NewMockDocumentHandler().WithNamespace(namespace))
+	require.Equal(t, basePath, h.Path())
+	require.Equal(t, http.MethodPost, h.Method())
+	require.NotNil(t, h.Handler())
+
+	t.Run("Success", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, newDeleteRequest(t))
+		require.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("Bad request", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, httptest.NewRequest(http.MethodPost, basePath, bytes.NewReader([]byte("{"))))
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+}
+
+func TestUpdateHandler_Error(t *testing.T) {
+	t.Run("Duplicate operation", func(t *testing.T) {
+		processor := mocks.NewMockDocumentHandler().WithNamespace(namespace).
+			WithError(errors.WithMessage(operationqueue.ErrDuplicateOperation, "unique suffix [abc]"))
+
+		rw := httptest.NewRecorder()
+		NewUpdateHandler(basePath, processor).Handler()(rw, newDeleteRequest(t))
+		require.Equal(t, http.StatusConflict, rw.Code)
+		require.Contains(t, rw.Body.String(), operationqueue.ErrDuplicateOperation.Error())
+	})
+
+	t.Run("Conflicting operation", func(t *testing.T) {
+		processor := mocks.NewMockDocumentHandler().WithNamespace(namespace).
+			WithError(errors.WithMessage(operationqueue.ErrConflictingOperation, "unique suffix [abc]"))
+
+		rw := httptest.NewRecorder()
+		NewUpdateHandler(basePath, processor).Handler()(rw, newDeleteRequest(t))
+		require.Equal(t, http.StatusConflict, rw.Code)
+		require.Contains(t, rw.Body.String(), operationqueue.ErrConflictingOperation.Error())
+	})
+
+	t.Run("Queue full", func(t *testing.T) {
+		processor := mocks.NewMockDocumentHandler().WithNamespace(namespace).
+			WithError(errors.WithMessage(operationqueue.ErrQueueFull, "maximum length of 10 reached"))
+
+		rw := httptest.NewRecorder()
+		NewUpdateHandler(basePath, processor).Handler()(rw, newDeleteRequest(t))
+		require.Equal(t, http.StatusServiceUnavailable, rw.Code)
+		require.Equal(t, "5", rw.Header().Get("Retry-After"))
+		require.Contains(t, rw.Body.String(), operationqueue.ErrQueueFull.Error())
+	})
+
+	t.Run("Other error", func(t *testing.T) {
+		processor := mocks.NewMockDocumentHandler().WithNamespace(namespace).
+			WithError(errors.New("injected processor error"))
+
+		rw := httptest.NewRecorder()
+		NewUpdateHandler(basePath, processor).Handler()(rw, newDeleteRequest(t))
+		require.Equal(t, http.StatusInternalServerError, rw.Code)
+		require.Contains(t, rw.Body.String(), "injected processor error")
+	})
+}
+
+func newDeleteRequest(t *testing.T) *http.Request {
+	payload, err := json.Marshal(&model.DeletePayloadSchema{
+		Operation:       model.OperationTypeDelete,
+		DidUniqueSuffix: "abc",
+	})
+	require.NoError(t, err)
+
+	req, err := json.Marshal(&model.Request{
+		Protected: &model.Header{Alg: "alg", Kid: "kid"},
+		Payload:   docutil.EncodeToString(payload),
+		Signature: "signature",
+	})
+	require.NoError(t, err)
+
+	return httptest.NewRequest(http.MethodPost, basePath, bytes.NewReader(req))
+}
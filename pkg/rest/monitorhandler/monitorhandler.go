@@ -0,0 +1,318 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package monitorhandler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/pkg/errors"
+	"github.com/trustbloc/sidetree-core-go/pkg/restapi/common"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/monitor"
+)
+
+var logger = flogging.MustGetLogger("sidetree_rest")
+
+// Monitor defines the monitor operations that are exposed by the handlers
+type Monitor interface {
+	Reset(lastBlockProcessed uint64) error
+	Rescan(from, to uint64) error
+	RescanStatus() *monitor.RescanStatus
+	IntegrityReport() *monitor.IntegrityReport
+	DeadLetters() ([]*monitor.DeadLetter, error)
+	Redrive(blockNum, txNum uint64) error
+}
+
+// ResetRequest is the body of a request to reset the monitor's last block processed
+type ResetRequest struct {
+	LastBlockProcessed uint64 `json:"lastBlockProcessed"`
+}
+
+// RescanRequest is the body of a request to rescan a range of blocks (inclusive)
+type RescanRequest struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
+// RedriveRequest is the body of a request to re-drive a dead-lettered anchor
+type RedriveRequest struct {
+	BlockNum uint64 `json:"blockNum"`
+	TxNum    uint64 `json:"txNum"`
+}
+
+// statusCodes maps the errors returned by the monitor to HTTP status codes.
+// All other errors result in an internal server error.
+var statusCodes = map[error]int{
+	monitor.ErrInvalidBlockRange:  http.StatusBadRequest,
+	monitor.ErrRescanInProgress:   http.StatusConflict,
+	monitor.ErrDeadLetterNotFound: http.StatusNotFound,
+}
+
+// BasePath returns the base path of the monitor handlers for the given channel
+func BasePath(channelID string) string {
+	return "/monitor/" + channelID
+}
+
+// ResetHandler resets the last block processed by the monitor so that the monitor re-verifies the blocks after it
+type ResetHandler struct {
+	path    string
+	monitor Monitor
+}
+
+// NewResetHandler returns a new reset handler
+func NewResetHandler(channelID string, m Monitor) *ResetHandler {
+	return &ResetHandler{
+		path:    BasePath(channelID) + "/reset",
+		monitor: m,
+	}
+}
+
+// Path returns the context path
+func (h *ResetHandler) Path() string {
+	return h.path
+}
+
+// Method returns the HTTP method
+func (h *ResetHandler) Method() string {
+	return http.MethodPost
+}
+
+// Handler returns the handler
+func (h *ResetHandler) Handler() common.HTTPRequestHandler {
+	return h.reset
+}
+
+func (h *ResetHandler) reset(rw http.ResponseWriter, req *http.Request) {
+	request := &ResetRequest{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		common.WriteError(rw, http.StatusBadRequest, errors.WithMessage(err, "invalid reset request"))
+		return
+	}
+
+	if err := h.monitor.Reset(request.LastBlockProcessed); err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+}
+
+// RescanHandler starts a one-off rescan of a range of blocks
+type RescanHandler struct {
+	path    string
+	monitor Monitor
+}
+
+// NewRescanHandler returns a new rescan handler
+func NewRescanHandler(channelID string, m Monitor) *RescanHandler {
+	return &RescanHandler{
+		path:    BasePath(channelID) + "/rescan",
+		monitor: m,
+	}
+}
+
+// Path returns the context path
+func (h *RescanHandler) Path() string {
+	return h.path
+}
+
+// Method returns the HTTP method
+func (h *RescanHandler) Method() string {
+	return http.MethodPost
+}
+
+// Handler returns the handler
+func (h *RescanHandler) Handler() common.HTTPRequestHandler {
+	return h.rescan
+}
+
+func (h *RescanHandler) rescan(rw http.ResponseWriter, req *http.Request) {
+	request := &RescanRequest{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		common.WriteError(rw, http.StatusBadRequest, errors.WithMessage(err, "invalid rescan request"))
+		return
+	}
+
+	if err := h.monitor.Rescan(request.From, request.To); err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+// RescanStatusHandler returns the status of the current (or last) rescan
+type RescanStatusHandler struct {
+	path    string
+	monitor Monitor
+}
+
+// NewRescanStatusHandler returns a new rescan status handler
+func NewRescanStatusHandler(channelID string, m Monitor) *RescanStatusHandler {
+	return &RescanStatusHandler{
+		path:    BasePath(channelID) + "/rescan",
+		monitor: m,
+	}
+}
+
+// Path returns the context path
+func (h *RescanStatusHandler) Path() string {
+	return h.path
+}
+
+// Method returns the HTTP method
+func (h *RescanStatusHandler) Method() string {
+	return http.MethodGet
+}
+
+// Handler returns the handler
+func (h *RescanStatusHandler) Handler() common.HTTPRequestHandler {
+	return h.status
+}
+
+func (h *RescanStatusHandler) status(rw http.ResponseWriter, _ *http.Request) {
+	status := h.monitor.RescanStatus()
+	if status == nil {
+		common.WriteError(rw, http.StatusNotFound, errors.New("no rescan has been requested"))
+		return
+	}
+
+	common.WriteResponse(rw, http.StatusOK, status)
+}
+
+// IntegrityReportHandler returns the integrity report of the operations in the document store
+type IntegrityReportHandler struct {
+	path    string
+	monitor Monitor
+}
+
+// NewIntegrityReportHandler returns a new integrity report handler
+func NewIntegrityReportHandler(channelID string, m Monitor) *IntegrityReportHandler {
+	return &IntegrityReportHandler{
+		path:    BasePath(channelID) + "/integrity",
+		monitor: m,
+	}
+}
+
+// Path returns the context path
+func (h *IntegrityReportHandler) Path() string {
+	return h.path
+}
+
+// Method returns the HTTP method
+func (h *IntegrityReportHandler) Method() string {
+	return http.MethodGet
+}
+
+// Handler returns the handler
+func (h *IntegrityReportHandler) Handler() common.HTTPRequestHandler {
+	return h.report
+}
+
+func (h *IntegrityReportHandler) report(rw http.ResponseWriter, _ *http.Request) {
+	common.WriteResponse(rw, http.StatusOK, h.monitor.IntegrityReport())
+}
+
+// DeadLettersHandler returns the anchors that the monitor was unable to process
+type DeadLettersHandler struct {
+	path    string
+	monitor Monitor
+}
+
+// NewDeadLettersHandler returns a new dead letters handler
+func NewDeadLettersHandler(channelID string, m Monitor) *DeadLettersHandler {
+	return &DeadLettersHandler{
+		path:    BasePath(channelID) + "/deadletters",
+		monitor: m,
+	}
+}
+
+// Path returns the context path
+func (h *DeadLettersHandler) Path() string {
+	return h.path
+}
+
+// Method returns the HTTP method
+func (h *DeadLettersHandler) Method() string {
+	return http.MethodGet
+}
+
+// Handler returns the handler
+func (h *DeadLettersHandler) Handler() common.HTTPRequestHandler {
+	return h.list
+}
+
+func (h *DeadLettersHandler) list(rw http.ResponseWriter, _ *http.Request) {
+	dls, err := h.monitor.DeadLetters()
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	if dls == nil {
+		dls = []*monitor.DeadLetter{}
+	}
+
+	common.WriteResponse(rw, http.StatusOK, dls)
+}
+
+// RedriveHandler re-drives a dead-lettered anchor
+type RedriveHandler struct {
+	path    string
+	monitor Monitor
+}
+
+// NewRedriveHandler returns a new re-drive handler
+func NewRedriveHandler(channelID string, m Monitor) *RedriveHandler {
+	return &RedriveHandler{
+		path:    BasePath(channelID) + "/deadletters/redrive",
+		monitor: m,
+	}
+}
+
+// Path returns the context path
+func (h *RedriveHandler) Path() string {
+	return h.path
+}
+
+// Method returns the HTTP method
+func (h *RedriveHandler) Method() string {
+	return http.MethodPost
+}
+
+// Handler returns the handler
+func (h *RedriveHandler) Handler() common.HTTPRequestHandler {
+	return h.redrive
+}
+
+func (h *RedriveHandler) redrive(rw http.ResponseWriter, req *http.Request) {
+	request := &RedriveRequest{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		common.WriteError(rw, http.StatusBadRequest, errors.WithMessage(err, "invalid re-drive request"))
+		return
+	}
+
+	if err := h.monitor.Redrive(request.BlockNum, request.TxNum); err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+}
+
+func writeError(rw http.ResponseWriter, err error) {
+	status, ok := statusCodes[errors.Cause(err)]
+	if !ok {
+		logger.Errorf("Monitor request failed: %s", err)
+
+		status = http.StatusInternalServerError
+	}
+
+	common.WriteError(rw, status, err)
+}
@@ -0,0 +1,270 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package monitorhandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/sidetree-fabric/pkg/observer/monitor"
+)
+
+const channel1 = "channel1"
+
+func TestResetHandler(t *testing.T) {
+	m := &mockMonitor{}
+
+	h := NewResetHandler(channel1, m)
+	require.Equal(t, "/monitor/channel1/reset", h.Path())
+	require.Equal(t, http.MethodPost, h.Method())
+	require.NotNil(t, h.Handler())
+
+	t.Run("Success", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, newRequest(t, h.Path(), &ResetRequest{LastBlockProcessed: 100}))
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Equal(t, uint64(100), m.lastBlockProcessed)
+	})
+
+	t.Run("Bad request", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, httptest.NewRequest(http.MethodPost, h.Path(), bytes.NewReader([]byte("{"))))
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("Invalid block", func(t *testing.T) {
+		m.err = errors.WithMessage(monitor.ErrInvalidBlockRange, "block [100] is too high")
+		defer func() { m.err = nil }()
+
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, newRequest(t, h.Path(), &ResetRequest{LastBlockProcessed: 100}))
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+		require.Contains(t, rw.Body.String(), monitor.ErrInvalidBlockRange.Error())
+	})
+
+	t.Run("Server error", func(t *testing.T) {
+		m.err = errors.New("injected monitor error")
+		defer func() { m.err = nil }()
+
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, newRequest(t, h.Path(), &ResetRequest{LastBlockProcessed: 100}))
+		require.Equal(t, http.StatusInternalServerError, rw.Code)
+	})
+}
+
+func TestRescanHandler(t *testing.T) {
+	m := &mockMonitor{}
+
+	h := NewRescanHandler(channel1, m)
+	require.Equal(t, "/monitor/channel1/rescan", h.Path())
+	require.Equal(t, http.MethodPost, h.Method())
+	require.NotNil(t, h.Handler())
+
+	t.Run("Success", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, newRequest(t, h.Path(), &RescanRequest{From: 10, To: 20}))
+		require.Equal(t, http.StatusAccepted, rw.Code)
+		require.Equal(t, uint64(10), m.from)
+		require.Equal(t, uint64(20), m.to)
+	})
+
+	t.Run("Bad request", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, httptest.NewRequest(http.MethodPost, h.Path(), bytes.NewReader([]byte("{"))))
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("In progress", func(t *testing.T) {
+		m.err = monitor.ErrRescanInProgress
+		defer func() { m.err = nil }()
+
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, newRequest(t, h.Path(), &RescanRequest{From: 10, To: 20}))
+		require.Equal(t, http.StatusConflict, rw.Code)
+	})
+}
+
+func TestRescanStatusHandler(t *testing.T) {
+	m := &mockMonitor{}
+
+	h := NewRescanStatusHandler(channel1, m)
+	require.Equal(t, "/monitor/channel1/rescan", h.Path())
+	require.Equal(t, http.MethodGet, h.Method())
+	require.NotNil(t, h.Handler())
+
+	t.Run("Not found", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, httptest.NewRequest(http.MethodGet, h.Path(), nil))
+		require.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		m.status = &monitor.RescanStatus{From: 10, To: 20, LastBlockScanned: 15, InProgress: true}
+
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, httptest.NewRequest(http.MethodGet, h.Path(), nil))
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		status := &monitor.RescanStatus{}
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), status))
+		require.Equal(t, m.status, status)
+	})
+}
+
+func TestIntegrityReportHandler(t *testing.T) {
+	m := &mockMonitor{
+		report: &monitor.IntegrityReport{ChannelID: channel1, Enabled: true, Verified: 10, Mismatched: 1, Repaired: 1},
+	}
+
+	h := NewIntegrityReportHandler(channel1, m)
+	require.Equal(t, "/monitor/channel1/integrity", h.Path())
+	require.Equal(t, http.MethodGet, h.Method())
+	require.NotNil(t, h.Handler())
+
+	rw := httptest.NewRecorder()
+	h.Handler()(rw, httptest.NewRequest(http.MethodGet, h.Path(), nil))
+	require.Equal(t, http.StatusOK, rw.Code)
+
+	report := &monitor.IntegrityReport{}
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), report))
+	require.Equal(t, m.report, report)
+}
+
+func TestDeadLettersHandler(t *testing.T) {
+	m := &mockMonitor{}
+
+	h := NewDeadLettersHandler(channel1, m)
+	require.Equal(t, "/monitor/channel1/deadletters", h.Path())
+	require.Equal(t, http.MethodGet, h.Method())
+	require.NotNil(t, h.Handler())
+
+	t.Run("Empty", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, httptest.NewRequest(http.MethodGet, h.Path(), nil))
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Equal(t, "[]", strings.TrimSpace(rw.Body.String()))
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		m.deadLetters = []*monitor.DeadLetter{{BlockNum: 1001, TxNum: 1, AnchorAddress: "anchor1", Error: "not found", Attempts: 3}}
+		defer func() { m.deadLetters = nil }()
+
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, httptest.NewRequest(http.MethodGet, h.Path(), nil))
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		var dls []*monitor.DeadLetter
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &dls))
+		require.Equal(t, m.deadLetters, dls)
+	})
+
+	t.Run("Server error", func(t *testing.T) {
+		m.err = errors.New("injected monitor error")
+		defer func() { m.err = nil }()
+
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, httptest.NewRequest(http.MethodGet, h.Path(), nil))
+		require.Equal(t, http.StatusInternalServerError, rw.Code)
+	})
+}
+
+func TestRedriveHandler(t *testing.T) {
+	m := &mockMonitor{}
+
+	h := NewRedriveHandler(channel1, m)
+	require.Equal(t, "/monitor/channel1/deadletters/redrive", h.Path())
+	require.Equal(t, http.MethodPost, h.Method())
+	require.NotNil(t, h.Handler())
+
+	t.Run("Success", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, newRequest(t, h.Path(), &RedriveRequest{BlockNum: 1001, TxNum: 2}))
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Equal(t, uint64(1001), m.blockNum)
+		require.Equal(t, uint64(2), m.txNum)
+	})
+
+	t.Run("Bad request", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, httptest.NewRequest(http.MethodPost, h.Path(), bytes.NewReader([]byte("{"))))
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		m.err = monitor.ErrDeadLetterNotFound
+		defer func() { m.err = nil }()
+
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, newRequest(t, h.Path(), &RedriveRequest{BlockNum: 1001, TxNum: 2}))
+		require.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run("Anchor still fails", func(t *testing.T) {
+		m.err = errors.New("content not found")
+		defer func() { m.err = nil }()
+
+		rw := httptest.NewRecorder()
+		h.Handler()(rw, newRequest(t, h.Path(), &RedriveRequest{BlockNum: 1001, TxNum: 2}))
+		require.Equal(t, http.StatusInternalServerError, rw.Code)
+		require.Contains(t, rw.Body.String(), "content not found")
+	})
+}
+
+func newRequest(t *testing.T, path string, request interface{}) *http.Request {
+	reqBytes, err := json.Marshal(request)
+	require.NoError(t, err)
+
+	return httptest.NewRequest(http.MethodPost, path, bytes.NewReader(reqBytes))
+}
+
+type mockMonitor struct {
+	lastBlockProcessed uint64
+	from               uint64
+	to                 uint64
+	status             *monitor.RescanStatus
+	report             *monitor.IntegrityReport
+	deadLetters        []*monitor.DeadLetter
+	blockNum           uint64
+	txNum              uint64
+	err                error
+}
+
+func (m *mockMonitor) Reset(lastBlockProcessed uint64) error {
+	m.lastBlockProcessed = lastBlockProcessed
+	return m.err
+}
+
+func (m *mockMonitor) Rescan(from, to uint64) error {
+	m.from = from
+	m.to = to
+	return m.err
+}
+
+func (m *mockMonitor) RescanStatus() *monitor.RescanStatus {
+	return m.status
+}
+
+func (m *mockMonitor) IntegrityReport() *monitor.IntegrityReport {
+	return m.report
+}
+
+func (m *mockMonitor) DeadLetters() ([]*monitor.DeadLetter, error) {
+	return m.deadLetters, m.err
+}
+
+func (m *mockMonitor) Redrive(blockNum, txNum uint64) error {
+	m.blockNum = blockNum
+	m.txNum = txNum
+	return m.err
+}
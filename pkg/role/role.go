@@ -7,6 +7,9 @@ SPDX-License-Identifier: Apache-2.0
 package role
 
 import (
+	"strings"
+
+	viper "github.com/spf13/viper2015"
 	"github.com/trustbloc/fabric-peer-ext/pkg/roles"
 )
 
@@ -19,6 +22,16 @@ const (
 
 	// Resolver indicates that this node exposes a REST API to resolve documents from the document operation store
 	Resolver = "sidetree-resolver"
+
+	// Monitor indicates that this node periodically ensures that the document operation store contains all of
+	// the operations that were anchored to the ledger (and runs the other periodic maintenance tasks)
+	Monitor = "sidetree-monitor"
+)
+
+const (
+	// inferMonitorKey is the peer config key that indicates whether the Monitor role is inferred from the
+	// Resolver and Committer roles when the Monitor role isn't set. Defaults to true.
+	inferMonitorKey = "sidetree.roles.inferMonitor"
 )
 
 // IsObserver returns true if this node has the Observer role
@@ -26,9 +39,15 @@ func IsObserver() bool {
 	return roles.HasRole(Observer)
 }
 
-// IsMonitor returns true if this node has the Resolver and the Committer roles
+// IsMonitor returns true if this node has the Monitor role. If the Monitor role isn't set then, for backward
+// compatibility, true is returned if this node has the Resolver and the Committer roles - unless this inference
+// is disabled in the peer config (sidetree.roles.inferMonitor=false).
 func IsMonitor() bool {
-	return IsResolver() && roles.IsCommitter()
+	if roles.HasRole(Monitor) {
+		return true
+	}
+
+	return inferMonitor() && IsResolver() && roles.IsCommitter()
 }
 
 // IsResolver returns true if this node has the Resolver role
@@ -40,3 +59,92 @@ func IsResolver() bool {
 func IsBatchWriter() bool {
 	return roles.HasRole(BatchWriter)
 }
+
+func inferMonitor() bool {
+	if !viper.IsSet(inferMonitorKey) {
+		return true
+	}
+
+	return viper.GetBool(inferMonitorKey)
+}
+
+// Roles contains the Sidetree roles that are assigned to the peer in the Sidetree ledger config (for a channel
+// or for a namespace). If no roles are assigned then the roles from the peer's static config apply.
+type Roles []string
+
+// Or returns these roles if any are assigned, otherwise the given roles are returned
+func (r Roles) Or(roles Roles) Roles {
+	if len(r) > 0 {
+		return r
+	}
+
+	return roles
+}
+
+// IsObserver returns true if the Observer role is assigned
+func (r Roles) IsObserver() bool {
+	if len(r) == 0 {
+		return IsObserver()
+	}
+
+	return r.contains(Observer)
+}
+
+// IsMonitor returns true if the Monitor role is assigned. If the Monitor role isn't assigned then the role is
+// inferred from the Resolver role and the peer's Committer role (as with IsMonitor).
+func (r Roles) IsMonitor() bool {
+	if len(r) == 0 {
+		return IsMonitor()
+	}
+
+	if r.contains(Monitor) {
+		return true
+	}
+
+	return inferMonitor() && r.contains(Resolver) && roles.IsCommitter()
+}
+
+// IsResolver returns true if the Resolver role is assigned
+func (r Roles) IsResolver() bool {
+	if len(r) == 0 {
+		return IsResolver()
+	}
+
+	return r.contains(Resolver)
+}
+
+// IsBatchWriter returns true if the Batch-Writer role is assigned
+func (r Roles) IsBatchWriter() bool {
+	if len(r) == 0 {
+		return IsBatchWriter()
+	}
+
+	return r.contains(BatchWriter)
+}
+
+// Equals returns true if the given roles contain the same roles as these roles (in any order)
+func (r Roles) Equals(roles Roles) bool {
+	for _, role := range r {
+		if !roles.contains(role) {
+			return false
+		}
+	}
+
+	for _, role := range roles {
+		if !r.contains(role) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r Roles) contains(role string) bool {
+	for _, rl := range r {
+		if strings.EqualFold(rl, role) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -9,6 +9,7 @@ package role
 import (
 	"testing"
 
+	viper "github.com/spf13/viper2015"
 	"github.com/stretchr/testify/require"
 	extroles "github.com/trustbloc/fabric-peer-ext/pkg/roles"
 )
@@ -25,10 +26,34 @@ func TestIsBatchWriter(t *testing.T) {
 func TestIsMonitor(t *testing.T) {
 	require.False(t, IsMonitor())
 
-	restore := setRoles(extroles.CommitterRole, Resolver)
-	defer restore()
+	t.Run("Inferred", func(t *testing.T) {
+		restore := setRoles(extroles.CommitterRole, Resolver)
+		defer restore()
+
+		require.True(t, IsMonitor())
+	})
+
+	t.Run("Inference disabled", func(t *testing.T) {
+		viper.Set(inferMonitorKey, false)
+		defer viper.Set(inferMonitorKey, nil)
+
+		restore := setRoles(extroles.CommitterRole, Resolver)
+		defer restore()
+
+		require.False(t, IsMonitor())
+		require.True(t, IsResolver())
+	})
 
-	require.True(t, IsMonitor())
+	t.Run("Explicit", func(t *testing.T) {
+		viper.Set(inferMonitorKey, false)
+		defer viper.Set(inferMonitorKey, nil)
+
+		restore := setRoles(extroles.CommitterRole, Monitor)
+		defer restore()
+
+		require.True(t, IsMonitor())
+		require.False(t, IsResolver())
+	})
 }
 
 func TestIsObserver(t *testing.T) {
@@ -40,6 +65,55 @@ func TestIsObserver(t *testing.T) {
 	require.True(t, IsObserver())
 }
 
+func TestRoles(t *testing.T) {
+	t.Run("Not assigned", func(t *testing.T) {
+		restore := setRoles(extroles.CommitterRole, BatchWriter, Resolver, Observer)
+		defer restore()
+
+		var r Roles
+
+		require.True(t, r.IsBatchWriter())
+		require.True(t, r.IsResolver())
+		require.True(t, r.IsObserver())
+		require.True(t, r.IsMonitor())
+	})
+
+	t.Run("Assigned", func(t *testing.T) {
+		restore := setRoles(extroles.CommitterRole, BatchWriter, Resolver, Observer)
+		defer restore()
+
+		r := Roles{"Sidetree-Batch-Writer"}
+
+		require.True(t, r.IsBatchWriter())
+		require.False(t, r.IsResolver())
+		require.False(t, r.IsObserver())
+		require.False(t, r.IsMonitor())
+
+		r = Roles{Resolver}
+		require.True(t, r.IsResolver())
+		require.True(t, r.IsMonitor())
+
+		viper.Set(inferMonitorKey, false)
+		defer viper.Set(inferMonitorKey, nil)
+
+		require.False(t, r.IsMonitor())
+		require.True(t, Roles{Resolver, Monitor}.IsMonitor())
+	})
+
+	t.Run("Or", func(t *testing.T) {
+		require.Equal(t, Roles{Resolver}, Roles{Resolver}.Or(Roles{BatchWriter}))
+		require.Equal(t, Roles{BatchWriter}, Roles(nil).Or(Roles{BatchWriter}))
+		require.Nil(t, Roles(nil).Or(nil))
+	})
+
+	t.Run("Equals", func(t *testing.T) {
+		require.True(t, Roles(nil).Equals(Roles{}))
+		require.True(t, Roles{Resolver, Observer}.Equals(Roles{Observer, Resolver}))
+		require.False(t, Roles{Resolver}.Equals(Roles{Resolver, Observer}))
+		require.False(t, Roles{Resolver, Observer}.Equals(Roles{Resolver}))
+	})
+}
+
 func setRoles(roles ...extroles.Role) (restore func()) {
 	rolesValue := make(map[extroles.Role]struct{})
 	for _, r := range roles {
@@ -11,17 +11,22 @@ Feature:
     Given DCAS collection config "dcas-mychannel" is defined for collection "dcas" as policy="OR('Org1MSP.member','Org2MSP.member')", requiredPeerCount=1, maxPeerCount=2, and timeToLive=
     Given DCAS collection config "docs-mychannel" is defined for collection "docs" as policy="OR('Org1MSP.member','Org2MSP.member')", requiredPeerCount=1, maxPeerCount=2, and timeToLive=
     Given off-ledger collection config "meta_data_coll" is defined for collection "meta_data" as policy="OR('Org1MSP.member','Org2MSP.member')", requiredPeerCount=0, maxPeerCount=0, and timeToLive=
+    Given off-ledger collection config "dead_letters_coll" is defined for collection "dead_letters" as policy="OR('Org1MSP.member','Org2MSP.member')", requiredPeerCount=0, maxPeerCount=0, and timeToLive=
+    Given off-ledger collection config "consistency_coll" is defined for collection "consistency" as policy="OR('Org1MSP.member','Org2MSP.member')", requiredPeerCount=0, maxPeerCount=0, and timeToLive=
+    Given off-ledger collection config "leader_coll" is defined for collection "leader" as policy="OR('Org1MSP.member','Org2MSP.member')", requiredPeerCount=0, maxPeerCount=0, and timeToLive=
+    Given off-ledger collection config "opqueue_org1_coll" is defined for collection "opqueue_org1" as policy="OR('Org1MSP.member')", requiredPeerCount=0, maxPeerCount=0, and timeToLive=
+    Given off-ledger collection config "opqueue_org2_coll" is defined for collection "opqueue_org2" as policy="OR('Org2MSP.member')", requiredPeerCount=0, maxPeerCount=0, and timeToLive=
 
     Given the channel "mychannel" is created and all peers have joined
     And the channel "yourchannel" is created and all peers have joined
 
     And "system" chaincode "configscc" is instantiated from path "in-process" on the "mychannel" channel with args "" with endorsement policy "AND('Org1MSP.member','Org2MSP.member')" with collection policy ""
     And "system" chaincode "sidetreetxn_cc" is instantiated from path "in-process" on the "mychannel" channel with args "" with endorsement policy "AND('Org1MSP.member','Org2MSP.member')" with collection policy "dcas-mychannel"
-    And "system" chaincode "document_cc" is instantiated from path "in-process" on the "mychannel" channel with args "" with endorsement policy "OR('Org1MSP.member','Org2MSP.member')" with collection policy "docs-mychannel,meta_data_coll"
+    And "system" chaincode "document_cc" is instantiated from path "in-process" on the "mychannel" channel with args "" with endorsement policy "OR('Org1MSP.member','Org2MSP.member')" with collection policy "docs-mychannel,meta_data_coll,dead_letters_coll,consistency_coll,leader_coll,opqueue_org1_coll,opqueue_org2_coll"
 
     And "system" chaincode "configscc" is instantiated from path "in-process" on the "yourchannel" channel with args "" with endorsement policy "AND('Org1MSP.member','Org2MSP.member')" with collection policy ""
     And "system" chaincode "sidetreetxn_cc" is instantiated from path "in-process" on the "yourchannel" channel with args "" with endorsement policy "AND('Org1MSP.member','Org2MSP.member')" with collection policy "dcas-mychannel"
-    And "system" chaincode "document_cc" is instantiated from path "in-process" on the "yourchannel" channel with args "" with endorsement policy "OR('Org1MSP.member','Org2MSP.member')" with collection policy "docs-mychannel,meta_data_coll"
+    And "system" chaincode "document_cc" is instantiated from path "in-process" on the "yourchannel" channel with args "" with endorsement policy "OR('Org1MSP.member','Org2MSP.member')" with collection policy "docs-mychannel,meta_data_coll,dead_letters_coll,consistency_coll,leader_coll,opqueue_org1_coll,opqueue_org2_coll"
 
     And fabric-cli network is initialized
     And fabric-cli plugin "../../.build/ledgerconfig" is installed
@@ -116,6 +121,35 @@ Feature:
     When client sends request to "http://localhost:48626/document" to resolve DID document
     Then check success response contains "#didDocumentHash"
 
+  @shared_operation_queue
+  Scenario: Batch writers in an org share the off-ledger operation queue
+    # peer0.org1 and peer1.org1 are both batch writers and store their pending operations in the
+    # org's "opqueue_org1" off-ledger collection. Only the peer holding the lease in the "leader"
+    # collection cuts batches, so an operation sent to either peer is processed by the leader.
+    When client sends request to "http://localhost:48426/document" to create DID document "fixtures/testdata/didDocument.json" in namespace "did:sidetree"
+    Then check success response contains "#didDocumentHash"
+
+    And we wait 10 seconds
+
+    When client sends request to "http://localhost:48626/document" to resolve DID document
+    Then check success response contains "#didDocumentHash"
+
+    # Stop peer0.org1 so that, if it holds the lease, peer1.org1 takes over leadership once the lease expires.
+    Given container "peer0.org1.example.com" is stopped
+    And we wait 2 seconds
+
+    When client sends request to "http://localhost:48426/document" to create DID document "fixtures/testdata/didDocument2.json" in namespace "did:sidetree"
+    Then check success response contains "#didDocumentHash"
+
+    # Wait longer than the lease timeout (10s) for peer1.org1 to be elected and cut the batch
+    And we wait 30 seconds
+
+    When client sends request to "http://localhost:48626/document" to resolve DID document
+    Then check success response contains "#didDocumentHash"
+
+    Then container "peer0.org1.example.com" is started
+    And we wait 10 seconds
+
   @invalid_config_update
   Scenario: Invalid configuration
     Given fabric-cli context "mychannel" is used